@@ -78,6 +78,11 @@ func init() {
 	backfillCmd.PersistentFlags().Int("backfill-workers", 4, "number of worker goroutines to concurrently make and process http requests")
 	backfillCmd.PersistentFlags().Int("backfill-timeout", 15, "timeout used for backfill http requests (in seconds)")
 	backfillCmd.PersistentFlags().Int("backfill-validation-level", 1, "data validated less than this amount will be backfilled")
+	backfillCmd.PersistentFlags().String("backfill-record-path", "", "if set, record the fetched payloads to this file")
+	backfillCmd.PersistentFlags().String("backfill-replay-path", "", "if set, fetch payloads from the recordings in this file instead of from the ethereum node")
+	backfillCmd.PersistentFlags().Bool("backfill-validate-state-diffs", false, "if true, only count headers as validated if their state diffs hash consistently up to their state root")
+	backfillCmd.PersistentFlags().Bool("backfill-cross-validate", false, "if true, a header's validation level is the number of independent nodes which supplied it with agreeing state roots")
+	backfillCmd.PersistentFlags().Bool("backfill-traces", false, "if true, also fetch the call traces of each block with debug_traceBlockByNumber and index their flattened call trees")
 	backfillCmd.PersistentFlags().String("eth-http-path", "", "http url for ethereum node")
 
 	// and their .toml config bindings
@@ -86,5 +91,10 @@ func init() {
 	viper.BindPFlag("backfill.workers", backfillCmd.PersistentFlags().Lookup("backfill-workers"))
 	viper.BindPFlag("backfill.timeout", backfillCmd.PersistentFlags().Lookup("backfill-timeout"))
 	viper.BindPFlag("backfill.validationLevel", backfillCmd.PersistentFlags().Lookup("backfill-validation-level"))
+	viper.BindPFlag("backfill.recordPath", backfillCmd.PersistentFlags().Lookup("backfill-record-path"))
+	viper.BindPFlag("backfill.replayPath", backfillCmd.PersistentFlags().Lookup("backfill-replay-path"))
+	viper.BindPFlag("backfill.validateStateDiffs", backfillCmd.PersistentFlags().Lookup("backfill-validate-state-diffs"))
+	viper.BindPFlag("backfill.crossValidate", backfillCmd.PersistentFlags().Lookup("backfill-cross-validate"))
+	viper.BindPFlag("backfill.traces", backfillCmd.PersistentFlags().Lookup("backfill-traces"))
 	viper.BindPFlag("ethereum.httpPath", backfillCmd.PersistentFlags().Lookup("eth-http-path"))
 }
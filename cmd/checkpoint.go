@@ -0,0 +1,121 @@
+// Copyright © 2020 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/checkpoint"
+	v "github.com/vulcanize/ipld-eth-indexer/version"
+)
+
+// checkpointCmd represents the checkpoint command
+var checkpointCmd = &cobra.Command{
+	Use:   "checkpoint",
+	Short: "Create and import checkpoints for bootstrapping a database mid-chain",
+	Long: `A checkpoint is a CAR archive of the indexed state at a block height, which a fresh database
+can be bootstrapped from instead of indexing the chain from genesis
+
+The archive's root is a manifest recording the chain, the block, its total difficulty, and the schema
+version of the database it was created from. It is followed by the IPLDs of the block header, its uncles,
+its transaction and receipt tries, and its complete state trie with every storage trie and contract code
+
+Use the create subcommand to write a checkpoint of the canonical block at --checkpoint-block-height, and the
+import subcommand to load and index one. Once imported, the checkpoint is the start of the chain's history:
+sync and backfill carry on forward from it and the heights below it are not reported as gaps`,
+}
+
+// checkpointCreateCmd represents the checkpoint create command
+var checkpointCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Write a checkpoint of the indexed state at a block height",
+	Long: `Use this command to write a checkpoint of the canonical block indexed at --checkpoint-block-height
+to --checkpoint-file-path
+
+The complete state at the height must be held in the database, e.g. because it was indexed from genesis
+with intermediate nodes or seeded with the snapshot command, otherwise the command fails on the first missing node`,
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		checkpointCreate()
+	},
+}
+
+// checkpointImportCmd represents the checkpoint import command
+var checkpointImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Bootstrap a database from a checkpoint",
+	Long: `Use this command to import the checkpoint at --checkpoint-file-path
+
+The checkpoint must be of the configured chain and created at a schema version no newer than this binary's.
+Its blocks are loaded into the blockstore, its block is indexed, and every node of its state trie and of
+every account's storage trie is indexed with diff=false, as by the snapshot command`,
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		checkpointImport()
+	},
+}
+
+func newCheckpointService() (checkpoint.Checkpointer, *checkpoint.Config) {
+	logWithCommand.Infof("running ipld-eth-indexer version: %s", v.VersionWithMeta)
+	logWithCommand.Debug("loading checkpoint configuration variables")
+	cConfig, err := checkpoint.NewConfig()
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("checkpoint config: %+v", cConfig)
+	logWithCommand.Debug("initializing new checkpoint service")
+	return checkpoint.NewCheckpointService(cConfig), cConfig
+}
+
+func checkpointCreate() {
+	cService, cConfig := newCheckpointService()
+	defer cConfig.Blockstore.Close()
+	logWithCommand.Info("starting up checkpoint create process")
+	if err := cService.Create(); err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("checkpoint at height %d written to %s", cConfig.BlockHeight, cConfig.FilePath)
+}
+
+func checkpointImport() {
+	cService, cConfig := newCheckpointService()
+	defer cConfig.Blockstore.Close()
+	logWithCommand.Info("starting up checkpoint import process")
+	if err := cService.Import(); err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("checkpoint %s imported", cConfig.FilePath)
+}
+
+func init() {
+	rootCmd.AddCommand(checkpointCmd)
+	checkpointCmd.AddCommand(checkpointCreateCmd)
+	checkpointCmd.AddCommand(checkpointImportCmd)
+
+	// flags
+	checkpointCmd.PersistentFlags().Int("checkpoint-block-height", 0, "block height to create the checkpoint at")
+	checkpointCmd.PersistentFlags().String("checkpoint-file-path", "", "path to the checkpoint archive")
+	checkpointCmd.PersistentFlags().Int("checkpoint-batch-size", 0, "number of blocks or nodes to insert per db transaction on import")
+
+	// and their .toml config bindings
+	viper.BindPFlag("checkpoint.blockHeight", checkpointCmd.PersistentFlags().Lookup("checkpoint-block-height"))
+	viper.BindPFlag("checkpoint.filePath", checkpointCmd.PersistentFlags().Lookup("checkpoint-file-path"))
+	viper.BindPFlag("checkpoint.batchSize", checkpointCmd.PersistentFlags().Lookup("checkpoint-batch-size"))
+}
@@ -0,0 +1,94 @@
+// Copyright © 2020 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+)
+
+// compressCmd represents the compress command
+var compressCmd = &cobra.Command{
+	Use:   "compress",
+	Short: "Rewrite the block data in public.blocks with the configured compression",
+	Long: `Use this command to compress the block data already in public.blocks with the configured
+blockstore compression (snappy or deflate), e.g. after turning compression on for the indexer
+
+Blocks already stored with the compression are skipped, so the command can be interrupted and rerun.
+With the compression set to none it decompresses every block instead.
+Blocks are rewritten in batches of --compress-batch-size per db transaction, and the space saved is reported at the end.
+
+The stats subcommand only reports the space taken up by the block data, compressed and uncompressed`,
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		compress()
+	},
+}
+
+// compressStatsCmd represents the compress stats command
+var compressStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Report the space taken up by the block data in public.blocks",
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		logCompressionStats(loadDB())
+	},
+}
+
+func compress() {
+	var bsConfig blockstore.Config
+	if err := bsConfig.Init(); err != nil {
+		logWithCommand.Fatal(err)
+	}
+	batchSize := viper.GetUint64("compress.batchSize")
+	if batchSize == 0 {
+		batchSize = 1000
+	}
+	db := loadDB()
+	before, after, err := blockstore.Recompress(db.DB, bsConfig.Compression, batchSize)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("rewrote %d blocks with %s compression: %d bytes stored as %d bytes, %d bytes saved",
+		after.Blocks, bsConfig.Compression, before.StoredBytes, after.StoredBytes, int64(before.StoredBytes)-int64(after.StoredBytes))
+	logCompressionStats(db)
+}
+
+func logCompressionStats(db *postgres.DB) {
+	stats, err := blockstore.GetCompressionStats(db.DB)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("public.blocks holds %d blocks (%d compressed): %d bytes uncompressed stored as %d bytes, %d bytes saved",
+		stats.Blocks, stats.Compressed, stats.RawBytes, stats.StoredBytes, stats.Saved())
+}
+
+func init() {
+	rootCmd.AddCommand(compressCmd)
+	compressCmd.AddCommand(compressStatsCmd)
+
+	// flags
+	compressCmd.PersistentFlags().Uint64("compress-batch-size", 1000, "number of blocks to rewrite per db transaction")
+
+	// and their .toml config bindings
+	viper.BindPFlag("compress.batchSize", compressCmd.PersistentFlags().Lookup("compress-batch-size"))
+}
@@ -0,0 +1,76 @@
+// Copyright © 2020 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/importer"
+	v "github.com/vulcanize/ipld-eth-indexer/version"
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import a CAR archive of Ethereum IPLDs",
+	Long: `Use this command to seed the database from a CAR archive of Ethereum IPLDs, without an archive node
+Every block in the archive is verified against its CID and loaded into public.blocks, and then
+the eth.header_cids, uncle_cids, transaction_cids, receipt_cids, state_cids and storage_cids
+rows are rebuilt for every block header found in the archive
+
+State and storage nodes are indexed as the difference from the parent block's state, where the parent's
+trie nodes are available; trie nodes missing from the archive are assumed to be unchanged`,
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		importCmdCommand()
+	},
+}
+
+func importCmdCommand() {
+	logWithCommand.Infof("running ipld-eth-indexer version: %s", v.VersionWithMeta)
+	logWithCommand.Debug("loading import configuration variables")
+	iConfig, err := importer.NewConfig()
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	defer iConfig.Blockstore.Close()
+	logWithCommand.Infof("import config: %+v", iConfig)
+	logWithCommand.Debug("initializing new import service")
+	iService, err := importer.NewImportService(iConfig)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Info("starting up import process")
+	if err := iService.Import(); err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("import of %s finished", iConfig.FilePath)
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	// flags
+	importCmd.PersistentFlags().String("import-file-path", "", "path to the CAR archive to import")
+	importCmd.PersistentFlags().Int("import-batch-size", 0, "number of blocks to insert per db transaction")
+
+	// and their .toml config bindings
+	viper.BindPFlag("import.filePath", importCmd.PersistentFlags().Lookup("import-file-path"))
+	viper.BindPFlag("import.batchSize", importCmd.PersistentFlags().Lookup("import-batch-size"))
+}
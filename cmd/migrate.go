@@ -0,0 +1,176 @@
+// Copyright © 2020 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/migrations"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	v "github.com/vulcanize/ipld-eth-indexer/version"
+)
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage the database schema",
+	Long: `Use the subcommands of this command to apply, roll back, and inspect the schema migrations
+embedded in the binary (the migrations of db/migrations it was built with)
+
+The applied migrations are recorded in the goose_db_version table, so databases previously migrated with the
+goose binary can be managed with this command and vice versa
+
+sync, backfill, and resync refuse to start unless the database is at the version of the latest embedded migration
+
+partition switches a freshly migrated database to the partitioned layout, see the partition subcommand`,
+}
+
+// migrateUpCmd represents the migrate up command
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply every migration not yet applied to the database",
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		migrateUp()
+	},
+}
+
+// migrateDownCmd represents the migrate down command
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Roll back the latest migration applied to the database",
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		migrateDown()
+	},
+}
+
+// migrateStatusCmd represents the migrate status command
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Report which migrations have been applied to the database",
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		migrateStatus()
+	},
+}
+
+// migratePartitionCmd represents the migrate partition command
+var migratePartitionCmd = &cobra.Command{
+	Use:   "partition",
+	Short: "Rebuild the eth tables partitioned by block number range",
+	Long: `Rebuilds the eth CID tables (headers, uncles, transactions, receipts, traces, state, state accounts, and storage)
+as tables partitioned by ranges of --partition-size block numbers
+
+This only works on a database which is at the latest schema version and has nothing indexed into it yet.
+The indexer creates the partitions it needs as the chain advances, and resync cleaning replaces whole partitions
+instead of deleting their rows.
+Migrations can't be rolled back past the block_number migration once the tables are partitioned.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		migratePartition()
+	},
+}
+
+func migrateUp() {
+	migrator := loadMigrator()
+	applied, err := migrator.Up()
+	for _, migration := range applied {
+		logWithCommand.Infof("applied migration %s", migration.Name)
+	}
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	version, err := migrator.Version()
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("database schema is at version %d", version)
+}
+
+func migrateDown() {
+	migration, err := loadMigrator().Down()
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("rolled back migration %s", migration.Name)
+}
+
+func migrateStatus() {
+	migrator := loadMigrator()
+	statuses, err := migrator.Status()
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.Applied {
+			logWithCommand.Infof("applied at %s: %s", status.AppliedAt.Format("2006-01-02 15:04:05"), status.Name)
+		} else {
+			logWithCommand.Infof("pending: %s", status.Name)
+		}
+	}
+	if err := migrator.CheckVersion(); err != nil {
+		logWithCommand.Warn(err)
+	}
+}
+
+func migratePartition() {
+	size := viper.GetUint64("migrate.partitionSize")
+	if err := migrations.Partition(loadDB().DB, size); err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("partitioned the eth tables into ranges of %d blocks", size)
+}
+
+func loadMigrator() *migrations.Migrator {
+	migrator, err := migrations.NewMigrator(loadDB().DB)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	return migrator
+}
+
+func loadDB() *postgres.DB {
+	logWithCommand.Infof("running ipld-eth-indexer version: %s", v.VersionWithMeta)
+	var dbConfig postgres.Config
+	dbConfig.Init()
+	db, err := postgres.NewDB(dbConfig, node.Info{}, false)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	return db
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.AddCommand(migrateUpCmd)
+	migrateCmd.AddCommand(migrateDownCmd)
+	migrateCmd.AddCommand(migrateStatusCmd)
+	migrateCmd.AddCommand(migratePartitionCmd)
+
+	// flags
+	migratePartitionCmd.PersistentFlags().Uint64("partition-size", 100000, "number of block numbers held by each partition")
+
+	// and their .toml config bindings
+	viper.BindPFlag("migrate.partitionSize", migratePartitionCmd.PersistentFlags().Lookup("partition-size"))
+}
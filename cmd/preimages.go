@@ -0,0 +1,81 @@
+// Copyright © 2020 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/layout"
+	v "github.com/vulcanize/ipld-eth-indexer/version"
+)
+
+// preimagesCmd represents the preimages command
+var preimagesCmd = &cobra.Command{
+	Use:   "preimages",
+	Short: "Fill the storage slot preimages table",
+	Long: `Use this command to fill eth.storage_preimages, which maps the keccak256 hashes used as storage leaf keys
+(and as the slots of mapping values and dynamic array elements) back to what was hashed
+
+Preimages can be loaded from a file of hex encoded preimages (one per line, 20 byte preimages are addresses and
+go to eth.address_preimages instead), derived from the fixed slots of the
+solc storage layouts in the --layout-dir, and fetched with debug_preimage from an ethereum node that records them
+(--cache.preimages) for the storage leaf keys indexed in a block range
+
+When a layout directory is set, fetching is restricted to the storage of the contracts with layouts`,
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		preimagesCmdCommand()
+	},
+}
+
+func preimagesCmdCommand() {
+	logWithCommand.Infof("running ipld-eth-indexer version: %s", v.VersionWithMeta)
+	logWithCommand.Debug("loading preimages configuration variables")
+	pConfig, err := layout.NewConfig()
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("preimages config: %+v", pConfig)
+	logWithCommand.Info("starting up preimages process")
+	inserted, err := layout.NewPreimageService(pConfig).Fill()
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("inserted %d new preimages", inserted)
+}
+
+func init() {
+	rootCmd.AddCommand(preimagesCmd)
+
+	// flags
+	preimagesCmd.PersistentFlags().String("preimages-file", "", "path to a file of hex encoded preimages, one per line")
+	preimagesCmd.PersistentFlags().Bool("preimages-fetch", false, "if true, fetch the preimages of indexed storage leaf keys from the ethereum node with debug_preimage")
+	preimagesCmd.PersistentFlags().Int("preimages-start", 0, "block height to start fetching preimages from")
+	preimagesCmd.PersistentFlags().Int("preimages-stop", 0, "block height to stop fetching preimages at (0 fetches up to the highest indexed block)")
+	preimagesCmd.PersistentFlags().String("eth-http-path", "", "http url for ethereum node")
+	preimagesCmd.PersistentFlags().Int("preimages-timeout", 15, "timeout used for debug_preimage requests (in seconds)")
+
+	// and their .toml config bindings
+	viper.BindPFlag("preimages.file", preimagesCmd.PersistentFlags().Lookup("preimages-file"))
+	viper.BindPFlag("preimages.fetch", preimagesCmd.PersistentFlags().Lookup("preimages-fetch"))
+	viper.BindPFlag("preimages.start", preimagesCmd.PersistentFlags().Lookup("preimages-start"))
+	viper.BindPFlag("preimages.stop", preimagesCmd.PersistentFlags().Lookup("preimages-stop"))
+	viper.BindPFlag("ethereum.httpPath", preimagesCmd.PersistentFlags().Lookup("eth-http-path"))
+	viper.BindPFlag("preimages.timeout", preimagesCmd.PersistentFlags().Lookup("preimages-timeout"))
+}
@@ -73,6 +73,11 @@ func init() {
 	resyncCmd.PersistentFlags().Bool("resync-clear-old-cache", false, "if true, clear out old data of the provided type within the resync range before resyncing (warning: clearing out data will delete any rows that FK reference it")
 	resyncCmd.PersistentFlags().Bool("resync-reset-validation", false, "if true, reset times_validated of headers in this range to 0")
 	resyncCmd.PersistentFlags().Int("resync-timeout", 15, "timeout used for resync http requests (in seconds)")
+	resyncCmd.PersistentFlags().String("resync-record-path", "", "if set, record the fetched payloads to this file")
+	resyncCmd.PersistentFlags().String("resync-replay-path", "", "if set, fetch payloads from the recordings in this file instead of from the ethereum node")
+	resyncCmd.PersistentFlags().Bool("resync-validate-state-diffs", false, "if true, only count headers as validated if their state diffs hash consistently up to their state root")
+	resyncCmd.PersistentFlags().Bool("resync-cross-validate", false, "if true, a header's validation level is the number of independent nodes which supplied it with agreeing state roots")
+	resyncCmd.PersistentFlags().Bool("resync-traces", false, "if true, also fetch the call traces of each block with debug_traceBlockByNumber and index their flattened call trees")
 	resyncCmd.PersistentFlags().String("eth-http-path", "", "http url for ethereum node")
 
 	// and their .toml config bindings
@@ -84,5 +89,10 @@ func init() {
 	viper.BindPFlag("resync.clearOldCache", resyncCmd.PersistentFlags().Lookup("resync-clear-old-cache"))
 	viper.BindPFlag("resync.resetValidation", resyncCmd.PersistentFlags().Lookup("resync-reset-validation"))
 	viper.BindPFlag("resync.timeout", resyncCmd.PersistentFlags().Lookup("resync-timeout"))
+	viper.BindPFlag("resync.recordPath", resyncCmd.PersistentFlags().Lookup("resync-record-path"))
+	viper.BindPFlag("resync.replayPath", resyncCmd.PersistentFlags().Lookup("resync-replay-path"))
+	viper.BindPFlag("resync.validateStateDiffs", resyncCmd.PersistentFlags().Lookup("resync-validate-state-diffs"))
+	viper.BindPFlag("resync.crossValidate", resyncCmd.PersistentFlags().Lookup("resync-cross-validate"))
+	viper.BindPFlag("resync.traces", resyncCmd.PersistentFlags().Lookup("resync-traces"))
 	viper.BindPFlag("ethereum.httpPath", resyncCmd.PersistentFlags().Lookup("eth-http-path"))
 }
@@ -106,6 +106,20 @@ func init() {
 	rootCmd.PersistentFlags().String("database-hostname", "localhost", "database hostname")
 	rootCmd.PersistentFlags().String("database-user", "", "database user")
 	rootCmd.PersistentFlags().String("database-password", "", "database password")
+	rootCmd.PersistentFlags().String("database-ssl-mode", "disable", "database sslmode (disable, allow, prefer, require, verify-ca, verify-full)")
+	rootCmd.PersistentFlags().String("database-ssl-root-cert", "", "path to the CA certificate to verify the database server certificate with")
+	rootCmd.PersistentFlags().String("database-ssl-cert", "", "path to the client certificate to authenticate to the database with")
+	rootCmd.PersistentFlags().String("database-ssl-key", "", "path to the key of the client certificate")
+	rootCmd.PersistentFlags().String("database-application-name", "", "application_name to report to the database")
+	rootCmd.PersistentFlags().String("database-statement-timeout", "", "statement_timeout of the database connections (e.g. 30s, 0 to disable)")
+	rootCmd.PersistentFlags().String("database-search-path", "", "search_path of the database connections")
+	rootCmd.PersistentFlags().String("database-dsn", "", "database connection string, overrides the other database settings if set")
+	rootCmd.PersistentFlags().String("database-replica-dsn", "", "connection string of a read replica to route read-only queries to")
+	rootCmd.PersistentFlags().Int("database-max-replica-lag", 30, "replication lag in seconds past which reads fall back to the primary")
+
+	rootCmd.PersistentFlags().String("blockstore-type", "postgres", "where IPLD block data is stored (postgres, flatfs, leveldb)")
+	rootCmd.PersistentFlags().String("blockstore-path", "", "directory of the flatfs or leveldb blockstore")
+	rootCmd.PersistentFlags().String("blockstore-compression", "none", "compression of the block data written to public.blocks (none, snappy, deflate)")
 
 	rootCmd.PersistentFlags().String("log-level", log.InfoLevel.String(), "log level (trace, debug, info, warn, error, fatal, panic)")
 	rootCmd.PersistentFlags().String("log-file", "", "file path for logging")
@@ -122,12 +136,42 @@ func init() {
 
 	rootCmd.PersistentFlags().Bool("metrics", false, "enable metrics")
 
+	rootCmd.PersistentFlags().String("server-http-path", "", "host:port to serve the rpc api over http on")
+	rootCmd.PersistentFlags().String("server-ws-path", "", "host:port to serve the rpc api over websockets on")
+	rootCmd.PersistentFlags().String("server-ipc-path", "", "path to the ipc socket to serve the rpc api on")
+	rootCmd.PersistentFlags().String("server-admin-path", "", "host:port to serve the non-public rpc apis over http on")
+	rootCmd.PersistentFlags().StringSlice("server-cors-domains", nil, "domains to accept cross origin http requests from")
+	rootCmd.PersistentFlags().StringSlice("server-ws-origins", nil, "origins to accept websocket requests from")
+
+	rootCmd.PersistentFlags().StringSlice("index-types", nil, "data types to index (uncles, transactions, receipts, state, storage), headers are always indexed")
+	rootCmd.PersistentFlags().StringSlice("index-addresses", nil, "addresses of the accounts to index the state, storage, transactions and logs of")
+	rootCmd.PersistentFlags().StringSlice("index-topics", nil, "event topics (topic0) to index the transactions of")
+	rootCmd.PersistentFlags().StringSlice("index-src", nil, "senders to index the transactions of")
+	rootCmd.PersistentFlags().StringSlice("index-dst", nil, "recipients to index the transactions of")
+	rootCmd.PersistentFlags().String("index-conflicts", "overwrite", "how re-indexing a row with different content is handled (overwrite, audit, reject)")
+
+	rootCmd.PersistentFlags().String("layout-dir", "", "directory of solc storage layout json files, each named by the address of its contract")
+
 	// and their .toml config bindings
 	viper.BindPFlag("database.name", rootCmd.PersistentFlags().Lookup("database-name"))
 	viper.BindPFlag("database.port", rootCmd.PersistentFlags().Lookup("database-port"))
 	viper.BindPFlag("database.hostname", rootCmd.PersistentFlags().Lookup("database-hostname"))
 	viper.BindPFlag("database.user", rootCmd.PersistentFlags().Lookup("database-user"))
 	viper.BindPFlag("database.password", rootCmd.PersistentFlags().Lookup("database-password"))
+	viper.BindPFlag("database.sslMode", rootCmd.PersistentFlags().Lookup("database-ssl-mode"))
+	viper.BindPFlag("database.sslRootCert", rootCmd.PersistentFlags().Lookup("database-ssl-root-cert"))
+	viper.BindPFlag("database.sslCert", rootCmd.PersistentFlags().Lookup("database-ssl-cert"))
+	viper.BindPFlag("database.sslKey", rootCmd.PersistentFlags().Lookup("database-ssl-key"))
+	viper.BindPFlag("database.applicationName", rootCmd.PersistentFlags().Lookup("database-application-name"))
+	viper.BindPFlag("database.statementTimeout", rootCmd.PersistentFlags().Lookup("database-statement-timeout"))
+	viper.BindPFlag("database.searchPath", rootCmd.PersistentFlags().Lookup("database-search-path"))
+	viper.BindPFlag("database.dsn", rootCmd.PersistentFlags().Lookup("database-dsn"))
+	viper.BindPFlag("database.replicaDSN", rootCmd.PersistentFlags().Lookup("database-replica-dsn"))
+	viper.BindPFlag("database.maxReplicaLag", rootCmd.PersistentFlags().Lookup("database-max-replica-lag"))
+
+	viper.BindPFlag("blockstore.type", rootCmd.PersistentFlags().Lookup("blockstore-type"))
+	viper.BindPFlag("blockstore.path", rootCmd.PersistentFlags().Lookup("blockstore-path"))
+	viper.BindPFlag("blockstore.compression", rootCmd.PersistentFlags().Lookup("blockstore-compression"))
 
 	viper.BindPFlag("log.file", rootCmd.PersistentFlags().Lookup("log-file"))
 	viper.BindPFlag("log.level", rootCmd.PersistentFlags().Lookup("log-level"))
@@ -143,6 +187,22 @@ func init() {
 	viper.BindPFlag("prom.http.port", rootCmd.PersistentFlags().Lookup("prom-http-port"))
 
 	viper.BindPFlag("metrics", rootCmd.PersistentFlags().Lookup("metrics"))
+
+	viper.BindPFlag("server.httpPath", rootCmd.PersistentFlags().Lookup("server-http-path"))
+	viper.BindPFlag("server.wsPath", rootCmd.PersistentFlags().Lookup("server-ws-path"))
+	viper.BindPFlag("server.ipcPath", rootCmd.PersistentFlags().Lookup("server-ipc-path"))
+	viper.BindPFlag("server.adminPath", rootCmd.PersistentFlags().Lookup("server-admin-path"))
+	viper.BindPFlag("server.corsDomains", rootCmd.PersistentFlags().Lookup("server-cors-domains"))
+	viper.BindPFlag("server.wsOrigins", rootCmd.PersistentFlags().Lookup("server-ws-origins"))
+
+	viper.BindPFlag("index.types", rootCmd.PersistentFlags().Lookup("index-types"))
+	viper.BindPFlag("index.addresses", rootCmd.PersistentFlags().Lookup("index-addresses"))
+	viper.BindPFlag("index.topics", rootCmd.PersistentFlags().Lookup("index-topics"))
+	viper.BindPFlag("index.src", rootCmd.PersistentFlags().Lookup("index-src"))
+	viper.BindPFlag("index.dst", rootCmd.PersistentFlags().Lookup("index-dst"))
+	viper.BindPFlag("index.conflicts", rootCmd.PersistentFlags().Lookup("index-conflicts"))
+
+	viper.BindPFlag("layout.dir", rootCmd.PersistentFlags().Lookup("layout-dir"))
 }
 
 func initConfig() {
@@ -0,0 +1,81 @@
+// Copyright © 2020 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"os"
+	"os/signal"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	srpc "github.com/vulcanize/ipld-eth-indexer/pkg/rpc"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/serve"
+	v "github.com/vulcanize/ipld-eth-indexer/version"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "serve the indexed data over the eth JSON-RPC api",
+	Long: `This command serves a read-only subset of the eth JSON-RPC api from the data indexed in PG-IPFS, so that
+standard Ethereum tooling can be pointed at it instead of at an archive node
+
+It supports eth_blockNumber, eth_getBlockByNumber, eth_getBlockByHash, eth_getTransactionByHash,
+eth_getTransactionReceipt, eth_getLogs, eth_getBalance, eth_getStorageAt, and eth_getCode
+Results are reconstructed from the IPLD blocks referenced by the eth.*_cids tables, blocks requested by number and
+the state at a block are resolved along the canonical chain
+
+At least one of the server paths must be set`,
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		serveCmdCommand()
+	},
+}
+
+func serveCmdCommand() {
+	logWithCommand.Infof("running ipld-eth-indexer version: %s", v.VersionWithMeta)
+	logWithCommand.Debug("loading serve configuration variables")
+	serveConfig, err := serve.NewConfig()
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	defer serveConfig.Blockstore.Close()
+	logWithCommand.Infof("serve config: %+v", serveConfig)
+	if !serveConfig.Server.Enabled() {
+		logWithCommand.Fatal("no server path is set to serve the eth api on")
+	}
+	logWithCommand.Debug("initializing new serve service")
+	server, err := serve.NewServeService(serveConfig)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Info("starting up rpc server")
+	rpcServer, err := srpc.StartServer(serveConfig.Server, server.APIs())
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt)
+	<-shutdown
+	rpcServer.Stop()
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,87 @@
+// Copyright © 2020 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/snapshot"
+	v "github.com/vulcanize/ipld-eth-indexer/version"
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Index the complete state trie at a block height",
+	Long: `Use this command to seed the database with the complete state at a starting block height, so that
+indexing can start mid-chain and historical state can be looked up before the first diffed block
+
+The block at the height is indexed as usual, and then every node of its state trie and of every
+account's storage trie is published and indexed with diff=false
+
+The state is read either directly from a geth leveldb/ancient directory (the node must be stopped),
+or from a statediffing geth node over rpc (statediff_stateTrieAt; only suited to chains with a small state)`,
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		snapshotCmdCommand()
+	},
+}
+
+func snapshotCmdCommand() {
+	logWithCommand.Infof("running ipld-eth-indexer version: %s", v.VersionWithMeta)
+	logWithCommand.Debug("loading snapshot configuration variables")
+	sConfig, err := snapshot.NewConfig()
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	defer sConfig.Blockstore.Close()
+	logWithCommand.Infof("snapshot config: %+v", sConfig)
+	logWithCommand.Debug("initializing new snapshot service")
+	sService, err := snapshot.NewSnapshotService(sConfig)
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Info("starting up snapshot process")
+	if err := sService.Snapshot(); err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Infof("snapshot at height %d finished", sConfig.BlockHeight)
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+
+	// flags
+	snapshotCmd.PersistentFlags().Int("snapshot-block-height", 0, "block height to snapshot the state at")
+	snapshotCmd.PersistentFlags().String("snapshot-mode", "", "source to take the snapshot from (leveldb|rpc)")
+	snapshotCmd.PersistentFlags().String("snapshot-leveldb-path", "", "path to the geth leveldb chaindata directory")
+	snapshotCmd.PersistentFlags().String("snapshot-ancient-path", "", "path to the geth ancient directory (defaults to the ancient directory within the leveldb path)")
+	snapshotCmd.PersistentFlags().Int("snapshot-batch-size", 0, "number of nodes to publish per db transaction")
+	snapshotCmd.PersistentFlags().Int("snapshot-timeout", 15, "timeout used for the snapshot http request (in seconds)")
+	snapshotCmd.PersistentFlags().String("eth-http-path", "", "http url for ethereum node")
+
+	// and their .toml config bindings
+	viper.BindPFlag("snapshot.blockHeight", snapshotCmd.PersistentFlags().Lookup("snapshot-block-height"))
+	viper.BindPFlag("snapshot.mode", snapshotCmd.PersistentFlags().Lookup("snapshot-mode"))
+	viper.BindPFlag("snapshot.levelDBPath", snapshotCmd.PersistentFlags().Lookup("snapshot-leveldb-path"))
+	viper.BindPFlag("snapshot.ancientPath", snapshotCmd.PersistentFlags().Lookup("snapshot-ancient-path"))
+	viper.BindPFlag("snapshot.batchSize", snapshotCmd.PersistentFlags().Lookup("snapshot-batch-size"))
+	viper.BindPFlag("snapshot.timeout", snapshotCmd.PersistentFlags().Lookup("snapshot-timeout"))
+	viper.BindPFlag("ethereum.httpPath", snapshotCmd.PersistentFlags().Lookup("eth-http-path"))
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	srpc "github.com/vulcanize/ipld-eth-indexer/pkg/rpc"
 	w "github.com/vulcanize/ipld-eth-indexer/pkg/sync"
 	v "github.com/vulcanize/ipld-eth-indexer/version"
 )
@@ -36,6 +37,9 @@ var syncCmd = &cobra.Command{
 publishing and indexing them in PG-IPFS.
 This command tracks the head of the chain, for filling in historical data see the backfill and resync commands
 
+If any of the server paths are set, the indexer_ admin api is served over them. It reports the status of the
+indexer and lets operators pause and resume it, change its number of workers, and enqueue ranges for resync or backfill.
+
 NOTE: Requires a sycmode=full statediffing go-ethereum node (doesn't require gcmode=archive)'
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -65,10 +69,21 @@ func sync() {
 	if err := syncer.Sync(wg); err != nil {
 		logWithCommand.Fatal(err)
 	}
+	var server *srpc.Server
+	if serverConfig := srpc.NewConfig(); serverConfig.Enabled() {
+		logWithCommand.Info("starting up rpc server")
+		server, err = srpc.StartServer(serverConfig, syncer.APIs())
+		if err != nil {
+			logWithCommand.Fatal(err)
+		}
+	}
 
 	shutdown := make(chan os.Signal)
 	signal.Notify(shutdown, os.Interrupt)
 	<-shutdown
+	if server != nil {
+		server.Stop()
+	}
 	syncer.Stop()
 	wg.Wait()
 }
@@ -78,9 +93,19 @@ func init() {
 
 	// flags
 	syncCmd.PersistentFlags().Int("sync-workers", 0, "how many worker goroutines to publish and index data")
+	syncCmd.PersistentFlags().String("sync-record-path", "", "if set, record the streamed payloads to this file")
+	syncCmd.PersistentFlags().String("sync-replay-path", "", "if set, replay the payloads recorded in this file instead of streaming from the ethereum node")
+	syncCmd.PersistentFlags().Bool("sync-validate-state-diffs", false, "if true, only count headers as validated if their state diffs hash consistently up to their state root")
+	syncCmd.PersistentFlags().Bool("sync-cross-validate", false, "if true, a header's validation level is the number of independent nodes which supplied it with agreeing state roots")
+	syncCmd.PersistentFlags().Int("sync-timeout", 15, "timeout used for http requests fetching ranges enqueued for resync (in seconds)")
 	syncCmd.PersistentFlags().String("eth-ws-path", "", "ws url for ethereum node")
 
 	// and their .toml config bindings
 	viper.BindPFlag("sync.workers", syncCmd.PersistentFlags().Lookup("sync-workers"))
+	viper.BindPFlag("sync.recordPath", syncCmd.PersistentFlags().Lookup("sync-record-path"))
+	viper.BindPFlag("sync.replayPath", syncCmd.PersistentFlags().Lookup("sync-replay-path"))
+	viper.BindPFlag("sync.validateStateDiffs", syncCmd.PersistentFlags().Lookup("sync-validate-state-diffs"))
+	viper.BindPFlag("sync.crossValidate", syncCmd.PersistentFlags().Lookup("sync-cross-validate"))
+	viper.BindPFlag("sync.timeout", syncCmd.PersistentFlags().Lookup("sync-timeout"))
 	viper.BindPFlag("ethereum.wsPath", syncCmd.PersistentFlags().Lookup("eth-ws-path"))
 }
@@ -0,0 +1,79 @@
+// Copyright © 2020 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/validate"
+	v "github.com/vulcanize/ipld-eth-indexer/version"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the indexed state diffs against their headers' state roots",
+	Long: `Use this command to validate the state diffs indexed in the database
+For every header in the block range it loads the state nodes indexed for it and checks that they hash
+consistently up to the header's state_root, and that the storage nodes of each account hash consistently
+up to the storage_root indexed for that account in eth.state_accounts
+
+This requires the state diffs to have been indexed with intermediate state and storage nodes
+
+Heights which fail validation can be queued for backfill by resetting their validation level`,
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		validateCmdCommand()
+	},
+}
+
+func validateCmdCommand() {
+	logWithCommand.Infof("running ipld-eth-indexer version: %s", v.VersionWithMeta)
+	logWithCommand.Debug("loading validate configuration variables")
+	vConfig, err := validate.NewConfig()
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	defer vConfig.Blockstore.Close()
+	logWithCommand.Infof("validate config: %+v", vConfig)
+	logWithCommand.Info("starting up validate process")
+	report, err := validate.NewValidateService(vConfig).Validate()
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Info(report.String())
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	// flags
+	validateCmd.PersistentFlags().Int("validate-start", 0, "block height to start validating from")
+	validateCmd.PersistentFlags().Int("validate-stop", 0, "block height to stop validating at (0 validates up to the highest indexed block)")
+	validateCmd.PersistentFlags().Int("validate-batch-size", 0, "number of block heights to load headers for per query")
+	validateCmd.PersistentFlags().Bool("validate-reset-validation", false, "if true, reset times_validated of headers at bad heights to 0 so that backfill resyncs them")
+	validateCmd.PersistentFlags().String("validate-report-path", "", "path to write the JSON report to")
+
+	// and their .toml config bindings
+	viper.BindPFlag("validate.start", validateCmd.PersistentFlags().Lookup("validate-start"))
+	viper.BindPFlag("validate.stop", validateCmd.PersistentFlags().Lookup("validate-stop"))
+	viper.BindPFlag("validate.batchSize", validateCmd.PersistentFlags().Lookup("validate-batch-size"))
+	viper.BindPFlag("validate.resetValidation", validateCmd.PersistentFlags().Lookup("validate-reset-validation"))
+	viper.BindPFlag("validate.reportPath", validateCmd.PersistentFlags().Lookup("validate-report-path"))
+}
@@ -0,0 +1,82 @@
+// Copyright © 2020 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/verify"
+	v "github.com/vulcanize/ipld-eth-indexer/version"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the content integrity of the database",
+	Long: `Use this command to verify the content integrity of the IPLD blockstore and the eth index tables
+For every eth.*_cids row in the block range it checks that the cid matches the mh_key, that the mh_key
+exists in public.blocks, and that the referenced data hashes to the key
+
+With --verify-orphans it also scans the entire public.blocks table, checking every block's data against
+its key and reporting blocks that are not referenced by any eth.*_cids row (contract code excluded)
+
+With --verify-enqueue the heights with problems are queued for backfill: their data is cleaned out, as resync
+does before refilling a range, so that a backfill process finds them as missing heights and refetches them`,
+	Run: func(cmd *cobra.Command, args []string) {
+		subCommand = cmd.CalledAs()
+		logWithCommand = *log.WithField("SubCommand", subCommand)
+		verifyCmdCommand()
+	},
+}
+
+func verifyCmdCommand() {
+	logWithCommand.Infof("running ipld-eth-indexer version: %s", v.VersionWithMeta)
+	logWithCommand.Debug("loading verify configuration variables")
+	vConfig, err := verify.NewConfig()
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	defer vConfig.Blockstore.Close()
+	logWithCommand.Infof("verify config: %+v", vConfig)
+	logWithCommand.Info("starting up verify process")
+	report, err := verify.NewVerifyService(vConfig).Verify()
+	if err != nil {
+		logWithCommand.Fatal(err)
+	}
+	logWithCommand.Info(report.String())
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	// flags
+	verifyCmd.PersistentFlags().Int("verify-start", 0, "block height to start verifying from")
+	verifyCmd.PersistentFlags().Int("verify-stop", 0, "block height to stop verifying at (0 verifies up to the highest indexed block)")
+	verifyCmd.PersistentFlags().Int("verify-batch-size", 0, "number of block heights to verify per query")
+	verifyCmd.PersistentFlags().Bool("verify-orphans", false, "if true, also scan the entire blockstore for corrupt and unreferenced blocks")
+	verifyCmd.PersistentFlags().Bool("verify-enqueue", false, "if true, clean out the data at bad heights so that backfill refills them")
+	verifyCmd.PersistentFlags().String("verify-report-path", "", "path to write the JSON report to")
+
+	// and their .toml config bindings
+	viper.BindPFlag("verify.start", verifyCmd.PersistentFlags().Lookup("verify-start"))
+	viper.BindPFlag("verify.stop", verifyCmd.PersistentFlags().Lookup("verify-stop"))
+	viper.BindPFlag("verify.batchSize", verifyCmd.PersistentFlags().Lookup("verify-batch-size"))
+	viper.BindPFlag("verify.orphans", verifyCmd.PersistentFlags().Lookup("verify-orphans"))
+	viper.BindPFlag("verify.enqueue", verifyCmd.PersistentFlags().Lookup("verify-enqueue"))
+	viper.BindPFlag("verify.reportPath", verifyCmd.PersistentFlags().Lookup("verify-report-path"))
+}
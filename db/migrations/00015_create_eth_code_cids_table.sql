@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE eth.code_cids (
+  code_hash             BYTEA PRIMARY KEY,
+  mh_key                TEXT NOT NULL REFERENCES public.blocks (key) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+  size                  INTEGER NOT NULL,
+  header_id             INTEGER NOT NULL REFERENCES eth.header_cids (id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+  block_number          BIGINT NOT NULL,
+  tx_hash               VARCHAR(66)
+);
+
+CREATE INDEX code_header_id_index ON eth.code_cids USING btree (header_id);
+
+CREATE INDEX code_block_number_index ON eth.code_cids USING brin (block_number);
+
+CREATE INDEX code_tx_hash_index ON eth.code_cids USING btree (tx_hash);
+
+CREATE INDEX account_code_hash_index ON eth.state_accounts USING btree (code_hash);
+
+CREATE TRIGGER code_cids_ai
+    after INSERT ON eth.code_cids
+    for each row
+    execute procedure eth.graphql_subscription('code_cids', 'code_hash');
+
+COMMENT ON TABLE eth.code_cids IS E'@name EthCodeCids';
+COMMENT ON TABLE eth.state_accounts IS E'@foreignKey (code_hash) references eth.code_cids (code_hash)';
+
+-- +goose Down
+DROP TRIGGER code_cids_ai ON eth.code_cids;
+COMMENT ON TABLE eth.state_accounts IS NULL;
+DROP INDEX eth.account_code_hash_index;
+DROP TABLE eth.code_cids;
@@ -0,0 +1,8 @@
+-- +goose Up
+CREATE TABLE eth.storage_preimages (
+  hash                  VARCHAR(66) PRIMARY KEY,
+  preimage              BYTEA NOT NULL
+);
+
+-- +goose Down
+DROP TABLE eth.storage_preimages;
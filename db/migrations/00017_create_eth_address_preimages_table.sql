@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE eth.address_preimages (
+  state_leaf_key        VARCHAR(66) PRIMARY KEY,
+  address               VARCHAR(66) NOT NULL
+);
+
+CREATE INDEX address_preimage_address_index ON eth.address_preimages USING btree (address);
+
+-- +goose Down
+DROP TABLE eth.address_preimages;
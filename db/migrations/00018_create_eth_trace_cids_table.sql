@@ -0,0 +1,37 @@
+-- +goose Up
+CREATE TABLE eth.trace_cids (
+  id                    SERIAL PRIMARY KEY,
+  tx_id                 INTEGER NOT NULL REFERENCES eth.transaction_cids (id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+  index                 INTEGER NOT NULL,
+  depth                 INTEGER NOT NULL,
+  call_type             VARCHAR(16) NOT NULL,
+  src                   VARCHAR(66) NOT NULL,
+  dst                   VARCHAR(66) NOT NULL,
+  value                 NUMERIC,
+  input_selector        VARCHAR(10),
+  gas                   BIGINT NOT NULL,
+  gas_used              BIGINT NOT NULL,
+  error                 TEXT,
+  cid                   TEXT NOT NULL,
+  mh_key                TEXT NOT NULL REFERENCES public.blocks (key) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+  UNIQUE (tx_id, index)
+);
+
+CREATE INDEX trace_src_index ON eth.trace_cids USING btree (src);
+
+CREATE INDEX trace_dst_index ON eth.trace_cids USING btree (dst);
+
+CREATE INDEX trace_input_selector_index ON eth.trace_cids USING btree (input_selector);
+
+CREATE INDEX trace_mh_index ON eth.trace_cids USING btree (mh_key);
+
+CREATE TRIGGER trace_cids_ai
+    after INSERT ON eth.trace_cids
+    for each row
+    execute procedure eth.graphql_subscription('trace_cids', 'id');
+
+COMMENT ON TABLE eth.trace_cids IS E'@name EthTraceCids';
+
+-- +goose Down
+DROP TRIGGER trace_cids_ai ON eth.trace_cids;
+DROP TABLE eth.trace_cids;
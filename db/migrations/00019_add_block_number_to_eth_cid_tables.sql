@@ -0,0 +1,88 @@
+-- +goose Up
+-- block_number is denormalized onto every table below eth.header_cids so that the tables can be partitioned by block range
+ALTER TABLE eth.uncle_cids ADD COLUMN block_number BIGINT;
+UPDATE eth.uncle_cids SET block_number = header_cids.block_number
+FROM eth.header_cids WHERE uncle_cids.header_id = header_cids.id;
+ALTER TABLE eth.uncle_cids ALTER COLUMN block_number SET NOT NULL;
+
+ALTER TABLE eth.transaction_cids ADD COLUMN block_number BIGINT;
+UPDATE eth.transaction_cids SET block_number = header_cids.block_number
+FROM eth.header_cids WHERE transaction_cids.header_id = header_cids.id;
+ALTER TABLE eth.transaction_cids ALTER COLUMN block_number SET NOT NULL;
+
+ALTER TABLE eth.receipt_cids ADD COLUMN block_number BIGINT;
+UPDATE eth.receipt_cids SET block_number = transaction_cids.block_number
+FROM eth.transaction_cids WHERE receipt_cids.tx_id = transaction_cids.id;
+ALTER TABLE eth.receipt_cids ALTER COLUMN block_number SET NOT NULL;
+
+ALTER TABLE eth.trace_cids ADD COLUMN block_number BIGINT;
+UPDATE eth.trace_cids SET block_number = transaction_cids.block_number
+FROM eth.transaction_cids WHERE trace_cids.tx_id = transaction_cids.id;
+ALTER TABLE eth.trace_cids ALTER COLUMN block_number SET NOT NULL;
+
+ALTER TABLE eth.state_cids ADD COLUMN block_number BIGINT;
+UPDATE eth.state_cids SET block_number = header_cids.block_number
+FROM eth.header_cids WHERE state_cids.header_id = header_cids.id;
+ALTER TABLE eth.state_cids ALTER COLUMN block_number SET NOT NULL;
+
+ALTER TABLE eth.state_accounts ADD COLUMN block_number BIGINT;
+UPDATE eth.state_accounts SET block_number = state_cids.block_number
+FROM eth.state_cids WHERE state_accounts.state_id = state_cids.id;
+ALTER TABLE eth.state_accounts ALTER COLUMN block_number SET NOT NULL;
+
+ALTER TABLE eth.storage_cids ADD COLUMN block_number BIGINT;
+UPDATE eth.storage_cids SET block_number = state_cids.block_number
+FROM eth.state_cids WHERE storage_cids.state_id = state_cids.id;
+ALTER TABLE eth.storage_cids ALTER COLUMN block_number SET NOT NULL;
+
+-- unique constraints of partitioned tables have to include the partition key
+ALTER TABLE eth.uncle_cids DROP CONSTRAINT uncle_cids_header_id_block_hash_key;
+ALTER TABLE eth.uncle_cids ADD UNIQUE (header_id, block_hash, block_number);
+
+ALTER TABLE eth.transaction_cids DROP CONSTRAINT transaction_cids_header_id_tx_hash_key;
+ALTER TABLE eth.transaction_cids ADD UNIQUE (header_id, tx_hash, block_number);
+
+ALTER TABLE eth.receipt_cids DROP CONSTRAINT receipt_cids_tx_id_key;
+ALTER TABLE eth.receipt_cids ADD UNIQUE (tx_id, block_number);
+
+ALTER TABLE eth.trace_cids DROP CONSTRAINT trace_cids_tx_id_index_key;
+ALTER TABLE eth.trace_cids ADD UNIQUE (tx_id, index, block_number);
+
+ALTER TABLE eth.state_cids DROP CONSTRAINT state_cids_header_id_state_path_key;
+ALTER TABLE eth.state_cids ADD UNIQUE (header_id, state_path, block_number);
+
+ALTER TABLE eth.state_accounts DROP CONSTRAINT state_accounts_state_id_key;
+ALTER TABLE eth.state_accounts ADD UNIQUE (state_id, block_number);
+
+ALTER TABLE eth.storage_cids DROP CONSTRAINT storage_cids_state_id_storage_path_key;
+ALTER TABLE eth.storage_cids ADD UNIQUE (state_id, storage_path, block_number);
+
+-- +goose Down
+ALTER TABLE eth.storage_cids DROP CONSTRAINT storage_cids_state_id_storage_path_block_number_key;
+ALTER TABLE eth.storage_cids ADD UNIQUE (state_id, storage_path);
+
+ALTER TABLE eth.state_accounts DROP CONSTRAINT state_accounts_state_id_block_number_key;
+ALTER TABLE eth.state_accounts ADD UNIQUE (state_id);
+
+ALTER TABLE eth.state_cids DROP CONSTRAINT state_cids_header_id_state_path_block_number_key;
+ALTER TABLE eth.state_cids ADD UNIQUE (header_id, state_path);
+
+ALTER TABLE eth.trace_cids DROP CONSTRAINT trace_cids_tx_id_index_block_number_key;
+ALTER TABLE eth.trace_cids ADD UNIQUE (tx_id, index);
+
+ALTER TABLE eth.receipt_cids DROP CONSTRAINT receipt_cids_tx_id_block_number_key;
+ALTER TABLE eth.receipt_cids ADD UNIQUE (tx_id);
+
+ALTER TABLE eth.transaction_cids DROP CONSTRAINT transaction_cids_header_id_tx_hash_block_number_key;
+ALTER TABLE eth.transaction_cids ADD UNIQUE (header_id, tx_hash);
+
+ALTER TABLE eth.uncle_cids DROP CONSTRAINT uncle_cids_header_id_block_hash_block_number_key;
+ALTER TABLE eth.uncle_cids ADD UNIQUE (header_id, block_hash);
+
+ALTER TABLE eth.storage_cids DROP COLUMN block_number;
+ALTER TABLE eth.state_accounts DROP COLUMN block_number;
+ALTER TABLE eth.state_cids DROP COLUMN block_number;
+ALTER TABLE eth.trace_cids DROP COLUMN block_number;
+ALTER TABLE eth.receipt_cids DROP COLUMN block_number;
+ALTER TABLE eth.transaction_cids DROP COLUMN block_number;
+ALTER TABLE eth.uncle_cids DROP COLUMN block_number;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- blocks kept in an external blockstore are recorded here by key only, so that the mh_key foreign keys still hold
+ALTER TABLE public.blocks ALTER COLUMN data DROP NOT NULL;
+
+-- +goose Down
+ALTER TABLE public.blocks ALTER COLUMN data SET NOT NULL;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- rows of the eth tables are scoped by the chain they were indexed from, so that several chains can share a database
+-- the tables below eth.header_cids are scoped through their header_id
+ALTER TABLE eth.header_cids ADD COLUMN chain_id INTEGER;
+UPDATE eth.header_cids SET chain_id = COALESCE(nodes.chain_id, 1)
+FROM public.nodes WHERE header_cids.node_id = nodes.id;
+ALTER TABLE eth.header_cids ALTER COLUMN chain_id SET NOT NULL;
+
+ALTER TABLE eth.header_cids DROP CONSTRAINT header_cids_block_number_block_hash_key;
+-- this also indexes the per chain block_number lookups
+ALTER TABLE eth.header_cids ADD UNIQUE (chain_id, block_number, block_hash);
+
+-- +goose Down
+ALTER TABLE eth.header_cids DROP CONSTRAINT header_cids_chain_id_block_number_block_hash_key;
+ALTER TABLE eth.header_cids ADD UNIQUE (block_number, block_hash);
+
+ALTER TABLE eth.header_cids DROP COLUMN chain_id;
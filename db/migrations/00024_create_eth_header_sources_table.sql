@@ -0,0 +1,36 @@
+-- +goose Up
+-- the nodes which supplied each header, along with the state root their state diff hashed up to (NULL if it didn't include the root node)
+-- rows are keyed by block hash rather than header id, so that they are independent of the layout of eth.header_cids
+CREATE TABLE eth.header_sources (
+  chain_id              INTEGER NOT NULL,
+  block_number          BIGINT NOT NULL,
+  block_hash            VARCHAR(66) NOT NULL,
+  node_id               INTEGER NOT NULL REFERENCES nodes (id) ON DELETE CASCADE,
+  state_root            VARCHAR(66),
+  validated             BOOLEAN NOT NULL,
+  times_indexed         INTEGER NOT NULL DEFAULT 1,
+  indexed_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  PRIMARY KEY (chain_id, block_number, block_hash, node_id)
+);
+
+CREATE INDEX header_sources_node_id_index ON eth.header_sources USING btree (node_id);
+
+-- disagreements between the nodes supplying the headers of a chain, on the block hash at a height or on the state root of a block
+CREATE TABLE eth.source_conflicts (
+  id                    SERIAL PRIMARY KEY,
+  chain_id              INTEGER NOT NULL,
+  block_number          BIGINT NOT NULL,
+  kind                  VARCHAR(16) NOT NULL,
+  node_id               INTEGER NOT NULL REFERENCES nodes (id) ON DELETE CASCADE,
+  block_hash            VARCHAR(66) NOT NULL,
+  state_root            VARCHAR(66),
+  other_node_id         INTEGER NOT NULL REFERENCES nodes (id) ON DELETE CASCADE,
+  other_block_hash      VARCHAR(66) NOT NULL,
+  other_state_root      VARCHAR(66),
+  detected_at           TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  UNIQUE (chain_id, block_number, node_id, block_hash, other_node_id, other_block_hash)
+);
+
+-- +goose Down
+DROP TABLE eth.source_conflicts;
+DROP TABLE eth.header_sources;
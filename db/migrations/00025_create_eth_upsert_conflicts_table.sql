@@ -0,0 +1,17 @@
+-- +goose Up
+-- changes to the content of existing rows of the eth CID tables made, or rejected, when re-indexing a block
+CREATE TABLE eth.upsert_conflicts (
+  id                    SERIAL PRIMARY KEY,
+  table_name            VARCHAR(32) NOT NULL,
+  block_number          BIGINT NOT NULL,
+  node_id               INTEGER NOT NULL REFERENCES nodes (id) ON DELETE CASCADE,
+  existing              JSONB NOT NULL,
+  replacement           JSONB NOT NULL,
+  overwritten           BOOLEAN NOT NULL,
+  detected_at           TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX upsert_conflicts_block_number_index ON eth.upsert_conflicts USING btree (block_number);
+
+-- +goose Down
+DROP TABLE eth.upsert_conflicts;
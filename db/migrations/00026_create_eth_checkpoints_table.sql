@@ -0,0 +1,15 @@
+-- +goose Up
+-- checkpoints imported into this database, indexed history for a chain starts at its earliest checkpoint
+CREATE TABLE eth.checkpoints (
+  chain_id              INTEGER NOT NULL,
+  block_number          BIGINT NOT NULL,
+  block_hash            VARCHAR(66) NOT NULL,
+  state_root            VARCHAR(66) NOT NULL,
+  schema_version        BIGINT NOT NULL,
+  node_id               INTEGER NOT NULL REFERENCES nodes (id) ON DELETE CASCADE,
+  imported_at           TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  PRIMARY KEY (chain_id, block_number)
+);
+
+-- +goose Down
+DROP TABLE eth.checkpoints;
@@ -0,0 +1,26 @@
+-- +goose Up
+-- contract code is indexed per chain, so that the block it was first seen at, and the header it references, are of its own chain
+ALTER TABLE eth.code_cids ADD COLUMN chain_id INTEGER;
+UPDATE eth.code_cids SET chain_id = header_cids.chain_id
+FROM eth.header_cids WHERE code_cids.header_id = header_cids.id;
+ALTER TABLE eth.code_cids ALTER COLUMN chain_id SET NOT NULL;
+
+ALTER TABLE eth.code_cids DROP CONSTRAINT code_cids_pkey;
+ALTER TABLE eth.code_cids ADD PRIMARY KEY (chain_id, code_hash);
+
+-- code_hash alone no longer identifies a row of eth.code_cids
+COMMENT ON TABLE eth.state_accounts IS NULL;
+
+-- +goose Down
+COMMENT ON TABLE eth.state_accounts IS E'@foreignKey (code_hash) references eth.code_cids (code_hash)';
+
+-- keep the code at the earliest block it has been seen at on any chain
+DELETE FROM eth.code_cids A
+USING eth.code_cids B
+WHERE A.code_hash = B.code_hash
+AND (A.block_number > B.block_number OR (A.block_number = B.block_number AND A.chain_id > B.chain_id));
+
+ALTER TABLE eth.code_cids DROP CONSTRAINT code_cids_pkey;
+ALTER TABLE eth.code_cids ADD PRIMARY KEY (code_hash);
+
+ALTER TABLE eth.code_cids DROP COLUMN chain_id;
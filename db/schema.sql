@@ -47,7 +47,8 @@ CREATE TABLE eth.header_cids (
     uncle_root character varying(66) NOT NULL,
     bloom bytea NOT NULL,
     "timestamp" numeric NOT NULL,
-    times_validated integer DEFAULT 1 NOT NULL
+    times_validated integer DEFAULT 1 NOT NULL,
+    chain_id integer NOT NULL
 );
 
 
@@ -123,7 +124,7 @@ BEGIN
   FOREACH header IN ARRAY headers
   LOOP
     -- check if it has any children
-    current_child_result = has_child(header.block_hash, header.block_number);
+    current_child_result = has_child(header.chain_id, header.block_hash, header.block_number);
     IF current_child_result.has_child THEN
       -- if it does, take note
       has_children_count = has_children_count + 1;
@@ -189,6 +190,42 @@ END;
 $$;
 
 
+--
+-- Name: canonical_header_id(integer, bigint); Type: FUNCTION; Schema: public; Owner: -
+--
+
+CREATE FUNCTION public.canonical_header_id(chain integer, height bigint) RETURNS integer
+    LANGUAGE plpgsql
+    AS $$
+DECLARE
+canonical_header eth.header_cids;
+  headers eth.header_cids[];
+  header_count INT;
+  temp_header eth.header_cids;
+BEGIN
+  -- collect all headers of the chain at this height
+FOR temp_header IN
+SELECT * FROM eth.header_cids WHERE chain_id = chain AND block_number = height
+    LOOP
+    headers = array_append(headers, temp_header);
+END LOOP;
+  -- count the number of headers collected
+  header_count = array_length(headers, 1);
+  -- if we have less than 1 header, return NULL
+  IF header_count IS NULL OR header_count < 1 THEN
+    RETURN NULL;
+  -- if we have one header, return its id
+  ELSIF header_count = 1 THEN
+    RETURN headers[1].id;
+  -- if we have multiple headers we need to determine which one is canonical
+ELSE
+    canonical_header = canonical_header_from_array(headers);
+RETURN canonical_header.id;
+END IF;
+END;
+$$;
+
+
 --
 -- Name: has_child(character varying, bigint); Type: FUNCTION; Schema: public; Owner: -
 --
@@ -222,6 +259,40 @@ END
 $$;
 
 
+--
+-- Name: has_child(integer, character varying, bigint); Type: FUNCTION; Schema: public; Owner: -
+--
+
+CREATE FUNCTION public.has_child(chain integer, hash character varying, height bigint) RETURNS public.child_result
+    LANGUAGE plpgsql
+    AS $$
+DECLARE
+child_height INT;
+  temp_child eth.header_cids;
+  new_child_result child_result;
+BEGIN
+  child_height = height + 1;
+  -- short circuit if there are no children
+SELECT exists(SELECT 1
+              FROM eth.header_cids
+              WHERE chain_id = chain
+                AND parent_hash = hash
+                AND block_number = child_height
+              LIMIT 1)
+INTO new_child_result.has_child;
+-- collect all the children for this header
+IF new_child_result.has_child THEN
+    FOR temp_child IN
+SELECT * FROM eth.header_cids WHERE chain_id = chain AND parent_hash = hash AND block_number = child_height
+    LOOP
+      new_child_result.children = array_append(new_child_result.children, temp_child);
+END LOOP;
+END IF;
+RETURN new_child_result;
+END
+$$;
+
+
 --
 -- Name: was_state_removed(bytea, bigint, character varying); Type: FUNCTION; Schema: public; Owner: -
 --
@@ -232,11 +303,13 @@ CREATE FUNCTION public.was_state_removed(path bytea, height bigint, hash charact
 SELECT exists(SELECT 1
               FROM eth.state_cids
                        INNER JOIN eth.header_cids ON (state_cids.header_id = header_cids.id)
+                       INNER JOIN (SELECT chain_id, block_number
+                                   FROM eth.header_cids
+                                   WHERE block_hash = hash
+                                   LIMIT 1) AS target ON (header_cids.chain_id = target.chain_id)
               WHERE state_path = path
-                AND block_number > height
-                AND block_number <= (SELECT block_number
-                                     FROM eth.header_cids
-                                     WHERE block_hash = hash)
+                AND header_cids.block_number > height
+                AND header_cids.block_number <= target.block_number
                 AND state_cids.node_type = 3
               LIMIT 1);
 $$;
@@ -253,16 +326,65 @@ SELECT exists(SELECT 1
               FROM eth.storage_cids
                        INNER JOIN eth.state_cids ON (storage_cids.state_id = state_cids.id)
                        INNER JOIN eth.header_cids ON (state_cids.header_id = header_cids.id)
+                       INNER JOIN (SELECT chain_id, block_number
+                                   FROM eth.header_cids
+                                   WHERE block_hash = hash
+                                   LIMIT 1) AS target ON (header_cids.chain_id = target.chain_id)
               WHERE storage_path = path
-                AND block_number > height
-                AND block_number <= (SELECT block_number
-                                     FROM eth.header_cids
-                                     WHERE block_hash = hash)
+                AND header_cids.block_number > height
+                AND header_cids.block_number <= target.block_number
                 AND storage_cids.node_type = 3
               LIMIT 1);
 $$;
 
 
+--
+-- Name: address_preimages; Type: TABLE; Schema: eth; Owner: -
+--
+
+CREATE TABLE eth.address_preimages (
+    state_leaf_key character varying(66) NOT NULL,
+    address character varying(66) NOT NULL
+);
+
+
+--
+-- Name: checkpoints; Type: TABLE; Schema: eth; Owner: -
+--
+
+CREATE TABLE eth.checkpoints (
+    chain_id integer NOT NULL,
+    block_number bigint NOT NULL,
+    block_hash character varying(66) NOT NULL,
+    state_root character varying(66) NOT NULL,
+    schema_version bigint NOT NULL,
+    node_id integer NOT NULL,
+    imported_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+--
+-- Name: code_cids; Type: TABLE; Schema: eth; Owner: -
+--
+
+CREATE TABLE eth.code_cids (
+    code_hash bytea NOT NULL,
+    mh_key text NOT NULL,
+    size integer NOT NULL,
+    header_id integer NOT NULL,
+    block_number bigint NOT NULL,
+    tx_hash character varying(66),
+    chain_id integer NOT NULL
+);
+
+
+--
+-- Name: TABLE code_cids; Type: COMMENT; Schema: eth; Owner: -
+--
+
+COMMENT ON TABLE eth.code_cids IS '@name EthCodeCids';
+
+
 --
 -- Name: header_cids_id_seq; Type: SEQUENCE; Schema: eth; Owner: -
 --
@@ -283,6 +405,22 @@ CREATE SEQUENCE eth.header_cids_id_seq
 ALTER SEQUENCE eth.header_cids_id_seq OWNED BY eth.header_cids.id;
 
 
+--
+-- Name: header_sources; Type: TABLE; Schema: eth; Owner: -
+--
+
+CREATE TABLE eth.header_sources (
+    chain_id integer NOT NULL,
+    block_number bigint NOT NULL,
+    block_hash character varying(66) NOT NULL,
+    node_id integer NOT NULL,
+    state_root character varying(66),
+    validated boolean NOT NULL,
+    times_indexed integer DEFAULT 1 NOT NULL,
+    indexed_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
 --
 -- Name: receipt_cids; Type: TABLE; Schema: eth; Owner: -
 --
@@ -300,7 +438,8 @@ CREATE TABLE eth.receipt_cids (
     topic3s character varying(66)[],
     log_contracts character varying(66)[],
     post_state character varying(66),
-    post_status integer
+    post_status integer,
+    block_number bigint NOT NULL
 );
 
 
@@ -324,6 +463,45 @@ CREATE SEQUENCE eth.receipt_cids_id_seq
 ALTER SEQUENCE eth.receipt_cids_id_seq OWNED BY eth.receipt_cids.id;
 
 
+--
+-- Name: source_conflicts; Type: TABLE; Schema: eth; Owner: -
+--
+
+CREATE TABLE eth.source_conflicts (
+    id integer NOT NULL,
+    chain_id integer NOT NULL,
+    block_number bigint NOT NULL,
+    kind character varying(16) NOT NULL,
+    node_id integer NOT NULL,
+    block_hash character varying(66) NOT NULL,
+    state_root character varying(66),
+    other_node_id integer NOT NULL,
+    other_block_hash character varying(66) NOT NULL,
+    other_state_root character varying(66),
+    detected_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+--
+-- Name: source_conflicts_id_seq; Type: SEQUENCE; Schema: eth; Owner: -
+--
+
+CREATE SEQUENCE eth.source_conflicts_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: source_conflicts_id_seq; Type: SEQUENCE OWNED BY; Schema: eth; Owner: -
+--
+
+ALTER SEQUENCE eth.source_conflicts_id_seq OWNED BY eth.source_conflicts.id;
+
+
 --
 -- Name: state_accounts; Type: TABLE; Schema: eth; Owner: -
 --
@@ -334,7 +512,8 @@ CREATE TABLE eth.state_accounts (
     balance numeric NOT NULL,
     nonce integer NOT NULL,
     code_hash bytea NOT NULL,
-    storage_root character varying(66) NOT NULL
+    storage_root character varying(66) NOT NULL,
+    block_number bigint NOT NULL
 );
 
 
@@ -370,7 +549,8 @@ CREATE TABLE eth.state_cids (
     mh_key text NOT NULL,
     state_path bytea,
     node_type integer NOT NULL,
-    diff boolean DEFAULT false NOT NULL
+    diff boolean DEFAULT false NOT NULL,
+    block_number bigint NOT NULL
 );
 
 
@@ -393,6 +573,16 @@ CREATE SEQUENCE eth.state_cids_id_seq
 ALTER SEQUENCE eth.state_cids_id_seq OWNED BY eth.state_cids.id;
 
 
+--
+-- Name: storage_preimages; Type: TABLE; Schema: eth; Owner: -
+--
+
+CREATE TABLE eth.storage_preimages (
+    hash character varying(66) NOT NULL,
+    preimage bytea NOT NULL
+);
+
+
 --
 -- Name: storage_cids; Type: TABLE; Schema: eth; Owner: -
 --
@@ -405,7 +595,8 @@ CREATE TABLE eth.storage_cids (
     mh_key text NOT NULL,
     storage_path bytea,
     node_type integer NOT NULL,
-    diff boolean DEFAULT false NOT NULL
+    diff boolean DEFAULT false NOT NULL,
+    block_number bigint NOT NULL
 );
 
 
@@ -428,6 +619,56 @@ CREATE SEQUENCE eth.storage_cids_id_seq
 ALTER SEQUENCE eth.storage_cids_id_seq OWNED BY eth.storage_cids.id;
 
 
+--
+-- Name: trace_cids; Type: TABLE; Schema: eth; Owner: -
+--
+
+CREATE TABLE eth.trace_cids (
+    id integer NOT NULL,
+    tx_id integer NOT NULL,
+    index integer NOT NULL,
+    depth integer NOT NULL,
+    call_type character varying(16) NOT NULL,
+    src character varying(66) NOT NULL,
+    dst character varying(66) NOT NULL,
+    value numeric,
+    input_selector character varying(10),
+    gas bigint NOT NULL,
+    gas_used bigint NOT NULL,
+    error text,
+    cid text NOT NULL,
+    mh_key text NOT NULL,
+    block_number bigint NOT NULL
+);
+
+
+--
+-- Name: TABLE trace_cids; Type: COMMENT; Schema: eth; Owner: -
+--
+
+COMMENT ON TABLE eth.trace_cids IS '@name EthTraceCids';
+
+
+--
+-- Name: trace_cids_id_seq; Type: SEQUENCE; Schema: eth; Owner: -
+--
+
+CREATE SEQUENCE eth.trace_cids_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: trace_cids_id_seq; Type: SEQUENCE OWNED BY; Schema: eth; Owner: -
+--
+
+ALTER SEQUENCE eth.trace_cids_id_seq OWNED BY eth.trace_cids.id;
+
+
 --
 -- Name: transaction_cids; Type: TABLE; Schema: eth; Owner: -
 --
@@ -441,7 +682,8 @@ CREATE TABLE eth.transaction_cids (
     mh_key text NOT NULL,
     dst character varying(66) NOT NULL,
     src character varying(66) NOT NULL,
-    tx_data bytea
+    tx_data bytea,
+    block_number bigint NOT NULL
 );
 
 
@@ -483,7 +725,8 @@ CREATE TABLE eth.uncle_cids (
     parent_hash character varying(66) NOT NULL,
     cid text NOT NULL,
     mh_key text NOT NULL,
-    reward numeric NOT NULL
+    reward numeric NOT NULL,
+    block_number bigint NOT NULL
 );
 
 
@@ -507,13 +750,49 @@ CREATE SEQUENCE eth.uncle_cids_id_seq
 ALTER SEQUENCE eth.uncle_cids_id_seq OWNED BY eth.uncle_cids.id;
 
 
+--
+-- Name: upsert_conflicts; Type: TABLE; Schema: eth; Owner: -
+--
+
+CREATE TABLE eth.upsert_conflicts (
+    id integer NOT NULL,
+    table_name character varying(32) NOT NULL,
+    block_number bigint NOT NULL,
+    node_id integer NOT NULL,
+    existing jsonb NOT NULL,
+    replacement jsonb NOT NULL,
+    overwritten boolean NOT NULL,
+    detected_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+--
+-- Name: upsert_conflicts_id_seq; Type: SEQUENCE; Schema: eth; Owner: -
+--
+
+CREATE SEQUENCE eth.upsert_conflicts_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: upsert_conflicts_id_seq; Type: SEQUENCE OWNED BY; Schema: eth; Owner: -
+--
+
+ALTER SEQUENCE eth.upsert_conflicts_id_seq OWNED BY eth.upsert_conflicts.id;
+
+
 --
 -- Name: blocks; Type: TABLE; Schema: public; Owner: -
 --
 
 CREATE TABLE public.blocks (
     key text NOT NULL,
-    data bytea NOT NULL
+    data bytea
 );
 
 
@@ -611,6 +890,13 @@ ALTER TABLE ONLY eth.header_cids ALTER COLUMN id SET DEFAULT nextval('eth.header
 ALTER TABLE ONLY eth.receipt_cids ALTER COLUMN id SET DEFAULT nextval('eth.receipt_cids_id_seq'::regclass);
 
 
+--
+-- Name: source_conflicts id; Type: DEFAULT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.source_conflicts ALTER COLUMN id SET DEFAULT nextval('eth.source_conflicts_id_seq'::regclass);
+
+
 --
 -- Name: state_accounts id; Type: DEFAULT; Schema: eth; Owner: -
 --
@@ -632,6 +918,13 @@ ALTER TABLE ONLY eth.state_cids ALTER COLUMN id SET DEFAULT nextval('eth.state_c
 ALTER TABLE ONLY eth.storage_cids ALTER COLUMN id SET DEFAULT nextval('eth.storage_cids_id_seq'::regclass);
 
 
+--
+-- Name: trace_cids id; Type: DEFAULT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.trace_cids ALTER COLUMN id SET DEFAULT nextval('eth.trace_cids_id_seq'::regclass);
+
+
 --
 -- Name: transaction_cids id; Type: DEFAULT; Schema: eth; Owner: -
 --
@@ -646,6 +939,13 @@ ALTER TABLE ONLY eth.transaction_cids ALTER COLUMN id SET DEFAULT nextval('eth.t
 ALTER TABLE ONLY eth.uncle_cids ALTER COLUMN id SET DEFAULT nextval('eth.uncle_cids_id_seq'::regclass);
 
 
+--
+-- Name: upsert_conflicts id; Type: DEFAULT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.upsert_conflicts ALTER COLUMN id SET DEFAULT nextval('eth.upsert_conflicts_id_seq'::regclass);
+
+
 --
 -- Name: goose_db_version id; Type: DEFAULT; Schema: public; Owner: -
 --
@@ -661,11 +961,35 @@ ALTER TABLE ONLY public.nodes ALTER COLUMN id SET DEFAULT nextval('public.nodes_
 
 
 --
--- Name: header_cids header_cids_block_number_block_hash_key; Type: CONSTRAINT; Schema: eth; Owner: -
+-- Name: address_preimages address_preimages_pkey; Type: CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.address_preimages
+    ADD CONSTRAINT address_preimages_pkey PRIMARY KEY (state_leaf_key);
+
+
+--
+-- Name: checkpoints checkpoints_pkey; Type: CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.checkpoints
+    ADD CONSTRAINT checkpoints_pkey PRIMARY KEY (chain_id, block_number);
+
+
+--
+-- Name: code_cids code_cids_pkey; Type: CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.code_cids
+    ADD CONSTRAINT code_cids_pkey PRIMARY KEY (chain_id, code_hash);
+
+
+--
+-- Name: header_cids header_cids_chain_id_block_number_block_hash_key; Type: CONSTRAINT; Schema: eth; Owner: -
 --
 
 ALTER TABLE ONLY eth.header_cids
-    ADD CONSTRAINT header_cids_block_number_block_hash_key UNIQUE (block_number, block_hash);
+    ADD CONSTRAINT header_cids_chain_id_block_number_block_hash_key UNIQUE (chain_id, block_number, block_hash);
 
 
 --
@@ -676,6 +1000,14 @@ ALTER TABLE ONLY eth.header_cids
     ADD CONSTRAINT header_cids_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: header_sources header_sources_pkey; Type: CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.header_sources
+    ADD CONSTRAINT header_sources_pkey PRIMARY KEY (chain_id, block_number, block_hash, node_id);
+
+
 --
 -- Name: receipt_cids receipt_cids_pkey; Type: CONSTRAINT; Schema: eth; Owner: -
 --
@@ -685,11 +1017,27 @@ ALTER TABLE ONLY eth.receipt_cids
 
 
 --
--- Name: receipt_cids receipt_cids_tx_id_key; Type: CONSTRAINT; Schema: eth; Owner: -
+-- Name: receipt_cids receipt_cids_tx_id_block_number_key; Type: CONSTRAINT; Schema: eth; Owner: -
 --
 
 ALTER TABLE ONLY eth.receipt_cids
-    ADD CONSTRAINT receipt_cids_tx_id_key UNIQUE (tx_id);
+    ADD CONSTRAINT receipt_cids_tx_id_block_number_key UNIQUE (tx_id, block_number);
+
+
+--
+-- Name: source_conflicts source_conflicts_chain_id_block_number_node_id_block_hash_o_key; Type: CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.source_conflicts
+    ADD CONSTRAINT source_conflicts_chain_id_block_number_node_id_block_hash_o_key UNIQUE (chain_id, block_number, node_id, block_hash, other_node_id, other_block_hash);
+
+
+--
+-- Name: source_conflicts source_conflicts_pkey; Type: CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.source_conflicts
+    ADD CONSTRAINT source_conflicts_pkey PRIMARY KEY (id);
 
 
 --
@@ -701,19 +1049,19 @@ ALTER TABLE ONLY eth.state_accounts
 
 
 --
--- Name: state_accounts state_accounts_state_id_key; Type: CONSTRAINT; Schema: eth; Owner: -
+-- Name: state_accounts state_accounts_state_id_block_number_key; Type: CONSTRAINT; Schema: eth; Owner: -
 --
 
 ALTER TABLE ONLY eth.state_accounts
-    ADD CONSTRAINT state_accounts_state_id_key UNIQUE (state_id);
+    ADD CONSTRAINT state_accounts_state_id_block_number_key UNIQUE (state_id, block_number);
 
 
 --
--- Name: state_cids state_cids_header_id_state_path_key; Type: CONSTRAINT; Schema: eth; Owner: -
+-- Name: state_cids state_cids_header_id_state_path_block_number_key; Type: CONSTRAINT; Schema: eth; Owner: -
 --
 
 ALTER TABLE ONLY eth.state_cids
-    ADD CONSTRAINT state_cids_header_id_state_path_key UNIQUE (header_id, state_path);
+    ADD CONSTRAINT state_cids_header_id_state_path_block_number_key UNIQUE (header_id, state_path, block_number);
 
 
 --
@@ -733,19 +1081,43 @@ ALTER TABLE ONLY eth.storage_cids
 
 
 --
--- Name: storage_cids storage_cids_state_id_storage_path_key; Type: CONSTRAINT; Schema: eth; Owner: -
+-- Name: storage_cids storage_cids_state_id_storage_path_block_number_key; Type: CONSTRAINT; Schema: eth; Owner: -
 --
 
 ALTER TABLE ONLY eth.storage_cids
-    ADD CONSTRAINT storage_cids_state_id_storage_path_key UNIQUE (state_id, storage_path);
+    ADD CONSTRAINT storage_cids_state_id_storage_path_block_number_key UNIQUE (state_id, storage_path, block_number);
 
 
 --
--- Name: transaction_cids transaction_cids_header_id_tx_hash_key; Type: CONSTRAINT; Schema: eth; Owner: -
+-- Name: trace_cids trace_cids_pkey; Type: CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.trace_cids
+    ADD CONSTRAINT trace_cids_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: trace_cids trace_cids_tx_id_index_block_number_key; Type: CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.trace_cids
+    ADD CONSTRAINT trace_cids_tx_id_index_block_number_key UNIQUE (tx_id, index, block_number);
+
+
+--
+-- Name: transaction_cids transaction_cids_header_id_tx_hash_block_number_key; Type: CONSTRAINT; Schema: eth; Owner: -
 --
 
 ALTER TABLE ONLY eth.transaction_cids
-    ADD CONSTRAINT transaction_cids_header_id_tx_hash_key UNIQUE (header_id, tx_hash);
+    ADD CONSTRAINT transaction_cids_header_id_tx_hash_block_number_key UNIQUE (header_id, tx_hash, block_number);
+
+
+--
+-- Name: storage_preimages storage_preimages_pkey; Type: CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.storage_preimages
+    ADD CONSTRAINT storage_preimages_pkey PRIMARY KEY (hash);
 
 
 --
@@ -757,11 +1129,11 @@ ALTER TABLE ONLY eth.transaction_cids
 
 
 --
--- Name: uncle_cids uncle_cids_header_id_block_hash_key; Type: CONSTRAINT; Schema: eth; Owner: -
+-- Name: uncle_cids uncle_cids_header_id_block_hash_block_number_key; Type: CONSTRAINT; Schema: eth; Owner: -
 --
 
 ALTER TABLE ONLY eth.uncle_cids
-    ADD CONSTRAINT uncle_cids_header_id_block_hash_key UNIQUE (header_id, block_hash);
+    ADD CONSTRAINT uncle_cids_header_id_block_hash_block_number_key UNIQUE (header_id, block_hash, block_number);
 
 
 --
@@ -772,6 +1144,14 @@ ALTER TABLE ONLY eth.uncle_cids
     ADD CONSTRAINT uncle_cids_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: upsert_conflicts upsert_conflicts_pkey; Type: CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.upsert_conflicts
+    ADD CONSTRAINT upsert_conflicts_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: blocks blocks_key_key; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -804,6 +1184,20 @@ ALTER TABLE ONLY public.nodes
     ADD CONSTRAINT nodes_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: account_code_hash_index; Type: INDEX; Schema: eth; Owner: -
+--
+
+CREATE INDEX account_code_hash_index ON eth.state_accounts USING btree (code_hash);
+
+
+--
+-- Name: address_preimage_address_index; Type: INDEX; Schema: eth; Owner: -
+--
+
+CREATE INDEX address_preimage_address_index ON eth.address_preimages USING btree (address);
+
+
 --
 -- Name: account_state_id_index; Type: INDEX; Schema: eth; Owner: -
 --
@@ -825,6 +1219,27 @@ CREATE INDEX block_hash_index ON eth.header_cids USING btree (block_hash);
 CREATE INDEX block_number_index ON eth.header_cids USING brin (block_number);
 
 
+--
+-- Name: code_block_number_index; Type: INDEX; Schema: eth; Owner: -
+--
+
+CREATE INDEX code_block_number_index ON eth.code_cids USING brin (block_number);
+
+
+--
+-- Name: code_header_id_index; Type: INDEX; Schema: eth; Owner: -
+--
+
+CREATE INDEX code_header_id_index ON eth.code_cids USING btree (header_id);
+
+
+--
+-- Name: code_tx_hash_index; Type: INDEX; Schema: eth; Owner: -
+--
+
+CREATE INDEX code_tx_hash_index ON eth.code_cids USING btree (tx_hash);
+
+
 --
 -- Name: header_cid_index; Type: INDEX; Schema: eth; Owner: -
 --
@@ -839,6 +1254,13 @@ CREATE INDEX header_cid_index ON eth.header_cids USING btree (cid);
 CREATE INDEX header_mh_index ON eth.header_cids USING btree (mh_key);
 
 
+--
+-- Name: header_sources_node_id_index; Type: INDEX; Schema: eth; Owner: -
+--
+
+CREATE INDEX header_sources_node_id_index ON eth.header_sources USING btree (node_id);
+
+
 --
 -- Name: rct_cid_index; Type: INDEX; Schema: eth; Owner: -
 --
@@ -1000,6 +1422,34 @@ CREATE INDEX storage_state_id_index ON eth.storage_cids USING btree (state_id);
 CREATE INDEX timestamp_index ON eth.header_cids USING brin ("timestamp");
 
 
+--
+-- Name: trace_dst_index; Type: INDEX; Schema: eth; Owner: -
+--
+
+CREATE INDEX trace_dst_index ON eth.trace_cids USING btree (dst);
+
+
+--
+-- Name: trace_input_selector_index; Type: INDEX; Schema: eth; Owner: -
+--
+
+CREATE INDEX trace_input_selector_index ON eth.trace_cids USING btree (input_selector);
+
+
+--
+-- Name: trace_mh_index; Type: INDEX; Schema: eth; Owner: -
+--
+
+CREATE INDEX trace_mh_index ON eth.trace_cids USING btree (mh_key);
+
+
+--
+-- Name: trace_src_index; Type: INDEX; Schema: eth; Owner: -
+--
+
+CREATE INDEX trace_src_index ON eth.trace_cids USING btree (src);
+
+
 --
 -- Name: tx_cid_index; Type: INDEX; Schema: eth; Owner: -
 --
@@ -1042,6 +1492,20 @@ CREATE INDEX tx_mh_index ON eth.transaction_cids USING btree (mh_key);
 CREATE INDEX tx_src_index ON eth.transaction_cids USING btree (src);
 
 
+--
+-- Name: upsert_conflicts_block_number_index; Type: INDEX; Schema: eth; Owner: -
+--
+
+CREATE INDEX upsert_conflicts_block_number_index ON eth.upsert_conflicts USING btree (block_number);
+
+
+--
+-- Name: code_cids code_cids_ai; Type: TRIGGER; Schema: eth; Owner: -
+--
+
+CREATE TRIGGER code_cids_ai AFTER INSERT ON eth.code_cids FOR EACH ROW EXECUTE FUNCTION eth.graphql_subscription('code_cids', 'code_hash');
+
+
 --
 -- Name: header_cids header_cids_ai; Type: TRIGGER; Schema: eth; Owner: -
 --
@@ -1077,6 +1541,13 @@ CREATE TRIGGER state_cids_ai AFTER INSERT ON eth.state_cids FOR EACH ROW EXECUTE
 CREATE TRIGGER storage_cids_ai AFTER INSERT ON eth.storage_cids FOR EACH ROW EXECUTE FUNCTION eth.graphql_subscription('storage_cids', 'id');
 
 
+--
+-- Name: trace_cids trace_cids_ai; Type: TRIGGER; Schema: eth; Owner: -
+--
+
+CREATE TRIGGER trace_cids_ai AFTER INSERT ON eth.trace_cids FOR EACH ROW EXECUTE FUNCTION eth.graphql_subscription('trace_cids', 'id');
+
+
 --
 -- Name: transaction_cids transaction_cids_ai; Type: TRIGGER; Schema: eth; Owner: -
 --
@@ -1091,6 +1562,30 @@ CREATE TRIGGER transaction_cids_ai AFTER INSERT ON eth.transaction_cids FOR EACH
 CREATE TRIGGER uncle_cids_ai AFTER INSERT ON eth.uncle_cids FOR EACH ROW EXECUTE FUNCTION eth.graphql_subscription('uncle_cids', 'id');
 
 
+--
+-- Name: checkpoints checkpoints_node_id_fkey; Type: FK CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.checkpoints
+    ADD CONSTRAINT checkpoints_node_id_fkey FOREIGN KEY (node_id) REFERENCES public.nodes(id) ON DELETE CASCADE;
+
+
+--
+-- Name: code_cids code_cids_header_id_fkey; Type: FK CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.code_cids
+    ADD CONSTRAINT code_cids_header_id_fkey FOREIGN KEY (header_id) REFERENCES eth.header_cids(id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+
+
+--
+-- Name: code_cids code_cids_mh_key_fkey; Type: FK CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.code_cids
+    ADD CONSTRAINT code_cids_mh_key_fkey FOREIGN KEY (mh_key) REFERENCES public.blocks(key) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+
+
 --
 -- Name: header_cids header_cids_mh_key_fkey; Type: FK CONSTRAINT; Schema: eth; Owner: -
 --
@@ -1107,6 +1602,14 @@ ALTER TABLE ONLY eth.header_cids
     ADD CONSTRAINT header_cids_node_id_fkey FOREIGN KEY (node_id) REFERENCES public.nodes(id) ON DELETE CASCADE;
 
 
+--
+-- Name: header_sources header_sources_node_id_fkey; Type: FK CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.header_sources
+    ADD CONSTRAINT header_sources_node_id_fkey FOREIGN KEY (node_id) REFERENCES public.nodes(id) ON DELETE CASCADE;
+
+
 --
 -- Name: receipt_cids receipt_cids_mh_key_fkey; Type: FK CONSTRAINT; Schema: eth; Owner: -
 --
@@ -1123,6 +1626,22 @@ ALTER TABLE ONLY eth.receipt_cids
     ADD CONSTRAINT receipt_cids_tx_id_fkey FOREIGN KEY (tx_id) REFERENCES eth.transaction_cids(id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
 
 
+--
+-- Name: source_conflicts source_conflicts_node_id_fkey; Type: FK CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.source_conflicts
+    ADD CONSTRAINT source_conflicts_node_id_fkey FOREIGN KEY (node_id) REFERENCES public.nodes(id) ON DELETE CASCADE;
+
+
+--
+-- Name: source_conflicts source_conflicts_other_node_id_fkey; Type: FK CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.source_conflicts
+    ADD CONSTRAINT source_conflicts_other_node_id_fkey FOREIGN KEY (other_node_id) REFERENCES public.nodes(id) ON DELETE CASCADE;
+
+
 --
 -- Name: state_accounts state_accounts_state_id_fkey; Type: FK CONSTRAINT; Schema: eth; Owner: -
 --
@@ -1163,6 +1682,22 @@ ALTER TABLE ONLY eth.storage_cids
     ADD CONSTRAINT storage_cids_state_id_fkey FOREIGN KEY (state_id) REFERENCES eth.state_cids(id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
 
 
+--
+-- Name: trace_cids trace_cids_mh_key_fkey; Type: FK CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.trace_cids
+    ADD CONSTRAINT trace_cids_mh_key_fkey FOREIGN KEY (mh_key) REFERENCES public.blocks(key) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+
+
+--
+-- Name: trace_cids trace_cids_tx_id_fkey; Type: FK CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.trace_cids
+    ADD CONSTRAINT trace_cids_tx_id_fkey FOREIGN KEY (tx_id) REFERENCES eth.transaction_cids(id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+
+
 --
 -- Name: transaction_cids transaction_cids_header_id_fkey; Type: FK CONSTRAINT; Schema: eth; Owner: -
 --
@@ -1195,6 +1730,14 @@ ALTER TABLE ONLY eth.uncle_cids
     ADD CONSTRAINT uncle_cids_mh_key_fkey FOREIGN KEY (mh_key) REFERENCES public.blocks(key) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
 
 
+--
+-- Name: upsert_conflicts upsert_conflicts_node_id_fkey; Type: FK CONSTRAINT; Schema: eth; Owner: -
+--
+
+ALTER TABLE ONLY eth.upsert_conflicts
+    ADD CONSTRAINT upsert_conflicts_node_id_fkey FOREIGN KEY (node_id) REFERENCES public.nodes(id) ON DELETE CASCADE;
+
+
 --
 -- PostgreSQL database dump complete
 --
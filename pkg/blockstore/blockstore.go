@@ -0,0 +1,58 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockstore
+
+import (
+	"errors"
+	"strings"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// ErrNotFound is returned by a Blockstore when it does not hold the requested block
+var ErrNotFound = errors.New("block not found")
+
+// Blockstore is a store for the raw IPLD block data that the eth.*_cids tables reference by mh_key
+// Keys are the blockstore-prefixed multihash keys used in the mh_key columns
+type Blockstore interface {
+	// Put durably writes the blocks, it must not return before they would survive a crash
+	Put(blocks []Block) error
+	Get(key string) ([]byte, error)
+	// Delete removes the blocks with the keys, keys it does not hold are ignored
+	Delete(keys []string) error
+	Close() error
+}
+
+// Block is a raw IPLD block and its blockstore-prefixed multihash key
+type Block struct {
+	Key  string
+	Data []byte
+}
+
+// dsKey strips the blockstore prefix off of a key, leaving the base32 encoded multihash
+func dsKey(key string) string {
+	return strings.TrimPrefix(key, blockstore.BlockPrefix.String()+"/")
+}
+
+// Load returns the block data joined from public.blocks, or reads the block from the store if public.blocks only records its key
+// The flatfs and leveldb blockstores leave public.blocks.data NULL, so readers which join public.blocks fall back to the store
+func Load(store Blockstore, key string, data Data) ([]byte, error) {
+	if len(data) > 0 {
+		return data, nil
+	}
+	return store.Get(key)
+}
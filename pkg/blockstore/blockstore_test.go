@@ -0,0 +1,223 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockstore_test
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/lib/pq"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+func mockBlock(data []byte) blockstore.Block {
+	key, _ := shared.MultihashKeyFromKeccak256(crypto.Keccak256Hash(data))
+	return blockstore.Block{Key: key, Data: data}
+}
+
+var (
+	block1 = mockBlock([]byte("mock block 1"))
+	block2 = mockBlock([]byte("mock block 2"))
+)
+
+var _ = Describe("Blockstore", func() {
+	var dir string
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "blockstore")
+		Expect(err).ToNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	backends := map[string]func(path string) (blockstore.Blockstore, error){
+		"FlatFS": func(path string) (blockstore.Blockstore, error) {
+			return blockstore.NewFlatFSBlockstore(path)
+		},
+		"LevelDB": func(path string) (blockstore.Blockstore, error) {
+			return blockstore.NewLevelDBBlockstore(path)
+		},
+	}
+	for name, open := range backends {
+		open := open
+		Describe(name, func() {
+			It("Gets the blocks that were put", func() {
+				bs, err := open(dir)
+				Expect(err).ToNot(HaveOccurred())
+				defer bs.Close()
+				err = bs.Put([]blockstore.Block{block1, block2})
+				Expect(err).ToNot(HaveOccurred())
+				data, err := bs.Get(block1.Key)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal(block1.Data))
+				data, err = bs.Get(block2.Key)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal(block2.Data))
+			})
+			It("Puts the same block more than once", func() {
+				bs, err := open(dir)
+				Expect(err).ToNot(HaveOccurred())
+				defer bs.Close()
+				Expect(bs.Put([]blockstore.Block{block1})).To(Succeed())
+				Expect(bs.Put([]blockstore.Block{block1, block1})).To(Succeed())
+				data, err := bs.Get(block1.Key)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal(block1.Data))
+			})
+			It("Returns ErrNotFound for a block it does not hold", func() {
+				bs, err := open(dir)
+				Expect(err).ToNot(HaveOccurred())
+				defer bs.Close()
+				_, err = bs.Get(block1.Key)
+				Expect(err).To(Equal(blockstore.ErrNotFound))
+			})
+			It("Keeps the blocks when it is reopened", func() {
+				bs, err := open(dir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(bs.Put([]blockstore.Block{block1})).To(Succeed())
+				Expect(bs.Close()).To(Succeed())
+				bs, err = open(dir)
+				Expect(err).ToNot(HaveOccurred())
+				defer bs.Close()
+				data, err := bs.Get(block1.Key)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal(block1.Data))
+			})
+			It("Deletes blocks, ignoring the ones it does not hold", func() {
+				bs, err := open(dir)
+				Expect(err).ToNot(HaveOccurred())
+				defer bs.Close()
+				Expect(bs.Put([]blockstore.Block{block1})).To(Succeed())
+				Expect(bs.Delete([]string{block1.Key, block2.Key})).To(Succeed())
+				_, err = bs.Get(block1.Key)
+				Expect(err).To(Equal(blockstore.ErrNotFound))
+			})
+			It("Requires a path", func() {
+				_, err := open("")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	}
+
+	Describe("NewBlockstore", func() {
+		It("Opens the configured type", func() {
+			bs, err := blockstore.NewBlockstore(blockstore.Config{Type: blockstore.FlatFS, Path: filepath.Join(dir, "flatfs")}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bs).To(BeAssignableToTypeOf(&blockstore.FlatFSBlockstore{}))
+			bs, err = blockstore.NewBlockstore(blockstore.Config{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bs).To(BeAssignableToTypeOf(&blockstore.PostgresBlockstore{}))
+		})
+		It("Rejects an unknown type", func() {
+			_, err := blockstore.NewBlockstore(blockstore.Config{Type: "badger"}, nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Load", func() {
+		It("Returns the joined data, or reads the block from the blockstore if the data is NULL", func() {
+			bs, err := blockstore.NewFlatFSBlockstore(dir)
+			Expect(err).ToNot(HaveOccurred())
+			defer bs.Close()
+			Expect(bs.Put([]blockstore.Block{block1})).To(Succeed())
+			data, err := blockstore.Load(bs, block2.Key, block2.Data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(block2.Data))
+			data, err = blockstore.Load(bs, block1.Key, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(block1.Data))
+			_, err = blockstore.Load(bs, block2.Key, nil)
+			Expect(err).To(Equal(blockstore.ErrNotFound))
+		})
+	})
+
+	Describe("Tx", func() {
+		var (
+			db *postgres.DB
+			bs blockstore.Blockstore
+		)
+		BeforeEach(func() {
+			var err error
+			db, bs = nil, nil
+			db, err = shared.SetupDB()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = db.Exec(`DELETE FROM public.blocks WHERE key = ANY($1)`, pqKeys())
+			Expect(err).ToNot(HaveOccurred())
+			bs, err = blockstore.NewLevelDBBlockstore(dir)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		AfterEach(func() {
+			if bs != nil {
+				bs.Close()
+			}
+			if db != nil {
+				db.Exec(`DELETE FROM public.blocks WHERE key = ANY($1)`, pqKeys())
+			}
+		})
+
+		It("Records only the keys in public.blocks and writes the blocks to the blockstore on commit", func() {
+			tx, err := blockstore.Begin(db.DB, bs)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tx.Put(block1.Key, block1.Data)).To(Succeed())
+			Expect(tx.Put(block2.Key, block2.Data)).To(Succeed())
+			_, err = bs.Get(block1.Key)
+			Expect(err).To(Equal(blockstore.ErrNotFound))
+			Expect(tx.Commit()).To(Succeed())
+
+			var data []byte
+			err = db.Get(&data, `SELECT data FROM public.blocks WHERE key = $1`, block1.Key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(BeNil())
+			data, err = bs.Get(block2.Key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(block2.Data))
+		})
+		It("Discards the staged blocks on rollback", func() {
+			tx, err := blockstore.Begin(db.DB, bs)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tx.Put(block1.Key, block1.Data)).To(Succeed())
+			Expect(tx.Rollback()).To(Succeed())
+			_, err = bs.Get(block1.Key)
+			Expect(err).To(Equal(blockstore.ErrNotFound))
+			var data []byte
+			err = db.Get(&data, `SELECT data FROM public.blocks WHERE key = $1`, block1.Key)
+			Expect(err).To(Equal(sql.ErrNoRows))
+		})
+		It("Writes the blocks to public.blocks with the Postgres blockstore", func() {
+			tx, err := blockstore.Begin(db.DB, blockstore.NewPostgresBlockstore(db.DB))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tx.Put(block1.Key, block1.Data)).To(Succeed())
+			Expect(tx.Commit()).To(Succeed())
+			data, err := blockstore.NewPostgresBlockstore(db.DB).Get(block1.Key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(block1.Data))
+		})
+	})
+})
+
+func pqKeys() interface{} {
+	return pq.Array([]string{block1.Key, block2.Key})
+}
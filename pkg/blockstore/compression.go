@@ -0,0 +1,181 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockstore
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/golang/snappy"
+)
+
+// Compression is the codec block data is compressed with before it is written to public.blocks
+type Compression string
+
+const (
+	NoCompression Compression = "none"
+	Snappy        Compression = "snappy"
+	Deflate       Compression = "deflate"
+)
+
+// Compressed block data is framed by compressedMagic, a codec byte, and the big endian uint32 length of the
+// uncompressed data, followed by the compressed bytes. Data which doesn't start with compressedMagic is stored as is,
+// so rows written before compression was turned on, or with it off, are read back unchanged.
+// Data which happens to start with compressedMagic is always framed, with codecStored if it isn't compressed, to keep it unambiguous.
+var compressedMagic = []byte{0xfe, 'I', 'P', 'Z'}
+
+const (
+	codecStored  byte = 0
+	codecSnappy  byte = 1
+	codecDeflate byte = 2
+
+	frameHeaderLen = 9
+	// blocks smaller than this are not worth compressing
+	minCompressSize = 128
+)
+
+var codecs = map[Compression]byte{
+	Snappy:  codecSnappy,
+	Deflate: codecDeflate,
+}
+
+// ParseCompression returns the Compression with the name, an empty name is no compression
+func ParseCompression(name string) (Compression, error) {
+	switch c := Compression(strings.ToLower(name)); c {
+	case "", NoCompression:
+		return NoCompression, nil
+	case Snappy, Deflate:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unrecognized blockstore compression %q", name)
+	}
+}
+
+// Compress encodes the block data for storage with the compression
+// data is returned as is if compressing it doesn't make it smaller
+func Compress(c Compression, data []byte) ([]byte, error) {
+	framed := isFramed(data)
+	codec, ok := codecs[c]
+	if !ok || (len(data) < minCompressSize && !framed) {
+		if framed {
+			return frame(codecStored, data, data), nil
+		}
+		return data, nil
+	}
+	var compressed []byte
+	switch codec {
+	case codecSnappy:
+		compressed = snappy.Encode(nil, data)
+	case codecDeflate:
+		buf := new(bytes.Buffer)
+		w, err := flate.NewWriter(buf, flate.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		compressed = buf.Bytes()
+	}
+	if frameHeaderLen+len(compressed) >= len(data) {
+		if framed {
+			return frame(codecStored, data, data), nil
+		}
+		return data, nil
+	}
+	return frame(codec, data, compressed), nil
+}
+
+// Decompress decodes block data as it was stored by Compress
+func Decompress(stored []byte) ([]byte, error) {
+	if !isFramed(stored) {
+		return stored, nil
+	}
+	codec := stored[len(compressedMagic)]
+	size := binary.BigEndian.Uint32(stored[len(compressedMagic)+1 : frameHeaderLen])
+	payload := stored[frameHeaderLen:]
+	var data []byte
+	var err error
+	switch codec {
+	case codecStored:
+		data = payload
+	case codecSnappy:
+		data, err = snappy.Decode(nil, payload)
+	case codecDeflate:
+		r := flate.NewReader(bytes.NewReader(payload))
+		data, err = ioutil.ReadAll(r)
+		r.Close()
+	default:
+		return nil, fmt.Errorf("unrecognized block compression codec %d", codec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if uint32(len(data)) != size {
+		return nil, fmt.Errorf("decompressed block is %d bytes, expected %d", len(data), size)
+	}
+	return data, nil
+}
+
+// compressedWith returns the codec the stored data is compressed with, and whether it is compressed at all
+func compressedWith(stored []byte) (byte, bool) {
+	if !isFramed(stored) || stored[len(compressedMagic)] == codecStored {
+		return 0, false
+	}
+	return stored[len(compressedMagic)], true
+}
+
+func isFramed(data []byte) bool {
+	return len(data) >= frameHeaderLen && bytes.Equal(data[:len(compressedMagic)], compressedMagic)
+}
+
+func frame(codec byte, data, payload []byte) []byte {
+	framed := make([]byte, frameHeaderLen, frameHeaderLen+len(payload))
+	copy(framed, compressedMagic)
+	framed[len(compressedMagic)] = codec
+	binary.BigEndian.PutUint32(framed[len(compressedMagic)+1:], uint32(len(data)))
+	return append(framed, payload...)
+}
+
+// Data is block data as read from public.blocks, it is decompressed as it is scanned
+type Data []byte
+
+// Scan satisfies the sql.Scanner interface
+func (d *Data) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case []byte:
+		data, err := Decompress(v)
+		if err != nil {
+			return err
+		}
+		// the driver may reuse src once Scan returns
+		*d = append(Data(nil), data...)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into blockstore.Data", src)
+	}
+}
@@ -0,0 +1,150 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockstore_test
+
+import (
+	"bytes"
+	"crypto/rand"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+var _ = Describe("Compression", func() {
+	compressible := bytes.Repeat([]byte("state-heavy rlp "), 64)
+	magicPrefixed := append([]byte{0xfe, 'I', 'P', 'Z', 0x01, 0, 0, 0, 3}, 'a', 'b', 'c')
+
+	for _, c := range []blockstore.Compression{blockstore.Snappy, blockstore.Deflate} {
+		c := c
+		It("Round trips compressible data with "+string(c), func() {
+			stored, err := blockstore.Compress(c, compressible)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(stored)).To(BeNumerically("<", len(compressible)))
+			data, err := blockstore.Decompress(stored)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(compressible))
+		})
+	}
+
+	It("Stores small and incompressible data as is", func() {
+		stored, err := blockstore.Compress(blockstore.Deflate, []byte("small"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stored).To(Equal([]byte("small")))
+		random := make([]byte, 1024)
+		_, err = rand.Read(random)
+		Expect(err).ToNot(HaveOccurred())
+		stored, err = blockstore.Compress(blockstore.Snappy, random)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stored).To(Equal(random))
+		data, err := blockstore.Decompress(random)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal(random))
+	})
+
+	It("Frames data which starts with the compression marker even when compression is off", func() {
+		stored, err := blockstore.Compress(blockstore.NoCompression, magicPrefixed)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stored).ToNot(Equal(magicPrefixed))
+		data, err := blockstore.Decompress(stored)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal(magicPrefixed))
+	})
+
+	It("Decompresses data as it is scanned", func() {
+		stored, err := blockstore.Compress(blockstore.Snappy, compressible)
+		Expect(err).ToNot(HaveOccurred())
+		var data blockstore.Data
+		Expect(data.Scan(stored)).To(Succeed())
+		Expect([]byte(data)).To(Equal(compressible))
+		Expect(data.Scan(nil)).To(Succeed())
+		Expect(data).To(BeNil())
+	})
+
+	It("Parses compression names", func() {
+		c, err := blockstore.ParseCompression("")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(Equal(blockstore.NoCompression))
+		c, err = blockstore.ParseCompression("Snappy")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(Equal(blockstore.Snappy))
+		_, err = blockstore.ParseCompression("zip")
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("Recompress", func() {
+		var db *postgres.DB
+		key := mockBlock(compressible).Key
+		BeforeEach(func() {
+			var err error
+			db = nil
+			db, err = shared.SetupDB()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = db.Exec(`DELETE FROM public.blocks`)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		AfterEach(func() {
+			if db != nil {
+				db.Exec(`DELETE FROM public.blocks`)
+			}
+		})
+
+		It("Compresses existing blocks, reports the space saved, and decompresses them again", func() {
+			Expect(blockstore.NewPostgresBlockstore(db.DB).Put([]blockstore.Block{{Key: key, Data: compressible}})).To(Succeed())
+			before, after, err := blockstore.Recompress(db.DB, blockstore.Deflate, 10)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(after.Blocks).To(Equal(uint64(1)))
+			Expect(after.Compressed).To(Equal(uint64(1)))
+			Expect(after.StoredBytes).To(BeNumerically("<", before.StoredBytes))
+
+			stats, err := blockstore.GetCompressionStats(db.DB)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats.Blocks).To(Equal(uint64(1)))
+			Expect(stats.Compressed).To(Equal(uint64(1)))
+			Expect(stats.RawBytes).To(Equal(uint64(len(compressible))))
+			Expect(stats.Saved()).To(BeNumerically(">", 0))
+
+			data, err := blockstore.NewPostgresBlockstore(db.DB).Get(key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(compressible))
+
+			_, after, err = blockstore.Recompress(db.DB, blockstore.Deflate, 10)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(after.Blocks).To(BeZero())
+
+			_, _, err = blockstore.Recompress(db.DB, blockstore.NoCompression, 10)
+			Expect(err).ToNot(HaveOccurred())
+			var stored []byte
+			Expect(db.Get(&stored, `SELECT data FROM public.blocks WHERE key = $1`, key)).To(Succeed())
+			Expect(stored).To(Equal(compressible))
+		})
+
+		It("Counts data too short to hold a frame header as uncompressed", func() {
+			short := magicPrefixed[:4]
+			_, err := db.Exec(`INSERT INTO public.blocks (key, data) VALUES ($1, $2)`, mockBlock(short).Key, short)
+			Expect(err).ToNot(HaveOccurred())
+			stats, err := blockstore.GetCompressionStats(db.DB)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats.Blocks).To(Equal(uint64(1)))
+			Expect(stats.Compressed).To(BeZero())
+			Expect(stats.RawBytes).To(Equal(uint64(len(short))))
+		})
+	})
+})
@@ -0,0 +1,80 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockstore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+)
+
+// Env variables
+const (
+	BLOCKSTORE_TYPE        = "BLOCKSTORE_TYPE"
+	BLOCKSTORE_PATH        = "BLOCKSTORE_PATH"
+	BLOCKSTORE_COMPRESSION = "BLOCKSTORE_COMPRESSION"
+)
+
+// Type is the backend the IPLD blocks are stored in
+type Type string
+
+const (
+	Postgres Type = "postgres"
+	FlatFS   Type = "flatfs"
+	LevelDB  Type = "leveldb"
+)
+
+// Config holds the blockstore settings, Type defaults to postgres
+type Config struct {
+	Type        Type
+	Path        string      // Path to the directory of the flatfs and leveldb blockstores
+	Compression Compression // Compression of the block data written to public.blocks, by the postgres blockstore
+}
+
+// Init fills the config from toml parameters and env variables
+func (c *Config) Init() error {
+	viper.BindEnv("blockstore.type", BLOCKSTORE_TYPE)
+	viper.BindEnv("blockstore.path", BLOCKSTORE_PATH)
+	viper.BindEnv("blockstore.compression", BLOCKSTORE_COMPRESSION)
+
+	c.Type = Type(strings.ToLower(viper.GetString("blockstore.type")))
+	if c.Type == "" {
+		c.Type = Postgres
+	}
+	c.Path = viper.GetString("blockstore.path")
+	var err error
+	c.Compression, err = ParseCompression(viper.GetString("blockstore.compression"))
+	return err
+}
+
+// NewBlockstore opens the configured blockstore, db is the database the eth.*_cids index is kept in
+func NewBlockstore(c Config, db *sqlx.DB) (Blockstore, error) {
+	switch c.Type {
+	case Postgres, "":
+		ps := NewPostgresBlockstore(db)
+		ps.SetCompression(c.Compression)
+		return ps, nil
+	case FlatFS:
+		return NewFlatFSBlockstore(c.Path)
+	case LevelDB:
+		return NewLevelDBBlockstore(c.Path)
+	default:
+		return nil, fmt.Errorf("unrecognized blockstore type %q", c.Type)
+	}
+}
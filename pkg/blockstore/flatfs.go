@@ -0,0 +1,148 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const flatFSExtension = ".data"
+
+// FlatFSBlockstore is a Blockstore which writes every block to its own file, sharded into directories by
+// the next-to-last two characters of the key in the same way as the default go-ds-flatfs layout
+type FlatFSBlockstore struct {
+	path string
+}
+
+// NewFlatFSBlockstore returns a FlatFSBlockstore rooted at the directory, creating it if needed
+func NewFlatFSBlockstore(path string) (*FlatFSBlockstore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("flatfs blockstore requires a path")
+	}
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	return &FlatFSBlockstore{path: path}, nil
+}
+
+// Put satisfies the Blockstore interface
+// every file is written to a temporary file, synced and renamed into place, and the shard directories are synced last
+func (fs *FlatFSBlockstore) Put(blocks []Block) error {
+	dirs := make(map[string]bool)
+	for _, block := range blocks {
+		dir, file := fs.filePath(block.Key)
+		if _, err := os.Stat(file); err == nil {
+			continue
+		}
+		if !dirs[dir] {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			dirs[dir] = true
+		}
+		if err := writeFileSync(dir, file, block.Data); err != nil {
+			return err
+		}
+	}
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get satisfies the Blockstore interface
+func (fs *FlatFSBlockstore) Get(key string) ([]byte, error) {
+	_, file := fs.filePath(key)
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Delete satisfies the Blockstore interface, the shard directories are synced once the files are removed
+func (fs *FlatFSBlockstore) Delete(keys []string) error {
+	dirs := make(map[string]bool)
+	for _, key := range keys {
+		dir, file := fs.filePath(key)
+		if err := os.Remove(file); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		dirs[dir] = true
+	}
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close satisfies the Blockstore interface
+func (fs *FlatFSBlockstore) Close() error {
+	return nil
+}
+
+// filePath returns the shard directory and the file path of the key
+func (fs *FlatFSBlockstore) filePath(key string) (string, string) {
+	name := dsKey(key)
+	shard := "_"
+	if len(name) >= 3 {
+		shard = name[len(name)-3 : len(name)-1]
+	}
+	dir := filepath.Join(fs.path, shard)
+	return dir, filepath.Join(dir, name+flatFSExtension)
+}
+
+func writeFileSync(dir, file string, data []byte) error {
+	tmp, err := ioutil.TempFile(dir, ".put-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,73 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockstore
+
+import (
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// LevelDBBlockstore is a Blockstore backed by a leveldb database
+type LevelDBBlockstore struct {
+	db *leveldb.DB
+}
+
+// NewLevelDBBlockstore opens, or creates, the leveldb database at the path
+func NewLevelDBBlockstore(path string) (*LevelDBBlockstore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("leveldb blockstore requires a path")
+	}
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &LevelDBBlockstore{db: db}, nil
+}
+
+// Put satisfies the Blockstore interface, the blocks are written in a single synced batch
+func (ls *LevelDBBlockstore) Put(blocks []Block) error {
+	batch := new(leveldb.Batch)
+	for _, block := range blocks {
+		batch.Put([]byte(block.Key), block.Data)
+	}
+	return ls.db.Write(batch, &opt.WriteOptions{Sync: true})
+}
+
+// Get satisfies the Blockstore interface
+func (ls *LevelDBBlockstore) Get(key string) ([]byte, error) {
+	data, err := ls.db.Get([]byte(key), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Delete satisfies the Blockstore interface, the keys are deleted in a single synced batch
+func (ls *LevelDBBlockstore) Delete(keys []string) error {
+	batch := new(leveldb.Batch)
+	for _, key := range keys {
+		batch.Delete([]byte(key))
+	}
+	return ls.db.Write(batch, &opt.WriteOptions{Sync: true})
+}
+
+// Close satisfies the Blockstore interface
+func (ls *LevelDBBlockstore) Close() error {
+	return ls.db.Close()
+}
@@ -0,0 +1,93 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockstore
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// PostgresBlockstore is the default Blockstore, backed by the public.blocks table
+// Blocks published with a Tx are written by the tx itself rather than through Put
+type PostgresBlockstore struct {
+	db *sqlx.DB
+	// compression applied to block data as it is written, data is decompressed on read regardless
+	compression Compression
+}
+
+// NewPostgresBlockstore returns a new PostgresBlockstore
+func NewPostgresBlockstore(db *sqlx.DB) *PostgresBlockstore {
+	return &PostgresBlockstore{db: db}
+}
+
+// SetCompression sets the compression block data is written with, by default it is written uncompressed
+func (ps *PostgresBlockstore) SetCompression(c Compression) {
+	ps.compression = c
+}
+
+// Put satisfies the Blockstore interface
+func (ps *PostgresBlockstore) Put(blocks []Block) error {
+	tx, err := ps.db.Beginx()
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if err := putPostgres(tx, ps.compression, block.Key, block.Data); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Get satisfies the Blockstore interface
+// rows recording the key of a block held in another blockstore have no data, and are treated as missing
+func (ps *PostgresBlockstore) Get(key string) ([]byte, error) {
+	var data Data
+	if err := ps.db.Get(&data, `SELECT data FROM public.blocks WHERE key = $1 AND data IS NOT NULL`, key); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// Delete satisfies the Blockstore interface
+// deleting a public.blocks row cascades to the eth.*_cids rows which reference it
+func (ps *PostgresBlockstore) Delete(keys []string) error {
+	_, err := ps.db.Exec(`DELETE FROM public.blocks WHERE key = ANY($1)`, pq.Array(keys))
+	return err
+}
+
+// Close satisfies the Blockstore interface, the db is owned by the caller and is left open
+func (ps *PostgresBlockstore) Close() error {
+	return nil
+}
+
+// putPostgres writes the block with the tx, filling in the data of a row that only recorded its key
+func putPostgres(tx *sqlx.Tx, c Compression, key string, data []byte) error {
+	stored, err := Compress(c, data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO public.blocks (key, data) VALUES ($1, $2)
+			ON CONFLICT (key) DO UPDATE SET data = EXCLUDED.data WHERE blocks.data IS NULL`, key, stored)
+	return err
+}
@@ -0,0 +1,123 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockstore
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// CompressionStats summarizes the space taken up by the block data in public.blocks
+type CompressionStats struct {
+	Blocks      uint64 `db:"blocks"`       // number of blocks with data in public.blocks
+	Compressed  uint64 `db:"compressed"`   // number of those which are stored compressed
+	StoredBytes uint64 `db:"stored_bytes"` // size of the data as stored
+	RawBytes    uint64 `db:"raw_bytes"`    // size of the data uncompressed
+}
+
+// Saved returns the number of bytes saved by compression
+func (s CompressionStats) Saved() int64 {
+	return int64(s.RawBytes) - int64(s.StoredBytes)
+}
+
+// the uncompressed length of a compressed block is read out of its frame header,
+// which is only read out of data long enough to hold one, as in isFramed
+var compressionStatsPgStr = fmt.Sprintf(`SELECT COUNT(*) AS blocks,
+			COUNT(*) FILTER (WHERE CASE WHEN octet_length(data) >= %[1]d AND substring(data FROM 1 FOR 4) = $1
+				THEN get_byte(data, 4) <> 0
+				ELSE false END) AS compressed,
+			COALESCE(SUM(octet_length(data)), 0) AS stored_bytes,
+			COALESCE(SUM(CASE WHEN octet_length(data) >= %[1]d AND substring(data FROM 1 FOR 4) = $1
+				THEN ('x' || encode(substring(data FROM 6 FOR 4), 'hex'))::BIT(32)::BIGINT
+				ELSE octet_length(data) END), 0) AS raw_bytes
+			FROM public.blocks
+			WHERE data IS NOT NULL`, frameHeaderLen)
+
+// GetCompressionStats scans public.blocks for the space taken up by its block data
+func GetCompressionStats(db *sqlx.DB) (CompressionStats, error) {
+	var stats CompressionStats
+	return stats, db.Get(&stats, compressionStatsPgStr, compressedMagic)
+}
+
+// Recompress rewrites the data of every block in public.blocks with the compression, batchSize blocks per db tx
+// Blocks already stored with the compression are left alone, so it can be rerun to pick up where it left off,
+// and with NoCompression it decompresses every block.
+// It returns the stats of the blocks it rewrote, before and after.
+func Recompress(db *sqlx.DB, c Compression, batchSize uint64) (before, after CompressionStats, err error) {
+	target, compress := codecs[c]
+	lastKey := ""
+	for {
+		var rows []struct {
+			Key  string `db:"key"`
+			Data []byte `db:"data"`
+		}
+		if err := db.Select(&rows, `SELECT key, data FROM public.blocks
+				WHERE key > $1 AND data IS NOT NULL
+				ORDER BY key LIMIT $2`, lastKey, batchSize); err != nil {
+			return before, after, err
+		}
+		if len(rows) == 0 {
+			return before, after, nil
+		}
+		tx, err := db.Beginx()
+		if err != nil {
+			return before, after, err
+		}
+		for _, row := range rows {
+			lastKey = row.Key
+			codec, compressed := compressedWith(row.Data)
+			if compressed == compress && (!compress || codec == target) {
+				continue
+			}
+			data, err := Decompress(row.Data)
+			if err != nil {
+				tx.Rollback()
+				return before, after, err
+			}
+			stored, err := Compress(c, data)
+			if err != nil {
+				tx.Rollback()
+				return before, after, err
+			}
+			if bytes.Equal(stored, row.Data) {
+				continue
+			}
+			if _, err := tx.Exec(`UPDATE public.blocks SET data = $2 WHERE key = $1`, row.Key, stored); err != nil {
+				tx.Rollback()
+				return before, after, err
+			}
+			before.add(row.Data, data)
+			after.add(stored, data)
+		}
+		if err := tx.Commit(); err != nil {
+			return before, after, err
+		}
+		logrus.Infof("recompressed blocks up to key %s: %d bytes rewritten to %d bytes", lastKey, before.StoredBytes, after.StoredBytes)
+	}
+}
+
+func (s *CompressionStats) add(stored, raw []byte) {
+	s.Blocks++
+	if _, ok := compressedWith(stored); ok {
+		s.Compressed++
+	}
+	s.StoredBytes += uint64(len(stored))
+	s.RawBytes += uint64(len(raw))
+}
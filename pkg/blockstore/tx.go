@@ -0,0 +1,87 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockstore
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// Tx is a Postgres tx that IPLD blocks are published with, alongside the index rows referencing them
+// With the Postgres blockstore the blocks are written by the tx itself. With any other blockstore the tx only writes
+// the block keys to public.blocks, with no data, so that the mh_key foreign keys still hold, and the blocks
+// are staged until Commit writes them to the blockstore ahead of committing the Postgres tx.
+// An index row is therefore never committed before its block is durable, and a crash or a failed commit
+// in between leaves only unreferenced blocks behind in the blockstore, which are rewritten as is when the data is reindexed.
+type Tx struct {
+	*sqlx.Tx
+	external    Blockstore
+	compression Compression
+	staged      []Block
+}
+
+// Begin begins a new Tx on the db, publishing blocks to the store
+func Begin(db *sqlx.DB, store Blockstore) (*Tx, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	return NewTx(tx, store), nil
+}
+
+// NewTx wraps an existing Postgres tx to publish blocks to the store
+func NewTx(tx *sqlx.Tx, store Blockstore) *Tx {
+	bt := &Tx{Tx: tx}
+	switch s := store.(type) {
+	case nil:
+	case *PostgresBlockstore:
+		bt.compression = s.compression
+	default:
+		bt.external = store
+	}
+	return bt
+}
+
+// Put publishes the block with the tx
+func (tx *Tx) Put(key string, data []byte) error {
+	if tx.external == nil {
+		return putPostgres(tx.Tx, tx.compression, key, data)
+	}
+	if _, err := tx.Exec(`INSERT INTO public.blocks (key, data) VALUES ($1, NULL) ON CONFLICT (key) DO NOTHING`, key); err != nil {
+		return err
+	}
+	tx.staged = append(tx.staged, Block{Key: key, Data: data})
+	return nil
+}
+
+// Commit writes the staged blocks to the blockstore and then commits the Postgres tx
+// the Postgres tx is rolled back if the blocks cannot be written
+func (tx *Tx) Commit() error {
+	if len(tx.staged) > 0 {
+		if err := tx.external.Put(tx.staged); err != nil {
+			tx.Tx.Rollback()
+			return err
+		}
+		tx.staged = nil
+	}
+	return tx.Tx.Commit()
+}
+
+// Rollback discards the staged blocks and rolls back the Postgres tx
+func (tx *Tx) Rollback() error {
+	tx.staged = nil
+	return tx.Tx.Rollback()
+}
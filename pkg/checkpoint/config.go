@@ -0,0 +1,95 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package checkpoint
+
+import (
+	"errors"
+
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+	"github.com/vulcanize/ipld-eth-indexer/utils"
+)
+
+// Env variables
+const (
+	CHECKPOINT_BLOCK_HEIGHT = "CHECKPOINT_BLOCK_HEIGHT"
+	CHECKPOINT_FILE_PATH    = "CHECKPOINT_FILE_PATH"
+	CHECKPOINT_BATCH_SIZE   = "CHECKPOINT_BATCH_SIZE"
+
+	CHECKPOINT_MAX_IDLE_CONNECTIONS = "CHECKPOINT_MAX_IDLE_CONNECTIONS"
+	CHECKPOINT_MAX_OPEN_CONNECTIONS = "CHECKPOINT_MAX_OPEN_CONNECTIONS"
+	CHECKPOINT_MAX_CONN_LIFETIME    = "CHECKPOINT_MAX_CONN_LIFETIME"
+)
+
+// Config holds the parameters needed to create or import a checkpoint
+type Config struct {
+	BlockHeight uint64 // Block height to create the checkpoint at, unused on import
+	FilePath    string // Path to the checkpoint archive
+	BatchSize   uint64 // Number of blocks or nodes to insert per db transaction on import
+
+	// DB info
+	DB               *postgres.DB
+	DBConfig         postgres.Config
+	Blockstore       blockstore.Blockstore
+	BlockstoreConfig blockstore.Config
+
+	NodeInfo node.Info
+}
+
+// NewConfig fills and returns a checkpoint config from toml parameters
+func NewConfig() (*Config, error) {
+	c := new(Config)
+	var err error
+
+	viper.BindEnv("checkpoint.blockHeight", CHECKPOINT_BLOCK_HEIGHT)
+	viper.BindEnv("checkpoint.filePath", CHECKPOINT_FILE_PATH)
+	viper.BindEnv("checkpoint.batchSize", CHECKPOINT_BATCH_SIZE)
+
+	c.BlockHeight = uint64(viper.GetInt64("checkpoint.blockHeight"))
+	c.FilePath = viper.GetString("checkpoint.filePath")
+	if c.FilePath == "" {
+		return nil, errors.New("checkpoint requires a file path")
+	}
+	c.BatchSize = uint64(viper.GetInt64("checkpoint.batchSize"))
+	c.NodeInfo = shared.GetEthNodeInfo()
+
+	c.DBConfig.Init()
+	overrideDBConnConfig(&c.DBConfig)
+	db := utils.LoadMigratedPostgres(c.DBConfig, c.NodeInfo, true)
+	c.DB = &db
+	if err := c.BlockstoreConfig.Init(); err != nil {
+		return nil, err
+	}
+	c.Blockstore, err = blockstore.NewBlockstore(c.BlockstoreConfig, c.DB.DB)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func overrideDBConnConfig(con *postgres.Config) {
+	viper.BindEnv("database.checkpoint.maxIdle", CHECKPOINT_MAX_IDLE_CONNECTIONS)
+	viper.BindEnv("database.checkpoint.maxOpen", CHECKPOINT_MAX_OPEN_CONNECTIONS)
+	viper.BindEnv("database.checkpoint.maxLifetime", CHECKPOINT_MAX_CONN_LIFETIME)
+	con.MaxIdle = viper.GetInt("database.checkpoint.maxIdle")
+	con.MaxOpen = viper.GetInt("database.checkpoint.maxOpen")
+	con.MaxLifetime = viper.GetInt("database.checkpoint.maxLifetime")
+}
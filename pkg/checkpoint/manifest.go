@@ -0,0 +1,77 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/ipfs/ipld"
+)
+
+// ManifestVersion is the version of the manifest format written by this binary
+const ManifestVersion = 1
+
+// Manifest describes the checkpoint held in an archive
+// It is encoded as json in a raw block which is the archive's root and first block
+type Manifest struct {
+	Version         uint64   `json:"version"`
+	SchemaVersion   int64    `json:"schemaVersion"` // Schema version of the database the checkpoint was created from
+	ChainID         uint64   `json:"chainID"`
+	NetworkID       string   `json:"networkID"`
+	GenesisBlock    string   `json:"genesisBlock"`
+	BlockNumber     uint64   `json:"blockNumber"`
+	BlockHash       string   `json:"blockHash"`
+	StateRoot       string   `json:"stateRoot"`
+	TotalDifficulty string   `json:"totalDifficulty"`
+	Uncles          []string `json:"uncles"` // Hashes of the block's uncles, in the order they are included in the block
+}
+
+// Encode returns the manifest's raw block and its cid
+func (m *Manifest) Encode() (cid.Cid, []byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return cid.Cid{}, nil, err
+	}
+	c, err := ipld.RawdataToCid(ipld.RawBinary, data, multihash.SHA2_256)
+	if err != nil {
+		return cid.Cid{}, nil, err
+	}
+	return c, data, nil
+}
+
+// DecodeManifest decodes the manifest held in the raw block with the provided cid
+func DecodeManifest(c cid.Cid, data []byte) (*Manifest, error) {
+	if c.Type() != ipld.RawBinary {
+		return nil, fmt.Errorf("checkpoint manifest %s is not a raw block", c.String())
+	}
+	derived, err := c.Prefix().Sum(data)
+	if err != nil {
+		return nil, err
+	}
+	if !derived.Equals(c) {
+		return nil, fmt.Errorf("checkpoint manifest does not match cid %s", c.String())
+	}
+	m := new(Manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("error decoding checkpoint manifest: %v", err)
+	}
+	return m, nil
+}
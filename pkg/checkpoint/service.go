@@ -0,0 +1,412 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package checkpoint
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/importer"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/ipfs/car"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/ipfs/ipld"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/migrations"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/snapshot"
+)
+
+// DefaultBatchSize is the default number of blocks or nodes inserted per db transaction on import
+const DefaultBatchSize uint64 = 10000
+
+// Checkpointer is the top level interface for creating and importing checkpoints
+type Checkpointer interface {
+	Create() error
+	Import() error
+}
+
+// Service for creating checkpoint archives of the indexed state at a height, and bootstrapping a database from them
+// An archive holds a manifest describing the checkpoint, followed by the IPLDs of the header, its uncles, its transaction
+// and receipt tries, and its complete state trie with every storage trie and contract code it references
+type Service struct {
+	// DB the checkpoint is created from, or imported into
+	DB *postgres.DB
+	// Blockstore the checkpoint IPLDs are read from, or loaded into
+	Blockstore blockstore.Blockstore
+	// Block height to create the checkpoint at
+	height uint64
+	// Path to the checkpoint archive
+	filePath string
+	// Number of blocks or nodes to insert per db transaction on import
+	batchSize uint64
+}
+
+// NewCheckpointService returns a new checkpoint service
+func NewCheckpointService(settings *Config) Checkpointer {
+	batchSize := settings.BatchSize
+	if batchSize == 0 {
+		batchSize = DefaultBatchSize
+	}
+	return &Service{
+		DB:         settings.DB,
+		Blockstore: settings.Blockstore,
+		height:     settings.BlockHeight,
+		filePath:   settings.FilePath,
+		batchSize:  batchSize,
+	}
+}
+
+type checkpointHeader struct {
+	ID           int64  `db:"id"`
+	BlockHash    string `db:"block_hash"`
+	MhKey        string `db:"mh_key"`
+	TD           string `db:"td"`
+	NetworkID    string `db:"network_id"`
+	GenesisBlock string `db:"genesis_block"`
+}
+
+// Create writes a checkpoint of the canonical block indexed at the configured height to the archive
+func (s *Service) Create() error {
+	var h checkpointHeader
+	pgStr := `SELECT header_cids.id, block_hash, mh_key, td, COALESCE(network_id, '') AS network_id, COALESCE(genesis_block, '') AS genesis_block
+			FROM eth.header_cids
+			INNER JOIN nodes ON (header_cids.node_id = nodes.id)
+			WHERE header_cids.id = canonical_header_id($1, $2)`
+	if err := s.DB.Get(&h, pgStr, s.DB.Node.ChainID, s.height); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no canonical header is indexed at height %d", s.height)
+		}
+		return err
+	}
+	rawHeader, err := s.Blockstore.Get(h.MhKey)
+	if err != nil {
+		return fmt.Errorf("error fetching header %s: %v", h.BlockHash, err)
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(rawHeader, header); err != nil {
+		return fmt.Errorf("error decoding header %s: %v", h.BlockHash, err)
+	}
+	uncles, rawUncles, err := s.uncles(h.ID, header)
+	if err != nil {
+		return err
+	}
+	migrator, err := migrations.NewMigrator(s.DB.DB)
+	if err != nil {
+		return err
+	}
+	schemaVersion, err := migrator.Version()
+	if err != nil {
+		return err
+	}
+	manifest := &Manifest{
+		Version:         ManifestVersion,
+		SchemaVersion:   schemaVersion,
+		ChainID:         s.DB.Node.ChainID,
+		NetworkID:       h.NetworkID,
+		GenesisBlock:    h.GenesisBlock,
+		BlockNumber:     header.Number.Uint64(),
+		BlockHash:       header.Hash().Hex(),
+		StateRoot:       header.Root.Hex(),
+		TotalDifficulty: h.TD,
+		Uncles:          make([]string, len(uncles)),
+	}
+	for i, uncle := range uncles {
+		manifest.Uncles[i] = uncle.Hash().Hex()
+	}
+	manifestCID, manifestData, err := manifest.Encode()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(s.filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writer, err := car.NewWriter(f, []cid.Cid{manifestCID})
+	if err != nil {
+		return err
+	}
+	if err := writer.Put(manifestCID, manifestData); err != nil {
+		return err
+	}
+	aw := &archiveWriter{
+		writer:       writer,
+		blocks:       importer.NewBlockstoreSource(s.Blockstore),
+		storageRoots: make(map[common.Hash]bool),
+		codeHashes:   make(map[common.Hash]bool),
+	}
+	if err := aw.put(ipld.MEthHeader, rawHeader); err != nil {
+		return err
+	}
+	for _, raw := range rawUncles {
+		if err := aw.put(ipld.MEthHeader, raw); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("writing checkpoint of block %d with hash %s to %s", manifest.BlockNumber, manifest.BlockHash, s.filePath)
+	if err := aw.putTrie(ipld.MEthTxTrie, header.TxHash); err != nil {
+		return fmt.Errorf("error writing transaction trie: %v", err)
+	}
+	if err := aw.putTrie(ipld.MEthTxReceiptTrie, header.ReceiptHash); err != nil {
+		return fmt.Errorf("error writing receipt trie: %v", err)
+	}
+	if err := aw.putState(header.Root); err != nil {
+		return fmt.Errorf("error writing state trie: %v", err)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	logrus.Infof("finished checkpoint at height %d: wrote %d blocks", manifest.BlockNumber, aw.count)
+	return nil
+}
+
+// uncles returns the uncles indexed for the header, in block order, and their rlp
+func (s *Service) uncles(headerID int64, header *types.Header) ([]*types.Header, [][]byte, error) {
+	var mhKeys []string
+	if err := s.DB.Select(&mhKeys, `SELECT mh_key FROM eth.uncle_cids WHERE header_id = $1`, headerID); err != nil {
+		return nil, nil, err
+	}
+	uncles := make([]*types.Header, len(mhKeys))
+	rawByHash := make(map[common.Hash][]byte, len(mhKeys))
+	for i, mhKey := range mhKeys {
+		raw, err := s.Blockstore.Get(mhKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error fetching uncle %s: %v", mhKey, err)
+		}
+		uncles[i] = new(types.Header)
+		if err := rlp.DecodeBytes(raw, uncles[i]); err != nil {
+			return nil, nil, fmt.Errorf("error decoding uncle %s: %v", mhKey, err)
+		}
+		rawByHash[uncles[i].Hash()] = raw
+	}
+	ordered, err := orderUncles(header, uncles)
+	if err != nil {
+		return nil, nil, err
+	}
+	raws := make([][]byte, len(ordered))
+	for i, uncle := range ordered {
+		raws[i] = rawByHash[uncle.Hash()]
+	}
+	return ordered, raws, nil
+}
+
+// archiveWriter copies the tries of a checkpoint out of the blockstore into an archive
+type archiveWriter struct {
+	writer *car.Writer
+	blocks importer.BlockSource
+	// storage tries and contract code shared by several accounts are only written once
+	storageRoots map[common.Hash]bool
+	codeHashes   map[common.Hash]bool
+
+	count uint64
+}
+
+func (aw *archiveWriter) put(codec uint64, raw []byte) error {
+	c, err := ipld.RawdataToCid(codec, raw, multihash.KECCAK_256)
+	if err != nil {
+		return err
+	}
+	if err := aw.writer.Put(c, raw); err != nil {
+		return err
+	}
+	aw.count++
+	if aw.count%100000 == 0 {
+		logrus.Infof("checkpoint progress: wrote %d blocks", aw.count)
+	}
+	return nil
+}
+
+// putTrie writes every hashed node of the trie with the provided root
+func (aw *archiveWriter) putTrie(codec uint64, root common.Hash) error {
+	return walkTrie(aw.blocks, root, nil, func(path, raw []byte, n *eth.DecodedTrieNode) error {
+		return aw.put(codec, raw)
+	})
+}
+
+// putState writes every hashed node of the state trie with the provided root, and the storage tries and code of its accounts
+func (aw *archiveWriter) putState(root common.Hash) error {
+	return walkTrie(aw.blocks, root, nil, func(path, raw []byte, n *eth.DecodedTrieNode) error {
+		if err := aw.put(ipld.MEthStateTrie, raw); err != nil {
+			return err
+		}
+		if n.NodeType != sdtypes.Leaf {
+			return nil
+		}
+		account := new(state.Account)
+		if err := rlp.DecodeBytes(n.Value, account); err != nil {
+			return fmt.Errorf("error decoding account at path %x: %v", path, err)
+		}
+		if !aw.storageRoots[account.Root] {
+			if err := aw.putTrie(ipld.MEthStorageTrie, account.Root); err != nil {
+				return err
+			}
+			aw.storageRoots[account.Root] = true
+		}
+		codeHash := common.BytesToHash(account.CodeHash)
+		if codeHash == emptyCodeHash || aw.codeHashes[codeHash] {
+			return nil
+		}
+		code, err := aw.blocks.Get(codeHash)
+		if err != nil {
+			return fmt.Errorf("error fetching code %s: %v", codeHash.Hex(), err)
+		}
+		// the code is keyed by its keccak256 hash, as it is when published by the indexer
+		if err := aw.put(ipld.RawBinary, code); err != nil {
+			return err
+		}
+		aw.codeHashes[codeHash] = true
+		return nil
+	})
+}
+
+// Import loads a checkpoint archive into the blockstore and indexes its block and complete state
+// The checkpoint is then recorded as the start of the chain's indexed history, so that backfill doesn't look for gaps below it
+func (s *Service) Import() error {
+	f, err := os.Open(s.filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader, err := car.NewReader(f)
+	if err != nil {
+		return err
+	}
+	if len(reader.Header.Roots) != 1 {
+		return fmt.Errorf("checkpoint archive has %d roots, expected its manifest", len(reader.Header.Roots))
+	}
+	c, data, err := reader.Next()
+	if err != nil {
+		return fmt.Errorf("error reading checkpoint manifest: %v", err)
+	}
+	if !c.Equals(reader.Header.Roots[0]) {
+		return fmt.Errorf("checkpoint archive does not start with its manifest %s", reader.Header.Roots[0].String())
+	}
+	manifest, err := DecodeManifest(c, data)
+	if err != nil {
+		return err
+	}
+	if err := s.checkManifest(manifest); err != nil {
+		return err
+	}
+	logrus.Infof("importing checkpoint of block %d with hash %s from %s", manifest.BlockNumber, manifest.BlockHash, s.filePath)
+	if err := s.load(reader); err != nil {
+		return err
+	}
+	snapshotter, err := snapshot.NewService(s.DB, s.Blockstore, NewSource(manifest, importer.NewBlockstoreSource(s.Blockstore)), manifest.BlockNumber, s.batchSize)
+	if err != nil {
+		return err
+	}
+	if err := snapshotter.Snapshot(); err != nil {
+		return err
+	}
+	pgStr := `INSERT INTO eth.checkpoints (chain_id, block_number, block_hash, state_root, schema_version, node_id) VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (chain_id, block_number) DO UPDATE SET (block_hash, state_root, schema_version, node_id, imported_at) = ($3, $4, $5, $6, now())`
+	_, err = s.DB.Exec(pgStr, s.DB.Node.ChainID, manifest.BlockNumber, manifest.BlockHash, manifest.StateRoot, manifest.SchemaVersion, s.DB.NodeID)
+	return err
+}
+
+// checkManifest returns an error if the checkpoint can't be imported into the database
+func (s *Service) checkManifest(manifest *Manifest) error {
+	if manifest.Version != ManifestVersion {
+		return fmt.Errorf("unsupported checkpoint manifest version %d", manifest.Version)
+	}
+	if manifest.ChainID != s.DB.Node.ChainID {
+		return fmt.Errorf("checkpoint is of chain %d but the indexer is configured for chain %d", manifest.ChainID, s.DB.Node.ChainID)
+	}
+	if manifest.GenesisBlock != "" && s.DB.Node.GenesisBlock != "" && manifest.GenesisBlock != s.DB.Node.GenesisBlock {
+		return fmt.Errorf("checkpoint has genesis block %s but the indexer is configured for genesis block %s", manifest.GenesisBlock, s.DB.Node.GenesisBlock)
+	}
+	latest, err := migrations.LatestVersion()
+	if err != nil {
+		return err
+	}
+	if manifest.SchemaVersion > latest {
+		return fmt.Errorf("checkpoint was created at schema version %d which is newer than the version %d this binary supports", manifest.SchemaVersion, latest)
+	}
+	return nil
+}
+
+// load verifies and inserts every remaining block in the archive
+func (s *Service) load(reader *car.Reader) error {
+	var count uint64
+	for {
+		loaded, err := s.loadBatch(reader)
+		if err != nil {
+			return err
+		}
+		count += loaded
+		logrus.Infof("loaded %d blocks", count)
+		if loaded < s.batchSize {
+			return nil
+		}
+	}
+}
+
+// loadBatch verifies and inserts up to batchSize blocks of the archive in a single transaction
+// it returns the number of blocks loaded, which is less than batchSize once the end of the archive is reached
+func (s *Service) loadBatch(reader *car.Reader) (count uint64, err error) {
+	tx, err := blockstore.Begin(s.DB.DB, s.Blockstore)
+	if err != nil {
+		return 0, err
+	}
+	// defer to handle transaction commit or rollback for any return case
+	defer func() {
+		if p := recover(); p != nil {
+			shared.Rollback(tx.Tx)
+			panic(p)
+		} else if err != nil {
+			shared.Rollback(tx.Tx)
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	for count < s.batchSize {
+		c, data, nextErr := reader.Next()
+		if nextErr == io.EOF {
+			return count, nil
+		}
+		if nextErr != nil {
+			return count, nextErr
+		}
+		// verify the cid against the data before it is written anywhere
+		derived, err := c.Prefix().Sum(data)
+		if err != nil {
+			return count, err
+		}
+		if !derived.Equals(c) {
+			return count, fmt.Errorf("block data does not match cid %s", c.String())
+		}
+		if err := shared.PublishDirect(tx, shared.MultihashKeyFromCID(c), data); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,196 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package checkpoint
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/statediff"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/importer"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/snapshot"
+)
+
+var emptyCodeHash = crypto.Keccak256Hash(nil)
+
+// Source satisfies the snapshot.Source interface by reading the block and state of a checkpoint back out of a BlockSource
+// the checkpoint archive has been loaded into
+type Source struct {
+	manifest *Manifest
+	blocks   importer.BlockSource
+}
+
+// NewSource returns a new Source for the checkpoint described by the manifest
+func NewSource(manifest *Manifest, blocks importer.BlockSource) *Source {
+	return &Source{
+		manifest: manifest,
+		blocks:   blocks,
+	}
+}
+
+// BlockPayload satisfies the snapshot.Source interface
+func (cs *Source) BlockPayload(height uint64) (statediff.Payload, error) {
+	if height != cs.manifest.BlockNumber {
+		return statediff.Payload{}, fmt.Errorf("checkpoint is at height %d, not %d", cs.manifest.BlockNumber, height)
+	}
+	header, err := cs.header(common.HexToHash(cs.manifest.BlockHash))
+	if err != nil {
+		return statediff.Payload{}, err
+	}
+	if header.Root != common.HexToHash(cs.manifest.StateRoot) {
+		return statediff.Payload{}, fmt.Errorf("checkpoint header has state root %s, manifest has %s", header.Root.Hex(), cs.manifest.StateRoot)
+	}
+	uncles := make([]*types.Header, len(cs.manifest.Uncles))
+	for i, hash := range cs.manifest.Uncles {
+		if uncles[i], err = cs.header(common.HexToHash(hash)); err != nil {
+			return statediff.Payload{}, err
+		}
+	}
+	if types.CalcUncleHash(uncles) != header.UncleHash {
+		return statediff.Payload{}, fmt.Errorf("checkpoint uncles do not match the uncle hash of block %s", cs.manifest.BlockHash)
+	}
+	td, ok := new(big.Int).SetString(cs.manifest.TotalDifficulty, 10)
+	if !ok {
+		return statediff.Payload{}, fmt.Errorf("unable to parse total difficulty %s", cs.manifest.TotalDifficulty)
+	}
+	return importer.NewPayloadBuilder(cs.blocks).BuildBlock(header, uncles, td)
+}
+
+// header fetches the header with the provided hash and checks it hashes to it
+func (cs *Source) header(hash common.Hash) (*types.Header, error) {
+	raw, err := cs.blocks.Get(hash)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching header %s: %v", hash.Hex(), err)
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(raw, header); err != nil {
+		return nil, fmt.Errorf("error decoding header %s: %v", hash.Hex(), err)
+	}
+	if header.Hash() != hash {
+		return nil, fmt.Errorf("header %s hashes to %s", hash.Hex(), header.Hash().Hex())
+	}
+	return header, nil
+}
+
+// WalkState satisfies the snapshot.Source interface
+func (cs *Source) WalkState(root common.Hash, handler snapshot.NodeHandler) error {
+	return walkTrie(cs.blocks, root, nil, func(path, raw []byte, n *eth.DecodedTrieNode) error {
+		stateNode := sdtypes.StateNode{
+			NodeType:  n.NodeType,
+			Path:      path,
+			NodeValue: raw,
+		}
+		if n.NodeType != sdtypes.Leaf {
+			return handler.HandleStateNode(stateNode)
+		}
+		stateNode.LeafKey = eth.LeafKey(path, n)
+		if err := handler.HandleStateNode(stateNode); err != nil {
+			return err
+		}
+		account := new(state.Account)
+		if err := rlp.DecodeBytes(n.Value, account); err != nil {
+			return fmt.Errorf("error decoding account at path %x: %v", path, err)
+		}
+		if err := walkTrie(cs.blocks, account.Root, nil, func(path, raw []byte, n *eth.DecodedTrieNode) error {
+			storageNode := sdtypes.StorageNode{
+				NodeType:  n.NodeType,
+				Path:      path,
+				NodeValue: raw,
+			}
+			if n.NodeType == sdtypes.Leaf {
+				storageNode.LeafKey = eth.LeafKey(path, n)
+			}
+			return handler.HandleStorageNode(storageNode)
+		}); err != nil {
+			return err
+		}
+		codeHash := common.BytesToHash(account.CodeHash)
+		if codeHash == emptyCodeHash {
+			return nil
+		}
+		code, err := cs.blocks.Get(codeHash)
+		if err != nil {
+			return fmt.Errorf("error fetching code %s: %v", codeHash.Hex(), err)
+		}
+		return handler.HandleCode(codeHash, code)
+	})
+}
+
+// Close satisfies the snapshot.Source interface
+func (cs *Source) Close() error {
+	return nil
+}
+
+// walkTrie calls f with the path, rlp, and decoded form of every hashed node in the trie with the provided root, in path order
+// Like the statediff builder, nodes embedded in their parent are skipped
+// Unlike the importer, a node missing from the source is an error, as a checkpoint must hold its tries in full
+func walkTrie(blocks importer.BlockSource, root common.Hash, path []byte, f func(path, raw []byte, n *eth.DecodedTrieNode) error) error {
+	if root == (common.Hash{}) || root == types.EmptyRootHash {
+		return nil
+	}
+	raw, err := blocks.Get(root)
+	if err != nil {
+		return fmt.Errorf("error fetching trie node %s: %v", root.Hex(), err)
+	}
+	n, err := eth.DecodeTrieNode(raw)
+	if err != nil {
+		return fmt.Errorf("error decoding trie node %s: %v", root.Hex(), err)
+	}
+	if err := f(path, raw, n); err != nil {
+		return err
+	}
+	switch n.NodeType {
+	case sdtypes.Branch:
+		for i, child := range n.Children {
+			if err := walkTrie(blocks, child.Hash, appendPath(path, byte(i)), f); err != nil {
+				return err
+			}
+		}
+	case sdtypes.Extension:
+		return walkTrie(blocks, n.Children[0].Hash, appendPath(path, n.Key...), f)
+	}
+	return nil
+}
+
+// appendPath returns a new path, leaving the provided path untouched
+func appendPath(path []byte, nibbles ...byte) []byte {
+	p := make([]byte, 0, len(path)+len(nibbles))
+	return append(append(p, path...), nibbles...)
+}
+
+// orderUncles returns the uncles in the order which hashes to the header's uncle hash
+// A block can include at most two uncles
+func orderUncles(header *types.Header, uncles []*types.Header) ([]*types.Header, error) {
+	if types.CalcUncleHash(uncles) == header.UncleHash {
+		return uncles, nil
+	}
+	if len(uncles) == 2 {
+		swapped := []*types.Header{uncles[1], uncles[0]}
+		if types.CalcUncleHash(swapped) == header.UncleHash {
+			return swapped, nil
+		}
+	}
+	return nil, fmt.Errorf("indexed uncles do not match the uncle hash of block %s", header.Hash().Hex())
+}
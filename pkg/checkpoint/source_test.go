@@ -0,0 +1,196 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package checkpoint_test
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/statediff"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/checkpoint"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/importer"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/snapshot"
+)
+
+// chainDBBlocks is a BlockSource serving the headers it holds, and the trie nodes and code of a geth chain database
+type chainDBBlocks struct {
+	sdb     state.Database
+	headers map[common.Hash][]byte
+}
+
+func (cb *chainDBBlocks) Get(hash common.Hash) ([]byte, error) {
+	if raw, ok := cb.headers[hash]; ok {
+		return raw, nil
+	}
+	if raw, err := cb.sdb.TrieDB().Node(hash); err == nil {
+		return raw, nil
+	}
+	code, err := cb.sdb.ContractCode(common.Hash{}, hash)
+	if err != nil {
+		return nil, importer.ErrBlockNotFound
+	}
+	return code, nil
+}
+
+// recordingHandler collects the nodes it is handed, nesting storage nodes under the last state node
+type recordingHandler struct {
+	stateNodes []sdtypes.StateNode
+	codes      map[common.Hash][]byte
+}
+
+func (rh *recordingHandler) HandleStateNode(node sdtypes.StateNode) error {
+	rh.stateNodes = append(rh.stateNodes, node)
+	return nil
+}
+
+func (rh *recordingHandler) HandleStorageNode(node sdtypes.StorageNode) error {
+	last := &rh.stateNodes[len(rh.stateNodes)-1]
+	last.StorageNodes = append(last.StorageNodes, node)
+	return nil
+}
+
+func (rh *recordingHandler) HandleCode(codeHash common.Hash, code []byte) error {
+	rh.codes[codeHash] = code
+	return nil
+}
+
+var _ = Describe("Source", func() {
+	var (
+		genesis  *types.Block
+		chainDB  *snapshot.ChainDBSource
+		manifest *checkpoint.Manifest
+		source   *checkpoint.Source
+		contract = common.HexToAddress("0xaE9BEa628c4Ce503DcFD7E305CaB4e29E7476592")
+		code     = []byte{0x60, 0x01, 0x60, 0x00, 0x55}
+	)
+	BeforeEach(func() {
+		alloc := core.GenesisAlloc{
+			contract: {
+				Balance: big.NewInt(0),
+				Code:    code,
+				Storage: map[common.Hash]common.Hash{},
+			},
+		}
+		for i := int64(1); i <= 30; i++ {
+			alloc[common.BigToAddress(big.NewInt(i))] = core.GenesisAccount{Balance: big.NewInt(i)}
+			alloc[contract].Storage[common.BigToHash(big.NewInt(i))] = common.BigToHash(big.NewInt(i * 100))
+		}
+		db := rawdb.NewMemoryDatabase()
+		genesis = (&core.Genesis{Config: params.TestChainConfig, Difficulty: big.NewInt(1), Alloc: alloc}).MustCommit(db)
+		chainDB = snapshot.NewChainDBSource(db)
+		rawHeader, err := rlp.EncodeToBytes(genesis.Header())
+		Expect(err).ToNot(HaveOccurred())
+		manifest = &checkpoint.Manifest{
+			Version:         checkpoint.ManifestVersion,
+			ChainID:         1,
+			BlockNumber:     0,
+			BlockHash:       genesis.Hash().Hex(),
+			StateRoot:       genesis.Root().Hex(),
+			TotalDifficulty: "1",
+			Uncles:          []string{},
+		}
+		source = checkpoint.NewSource(manifest, &chainDBBlocks{
+			sdb:     state.NewDatabase(db),
+			headers: map[common.Hash][]byte{genesis.Hash(): rawHeader},
+		})
+	})
+	AfterEach(func() {
+		chainDB.Close()
+	})
+
+	It("Returns the checkpoint block with an empty state diff", func() {
+		payload, err := source.BlockPayload(0)
+		Expect(err).ToNot(HaveOccurred())
+		block := new(types.Block)
+		Expect(rlp.DecodeBytes(payload.BlockRlp, block)).To(Succeed())
+		Expect(block.Hash()).To(Equal(genesis.Hash()))
+		Expect(payload.TotalDifficulty).To(Equal(big.NewInt(1)))
+		stateDiff := new(statediff.StateObject)
+		Expect(rlp.DecodeBytes(payload.StateObjectRlp, stateDiff)).To(Succeed())
+		Expect(stateDiff.BlockHash).To(Equal(genesis.Hash()))
+		Expect(stateDiff.Nodes).To(BeEmpty())
+	})
+
+	It("Errors if asked for a block other than the checkpoint", func() {
+		_, err := source.BlockPayload(1)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Errors if the header doesn't match the manifest", func() {
+		manifest.StateRoot = common.Hash{}.Hex()
+		_, err := source.BlockPayload(0)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Walks the same nodes as a geth chain database", func() {
+		expected := &recordingHandler{codes: make(map[common.Hash][]byte)}
+		Expect(chainDB.WalkState(genesis.Root(), expected)).To(Succeed())
+		handler := &recordingHandler{codes: make(map[common.Hash][]byte)}
+		Expect(source.WalkState(genesis.Root(), handler)).To(Succeed())
+		Expect(len(handler.stateNodes)).To(BeNumerically(">", 31))
+		Expect(handler.stateNodes).To(Equal(expected.stateNodes))
+		Expect(handler.codes).To(Equal(expected.codes))
+	})
+
+	It("Errors if a trie node is missing", func() {
+		source = checkpoint.NewSource(manifest, &chainDBBlocks{
+			sdb:     state.NewDatabase(rawdb.NewMemoryDatabase()),
+			headers: map[common.Hash][]byte{},
+		})
+		err := source.WalkState(genesis.Root(), &recordingHandler{codes: make(map[common.Hash][]byte)})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Manifest", func() {
+	It("Round trips through its raw block", func() {
+		manifest := &checkpoint.Manifest{
+			Version:         checkpoint.ManifestVersion,
+			SchemaVersion:   26,
+			ChainID:         1,
+			NetworkID:       "1",
+			GenesisBlock:    "0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3",
+			BlockNumber:     1000000,
+			BlockHash:       "0x8e38b4dbf6b11fcc3b9dee84fb7986e29ca0a02cecd8977c161ff7333329681e",
+			StateRoot:       "0x0e066f3c2297a5cb300593052617d1bca5946f0caa0635fdb1b85ac7e5236f34",
+			TotalDifficulty: "10000000000",
+			Uncles:          []string{},
+		}
+		c, data, err := manifest.Encode()
+		Expect(err).ToNot(HaveOccurred())
+		decoded, err := checkpoint.DecodeManifest(c, data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decoded).To(Equal(manifest))
+	})
+
+	It("Rejects data that doesn't match its cid", func() {
+		c, data, err := (&checkpoint.Manifest{Version: checkpoint.ManifestVersion}).Encode()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = checkpoint.DecodeManifest(c, append(data, ' '))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -20,12 +20,66 @@ import (
 	"fmt"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/migrations"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
 )
 
+// partitionedCIDTables are the partitioned tables holding each data type, ordered so that tables come before the tables they reference
+// partitionedIPLDTables are the ones among them whose IPLDs are removed along with them
+var (
+	partitionedCIDTables = map[shared.DataType][]string{
+		shared.Full:         {"eth.storage_cids", "eth.state_accounts", "eth.state_cids", "eth.trace_cids", "eth.receipt_cids", "eth.transaction_cids", "eth.uncle_cids", "eth.header_cids"},
+		shared.Headers:      {"eth.storage_cids", "eth.state_accounts", "eth.state_cids", "eth.trace_cids", "eth.receipt_cids", "eth.transaction_cids", "eth.uncle_cids", "eth.header_cids"},
+		shared.Uncles:       {"eth.uncle_cids"},
+		shared.Transactions: {"eth.trace_cids", "eth.receipt_cids", "eth.transaction_cids"},
+		shared.Receipts:     {"eth.receipt_cids"},
+		shared.State:        {"eth.storage_cids", "eth.state_accounts", "eth.state_cids"},
+		shared.Storage:      {"eth.storage_cids"},
+	}
+	partitionedIPLDTables = map[shared.DataType][]string{
+		shared.Full:         {"eth.storage_cids", "eth.state_cids", "eth.trace_cids", "eth.receipt_cids", "eth.transaction_cids", "eth.uncle_cids", "eth.header_cids"},
+		shared.Headers:      {"eth.storage_cids", "eth.state_cids", "eth.trace_cids", "eth.receipt_cids", "eth.transaction_cids", "eth.uncle_cids", "eth.header_cids"},
+		shared.Uncles:       {"eth.uncle_cids"},
+		shared.Transactions: {"eth.trace_cids", "eth.receipt_cids", "eth.transaction_cids"},
+		shared.Receipts:     {"eth.receipt_cids"},
+		shared.State:        {"eth.storage_cids", "eth.state_cids"},
+		shared.Storage:      {"eth.storage_cids"},
+	}
+	// chainReferences select the rows of each table referencing the IPLD A.key from the other chains than chain $N
+	chainReferences = map[string]string{
+		"eth.header_cids": `SELECT 1 FROM eth.header_cids X
+				WHERE X.mh_key = A.key AND X.chain_id <> $%d`,
+		"eth.uncle_cids": `SELECT 1 FROM eth.uncle_cids X INNER JOIN eth.header_cids Y ON (X.header_id = Y.id)
+				WHERE X.mh_key = A.key AND Y.chain_id <> $%d`,
+		"eth.transaction_cids": `SELECT 1 FROM eth.transaction_cids X INNER JOIN eth.header_cids Y ON (X.header_id = Y.id)
+				WHERE X.mh_key = A.key AND Y.chain_id <> $%d`,
+		"eth.trace_cids": `SELECT 1 FROM eth.trace_cids X INNER JOIN eth.transaction_cids Y ON (X.tx_id = Y.id) INNER JOIN eth.header_cids Z ON (Y.header_id = Z.id)
+				WHERE X.mh_key = A.key AND Z.chain_id <> $%d`,
+		"eth.receipt_cids": `SELECT 1 FROM eth.receipt_cids X INNER JOIN eth.transaction_cids Y ON (X.tx_id = Y.id) INNER JOIN eth.header_cids Z ON (Y.header_id = Z.id)
+				WHERE X.mh_key = A.key AND Z.chain_id <> $%d`,
+		"eth.state_cids": `SELECT 1 FROM eth.state_cids X INNER JOIN eth.header_cids Y ON (X.header_id = Y.id)
+				WHERE X.mh_key = A.key AND Y.chain_id <> $%d`,
+		"eth.storage_cids": `SELECT 1 FROM eth.storage_cids X INNER JOIN eth.state_cids Y ON (X.state_id = Y.id) INNER JOIN eth.header_cids Z ON (Y.header_id = Z.id)
+				WHERE X.mh_key = A.key AND Z.chain_id <> $%d`,
+	}
+)
+
+// unreferencedByOtherChains returns the condition that none of the tables reference the IPLD A.key from another chain than chain $arg
+// IPLDs are content addressed and can be shared by chains indexed into the same database, removing one would cascade into the other chains' rows
+func unreferencedByOtherChains(arg int, tables ...string) string {
+	condition := ""
+	for _, table := range tables {
+		condition += fmt.Sprintf(`
+			AND NOT EXISTS (`+chainReferences[table]+`)`, arg)
+	}
+	return condition
+}
+
 // Cleaner interface to allow substitution of mocks in tests
 type Cleaner interface {
 	ResetValidation(rngs [][2]uint64) error
@@ -33,8 +87,13 @@ type Cleaner interface {
 }
 
 // DBCleaner satisfies the Cleaner interface fo ethereum
+// it only removes the data of the chain of its node
 type DBCleaner struct {
 	db *postgres.DB
+	// blockstore holding the IPLD blocks when public.blocks only records their keys, nil if they are held in public.blocks
+	blocks blockstore.Blockstore
+	// keys of the public.blocks rows deleted by the current Clean, only collected if blocks is set
+	deleted []string
 }
 
 // NewDBCleaner returns a new DBCleaner struct
@@ -44,7 +103,17 @@ func NewDBCleaner(db *postgres.DB) *DBCleaner {
 	}
 }
 
+// SetBlockstore sets the blockstore the IPLD blocks are removed from along with their public.blocks rows
+func (c *DBCleaner) SetBlockstore(blocks blockstore.Blockstore) {
+	if _, ok := blocks.(*blockstore.PostgresBlockstore); ok {
+		c.blocks = nil
+		return
+	}
+	c.blocks = blocks
+}
+
 // ResetValidation resets the validation level to 0 to enable revalidation
+// The headers' sources are marked as unvalidated too, so that they count again once re-indexed under cross validation
 func (c *DBCleaner) ResetValidation(rngs [][2]uint64) error {
 	tx, err := c.db.Beginx()
 	if err != nil {
@@ -54,8 +123,17 @@ func (c *DBCleaner) ResetValidation(rngs [][2]uint64) error {
 		logrus.Infof("eth db cleaner resetting validation level to 0 for block range %d to %d", rng[0], rng[1])
 		pgStr := `UPDATE eth.header_cids
 				SET times_validated = 0
-				WHERE block_number BETWEEN $1 AND $2`
-		if _, err := tx.Exec(pgStr, rng[0], rng[1]); err != nil {
+				WHERE block_number BETWEEN $1 AND $2
+				AND chain_id = $3`
+		if _, err := tx.Exec(pgStr, rng[0], rng[1], c.db.Node.ChainID); err != nil {
+			shared.Rollback(tx)
+			return err
+		}
+		pgStr = `UPDATE eth.header_sources
+				SET validated = false
+				WHERE block_number BETWEEN $1 AND $2
+				AND chain_id = $3`
+		if _, err := tx.Exec(pgStr, rng[0], rng[1], c.db.Node.ChainID); err != nil {
 			shared.Rollback(tx)
 			return err
 		}
@@ -64,25 +142,161 @@ func (c *DBCleaner) ResetValidation(rngs [][2]uint64) error {
 }
 
 // Clean removes the specified data from the db within the provided block range
+// If the tables are partitioned, the partitions which lie entirely within a range are replaced with empty ones instead of having their rows deleted,
+// unless other chains have data in them
+// If a blockstore is set, the IPLD blocks whose public.blocks rows were deleted are removed from it once the deletion is committed
 func (c *DBCleaner) Clean(rngs [][2]uint64, t shared.DataType) error {
+	c.deleted = nil
+	partitions, err := migrations.LoadPartitions(c.db.DB)
+	if err != nil {
+		return err
+	}
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
+	// partitions are replaced before any rows are deleted, the rows left over are deleted afterwards
+	rowRngs := make([][2]uint64, 0, len(rngs))
 	for _, rng := range rngs {
 		logrus.Infof("eth db cleaner cleaning up block range %d to %d", rng[0], rng[1])
+		if partitions == nil {
+			rowRngs = append(rowRngs, rng)
+			continue
+		}
+		leftOver, err := c.resetPartitions(tx, partitions, rng, t)
+		if err != nil {
+			shared.Rollback(tx)
+			return err
+		}
+		rowRngs = append(rowRngs, leftOver...)
+	}
+	for _, rng := range rowRngs {
 		if err := c.clean(tx, rng, t); err != nil {
 			shared.Rollback(tx)
 			return err
 		}
 	}
+	// the sources of the removed headers go with them, recorded conflicts are kept for investigation
+	if t == shared.Full || t == shared.Headers {
+		for _, rng := range rngs {
+			if err := c.cleanHeaderSources(tx, rng); err != nil {
+				shared.Rollback(tx)
+				return err
+			}
+		}
+	}
 	if err := tx.Commit(); err != nil {
 		return err
 	}
+	if err := c.deleteFromBlockstore(); err != nil {
+		return err
+	}
 	logrus.Infof("eth db cleaner vacuum analyzing cleaned tables to free up space from deleted rows")
 	return c.vacuumAnalyze(t)
 }
 
+// resetPartitions replaces the partitions of the data type which lie entirely within the range, and only hold data of this chain, with empty ones
+// it returns the parts of the range outside of those partitions, whose rows still have to be deleted
+func (c *DBCleaner) resetPartitions(tx *sqlx.Tx, partitions *migrations.Partitions, rng [2]uint64, t shared.DataType) ([][2]uint64, error) {
+	tables, ok := partitionedCIDTables[t]
+	if !ok {
+		return nil, fmt.Errorf("eth cleaner unrecognized type: %s", t.String())
+	}
+	starts := partitions.Covered(rng)
+	if len(starts) == 0 {
+		return [][2]uint64{rng}, nil
+	}
+	// the IPLDs are removed after the partitions, so that removing them doesn't cascade into deleting the rows one by one
+	if _, err := tx.Exec(`CREATE TEMPORARY TABLE IF NOT EXISTS cleaned_keys (key TEXT NOT NULL) ON COMMIT DROP`); err != nil {
+		return nil, err
+	}
+	leftOver := make([][2]uint64, 0, 2)
+	for _, start := range starts {
+		partitionRng := [2]uint64{start, start + partitions.Size() - 1}
+		var otherChains bool
+		pgStr := `SELECT EXISTS (SELECT 1 FROM eth.header_cids WHERE block_number BETWEEN $1 AND $2 AND chain_id <> $3)`
+		if err := tx.Get(&otherChains, pgStr, partitionRng[0], partitionRng[1], c.db.Node.ChainID); err != nil {
+			return nil, err
+		}
+		if otherChains {
+			leftOver = append(leftOver, partitionRng)
+			continue
+		}
+		logrus.Infof("eth db cleaner replacing the %s partitions for block range %d to %d", t.String(), partitionRng[0], partitionRng[1])
+		for _, table := range partitionedIPLDTables[t] {
+			pgStr = fmt.Sprintf(`INSERT INTO cleaned_keys (key) SELECT mh_key FROM %s WHERE block_number BETWEEN $1 AND $2`, table)
+			if _, err := tx.Exec(pgStr, partitionRng[0], partitionRng[1]); err != nil {
+				return nil, err
+			}
+		}
+		// code references the header it was first seen at
+		if t == shared.Full || t == shared.Headers {
+			pgStr = `DELETE FROM eth.code_cids WHERE block_number BETWEEN $1 AND $2 AND chain_id = $3`
+			if _, err := tx.Exec(pgStr, partitionRng[0], partitionRng[1], c.db.Node.ChainID); err != nil {
+				return nil, err
+			}
+		}
+		if err := partitions.Reset(tx, start, tables); err != nil {
+			return nil, err
+		}
+		pgStr = `DELETE FROM public.blocks A USING cleaned_keys WHERE A.key = cleaned_keys.key` +
+			unreferencedByOtherChains(1, partitionedIPLDTables[shared.Full]...)
+		if err := c.deleteBlocks(tx, pgStr, c.db.Node.ChainID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`DELETE FROM cleaned_keys`); err != nil {
+			return nil, err
+		}
+	}
+	if first := starts[0]; rng[0] < first {
+		leftOver = append(leftOver, [2]uint64{rng[0], first - 1})
+	}
+	if next := starts[len(starts)-1] + partitions.Size(); next <= rng[1] {
+		leftOver = append(leftOver, [2]uint64{next, rng[1]})
+	}
+	return leftOver, nil
+}
+
+// deleteBlocks executes the DELETE FROM public.blocks A statement, collecting the deleted keys if a blockstore is set
+func (c *DBCleaner) deleteBlocks(tx *sqlx.Tx, pgStr string, args ...interface{}) error {
+	if c.blocks == nil {
+		_, err := tx.Exec(pgStr, args...)
+		return err
+	}
+	keys := make([]string, 0)
+	if err := tx.Select(&keys, pgStr+`
+			RETURNING A.key`, args...); err != nil {
+		return err
+	}
+	c.deleted = append(c.deleted, keys...)
+	return nil
+}
+
+// deleteFromBlockstore removes the blocks whose public.blocks rows were deleted from the blockstore
+// keys which have been indexed again since are left alone
+func (c *DBCleaner) deleteFromBlockstore() error {
+	if c.blocks == nil || len(c.deleted) == 0 {
+		return nil
+	}
+	reindexed := make([]string, 0)
+	if err := c.db.Select(&reindexed, `SELECT key FROM public.blocks WHERE key = ANY($1)`, pq.Array(c.deleted)); err != nil {
+		return err
+	}
+	skip := make(map[string]bool, len(reindexed))
+	for _, key := range reindexed {
+		skip[key] = true
+	}
+	keys := make([]string, 0, len(c.deleted))
+	for _, key := range c.deleted {
+		if !skip[key] {
+			keys = append(keys, key)
+		}
+	}
+	logrus.Infof("eth db cleaner removing %d blocks from the blockstore", len(keys))
+	c.deleted = nil
+	return c.blocks.Delete(keys)
+}
+
 func (c *DBCleaner) clean(tx *sqlx.Tx, rng [2]uint64, t shared.DataType) error {
 	switch t {
 	case shared.Full, shared.Headers:
@@ -93,6 +307,9 @@ func (c *DBCleaner) clean(tx *sqlx.Tx, rng [2]uint64, t shared.DataType) error {
 		}
 		return c.cleanUncleMetaData(tx, rng)
 	case shared.Transactions:
+		if err := c.cleanTraceIPLDs(tx, rng); err != nil {
+			return err
+		}
 		if err := c.cleanReceiptIPLDs(tx, rng); err != nil {
 			return err
 		}
@@ -231,6 +448,9 @@ func (c *DBCleaner) cleanFull(tx *sqlx.Tx, rng [2]uint64) error {
 	if err := c.cleanStateIPLDs(tx, rng); err != nil {
 		return err
 	}
+	if err := c.cleanTraceIPLDs(tx, rng); err != nil {
+		return err
+	}
 	if err := c.cleanReceiptIPLDs(tx, rng); err != nil {
 		return err
 	}
@@ -252,9 +472,10 @@ func (c *DBCleaner) cleanStorageIPLDs(tx *sqlx.Tx, rng [2]uint64) error {
 			WHERE A.key = B.mh_key
 			AND B.state_id = C.id
 			AND C.header_id = D.id
-			AND D.block_number BETWEEN $1 AND $2`
-	_, err := tx.Exec(pgStr, rng[0], rng[1])
-	return err
+			AND D.block_number BETWEEN $1 AND $2
+			AND D.chain_id = $3` +
+		unreferencedByOtherChains(3, "eth.storage_cids")
+	return c.deleteBlocks(tx, pgStr, rng[0], rng[1], c.db.Node.ChainID)
 }
 
 func (c *DBCleaner) cleanStorageMetaData(tx *sqlx.Tx, rng [2]uint64) error {
@@ -262,8 +483,9 @@ func (c *DBCleaner) cleanStorageMetaData(tx *sqlx.Tx, rng [2]uint64) error {
 			USING eth.state_cids B, eth.header_cids C
 			WHERE A.state_id = B.id
 			AND B.header_id = C.id
-			AND C.block_number BETWEEN $1 AND $2`
-	_, err := tx.Exec(pgStr, rng[0], rng[1])
+			AND C.block_number BETWEEN $1 AND $2
+			AND C.chain_id = $3`
+	_, err := tx.Exec(pgStr, rng[0], rng[1], c.db.Node.ChainID)
 	return err
 }
 
@@ -272,29 +494,44 @@ func (c *DBCleaner) cleanStateIPLDs(tx *sqlx.Tx, rng [2]uint64) error {
 			USING eth.state_cids B, eth.header_cids C
 			WHERE A.key = B.mh_key
 			AND B.header_id = C.id
-			AND C.block_number BETWEEN $1 AND $2`
-	_, err := tx.Exec(pgStr, rng[0], rng[1])
-	return err
+			AND C.block_number BETWEEN $1 AND $2
+			AND C.chain_id = $3` +
+		unreferencedByOtherChains(3, "eth.state_cids")
+	return c.deleteBlocks(tx, pgStr, rng[0], rng[1], c.db.Node.ChainID)
 }
 
 func (c *DBCleaner) cleanStateMetaData(tx *sqlx.Tx, rng [2]uint64) error {
 	pgStr := `DELETE FROM eth.state_cids A
 			USING eth.header_cids B
 			WHERE A.header_id = B.id
-			AND B.block_number BETWEEN $1 AND $2`
-	_, err := tx.Exec(pgStr, rng[0], rng[1])
+			AND B.block_number BETWEEN $1 AND $2
+			AND B.chain_id = $3`
+	_, err := tx.Exec(pgStr, rng[0], rng[1], c.db.Node.ChainID)
 	return err
 }
 
+func (c *DBCleaner) cleanTraceIPLDs(tx *sqlx.Tx, rng [2]uint64) error {
+	pgStr := `DELETE FROM public.blocks A
+			USING eth.trace_cids B, eth.transaction_cids C, eth.header_cids D
+			WHERE A.key = B.mh_key
+			AND B.tx_id = C.id
+			AND C.header_id = D.id
+			AND D.block_number BETWEEN $1 AND $2
+			AND D.chain_id = $3` +
+		unreferencedByOtherChains(3, "eth.trace_cids")
+	return c.deleteBlocks(tx, pgStr, rng[0], rng[1], c.db.Node.ChainID)
+}
+
 func (c *DBCleaner) cleanReceiptIPLDs(tx *sqlx.Tx, rng [2]uint64) error {
 	pgStr := `DELETE FROM public.blocks A
 			USING eth.receipt_cids B, eth.transaction_cids C, eth.header_cids D
 			WHERE A.key = B.mh_key
 			AND B.tx_id = C.id
 			AND C.header_id = D.id
-			AND D.block_number BETWEEN $1 AND $2`
-	_, err := tx.Exec(pgStr, rng[0], rng[1])
-	return err
+			AND D.block_number BETWEEN $1 AND $2
+			AND D.chain_id = $3` +
+		unreferencedByOtherChains(3, "eth.receipt_cids")
+	return c.deleteBlocks(tx, pgStr, rng[0], rng[1], c.db.Node.ChainID)
 }
 
 func (c *DBCleaner) cleanReceiptMetaData(tx *sqlx.Tx, rng [2]uint64) error {
@@ -302,8 +539,9 @@ func (c *DBCleaner) cleanReceiptMetaData(tx *sqlx.Tx, rng [2]uint64) error {
 			USING eth.transaction_cids B, eth.header_cids C
 			WHERE A.tx_id = B.id
 			AND B.header_id = C.id
-			AND C.block_number BETWEEN $1 AND $2`
-	_, err := tx.Exec(pgStr, rng[0], rng[1])
+			AND C.block_number BETWEEN $1 AND $2
+			AND C.chain_id = $3`
+	_, err := tx.Exec(pgStr, rng[0], rng[1], c.db.Node.ChainID)
 	return err
 }
 
@@ -312,17 +550,19 @@ func (c *DBCleaner) cleanTransactionIPLDs(tx *sqlx.Tx, rng [2]uint64) error {
 			USING eth.transaction_cids B, eth.header_cids C
 			WHERE A.key = B.mh_key
 			AND B.header_id = C.id
-			AND C.block_number BETWEEN $1 AND $2`
-	_, err := tx.Exec(pgStr, rng[0], rng[1])
-	return err
+			AND C.block_number BETWEEN $1 AND $2
+			AND C.chain_id = $3` +
+		unreferencedByOtherChains(3, "eth.transaction_cids")
+	return c.deleteBlocks(tx, pgStr, rng[0], rng[1], c.db.Node.ChainID)
 }
 
 func (c *DBCleaner) cleanTransactionMetaData(tx *sqlx.Tx, rng [2]uint64) error {
 	pgStr := `DELETE FROM eth.transaction_cids A
 			USING eth.header_cids B
 			WHERE A.header_id = B.id
-			AND B.block_number BETWEEN $1 AND $2`
-	_, err := tx.Exec(pgStr, rng[0], rng[1])
+			AND B.block_number BETWEEN $1 AND $2
+			AND B.chain_id = $3`
+	_, err := tx.Exec(pgStr, rng[0], rng[1], c.db.Node.ChainID)
 	return err
 }
 
@@ -331,17 +571,19 @@ func (c *DBCleaner) cleanUncleIPLDs(tx *sqlx.Tx, rng [2]uint64) error {
 			USING eth.uncle_cids B, eth.header_cids C
 			WHERE A.key = B.mh_key
 			AND B.header_id = C.id
-			AND C.block_number BETWEEN $1 AND $2`
-	_, err := tx.Exec(pgStr, rng[0], rng[1])
-	return err
+			AND C.block_number BETWEEN $1 AND $2
+			AND C.chain_id = $3` +
+		unreferencedByOtherChains(3, "eth.uncle_cids")
+	return c.deleteBlocks(tx, pgStr, rng[0], rng[1], c.db.Node.ChainID)
 }
 
 func (c *DBCleaner) cleanUncleMetaData(tx *sqlx.Tx, rng [2]uint64) error {
 	pgStr := `DELETE FROM eth.uncle_cids A
 			USING eth.header_cids B
 			WHERE A.header_id = B.id
-			AND B.block_number BETWEEN $1 AND $2`
-	_, err := tx.Exec(pgStr, rng[0], rng[1])
+			AND B.block_number BETWEEN $1 AND $2
+			AND B.chain_id = $3`
+	_, err := tx.Exec(pgStr, rng[0], rng[1], c.db.Node.ChainID)
 	return err
 }
 
@@ -349,14 +591,24 @@ func (c *DBCleaner) cleanHeaderIPLDs(tx *sqlx.Tx, rng [2]uint64) error {
 	pgStr := `DELETE FROM public.blocks A
 			USING eth.header_cids B
 			WHERE A.key = B.mh_key
-			AND B.block_number BETWEEN $1 AND $2`
-	_, err := tx.Exec(pgStr, rng[0], rng[1])
-	return err
+			AND B.block_number BETWEEN $1 AND $2
+			AND B.chain_id = $3` +
+		unreferencedByOtherChains(3, "eth.header_cids")
+	return c.deleteBlocks(tx, pgStr, rng[0], rng[1], c.db.Node.ChainID)
 }
 
 func (c *DBCleaner) cleanHeaderMetaData(tx *sqlx.Tx, rng [2]uint64) error {
 	pgStr := `DELETE FROM eth.header_cids
-			WHERE block_number BETWEEN $1 AND $2`
-	_, err := tx.Exec(pgStr, rng[0], rng[1])
+			WHERE block_number BETWEEN $1 AND $2
+			AND chain_id = $3`
+	_, err := tx.Exec(pgStr, rng[0], rng[1], c.db.Node.ChainID)
+	return err
+}
+
+func (c *DBCleaner) cleanHeaderSources(tx *sqlx.Tx, rng [2]uint64) error {
+	pgStr := `DELETE FROM eth.header_sources
+			WHERE block_number BETWEEN $1 AND $2
+			AND chain_id = $3`
+	_, err := tx.Exec(pgStr, rng[0], rng[1], c.db.Node.ChainID)
 	return err
 }
@@ -17,14 +17,18 @@
 package eth_test
 
 import (
+	"io/ioutil"
 	"math/big"
+	"os"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
 )
@@ -124,6 +128,7 @@ var (
 			MhKey:    state1MhKey1,
 			Path:     state1Path,
 			NodeType: 2,
+			Diff:     true,
 			StateKey: state1Key.String(),
 		},
 		{
@@ -131,6 +136,7 @@ var (
 			MhKey:    state2MhKey1,
 			Path:     state2Path,
 			NodeType: 2,
+			Diff:     true,
 			StateKey: state2Key.String(),
 		},
 	}
@@ -148,6 +154,7 @@ var (
 				StorageKey: storageKey.String(),
 				Path:       storagePath,
 				NodeType:   2,
+				Diff:       true,
 			},
 		},
 	}
@@ -207,6 +214,7 @@ var (
 			MhKey:    state1MhKey2,
 			Path:     state1Path,
 			NodeType: 2,
+			Diff:     true,
 			StateKey: state1Key.String(),
 		},
 	}
@@ -353,6 +361,34 @@ var _ = Describe("Cleaner", func() {
 			Expect(storageCount).To(Equal(0))
 			Expect(blocksCount).To(Equal(0))
 		})
+		It("Removes the cleaned blocks from a non-postgres blockstore", func() {
+			dir, err := ioutil.TempDir("", "cleaner")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+			bs, err := blockstore.NewLevelDBBlockstore(dir)
+			Expect(err).ToNot(HaveOccurred())
+			defer bs.Close()
+			blocks := make([]blockstore.Block, len(mhKeys))
+			for i, key := range mhKeys {
+				blocks[i] = blockstore.Block{Key: key, Data: mockData}
+			}
+			Expect(bs.Put(blocks)).To(Succeed())
+			cleaner.SetBlockstore(bs)
+
+			err = cleaner.Clean(rngs, shared.Uncles)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = bs.Get(uncleMhKey)
+			Expect(err).To(Equal(blockstore.ErrNotFound))
+			_, err = bs.Get(headerMhKey1)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = cleaner.Clean(rngs, shared.Full)
+			Expect(err).ToNot(HaveOccurred())
+			for _, key := range mhKeys {
+				_, err = bs.Get(key)
+				Expect(err).To(Equal(blockstore.ErrNotFound))
+			}
+		})
 		It("Cleans headers and all linked data (same as full)", func() {
 			err := cleaner.Clean(rngs, shared.Headers)
 			Expect(err).ToNot(HaveOccurred())
@@ -694,5 +730,21 @@ var _ = Describe("Cleaner", func() {
 			Expect(validationTimes[0]).To(Equal(0))
 			Expect(validationTimes[1]).To(Equal(1))
 		})
+		It("Only resets the validation level of its own chain", func() {
+			otherDB, err := shared.SetupDBWithNode(node.Info{ID: "otherChainNode", ChainID: 3})
+			Expect(err).ToNot(HaveOccurred())
+			err = eth.NewCIDIndexer(otherDB).Index(mockCIDPayload1)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = cleaner.ResetValidation(rngs)
+			Expect(err).ToNot(HaveOccurred())
+
+			var validationTimes []int
+			pgStr := `SELECT times_validated FROM eth.header_cids WHERE chain_id = $1`
+			err = db.Select(&validationTimes, pgStr, 3)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(validationTimes)).To(Equal(1))
+			Expect(validationTimes[0]).To(Equal(1))
+		})
 	})
 })
@@ -0,0 +1,166 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/statediff"
+	"github.com/sirupsen/logrus"
+)
+
+// FileStreamer satisfies the Streamer interface by replaying the payloads recorded in a local file, in the order they were recorded
+type FileStreamer struct {
+	path string
+}
+
+// NewFileStreamer returns a new FileStreamer for the payload file at the provided path
+func NewFileStreamer(path string) *FileStreamer {
+	return &FileStreamer{path: path}
+}
+
+// Stream replays every payload in the file onto the provided channel
+// Once the file has been fully replayed the subscription stays open, but quiet, until it is unsubscribed
+func (fs *FileStreamer) Stream(payloadChan chan statediff.Payload) (Subscription, error) {
+	f, err := os.Open(fs.path)
+	if err != nil {
+		return nil, err
+	}
+	sub := newFileSubscription()
+	go func() {
+		defer f.Close()
+		reader := newPayloadFileReader(f)
+		var count int
+		for {
+			rec, _, _, err := reader.next()
+			if err == io.EOF {
+				logrus.Infof("finished replaying %d payloads from %s", count, fs.path)
+				return
+			}
+			if err == io.ErrUnexpectedEOF {
+				logrus.Warnf("finished replaying %d payloads from %s, last record is truncated", count, fs.path)
+				return
+			}
+			if err != nil {
+				sub.errChan <- err
+				return
+			}
+			select {
+			case payloadChan <- rec.payload():
+				count++
+			case <-sub.quitChan:
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// fileSubscription satisfies the Subscription interface for a FileStreamer
+type fileSubscription struct {
+	errChan  chan error
+	quitChan chan struct{}
+	once     sync.Once
+}
+
+func newFileSubscription() *fileSubscription {
+	return &fileSubscription{
+		errChan:  make(chan error, 1),
+		quitChan: make(chan struct{}),
+	}
+}
+
+// Err returns the subscription error channel
+func (fs *fileSubscription) Err() <-chan error {
+	return fs.errChan
+}
+
+// Unsubscribe stops the replay
+func (fs *fileSubscription) Unsubscribe() {
+	fs.once.Do(func() {
+		close(fs.quitChan)
+	})
+}
+
+// FileFetcher satisfies the Fetcher interface by looking up payloads recorded in a local file
+// If multiple payloads were recorded at the same height, the last one recorded is used
+type FileFetcher struct {
+	file *os.File
+	// block height => offset and length of the record in the file
+	index map[uint64][2]int64
+}
+
+// NewFileFetcher opens and indexes the payload file at the provided path
+func NewFileFetcher(path string) (*FileFetcher, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[uint64][2]int64)
+	reader := newPayloadFileReader(f)
+	for {
+		rec, offset, length, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			logrus.Warnf("last record of payload file %s is truncated", path)
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		index[rec.BlockNumber] = [2]int64{offset, length}
+	}
+	logrus.Infof("indexed payloads at %d heights from %s", len(index), path)
+	return &FileFetcher{
+		file:  f,
+		index: index,
+	}, nil
+}
+
+// FetchAt returns the recorded payloads at the given block heights
+// It is safe for concurrent use
+func (ff *FileFetcher) FetchAt(blockHeights []uint64) ([]statediff.Payload, error) {
+	results := make([]statediff.Payload, 0, len(blockHeights))
+	for _, height := range blockHeights {
+		loc, ok := ff.index[height]
+		if !ok {
+			return nil, fmt.Errorf("ethereum FileFetcher has no payload recorded at blockheight %d", height)
+		}
+		buf := make([]byte, loc[1])
+		if _, err := ff.file.ReadAt(buf, loc[0]); err != nil {
+			return nil, fmt.Errorf("ethereum FileFetcher err at blockheight %d: %v", height, err)
+		}
+		var rec payloadRecord
+		if err := rlp.DecodeBytes(buf, &rec); err != nil {
+			return nil, fmt.Errorf("ethereum FileFetcher err at blockheight %d: %v", height, err)
+		}
+		results = append(results, rec.payload())
+	}
+	return results, nil
+}
+
+// Close closes the underlying file
+func (ff *FileFetcher) Close() error {
+	return ff.file.Close()
+}
@@ -0,0 +1,139 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+// indexFilter applies a shared.IndexFilter to the contents of a payload
+type indexFilter struct {
+	shared.IndexFilter
+	addresses, src, dst map[common.Address]bool
+	topics              map[common.Hash]bool
+	// leaf keys of the watched addresses, nil if every account is watched
+	stateKeys map[common.Hash]bool
+}
+
+func newIndexFilter(f shared.IndexFilter) *indexFilter {
+	filter := &indexFilter{
+		IndexFilter: f,
+		addresses:   addressSet(f.Addresses),
+		src:         addressSet(f.Src),
+		dst:         addressSet(f.Dst),
+		topics:      make(map[common.Hash]bool, len(f.Topics)),
+	}
+	for _, topic := range f.Topics {
+		filter.topics[topic] = true
+	}
+	if len(f.Addresses) > 0 {
+		filter.stateKeys = make(map[common.Hash]bool, len(f.Addresses))
+		for _, address := range f.Addresses {
+			filter.stateKeys[crypto.Keccak256Hash(address.Bytes())] = true
+		}
+	}
+	return filter
+}
+
+func addressSet(addresses []common.Address) map[common.Address]bool {
+	set := make(map[common.Address]bool, len(addresses))
+	for _, address := range addresses {
+		set[address] = true
+	}
+	return set
+}
+
+// matchTx returns true if the transaction and its receipt should be indexed
+func (f *indexFilter) matchTx(trx *types.Transaction, from common.Address, receipt *types.Receipt) bool {
+	if !f.FiltersTransactions() {
+		return true
+	}
+	if f.src[from] {
+		return true
+	}
+	if to := trx.To(); to != nil && (f.dst[*to] || f.addresses[*to]) {
+		return true
+	}
+	if receipt.ContractAddress != (common.Address{}) && f.addresses[receipt.ContractAddress] {
+		return true
+	}
+	for _, log := range receipt.Logs {
+		if f.addresses[log.Address] || (len(log.Topics) > 0 && f.topics[log.Topics[0]]) {
+			return true
+		}
+	}
+	return false
+}
+
+// stateNodes returns the state nodes, and their storage nodes, which should be indexed
+// When watching addresses only their leaf nodes are kept, along with removed nodes which don't carry a leaf key
+// If only storage is indexed, state nodes are only kept as the parents of their storage nodes
+func (f *indexFilter) stateNodes(nodes []sdtypes.StateNode) []sdtypes.StateNode {
+	indexState, indexStorage := f.Indexes(shared.State), f.Indexes(shared.Storage)
+	if f.FullState() {
+		return nodes
+	}
+	filtered := make([]sdtypes.StateNode, 0, len(nodes))
+	if !indexState && !indexStorage {
+		return filtered
+	}
+	for _, node := range nodes {
+		unkeyedRemoval := node.NodeType == sdtypes.Removed && len(node.LeafKey) == 0
+		if f.stateKeys != nil && !unkeyedRemoval && !f.stateKeys[common.BytesToHash(node.LeafKey)] {
+			continue
+		}
+		if !indexStorage {
+			node.StorageNodes = nil
+		}
+		if !indexState && len(node.StorageNodes) == 0 {
+			continue
+		}
+		filtered = append(filtered, node)
+	}
+	return filtered
+}
+
+// codes returns the contract codes which should be indexed, those of the watched accounts in the (filtered) state nodes
+func (f *indexFilter) codes(nodes []sdtypes.StateNode, codes []sdtypes.CodeAndCodeHash) []sdtypes.CodeAndCodeHash {
+	if !f.Indexes(shared.State) {
+		return nil
+	}
+	if f.stateKeys == nil {
+		return codes
+	}
+	codeHashes := make(map[common.Hash]bool)
+	for _, node := range nodes {
+		if node.NodeType != sdtypes.Leaf {
+			continue
+		}
+		if account, err := DecodeStateLeafAccount(node.NodeValue); err == nil {
+			codeHashes[common.BytesToHash(account.CodeHash)] = true
+		}
+	}
+	filtered := make([]sdtypes.CodeAndCodeHash, 0, len(codes))
+	for _, c := range codes {
+		if codeHashes[c.Hash] {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,101 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package eth_test
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+var _ = Describe("Filtered indexing", func() {
+	var (
+		db          *postgres.DB
+		err         error
+		transformer *eth.StateDiffTransformer
+	)
+	BeforeEach(func() {
+		db, err = shared.SetupDB()
+		Expect(err).ToNot(HaveOccurred())
+		transformer = eth.NewStateDiffTransformer(params.MainnetChainConfig, db)
+	})
+	AfterEach(func() {
+		eth.TearDownDB(db)
+	})
+
+	transform := func(filter shared.IndexFilter) {
+		transformer.SetFilter(filter)
+		_, err = transformer.Transform(1, mocks.MockStateDiffPayload)
+		Expect(err).ToNot(HaveOccurred())
+	}
+	count := func(table string) int {
+		var n int
+		err = db.Get(&n, `SELECT COUNT(*) FROM `+table)
+		Expect(err).ToNot(HaveOccurred())
+		return n
+	}
+
+	It("Always indexes the header", func() {
+		transform(shared.IndexFilter{Types: []shared.DataType{shared.Uncles}})
+		Expect(count("eth.header_cids")).To(Equal(1))
+		Expect(count("eth.transaction_cids")).To(Equal(0))
+		Expect(count("eth.receipt_cids")).To(Equal(0))
+		Expect(count("eth.state_cids")).To(Equal(0))
+		Expect(count("eth.storage_cids")).To(Equal(0))
+	})
+
+	It("Only indexes the state, storage and transactions of the watched addresses", func() {
+		transform(shared.IndexFilter{Addresses: []common.Address{mocks.ContractAddress}})
+		txs := make([]string, 0)
+		err = db.Select(&txs, `SELECT cid FROM eth.transaction_cids`)
+		Expect(err).ToNot(HaveOccurred())
+		// the contract creation
+		Expect(txs).To(Equal([]string{mocks.Trx3CID.String()}))
+		Expect(count("eth.receipt_cids")).To(Equal(1))
+		stateKeys := make([]string, 0)
+		err = db.Select(&stateKeys, `SELECT state_leaf_key FROM eth.state_cids`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stateKeys).To(Equal([]string{common.BytesToHash(mocks.ContractLeafKey).Hex()}))
+		Expect(count("eth.storage_cids")).To(Equal(1))
+	})
+
+	It("Indexes the transactions emitting the watched topics", func() {
+		transform(shared.IndexFilter{
+			Types:  []shared.DataType{shared.Receipts},
+			Topics: []common.Hash{common.HexToHash("0x05")},
+		})
+		txs := make([]string, 0)
+		err = db.Select(&txs, `SELECT cid FROM eth.transaction_cids`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(txs).To(Equal([]string{mocks.Trx2CID.String()}))
+		Expect(count("eth.receipt_cids")).To(Equal(1))
+		Expect(count("eth.state_cids")).To(Equal(0))
+	})
+
+	It("Only indexes the state nodes which are parents of storage nodes if only storage is indexed", func() {
+		transform(shared.IndexFilter{Types: []shared.DataType{shared.Storage}})
+		Expect(count("eth.transaction_cids")).To(Equal(0))
+		Expect(count("eth.state_cids")).To(Equal(1))
+		Expect(count("eth.storage_cids")).To(Equal(1))
+	})
+})
@@ -19,7 +19,10 @@ package eth
 import (
 	"fmt"
 
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/statediff"
 	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
 )
 
@@ -38,6 +41,21 @@ func ResolveFromNodeType(nodeType sdtypes.NodeType) int {
 	}
 }
 
+func ResolveToNodeType(nodeType int) sdtypes.NodeType {
+	switch nodeType {
+	case 0:
+		return sdtypes.Branch
+	case 1:
+		return sdtypes.Extension
+	case 2:
+		return sdtypes.Leaf
+	case 3:
+		return sdtypes.Removed
+	default:
+		return sdtypes.Unknown
+	}
+}
+
 // ChainConfig returns the appropriate ethereum chain config for the provided chain id
 func ChainConfig(chainID uint64) (*params.ChainConfig, error) {
 	switch chainID {
@@ -53,3 +71,15 @@ func ChainConfig(chainID uint64) (*params.ChainConfig, error) {
 		return nil, fmt.Errorf("chain config for chainid %d not available", chainID)
 	}
 }
+
+// PayloadHeader decodes only the header out of the payload's block rlp
+func PayloadHeader(payload statediff.Payload) (*types.Header, error) {
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(payload.BlockRlp, &struct {
+		Header *types.Header
+		Rest   []rlp.RawValue `rlp:"tail"`
+	}{Header: header}); err != nil {
+		return nil, fmt.Errorf("error decoding payload block rlp: %v", err)
+	}
+	return header, nil
+}
@@ -17,10 +17,18 @@
 package eth
 
 import (
+	"sort"
+	"strconv"
+	"sync"
+
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/migrations"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/prom"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
@@ -38,6 +46,18 @@ type Indexer interface {
 // Indexer satisfies the Indexer interface for ethereum
 type CIDIndexer struct {
 	db *postgres.DB
+	// blockstore the IPLDs of the indexed rows are published to, public.blocks if nil
+	blocks blockstore.Blockstore
+
+	// how re-indexing a row with different content is handled, OverwriteConflicts if empty
+	conflicts shared.ConflictMode
+	// if true, times_validated counts the independent sources which supplied a validated header that agrees with the indexed state root
+	crossValidate bool
+
+	// partitions of the eth tables, nil unless the database has the partitioned layout
+	partitions     *migrations.Partitions
+	partitionsErr  error
+	loadPartitions sync.Once
 }
 
 // NewCIDIndexer creates a new pointer to a Indexer which satisfies the CIDIndexer interface
@@ -47,8 +67,31 @@ func NewCIDIndexer(db *postgres.DB) *CIDIndexer {
 	}
 }
 
+// SetCrossValidation turns cross validation of the indexed headers against their other sources on or off
+func (in *CIDIndexer) SetCrossValidation(crossValidate bool) {
+	in.crossValidate = crossValidate
+}
+
+// SetConflictMode sets how re-indexing a row with content that differs from the indexed content is handled
+// By default the content is overwritten, and the change is recorded in eth.upsert_conflicts
+func (in *CIDIndexer) SetConflictMode(mode shared.ConflictMode) {
+	in.conflicts = mode
+}
+
+// beginx begins a new db tx which publishes IPLDs to the indexer's blockstore
+func (in *CIDIndexer) beginx() (*blockstore.Tx, error) {
+	return blockstore.Begin(in.db.DB, in.blocks)
+}
+
 // Index indexes a cidPayload in Postgres
 func (in *CIDIndexer) Index(cids CIDPayload) error {
+	blockNumber, err := strconv.ParseUint(cids.HeaderCID.BlockNumber, 10, 64)
+	if err != nil {
+		return err
+	}
+	if err := in.preparePartitions(blockNumber); err != nil {
+		return err
+	}
 	// Begin new db tx
 	tx, err := in.db.Beginx()
 	if err != nil {
@@ -65,63 +108,135 @@ func (in *CIDIndexer) Index(cids CIDPayload) error {
 		}
 	}()
 
-	headerID, err := in.indexHeaderCID(tx, cids.HeaderCID)
+	headerID, err := in.indexHeaderCID(tx, cids.HeaderCID, true, "")
 	if err != nil {
 		log.Error("eth indexer error when indexing header")
 		return err
 	}
 	for _, uncle := range cids.UncleCIDs {
-		if err := in.indexUncleCID(tx, uncle, headerID); err != nil {
+		if err := in.indexUncleCID(tx, uncle, headerID, blockNumber); err != nil {
 			log.Error("eth indexer error when indexing uncle")
 			return err
 		}
 	}
-	if err := in.indexTransactionAndReceiptCIDs(tx, cids, headerID); err != nil {
+	if err := in.indexTransactionAndReceiptCIDs(tx, cids, headerID, blockNumber); err != nil {
 		log.Error("eth indexer error when indexing transactions and receipts")
 		return err
 	}
-	err = in.indexStateAndStorageCIDs(tx, cids, headerID)
+	err = in.indexStateAndStorageCIDs(tx, cids, headerID, blockNumber)
 	if err != nil {
 		log.Error("eth indexer error when indexing state and storage nodes")
 	}
 	return err
 }
 
-func (in *CIDIndexer) indexHeaderCID(tx *sqlx.Tx, header HeaderModel) (int64, error) {
-	var headerID int64
-	err := tx.QueryRowx(`INSERT INTO eth.header_cids (block_number, block_hash, parent_hash, cid, td, node_id, reward, state_root, tx_root, receipt_root, uncle_root, bloom, timestamp, mh_key, times_validated)
-								VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
-								ON CONFLICT (block_number, block_hash) DO UPDATE SET (parent_hash, cid, td, node_id, reward, state_root, tx_root, receipt_root, uncle_root, bloom, timestamp, mh_key, times_validated) = ($3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, eth.header_cids.times_validated + 1)
-								RETURNING id`,
-		header.BlockNumber, header.BlockHash, header.ParentHash, header.CID, header.TotalDifficulty, in.db.NodeID, header.Reward, header.StateRoot, header.TxRoot,
-		header.RctRoot, header.UncleRoot, header.Bloom, header.Timestamp, header.MhKey, 1).Scan(&headerID)
-	if err == nil {
-		prom.BlockInc()
+// preparePartitions creates the partitions which hold the height, if the database has the partitioned layout
+// it is called before beginning the tx that indexes the height, as creating partitions locks the tables
+func (in *CIDIndexer) preparePartitions(height uint64) error {
+	in.loadPartitions.Do(func() {
+		in.partitions, in.partitionsErr = migrations.LoadPartitions(in.db.DB)
+	})
+	if in.partitionsErr != nil || in.partitions == nil {
+		return in.partitionsErr
+	}
+	return in.partitions.Ensure(height)
+}
+
+// indexHeaderCID upserts the header under the chain of the indexer's node, incrementing times_validated only if the header's data was validated
+// diffRoot is the state root the node's state diff hashed up to, or empty if the diff didn't include the state root node
+// The indexer's node is recorded as a source of the header; with cross validation on, times_validated is set to the number of
+// sources which supplied the header with validated data that doesn't disagree with the header's state root
+func (in *CIDIndexer) indexHeaderCID(tx *sqlx.Tx, header HeaderModel, validated bool, diffRoot string) (int64, error) {
+	var increment int64
+	if validated {
+		increment = 1
+	}
+	headerID, err := in.upsert(tx, upsert{
+		table: "header_cids",
+		pgStr: `INSERT INTO eth.header_cids (block_number, block_hash, parent_hash, cid, td, node_id, reward, state_root, tx_root, receipt_root, uncle_root, bloom, timestamp, mh_key, times_validated, chain_id)
+								VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+								ON CONFLICT (chain_id, block_number, block_hash) DO UPDATE SET (parent_hash, cid, td, node_id, reward, state_root, tx_root, receipt_root, uncle_root, bloom, timestamp, mh_key, times_validated) = ($3, $4, GREATEST(eth.header_cids.td, $5), $6, $7, $8, $9, $10, $11, $12, $13, $14, eth.header_cids.times_validated + $15)`,
+		args: []interface{}{header.BlockNumber, header.BlockHash, header.ParentHash, header.CID, header.TotalDifficulty, in.db.NodeID, header.Reward, header.StateRoot, header.TxRoot,
+			header.RctRoot, header.UncleRoot, header.Bloom, header.Timestamp, header.MhKey, increment, in.db.Node.ChainID},
+		keyArgs: []interface{}{in.db.Node.ChainID, header.BlockNumber, header.BlockHash},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := in.indexHeaderSource(tx, header, validated, diffRoot); err != nil {
+		return 0, err
+	}
+	if in.crossValidate {
+		_, err = tx.Exec(`UPDATE eth.header_cids SET times_validated = (SELECT COUNT(*) FROM eth.header_sources
+								WHERE header_sources.chain_id = $1 AND header_sources.block_number = $2 AND header_sources.block_hash = $3
+								AND header_sources.validated
+								AND (header_sources.state_root IS NULL OR header_sources.state_root = header_cids.state_root))
+							WHERE chain_id = $1 AND block_number = $2 AND block_hash = $3`,
+			in.db.Node.ChainID, header.BlockNumber, header.BlockHash)
+		if err != nil {
+			return 0, err
+		}
 	}
-	return headerID, err
+	prom.BlockInc()
+	return headerID, nil
 }
 
-func (in *CIDIndexer) indexUncleCID(tx *sqlx.Tx, uncle UncleModel, headerID int64) error {
-	_, err := tx.Exec(`INSERT INTO eth.uncle_cids (block_hash, header_id, parent_hash, cid, reward, mh_key) VALUES ($1, $2, $3, $4, $5, $6)
-								ON CONFLICT (header_id, block_hash) DO UPDATE SET (parent_hash, cid, reward, mh_key) = ($3, $4, $5, $6)`,
-		uncle.BlockHash, headerID, uncle.ParentHash, uncle.CID, uncle.Reward, uncle.MhKey)
+// indexHeaderSource records the indexer's node as a source of the header, and records any disagreement between it and the other
+// sources of the height in eth.source_conflicts
+// Nodes which supplied different blocks at the height conflict on the block hash, nodes which supplied the same block but whose
+// state diffs hashed up to different state roots conflict on the state root
+func (in *CIDIndexer) indexHeaderSource(tx *sqlx.Tx, header HeaderModel, validated bool, diffRoot string) error {
+	_, err := tx.Exec(`INSERT INTO eth.header_sources (chain_id, block_number, block_hash, node_id, state_root, validated)
+							VALUES ($1, $2, $3, $4, NULLIF($5::VARCHAR(66), ''), $6)
+							ON CONFLICT (chain_id, block_number, block_hash, node_id) DO UPDATE SET (state_root, validated, times_indexed, indexed_at) =
+							(COALESCE(EXCLUDED.state_root, eth.header_sources.state_root), eth.header_sources.validated OR EXCLUDED.validated, eth.header_sources.times_indexed + 1, now())`,
+		in.db.Node.ChainID, header.BlockNumber, header.BlockHash, in.db.NodeID, diffRoot, validated)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`INSERT INTO eth.source_conflicts (chain_id, block_number, kind, node_id, block_hash, state_root, other_node_id, other_block_hash, other_state_root)
+							SELECT $1, $2, CASE WHEN other.block_hash <> $3 THEN 'block_hash' ELSE 'state_root' END, $4, $3, source.state_root,
+							other.node_id, other.block_hash, other.state_root
+							FROM eth.header_sources AS source, eth.header_sources AS other
+							WHERE source.chain_id = $1 AND source.block_number = $2 AND source.block_hash = $3 AND source.node_id = $4
+							AND other.chain_id = $1 AND other.block_number = $2 AND other.node_id <> $4
+							AND (other.block_hash <> $3 OR other.state_root <> source.state_root)
+							AND NOT EXISTS (SELECT 1 FROM eth.source_conflicts
+								WHERE source_conflicts.chain_id = $1 AND source_conflicts.block_number = $2
+								AND source_conflicts.node_id = other.node_id AND source_conflicts.block_hash = other.block_hash
+								AND source_conflicts.other_node_id = $4 AND source_conflicts.other_block_hash = $3)
+							ON CONFLICT DO NOTHING`,
+		in.db.Node.ChainID, header.BlockNumber, header.BlockHash, in.db.NodeID)
+	if err != nil {
+		return err
+	}
+	if conflicts, err := res.RowsAffected(); err == nil && conflicts > 0 {
+		log.Warnf("eth indexer: header %s at height %s from node %s conflicts with %d other source(s), see eth.source_conflicts",
+			header.BlockHash, header.BlockNumber, in.db.Node.ID, conflicts)
+	}
+	return nil
+}
+
+func (in *CIDIndexer) indexUncleCID(tx *sqlx.Tx, uncle UncleModel, headerID int64, blockNumber uint64) error {
+	_, err := in.upsert(tx, upsert{
+		table: "uncle_cids",
+		pgStr: `INSERT INTO eth.uncle_cids (block_hash, header_id, parent_hash, cid, reward, mh_key, block_number) VALUES ($1, $2, $3, $4, $5, $6, $7)
+								ON CONFLICT (header_id, block_hash, block_number) DO UPDATE SET (parent_hash, cid, reward, mh_key) = ($3, $4, $5, $6)`,
+		args:    []interface{}{uncle.BlockHash, headerID, uncle.ParentHash, uncle.CID, uncle.Reward, uncle.MhKey, blockNumber},
+		keyArgs: []interface{}{headerID, uncle.BlockHash, blockNumber},
+	})
 	return err
 }
 
-func (in *CIDIndexer) indexTransactionAndReceiptCIDs(tx *sqlx.Tx, payload CIDPayload, headerID int64) error {
+func (in *CIDIndexer) indexTransactionAndReceiptCIDs(tx *sqlx.Tx, payload CIDPayload, headerID int64, blockNumber uint64) error {
 	for _, trxCidMeta := range payload.TransactionCIDs {
-		var txID int64
-		err := tx.QueryRowx(`INSERT INTO eth.transaction_cids (header_id, tx_hash, cid, dst, src, index, mh_key, tx_data) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-									ON CONFLICT (header_id, tx_hash) DO UPDATE SET (cid, dst, src, index, mh_key, tx_data) = ($3, $4, $5, $6, $7, $8)
-									RETURNING id`,
-			headerID, trxCidMeta.TxHash, trxCidMeta.CID, trxCidMeta.Dst, trxCidMeta.Src, trxCidMeta.Index, trxCidMeta.MhKey, trxCidMeta.Data).Scan(&txID)
+		txID, err := in.indexTransactionCID(tx, trxCidMeta, headerID, blockNumber)
 		if err != nil {
 			return err
 		}
-		prom.TransactionInc()
 		receiptCidMeta, ok := payload.ReceiptCIDs[common.HexToHash(trxCidMeta.TxHash)]
 		if ok {
-			if err := in.indexReceiptCID(tx, receiptCidMeta, txID); err != nil {
+			if err := in.indexReceiptCID(tx, receiptCidMeta, txID, blockNumber); err != nil {
 				return err
 			}
 		}
@@ -129,39 +244,37 @@ func (in *CIDIndexer) indexTransactionAndReceiptCIDs(tx *sqlx.Tx, payload CIDPay
 	return nil
 }
 
-func (in *CIDIndexer) indexTransactionCID(tx *sqlx.Tx, transaction TxModel, headerID int64) (int64, error) {
-	var txID int64
-	err := tx.QueryRowx(`INSERT INTO eth.transaction_cids (header_id, tx_hash, cid, dst, src, index, mh_key, tx_data) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-									ON CONFLICT (header_id, tx_hash) DO UPDATE SET (cid, dst, src, index, mh_key, tx_data) = ($3, $4, $5, $6, $7, $8)
-									RETURNING id`,
-		headerID, transaction.TxHash, transaction.CID, transaction.Dst, transaction.Src, transaction.Index, transaction.MhKey, transaction.Data).Scan(&txID)
+func (in *CIDIndexer) indexTransactionCID(tx *sqlx.Tx, transaction TxModel, headerID int64, blockNumber uint64) (int64, error) {
+	txID, err := in.upsert(tx, upsert{
+		table: "transaction_cids",
+		pgStr: `INSERT INTO eth.transaction_cids (header_id, tx_hash, cid, dst, src, index, mh_key, tx_data, block_number) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+									ON CONFLICT (header_id, tx_hash, block_number) DO UPDATE SET (cid, dst, src, index, mh_key, tx_data) = ($3, $4, $5, $6, $7, $8)`,
+		args:    []interface{}{headerID, transaction.TxHash, transaction.CID, transaction.Dst, transaction.Src, transaction.Index, transaction.MhKey, transaction.Data, blockNumber},
+		keyArgs: []interface{}{headerID, transaction.TxHash, blockNumber},
+	})
 	if err == nil {
 		prom.TransactionInc()
 	}
 	return txID, err
 }
 
-func (in *CIDIndexer) indexReceiptCID(tx *sqlx.Tx, rct ReceiptModel, txID int64) error {
-	_, err := tx.Exec(`INSERT INTO eth.receipt_cids (tx_id, cid, contract, contract_hash, topic0s, topic1s, topic2s, topic3s, log_contracts, mh_key, post_state, post_status) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-							  ON CONFLICT (tx_id) DO UPDATE SET (cid, contract, contract_hash, topic0s, topic1s, topic2s, topic3s, log_contracts, mh_key, post_state, post_status) = ($2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
-		txID, rct.CID, rct.Contract, rct.ContractHash, rct.Topic0s, rct.Topic1s, rct.Topic2s, rct.Topic3s, rct.LogContracts, rct.MhKey, rct.PostState, rct.PostStatus)
+func (in *CIDIndexer) indexReceiptCID(tx *sqlx.Tx, rct ReceiptModel, txID int64, blockNumber uint64) error {
+	_, err := in.upsert(tx, upsert{
+		table: "receipt_cids",
+		pgStr: `INSERT INTO eth.receipt_cids (tx_id, cid, contract, contract_hash, topic0s, topic1s, topic2s, topic3s, log_contracts, mh_key, post_state, post_status, block_number) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+							  ON CONFLICT (tx_id, block_number) DO UPDATE SET (cid, contract, contract_hash, topic0s, topic1s, topic2s, topic3s, log_contracts, mh_key, post_state, post_status) = ($2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		args:    []interface{}{txID, rct.CID, rct.Contract, rct.ContractHash, rct.Topic0s, rct.Topic1s, rct.Topic2s, rct.Topic3s, rct.LogContracts, rct.MhKey, rct.PostState, rct.PostStatus, blockNumber},
+		keyArgs: []interface{}{txID, blockNumber},
+	})
 	if err == nil {
 		prom.ReceiptInc()
 	}
 	return err
 }
 
-func (in *CIDIndexer) indexStateAndStorageCIDs(tx *sqlx.Tx, payload CIDPayload, headerID int64) error {
+func (in *CIDIndexer) indexStateAndStorageCIDs(tx *sqlx.Tx, payload CIDPayload, headerID int64, blockNumber uint64) error {
 	for _, stateCID := range payload.StateNodeCIDs {
-		var stateID int64
-		var stateKey string
-		if stateCID.StateKey != nullHash.String() {
-			stateKey = stateCID.StateKey
-		}
-		err := tx.QueryRowx(`INSERT INTO eth.state_cids (header_id, state_leaf_key, cid, state_path, node_type, diff, mh_key) VALUES ($1, $2, $3, $4, $5, $6, $7)
-									ON CONFLICT (header_id, state_path) DO UPDATE SET (state_leaf_key, cid, node_type, diff, mh_key) = ($2, $3, $5, $6, $7)
-									RETURNING id`,
-			headerID, stateKey, stateCID.CID, stateCID.Path, stateCID.NodeType, true, stateCID.MhKey).Scan(&stateID)
+		stateID, err := in.indexStateCID(tx, stateCID, headerID, blockNumber)
 		if err != nil {
 			return err
 		}
@@ -169,12 +282,12 @@ func (in *CIDIndexer) indexStateAndStorageCIDs(tx *sqlx.Tx, payload CIDPayload,
 		if stateCID.NodeType == 2 {
 			statePath := common.Bytes2Hex(stateCID.Path)
 			for _, storageCID := range payload.StorageNodeCIDs[statePath] {
-				if err := in.indexStorageCID(tx, storageCID, stateID); err != nil {
+				if err := in.indexStorageCID(tx, storageCID, stateID, blockNumber); err != nil {
 					return err
 				}
 			}
 			if stateAccount, ok := payload.StateAccounts[statePath]; ok {
-				if err := in.indexStateAccount(tx, stateAccount, stateID); err != nil {
+				if err := in.indexStateAccount(tx, stateAccount, stateID, blockNumber); err != nil {
 					return err
 				}
 			}
@@ -183,33 +296,91 @@ func (in *CIDIndexer) indexStateAndStorageCIDs(tx *sqlx.Tx, payload CIDPayload,
 	return nil
 }
 
-func (in *CIDIndexer) indexStateCID(tx *sqlx.Tx, stateNode StateNodeModel, headerID int64) (int64, error) {
-	var stateID int64
+func (in *CIDIndexer) indexStateCID(tx *sqlx.Tx, stateNode StateNodeModel, headerID int64, blockNumber uint64) (int64, error) {
 	var stateKey string
 	if stateNode.StateKey != nullHash.String() {
 		stateKey = stateNode.StateKey
 	}
-	err := tx.QueryRowx(`INSERT INTO eth.state_cids (header_id, state_leaf_key, cid, state_path, node_type, diff, mh_key) VALUES ($1, $2, $3, $4, $5, $6, $7)
-									ON CONFLICT (header_id, state_path) DO UPDATE SET (state_leaf_key, cid, node_type, diff, mh_key) = ($2, $3, $5, $6, $7)
-									RETURNING id`,
-		headerID, stateKey, stateNode.CID, stateNode.Path, stateNode.NodeType, true, stateNode.MhKey).Scan(&stateID)
-	return stateID, err
+	return in.upsert(tx, upsert{
+		table: "state_cids",
+		pgStr: `INSERT INTO eth.state_cids (header_id, state_leaf_key, cid, state_path, node_type, diff, mh_key, block_number) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+									ON CONFLICT (header_id, state_path, block_number) DO UPDATE SET (state_leaf_key, cid, node_type, diff, mh_key) = ($2, $3, $5, $6 OR eth.state_cids.diff, $7)`,
+		args:    []interface{}{headerID, stateKey, stateNode.CID, stateNode.Path, stateNode.NodeType, stateNode.Diff, stateNode.MhKey, blockNumber},
+		keyArgs: []interface{}{headerID, stateNode.Path, blockNumber},
+	})
 }
 
-func (in *CIDIndexer) indexStateAccount(tx *sqlx.Tx, stateAccount StateAccountModel, stateID int64) error {
-	_, err := tx.Exec(`INSERT INTO eth.state_accounts (state_id, balance, nonce, code_hash, storage_root) VALUES ($1, $2, $3, $4, $5)
-							  ON CONFLICT (state_id) DO UPDATE SET (balance, nonce, code_hash, storage_root) = ($2, $3, $4, $5)`,
-		stateID, stateAccount.Balance, stateAccount.Nonce, stateAccount.CodeHash, stateAccount.StorageRoot)
+func (in *CIDIndexer) indexStateAccount(tx *sqlx.Tx, stateAccount StateAccountModel, stateID int64, blockNumber uint64) error {
+	_, err := in.upsert(tx, upsert{
+		table: "state_accounts",
+		pgStr: `INSERT INTO eth.state_accounts (state_id, balance, nonce, code_hash, storage_root, block_number) VALUES ($1, $2, $3, $4, $5, $6)
+							  ON CONFLICT (state_id, block_number) DO UPDATE SET (balance, nonce, code_hash, storage_root) = ($2, $3, $4, $5)`,
+		args:    []interface{}{stateID, stateAccount.Balance, stateAccount.Nonce, stateAccount.CodeHash, stateAccount.StorageRoot, blockNumber},
+		keyArgs: []interface{}{stateID, blockNumber},
+	})
 	return err
 }
 
-func (in *CIDIndexer) indexStorageCID(tx *sqlx.Tx, storageCID StorageNodeModel, stateID int64) error {
+func (in *CIDIndexer) indexStorageCID(tx *sqlx.Tx, storageCID StorageNodeModel, stateID int64, blockNumber uint64) error {
 	var storageKey string
 	if storageCID.StorageKey != nullHash.String() {
 		storageKey = storageCID.StorageKey
 	}
-	_, err := tx.Exec(`INSERT INTO eth.storage_cids (state_id, storage_leaf_key, cid, storage_path, node_type, diff, mh_key) VALUES ($1, $2, $3, $4, $5, $6, $7) 
-							  ON CONFLICT (state_id, storage_path) DO UPDATE SET (storage_leaf_key, cid, node_type, diff, mh_key) = ($2, $3, $5, $6, $7)`,
-		stateID, storageKey, storageCID.CID, storageCID.Path, storageCID.NodeType, true, storageCID.MhKey)
+	_, err := in.upsert(tx, upsert{
+		table: "storage_cids",
+		pgStr: `INSERT INTO eth.storage_cids (state_id, storage_leaf_key, cid, storage_path, node_type, diff, mh_key, block_number) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+							  ON CONFLICT (state_id, storage_path, block_number) DO UPDATE SET (storage_leaf_key, cid, node_type, diff, mh_key) = ($2, $3, $5, $6 OR eth.storage_cids.diff, $7)`,
+		args:    []interface{}{stateID, storageKey, storageCID.CID, storageCID.Path, storageCID.NodeType, storageCID.Diff, storageCID.MhKey, blockNumber},
+		keyArgs: []interface{}{stateID, storageCID.Path, blockNumber},
+	})
+	return err
+}
+
+// indexCodeCID indexes contract code at the earliest block it has been seen at on the chain of the node
+// the creating tx is only known for contracts created directly by a transaction, it is left NULL otherwise
+func (in *CIDIndexer) indexCodeCID(tx *sqlx.Tx, code CodeModel) error {
+	_, err := tx.Exec(`INSERT INTO eth.code_cids (code_hash, mh_key, size, header_id, block_number, tx_hash, chain_id) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+							  ON CONFLICT (chain_id, code_hash) DO UPDATE SET (header_id, block_number, tx_hash) = (EXCLUDED.header_id, EXCLUDED.block_number, EXCLUDED.tx_hash)
+							  WHERE EXCLUDED.block_number < eth.code_cids.block_number
+							  OR (EXCLUDED.block_number = eth.code_cids.block_number AND eth.code_cids.tx_hash IS NULL AND EXCLUDED.tx_hash IS NOT NULL)`,
+		code.CodeHash, code.MhKey, code.Size, code.HeaderID, code.BlockNumber, code.TxHash, in.db.Node.ChainID)
+	return err
+}
+
+// indexAddressPreimages records the addresses behind their state leaf keys, addresses which are already recorded are skipped
+// rows are inserted in leaf key order, so that workers inserting the same addresses concurrently lock them in the same order
+func (in *CIDIndexer) indexAddressPreimages(tx *sqlx.Tx, addresses map[common.Address]bool) error {
+	if len(addresses) == 0 {
+		return nil
+	}
+	preimages := make(map[string]string, len(addresses))
+	keys := make([]string, 0, len(addresses))
+	for address := range addresses {
+		key := crypto.Keccak256Hash(address.Bytes()).String()
+		preimages[key] = address.String()
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = preimages[key]
+	}
+	_, err := tx.Exec(`INSERT INTO eth.address_preimages (state_leaf_key, address) SELECT * FROM unnest($1::VARCHAR(66)[], $2::VARCHAR(66)[])
+							  ON CONFLICT (state_leaf_key) DO NOTHING`,
+		pq.Array(keys), pq.Array(values))
+	return err
+}
+
+// indexTraceCID indexes a single frame of a transaction's call tree, re-tracing a transaction with a different result is a conflict
+func (in *CIDIndexer) indexTraceCID(tx *sqlx.Tx, trace TraceModel) error {
+	_, err := in.upsert(tx, upsert{
+		table: "trace_cids",
+		pgStr: `INSERT INTO eth.trace_cids (tx_id, index, depth, call_type, src, dst, value, input_selector, gas, gas_used, error, cid, mh_key, block_number)
+							  VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::NUMERIC, NULLIF($8, ''), $9, $10, NULLIF($11, ''), $12, $13, $14)
+							  ON CONFLICT (tx_id, index, block_number) DO UPDATE SET (depth, call_type, src, dst, value, input_selector, gas, gas_used, error, cid, mh_key) =
+							  (EXCLUDED.depth, EXCLUDED.call_type, EXCLUDED.src, EXCLUDED.dst, EXCLUDED.value, EXCLUDED.input_selector, EXCLUDED.gas, EXCLUDED.gas_used, EXCLUDED.error, EXCLUDED.cid, EXCLUDED.mh_key)`,
+		args:    []interface{}{trace.TxID, trace.Index, trace.Depth, trace.CallType, trace.Src, trace.Dst, trace.Value, trace.Selector, trace.Gas, trace.GasUsed, trace.Error, trace.CID, trace.MhKey, trace.BlockNumber},
+		keyArgs: []interface{}{trace.TxID, trace.Index, trace.BlockNumber},
+	})
 	return err
 }
@@ -23,6 +23,7 @@ import (
 
 	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
 )
@@ -133,5 +134,173 @@ var _ = Describe("Indexer", func() {
 				Path:       []byte{},
 			}))
 		})
+		It("Records the block number on every CID table", func() {
+			err = repo.Index(mocks.MockCIDPayload)
+			Expect(err).ToNot(HaveOccurred())
+			for _, table := range []string{"eth.transaction_cids", "eth.receipt_cids", "eth.state_cids", "eth.state_accounts", "eth.storage_cids"} {
+				blockNumbers := make([]uint64, 0)
+				err = db.Select(&blockNumbers, `SELECT DISTINCT block_number FROM `+table)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(blockNumbers).To(Equal([]uint64{mocks.BlockNumber.Uint64()}), table)
+			}
+		})
+	})
+
+	Describe("Cross validation", func() {
+		var (
+			otherDB   *postgres.DB
+			otherRepo *eth.CIDIndexer
+		)
+		BeforeEach(func() {
+			otherDB, err = shared.SetupDBWithNode(node.Info{ID: "otherSourceNode"})
+			Expect(err).ToNot(HaveOccurred())
+			otherRepo = eth.NewCIDIndexer(otherDB)
+			repo.SetCrossValidation(true)
+			otherRepo.SetCrossValidation(true)
+		})
+		AfterEach(func() {
+			otherDB.Close()
+		})
+
+		It("Records every node which supplied a header", func() {
+			err = repo.Index(mocks.MockCIDPayload)
+			Expect(err).ToNot(HaveOccurred())
+			err = repo.Index(mocks.MockCIDPayload)
+			Expect(err).ToNot(HaveOccurred())
+			err = otherRepo.Index(mocks.MockCIDPayload)
+			Expect(err).ToNot(HaveOccurred())
+			type source struct {
+				NodeID       int64 `db:"node_id"`
+				TimesIndexed int   `db:"times_indexed"`
+			}
+			sources := make([]source, 0)
+			err = db.Select(&sources, `SELECT node_id, times_indexed FROM eth.header_sources WHERE block_hash = $1 ORDER BY times_indexed DESC`,
+				mocks.MockCIDPayload.HeaderCID.BlockHash)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sources).To(Equal([]source{{NodeID: db.NodeID, TimesIndexed: 2}, {NodeID: otherDB.NodeID, TimesIndexed: 1}}))
+		})
+
+		It("Counts the independent sources which agree on a header as its validation level", func() {
+			err = repo.Index(mocks.MockCIDPayload)
+			Expect(err).ToNot(HaveOccurred())
+			err = repo.Index(mocks.MockCIDPayload)
+			Expect(err).ToNot(HaveOccurred())
+			var timesValidated int
+			err = db.Get(&timesValidated, `SELECT times_validated FROM eth.header_cids WHERE block_hash = $1`, mocks.MockCIDPayload.HeaderCID.BlockHash)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(timesValidated).To(Equal(1))
+			err = otherRepo.Index(mocks.MockCIDPayload)
+			Expect(err).ToNot(HaveOccurred())
+			err = db.Get(&timesValidated, `SELECT times_validated FROM eth.header_cids WHERE block_hash = $1`, mocks.MockCIDPayload.HeaderCID.BlockHash)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(timesValidated).To(Equal(2))
+		})
+
+		It("Records conflicting block hashes", func() {
+			err = repo.Index(mocks.MockCIDPayload)
+			Expect(err).ToNot(HaveOccurred())
+			conflicting := eth.CIDPayload{HeaderCID: mocks.MockCIDPayload.HeaderCID}
+			conflicting.HeaderCID.BlockHash = common.HexToHash("0xfff").String()
+			err = otherRepo.Index(conflicting)
+			Expect(err).ToNot(HaveOccurred())
+			type conflict struct {
+				Kind           string `db:"kind"`
+				NodeID         int64  `db:"node_id"`
+				BlockHash      string `db:"block_hash"`
+				OtherNodeID    int64  `db:"other_node_id"`
+				OtherBlockHash string `db:"other_block_hash"`
+			}
+			conflicts := make([]conflict, 0)
+			err = db.Select(&conflicts, `SELECT kind, node_id, block_hash, other_node_id, other_block_hash FROM eth.source_conflicts`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(conflicts).To(Equal([]conflict{{
+				Kind:           "block_hash",
+				NodeID:         otherDB.NodeID,
+				BlockHash:      conflicting.HeaderCID.BlockHash,
+				OtherNodeID:    db.NodeID,
+				OtherBlockHash: mocks.MockCIDPayload.HeaderCID.BlockHash,
+			}}))
+			// indexing the header again doesn't record the conflict twice, from either side
+			err = repo.Index(mocks.MockCIDPayload)
+			Expect(err).ToNot(HaveOccurred())
+			var count int
+			err = db.Get(&count, `SELECT COUNT(*) FROM eth.source_conflicts`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(count).To(Equal(1))
+		})
+	})
+
+	Describe("Conflicting content", func() {
+		var conflicting eth.CIDPayload
+		BeforeEach(func() {
+			err = repo.Index(mocks.MockCIDPayload)
+			Expect(err).ToNot(HaveOccurred())
+			conflicting = mocks.MockCIDPayload
+			conflicting.TransactionCIDs = append([]eth.TxModel{}, mocks.MockCIDPayload.TransactionCIDs...)
+			conflicting.TransactionCIDs[0].CID = mocks.Trx2CID.String()
+		})
+		txCID := func() string {
+			var cid string
+			err = db.Get(&cid, `SELECT cid FROM eth.transaction_cids WHERE tx_hash = $1`, mocks.MockCIDPayload.TransactionCIDs[0].TxHash)
+			Expect(err).ToNot(HaveOccurred())
+			return cid
+		}
+		conflicts := func() []bool {
+			overwritten := make([]bool, 0)
+			err = db.Select(&overwritten, `SELECT overwritten FROM eth.upsert_conflicts WHERE table_name = 'eth.transaction_cids'`)
+			Expect(err).ToNot(HaveOccurred())
+			return overwritten
+		}
+
+		It("Doesn't record re-indexing the same content", func() {
+			err = repo.Index(mocks.MockCIDPayload)
+			Expect(err).ToNot(HaveOccurred())
+			var count int
+			err = db.Get(&count, `SELECT COUNT(*) FROM eth.upsert_conflicts`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(count).To(Equal(0))
+		})
+
+		It("Overwrites conflicting content and records the change by default", func() {
+			err = repo.Index(conflicting)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(txCID()).To(Equal(mocks.Trx2CID.String()))
+			Expect(conflicts()).To(Equal([]bool{true}))
+		})
+
+		It("Keeps the indexed content when auditing conflicts", func() {
+			repo.SetConflictMode(shared.AuditConflicts)
+			err = repo.Index(conflicting)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(txCID()).To(Equal(mocks.Trx1CID.String()))
+			Expect(conflicts()).To(Equal([]bool{false}))
+		})
+
+		It("Rejects payloads with conflicting content", func() {
+			repo.SetConflictMode(shared.RejectConflicts)
+			err = repo.Index(conflicting)
+			Expect(err).To(HaveOccurred())
+			Expect(err).To(BeAssignableToTypeOf(&eth.ConflictError{}))
+			Expect(txCID()).To(Equal(mocks.Trx1CID.String()))
+			Expect(conflicts()).To(BeEmpty())
+		})
+
+		It("Keeps the greater total difficulty of a header without recording a conflict", func() {
+			repo.SetConflictMode(shared.RejectConflicts)
+			greater := mocks.MockCIDPayload
+			greater.HeaderCID.TotalDifficulty = "1000000000000"
+			err = repo.Index(greater)
+			Expect(err).ToNot(HaveOccurred())
+			err = repo.Index(mocks.MockCIDPayload)
+			Expect(err).ToNot(HaveOccurred())
+			var td string
+			err = db.Get(&td, `SELECT td FROM eth.header_cids WHERE block_hash = $1`, mocks.MockCIDPayload.HeaderCID.BlockHash)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(td).To(Equal("1000000000000"))
+			var count int
+			err = db.Get(&count, `SELECT COUNT(*) FROM eth.upsert_conflicts`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(count).To(Equal(0))
+		})
 	})
 })
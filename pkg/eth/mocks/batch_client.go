@@ -20,9 +20,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/statediff"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
 )
 
 // BackFillerClient is a mock client for use in backfiller tests
@@ -84,3 +88,46 @@ func (mc *BackFillerClient) BatchCallContext(ctx context.Context, batch []rpc.Ba
 	}
 	return nil
 }
+
+// TraceClient is a mock client for use in trace fetcher tests
+type TraceClient struct {
+	MappedTracesAt map[uint64][]byte
+}
+
+// SetReturnTracesAt method to set what traces the mock client returns
+func (mc *TraceClient) SetReturnTracesAt(height uint64, traces []eth.TxTrace) error {
+	if mc.MappedTracesAt == nil {
+		mc.MappedTracesAt = make(map[uint64][]byte)
+	}
+	by, err := json.Marshal(traces)
+	if err != nil {
+		return err
+	}
+	mc.MappedTracesAt[height] = by
+	return nil
+}
+
+// BatchCallContext mockClient method to simulate batch call to geth
+func (mc *TraceClient) BatchCallContext(ctx context.Context, batch []rpc.BatchElem) error {
+	if mc.MappedTracesAt == nil {
+		return errors.New("mockclient needs to be initialized with traces")
+	}
+	for i, batchElem := range batch {
+		if len(batchElem.Args) < 2 {
+			return errors.New("expected batch elem to contain a block number and a trace config")
+		}
+		blockHeight, ok := batchElem.Args[0].(hexutil.Uint64)
+		if !ok {
+			return errors.New("expected batch elem first argument to be a hexutil.Uint64")
+		}
+		traces, ok := mc.MappedTracesAt[uint64(blockHeight)]
+		if !ok {
+			batch[i].Error = fmt.Errorf("block #%d not found", blockHeight)
+			continue
+		}
+		if err := json.Unmarshal(traces, batchElem.Result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
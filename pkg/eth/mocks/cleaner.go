@@ -0,0 +1,42 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package mocks
+
+import (
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+// Cleaner mock for tests
+type Cleaner struct {
+	PassedResetRanges [][2]uint64
+	PassedCleanRanges [][2]uint64
+	PassedDataType    shared.DataType
+	ReturnErr         error
+}
+
+// ResetValidation mock method
+func (c *Cleaner) ResetValidation(rngs [][2]uint64) error {
+	c.PassedResetRanges = append(c.PassedResetRanges, rngs...)
+	return c.ReturnErr
+}
+
+// Clean mock method
+func (c *Cleaner) Clean(rngs [][2]uint64, t shared.DataType) error {
+	c.PassedCleanRanges = append(c.PassedCleanRanges, rngs...)
+	c.PassedDataType = t
+	return c.ReturnErr
+}
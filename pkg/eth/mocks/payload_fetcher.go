@@ -21,6 +21,8 @@ import (
 	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/statediff"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
 )
 
 // PayloadFetcher mock for tests
@@ -48,3 +50,24 @@ func (fetcher *PayloadFetcher) FetchAt(blockHeights []uint64) ([]statediff.Paylo
 	}
 	return results, nil
 }
+
+// TraceFetcher mock for tests
+type TraceFetcher struct {
+	TracesToReturn       map[uint64][]eth.TxTrace
+	CalledAtBlockHeights [][]uint64
+}
+
+// FetchTracesAt mock method
+func (fetcher *TraceFetcher) FetchTracesAt(blockHeights []uint64) (map[uint64][]eth.TxTrace, error) {
+	if fetcher.TracesToReturn == nil {
+		return nil, errors.New("mock TraceFetcher needs to be initialized with traces to return")
+	}
+	fetcher.CalledAtBlockHeights = append(fetcher.CalledAtBlockHeights, blockHeights)
+	results := make(map[uint64][]eth.TxTrace, len(blockHeights))
+	for _, height := range blockHeights {
+		if traces, ok := fetcher.TracesToReturn[height]; ok {
+			results[height] = traces
+		}
+	}
+	return results, nil
+}
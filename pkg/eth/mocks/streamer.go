@@ -19,6 +19,8 @@ package mocks
 import (
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/statediff"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
 )
 
 // PayloadStreamer mock struct
@@ -30,7 +32,7 @@ type PayloadStreamer struct {
 }
 
 // Stream mock method
-func (sds *PayloadStreamer) Stream(payloadChan chan statediff.Payload) (*rpc.ClientSubscription, error) {
+func (sds *PayloadStreamer) Stream(payloadChan chan statediff.Payload) (eth.Subscription, error) {
 	sds.PassedPayloadChan = payloadChan
 
 	go func() {
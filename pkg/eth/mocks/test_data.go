@@ -20,11 +20,13 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"encoding/json"
 	"math/big"
 
 	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -254,7 +256,7 @@ var (
 
 	nonce1             = uint64(1)
 	ContractRoot       = "0x821e2556a290c86405f8160a2d662042a431ba456b9db265c79bb837c04be5f0"
-	ContractCodeHash   = common.HexToHash("0x753f98a8d4328b15636e46f66f2cb4bc860100aa17967cc145fcd17d1d4710ea")
+	ContractCodeHash   = MockCodeHash
 	contractPath       = common.Bytes2Hex([]byte{'\x06'})
 	ContractLeafKey    = testhelpers.AddressToLeafKey(ContractAddress)
 	ContractAccount, _ = rlp.EncodeToBytes(state.Account{
@@ -343,6 +345,7 @@ var (
 			MhKey:    State1MhKey,
 			Path:     []byte{'\x06'},
 			NodeType: 2,
+			Diff:     true,
 			StateKey: common.BytesToHash(ContractLeafKey).Hex(),
 		},
 		{
@@ -350,6 +353,7 @@ var (
 			MhKey:    State2MhKey,
 			Path:     []byte{'\x0c'},
 			NodeType: 2,
+			Diff:     true,
 			StateKey: common.BytesToHash(AccountLeafKey).Hex(),
 		},
 	}
@@ -414,6 +418,7 @@ var (
 					Path:       []byte{},
 					StorageKey: common.BytesToHash(StorageLeafKey).Hex(),
 					NodeType:   2,
+					Diff:       true,
 				},
 			},
 		},
@@ -432,6 +437,60 @@ var (
 			},
 		},
 	}
+
+	// call trace data
+	MockBalanceOfInput = hexutil.MustDecode("0x70a08231000000000000000000000000ae9bea628c4ce503dcfd7e305cab4e29e7476592")
+	MockCallTrace      = eth.CallFrame{
+		Type:    "CALL",
+		From:    SenderAddr,
+		To:      Address,
+		Value:   (*hexutil.Big)(big.NewInt(1000)),
+		Gas:     50,
+		GasUsed: 45,
+		Input:   []byte{},
+		Calls: []eth.CallFrame{
+			{
+				Type:    "STATICCALL",
+				From:    Address,
+				To:      AnotherAddress,
+				Gas:     30,
+				GasUsed: 5,
+				Input:   MockBalanceOfInput,
+			},
+			{
+				Type:    "CALL",
+				From:    Address,
+				To:      AnotherAddress,
+				Value:   (*hexutil.Big)(big.NewInt(10)),
+				Gas:     20,
+				GasUsed: 20,
+				Input:   []byte{},
+				Error:   "out of gas",
+			},
+		},
+	}
+	MockCallTraces = []eth.TxTrace{
+		mockTxTrace(MockCallTrace),
+		mockTxTrace(eth.CallFrame{
+			Type:    "CALL",
+			From:    SenderAddr,
+			To:      AnotherAddress,
+			Value:   (*hexutil.Big)(big.NewInt(2000)),
+			Gas:     100,
+			GasUsed: 21,
+			Input:   []byte{},
+		}),
+		mockTxTrace(eth.CallFrame{
+			Type:    "CREATE",
+			From:    SenderAddr,
+			To:      ContractAddress,
+			Value:   (*hexutil.Big)(big.NewInt(1500)),
+			Gas:     75,
+			GasUsed: 75,
+			Input:   MockContractByteCode,
+			Output:  MockContractByteCode,
+		}),
+	}
 )
 
 // createTransactionsAndReceipts is a helper function to generate signed mock transactions and mock receipts with mock logs
@@ -474,3 +533,12 @@ func createTransactionsAndReceipts() (types.Transactions, types.Receipts, common
 	mockReceipt3.TxHash = signedTrx3.Hash()
 	return types.Transactions{signedTrx1, signedTrx2, signedTrx3}, types.Receipts{mockReceipt1, mockReceipt2, mockReceipt3}, SenderAddr
 }
+
+// mockTxTrace is a helper function to wrap a call frame in the result returned by debug_traceBlockByNumber
+func mockTxTrace(frame eth.CallFrame) eth.TxTrace {
+	result, err := json.Marshal(frame)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return eth.TxTrace{Result: result}
+}
@@ -18,6 +18,8 @@ package mocks
 
 import (
 	"github.com/ethereum/go-ethereum/statediff"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
 )
 
 // Transformer for testing
@@ -52,3 +54,19 @@ func (t *IterativeTransformer) Transform(workerID int, payload statediff.Payload
 	t.iteration++
 	return height, t.ReturnErr
 }
+
+// TraceTransformer for testing
+type TraceTransformer struct {
+	PassedWorkerIDs []int
+	PassedPayloads  []statediff.Payload
+	PassedTraces    [][]eth.TxTrace
+	ReturnErr       error
+}
+
+// Transform mock method
+func (t *TraceTransformer) Transform(workerID int, payload statediff.Payload, traces []eth.TxTrace) error {
+	t.PassedWorkerIDs = append(t.PassedWorkerIDs, workerID)
+	t.PassedPayloads = append(t.PassedPayloads, payload)
+	t.PassedTraces = append(t.PassedTraces, traces)
+	return t.ReturnErr
+}
@@ -40,32 +40,35 @@ type HeaderModel struct {
 
 // UncleModel is the db model for eth.uncle_cids
 type UncleModel struct {
-	ID         int64  `db:"id"`
-	HeaderID   int64  `db:"header_id"`
-	BlockHash  string `db:"block_hash"`
-	ParentHash string `db:"parent_hash"`
-	CID        string `db:"cid"`
-	MhKey      string `db:"mh_key"`
-	Reward     string `db:"reward"`
+	ID          int64  `db:"id"`
+	HeaderID    int64  `db:"header_id"`
+	BlockNumber uint64 `db:"block_number"`
+	BlockHash   string `db:"block_hash"`
+	ParentHash  string `db:"parent_hash"`
+	CID         string `db:"cid"`
+	MhKey       string `db:"mh_key"`
+	Reward      string `db:"reward"`
 }
 
 // TxModel is the db model for eth.transaction_cids
 type TxModel struct {
-	ID       int64  `db:"id"`
-	HeaderID int64  `db:"header_id"`
-	Index    int64  `db:"index"`
-	TxHash   string `db:"tx_hash"`
-	CID      string `db:"cid"`
-	MhKey    string `db:"mh_key"`
-	Dst      string `db:"dst"`
-	Src      string `db:"src"`
-	Data     []byte `db:"tx_data"`
+	ID          int64  `db:"id"`
+	HeaderID    int64  `db:"header_id"`
+	BlockNumber uint64 `db:"block_number"`
+	Index       int64  `db:"index"`
+	TxHash      string `db:"tx_hash"`
+	CID         string `db:"cid"`
+	MhKey       string `db:"mh_key"`
+	Dst         string `db:"dst"`
+	Src         string `db:"src"`
+	Data        []byte `db:"tx_data"`
 }
 
 // ReceiptModel is the db model for eth.receipt_cids
 type ReceiptModel struct {
 	ID           int64          `db:"id"`
 	TxID         int64          `db:"tx_id"`
+	BlockNumber  uint64         `db:"block_number"`
 	CID          string         `db:"cid"`
 	MhKey        string         `db:"mh_key"`
 	PostStatus   uint64         `db:"post_status"`
@@ -81,26 +84,28 @@ type ReceiptModel struct {
 
 // StateNodeModel is the db model for eth.state_cids
 type StateNodeModel struct {
-	ID       int64  `db:"id"`
-	HeaderID int64  `db:"header_id"`
-	Path     []byte `db:"state_path"`
-	StateKey string `db:"state_leaf_key"`
-	NodeType int    `db:"node_type"`
-	CID      string `db:"cid"`
-	MhKey    string `db:"mh_key"`
-	Diff     bool   `db:"diff"`
+	ID          int64  `db:"id"`
+	HeaderID    int64  `db:"header_id"`
+	BlockNumber uint64 `db:"block_number"`
+	Path        []byte `db:"state_path"`
+	StateKey    string `db:"state_leaf_key"`
+	NodeType    int    `db:"node_type"`
+	CID         string `db:"cid"`
+	MhKey       string `db:"mh_key"`
+	Diff        bool   `db:"diff"`
 }
 
 // StorageNodeModel is the db model for eth.storage_cids
 type StorageNodeModel struct {
-	ID         int64  `db:"id"`
-	StateID    int64  `db:"state_id"`
-	Path       []byte `db:"storage_path"`
-	StorageKey string `db:"storage_leaf_key"`
-	NodeType   int    `db:"node_type"`
-	CID        string `db:"cid"`
-	MhKey      string `db:"mh_key"`
-	Diff       bool   `db:"diff"`
+	ID          int64  `db:"id"`
+	StateID     int64  `db:"state_id"`
+	BlockNumber uint64 `db:"block_number"`
+	Path        []byte `db:"storage_path"`
+	StorageKey  string `db:"storage_leaf_key"`
+	NodeType    int    `db:"node_type"`
+	CID         string `db:"cid"`
+	MhKey       string `db:"mh_key"`
+	Diff        bool   `db:"diff"`
 }
 
 // StorageNodeWithStateKeyModel is a db model for eth.storage_cids + eth.state_cids.state_key
@@ -120,8 +125,38 @@ type StorageNodeWithStateKeyModel struct {
 type StateAccountModel struct {
 	ID          int64  `db:"id"`
 	StateID     int64  `db:"state_id"`
+	BlockNumber uint64 `db:"block_number"`
 	Balance     string `db:"balance"`
 	Nonce       uint64 `db:"nonce"`
 	CodeHash    []byte `db:"code_hash"`
 	StorageRoot string `db:"storage_root"`
 }
+
+// CodeModel is the db model for eth.code_cids
+type CodeModel struct {
+	CodeHash    []byte `db:"code_hash"`
+	MhKey       string `db:"mh_key"`
+	Size        int    `db:"size"`
+	HeaderID    int64  `db:"header_id"`
+	BlockNumber uint64 `db:"block_number"`
+	TxHash      string `db:"tx_hash"`
+}
+
+// TraceModel is the db model for eth.trace_cids, a single call frame of a transaction's flattened call tree
+type TraceModel struct {
+	ID          int64  `db:"id"`
+	TxID        int64  `db:"tx_id"`
+	BlockNumber uint64 `db:"block_number"`
+	Index       int64  `db:"index"`
+	Depth       int64  `db:"depth"`
+	CallType    string `db:"call_type"`
+	Src         string `db:"src"`
+	Dst         string `db:"dst"`
+	Value       string `db:"value"`
+	Selector    string `db:"input_selector"`
+	Gas         uint64 `db:"gas"`
+	GasUsed     uint64 `db:"gas_used"`
+	Error       string `db:"error"`
+	CID         string `db:"cid"`
+	MhKey       string `db:"mh_key"`
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/statediff"
 )
@@ -53,6 +54,7 @@ func NewPayloadFetcher(bc BatchClient, timeout time.Duration) *PayloadFetcher {
 		timeout: timeout,
 		params: statediff.Params{
 			IncludeReceipts:          true,
+			IncludeCode:              true,
 			IncludeTD:                true,
 			IncludeBlock:             true,
 			IntermediateStateNodes:   true,
@@ -62,6 +64,11 @@ func NewPayloadFetcher(bc BatchClient, timeout time.Duration) *PayloadFetcher {
 }
 
 // FetchAt fetches the statediff payloads at the given block heights
+// WatchAddresses narrows the state diffs fetched from the node to the accounts at the addresses
+func (fetcher *PayloadFetcher) WatchAddresses(addresses []common.Address) {
+	fetcher.params.WatchedAddresses = addresses
+}
+
 // Calls StateDiffAt(ctx context.Context, blockNumber uint64, params Params) (*Payload, error)
 func (fetcher *PayloadFetcher) FetchAt(blockHeights []uint64) ([]statediff.Payload, error) {
 	batch := make([]rpc.BatchElem, 0)
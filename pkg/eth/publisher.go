@@ -23,9 +23,9 @@ import (
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/rlp"
 	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
-	"github.com/jmoiron/sqlx"
 	"github.com/multiformats/go-multihash"
 
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/ipfs/ipld"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
@@ -50,6 +50,11 @@ func NewIPLDPublisher(db *postgres.DB) *IPLDPublisher {
 	}
 }
 
+// SetBlockstore sets the blockstore the IPLDs are published to, by default they are published to public.blocks
+func (pub *IPLDPublisher) SetBlockstore(blocks blockstore.Blockstore) {
+	pub.indexer.blocks = blocks
+}
+
 // Publish publishes an IPLDPayload to IPFS and returns the corresponding CIDPayload
 func (pub *IPLDPublisher) Publish(payload ConvertedPayload) error {
 	// Generate the iplds
@@ -58,17 +63,22 @@ func (pub *IPLDPublisher) Publish(payload ConvertedPayload) error {
 		return err
 	}
 
+	blockNumber := payload.Block.NumberU64()
+	if err := pub.indexer.preparePartitions(blockNumber); err != nil {
+		return err
+	}
+
 	// Begin new db tx
-	tx, err := pub.indexer.db.Beginx()
+	tx, err := pub.indexer.beginx()
 	if err != nil {
 		return err
 	}
 	defer func() {
 		if p := recover(); p != nil {
-			shared.Rollback(tx)
+			shared.Rollback(tx.Tx)
 			panic(p)
 		} else if err != nil {
-			shared.Rollback(tx)
+			shared.Rollback(tx.Tx)
 		} else {
 			err = tx.Commit()
 		}
@@ -106,7 +116,7 @@ func (pub *IPLDPublisher) Publish(payload ConvertedPayload) error {
 		UncleRoot:       payload.Block.UncleHash().String(),
 		Timestamp:       payload.Block.Time(),
 	}
-	headerID, err := pub.indexer.indexHeaderCID(tx, header)
+	headerID, err := pub.indexer.indexHeaderCID(tx.Tx, header, true, "")
 	if err != nil {
 		return err
 	}
@@ -116,7 +126,7 @@ func (pub *IPLDPublisher) Publish(payload ConvertedPayload) error {
 		if err := shared.PublishIPLD(tx, uncleNode); err != nil {
 			return err
 		}
-		uncleReward := CalcUncleMinerReward(payload.Block.Number().Uint64(), uncleNode.Number.Uint64())
+		uncleReward := CalcUncleMinerReward(blockNumber, uncleNode.Number.Uint64())
 		uncle := UncleModel{
 			CID:        uncleNode.Cid().String(),
 			MhKey:      shared.MultihashKeyFromCID(uncleNode.Cid()),
@@ -124,7 +134,7 @@ func (pub *IPLDPublisher) Publish(payload ConvertedPayload) error {
 			BlockHash:  uncleNode.Hash().String(),
 			Reward:     uncleReward.String(),
 		}
-		if err := pub.indexer.indexUncleCID(tx, uncle, headerID); err != nil {
+		if err := pub.indexer.indexUncleCID(tx.Tx, uncle, headerID, blockNumber); err != nil {
 			return err
 		}
 	}
@@ -141,7 +151,7 @@ func (pub *IPLDPublisher) Publish(payload ConvertedPayload) error {
 		txModel := payload.TxMetaData[i]
 		txModel.CID = txNode.Cid().String()
 		txModel.MhKey = shared.MultihashKeyFromCID(txNode.Cid())
-		txID, err := pub.indexer.indexTransactionCID(tx, txModel, headerID)
+		txID, err := pub.indexer.indexTransactionCID(tx.Tx, txModel, headerID, blockNumber)
 		if err != nil {
 			return err
 		}
@@ -153,18 +163,18 @@ func (pub *IPLDPublisher) Publish(payload ConvertedPayload) error {
 		} else {
 			rctModel.PostState = common.Bytes2Hex(payload.Receipts[i].PostState)
 		}
-		if err := pub.indexer.indexReceiptCID(tx, rctModel, txID); err != nil {
+		if err := pub.indexer.indexReceiptCID(tx.Tx, rctModel, txID, blockNumber); err != nil {
 			return err
 		}
 	}
 
 	// Publish and index state and storage
-	err = pub.publishAndIndexStateAndStorage(tx, payload, headerID)
+	err = pub.publishAndIndexStateAndStorage(tx, payload, headerID, blockNumber)
 
 	return err // return err variable explicitly so that we return the err = tx.Commit() assignment in the defer
 }
 
-func (pub *IPLDPublisher) publishAndIndexStateAndStorage(tx *sqlx.Tx, payload ConvertedPayload, headerID int64) error {
+func (pub *IPLDPublisher) publishAndIndexStateAndStorage(tx *blockstore.Tx, payload ConvertedPayload, headerID int64, blockNumber uint64) error {
 	// Publish and index state and storage
 	for _, stateNode := range payload.StateNodes {
 		stateCIDStr, err := shared.PublishRaw(tx, ipld.MEthStateTrie, multihash.KECCAK_256, stateNode.Value)
@@ -178,8 +188,9 @@ func (pub *IPLDPublisher) publishAndIndexStateAndStorage(tx *sqlx.Tx, payload Co
 			CID:      stateCIDStr,
 			MhKey:    mhKey,
 			NodeType: ResolveFromNodeType(stateNode.Type),
+			Diff:     true,
 		}
-		stateID, err := pub.indexer.indexStateCID(tx, stateModel, headerID)
+		stateID, err := pub.indexer.indexStateCID(tx.Tx, stateModel, headerID, blockNumber)
 		if err != nil {
 			return err
 		}
@@ -202,7 +213,7 @@ func (pub *IPLDPublisher) publishAndIndexStateAndStorage(tx *sqlx.Tx, payload Co
 				CodeHash:    account.CodeHash,
 				StorageRoot: account.Root.String(),
 			}
-			if err := pub.indexer.indexStateAccount(tx, accountModel, stateID); err != nil {
+			if err := pub.indexer.indexStateAccount(tx.Tx, accountModel, stateID, blockNumber); err != nil {
 				return err
 			}
 			for _, storageNode := range payload.StorageNodes[common.Bytes2Hex(stateNode.Path)] {
@@ -217,8 +228,9 @@ func (pub *IPLDPublisher) publishAndIndexStateAndStorage(tx *sqlx.Tx, payload Co
 					CID:        storageCIDStr,
 					MhKey:      mhKey,
 					NodeType:   ResolveFromNodeType(storageNode.Type),
+					Diff:       true,
 				}
-				if err := pub.indexer.indexStorageCID(tx, storageModel, stateID); err != nil {
+				if err := pub.indexer.indexStorageCID(tx.Tx, storageModel, stateID, blockNumber); err != nil {
 					return err
 				}
 			}
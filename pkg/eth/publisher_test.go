@@ -176,6 +176,7 @@ var _ = Describe("PublishAndIndexer", func() {
 					Expect(account).To(Equal(eth.StateAccountModel{
 						ID:          account.ID,
 						StateID:     stateNode.ID,
+						BlockNumber: mocks.BlockNumber.Uint64(),
 						Balance:     "0",
 						CodeHash:    mocks.ContractCodeHash.Bytes(),
 						StorageRoot: mocks.ContractRoot,
@@ -190,6 +191,7 @@ var _ = Describe("PublishAndIndexer", func() {
 					Expect(account).To(Equal(eth.StateAccountModel{
 						ID:          account.ID,
 						StateID:     stateNode.ID,
+						BlockNumber: mocks.BlockNumber.Uint64(),
 						Balance:     "1000",
 						CodeHash:    mocks.AccountCodeHash.Bytes(),
 						StorageRoot: mocks.AccountRoot,
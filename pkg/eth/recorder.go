@@ -0,0 +1,147 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/statediff"
+)
+
+// maxRecordSize guards against reading absurdly large records from a corrupt payload file
+const maxRecordSize = 1 << 30
+
+// Recorder interface for substituting mocks in tests
+type Recorder interface {
+	Record(payload statediff.Payload) error
+	Close() error
+}
+
+// payloadRecord is the on-disk representation of a statediff.Payload
+// Records are written as a uvarint length prefix followed by the rlp encoded record
+type payloadRecord struct {
+	BlockNumber     uint64
+	BlockRlp        []byte
+	TotalDifficulty *big.Int `rlp:"nil"`
+	ReceiptsRlp     []byte
+	StateObjectRlp  []byte
+}
+
+func (r payloadRecord) payload() statediff.Payload {
+	return statediff.Payload{
+		BlockRlp:        r.BlockRlp,
+		TotalDifficulty: r.TotalDifficulty,
+		ReceiptsRlp:     r.ReceiptsRlp,
+		StateObjectRlp:  r.StateObjectRlp,
+	}
+}
+
+// PayloadRecorder satisfies the Recorder interface by appending raw payloads to a local file
+type PayloadRecorder struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+// NewPayloadRecorder opens (or creates) the payload file at the provided path for appending
+func NewPayloadRecorder(path string) (*PayloadRecorder, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &PayloadRecorder{file: f}, nil
+}
+
+// Record appends the payload to the file
+// It is safe for concurrent use
+func (pr *PayloadRecorder) Record(payload statediff.Payload) error {
+	header, err := PayloadHeader(payload)
+	if err != nil {
+		return err
+	}
+	enc, err := rlp.EncodeToBytes(payloadRecord{
+		BlockNumber:     header.Number.Uint64(),
+		BlockRlp:        payload.BlockRlp,
+		TotalDifficulty: payload.TotalDifficulty,
+		ReceiptsRlp:     payload.ReceiptsRlp,
+		StateObjectRlp:  payload.StateObjectRlp,
+	})
+	if err != nil {
+		return err
+	}
+	// write the whole record in a single call so that an interrupted write can only ever truncate the last record
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(enc))
+	buf = append(buf[:binary.PutUvarint(buf, uint64(len(enc)))], enc...)
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+	_, err = pr.file.Write(buf)
+	return err
+}
+
+// Close closes the underlying file
+func (pr *PayloadRecorder) Close() error {
+	pr.lock.Lock()
+	defer pr.lock.Unlock()
+	return pr.file.Close()
+}
+
+// payloadFileReader reads records sequentially out of a payload file, tracking their offsets
+type payloadFileReader struct {
+	br     *bufio.Reader
+	offset int64
+}
+
+func newPayloadFileReader(r io.Reader) *payloadFileReader {
+	return &payloadFileReader{br: bufio.NewReader(r)}
+}
+
+// next returns the next record and the offset and length of its rlp in the file
+// it returns io.EOF at the end of the file, and io.ErrUnexpectedEOF if the last record is truncated
+func (pfr *payloadFileReader) next() (payloadRecord, int64, int64, error) {
+	l, err := binary.ReadUvarint(pfr.br)
+	if err == io.EOF {
+		return payloadRecord{}, 0, 0, io.EOF
+	}
+	if err != nil {
+		return payloadRecord{}, 0, 0, io.ErrUnexpectedEOF
+	}
+	if l > maxRecordSize {
+		return payloadRecord{}, 0, 0, fmt.Errorf("payload record length %d exceeds maximum of %d", l, maxRecordSize)
+	}
+	start := pfr.offset + int64(uvarintLen(l))
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(pfr.br, buf); err != nil {
+		return payloadRecord{}, 0, 0, io.ErrUnexpectedEOF
+	}
+	pfr.offset = start + int64(l)
+	var rec payloadRecord
+	if err := rlp.DecodeBytes(buf, &rec); err != nil {
+		return payloadRecord{}, 0, 0, fmt.Errorf("error decoding payload record at offset %d: %v", start, err)
+	}
+	return rec, start, int64(l), nil
+}
+
+func uvarintLen(x uint64) int {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return binary.PutUvarint(buf, x)
+}
@@ -0,0 +1,121 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package eth_test
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/statediff"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+)
+
+var _ = Describe("Payload recording and replay", func() {
+	var (
+		dir      string
+		path     string
+		payload1 statediff.Payload
+		payload2 statediff.Payload
+		payload3 statediff.Payload
+	)
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "payloads")
+		Expect(err).ToNot(HaveOccurred())
+		path = filepath.Join(dir, "payloads.rlp")
+
+		payload1 = mocks.MockStateDiffPayload
+		header := types.CopyHeader(mocks.MockBlock.Header())
+		header.Number = big.NewInt(2)
+		blockRlp, err := rlp.EncodeToBytes(types.NewBlockWithHeader(header))
+		Expect(err).ToNot(HaveOccurred())
+		payload2 = statediff.Payload{
+			BlockRlp:        blockRlp,
+			StateObjectRlp:  mocks.MockStateDiffBytes,
+			ReceiptsRlp:     []byte{0xc0},
+			TotalDifficulty: big.NewInt(1337),
+		}
+		// a later recording at the same height as payload1
+		payload3 = payload1
+		payload3.TotalDifficulty = big.NewInt(7331)
+
+		recorder, err := eth.NewPayloadRecorder(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(recorder.Record(payload1)).To(Succeed())
+		Expect(recorder.Record(payload2)).To(Succeed())
+		Expect(recorder.Record(payload3)).To(Succeed())
+		Expect(recorder.Close()).To(Succeed())
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("FileFetcher", func() {
+		It("Fetches the last payload recorded at each height", func() {
+			fetcher, err := eth.NewFileFetcher(path)
+			Expect(err).ToNot(HaveOccurred())
+			defer fetcher.Close()
+			payloads, err := fetcher.FetchAt([]uint64{2, 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(payloads).To(Equal([]statediff.Payload{payload2, payload3}))
+		})
+
+		It("Errors if no payload was recorded at a height", func() {
+			fetcher, err := eth.NewFileFetcher(path)
+			Expect(err).ToNot(HaveOccurred())
+			defer fetcher.Close()
+			_, err = fetcher.FetchAt([]uint64{1, 3})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Ignores a truncated trailing record", func() {
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = f.Write([]byte{0x10, 0xc0})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+			fetcher, err := eth.NewFileFetcher(path)
+			Expect(err).ToNot(HaveOccurred())
+			defer fetcher.Close()
+			payloads, err := fetcher.FetchAt([]uint64{2})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(payloads).To(Equal([]statediff.Payload{payload2}))
+		})
+	})
+
+	Describe("FileStreamer", func() {
+		It("Replays every payload in the order it was recorded", func() {
+			payloadChan := make(chan statediff.Payload, 3)
+			sub, err := eth.NewFileStreamer(path).Stream(payloadChan)
+			Expect(err).ToNot(HaveOccurred())
+			defer sub.Unsubscribe()
+			for _, expected := range []statediff.Payload{payload1, payload2, payload3} {
+				Eventually(payloadChan, time.Second).Should(Receive(Equal(expected)))
+			}
+			Consistently(sub.Err()).ShouldNot(Receive())
+		})
+	})
+})
@@ -35,6 +35,8 @@ type Retriever interface {
 // GapRetriever type for Ethereum
 type GapRetriever struct {
 	db *postgres.DB
+	// if true, heights the retriever's node has already supplied a validated header for are not reported as validation gaps
+	crossValidate bool
 }
 
 // NewGapRetriever returns a pointer to a new GapRetriever
@@ -44,17 +46,32 @@ func NewGapRetriever(db *postgres.DB) *GapRetriever {
 	}
 }
 
-// RetrieveFirstBlockNumber is used to retrieve the first block number in the db
+// SetCrossValidation turns cross validation on or off
+// When on, times_validated counts independent sources, which the retriever's node can't raise by re-indexing a height it has already supplied,
+// so heights below the validation level are only reported as gaps if the node hasn't supplied a validated header for them yet
+func (ecr *GapRetriever) SetCrossValidation(crossValidate bool) {
+	ecr.crossValidate = crossValidate
+}
+
+// RetrieveFirstBlockNumber is used to retrieve the first block number of the node's chain in the db
 func (ecr *GapRetriever) RetrieveFirstBlockNumber() (int64, error) {
 	var blockNumber int64
-	err := ecr.db.Get(&blockNumber, "SELECT block_number FROM eth.header_cids ORDER BY block_number ASC LIMIT 1")
+	err := ecr.db.Reader().Get(&blockNumber, "SELECT block_number FROM eth.header_cids WHERE chain_id = $1 ORDER BY block_number ASC LIMIT 1", ecr.db.Node.ChainID)
 	return blockNumber, err
 }
 
-// RetrieveLastBlockNumber is used to retrieve the latest block number in the db
+// RetrieveHistoryStart returns the height indexed history begins at for the node's chain
+// This is the height of the earliest checkpoint imported into the db, or 0 if the db was indexed from genesis
+func (ecr *GapRetriever) RetrieveHistoryStart() (int64, error) {
+	var blockNumber int64
+	err := ecr.db.Reader().Get(&blockNumber, "SELECT COALESCE(MIN(block_number), 0) FROM eth.checkpoints WHERE chain_id = $1", ecr.db.Node.ChainID)
+	return blockNumber, err
+}
+
+// RetrieveLastBlockNumber is used to retrieve the latest block number of the node's chain in the db
 func (ecr *GapRetriever) RetrieveLastBlockNumber() (int64, error) {
 	var blockNumber int64
-	err := ecr.db.Get(&blockNumber, "SELECT block_number FROM eth.header_cids ORDER BY block_number DESC LIMIT 1 ")
+	err := ecr.db.Reader().Get(&blockNumber, "SELECT block_number FROM eth.header_cids WHERE chain_id = $1 ORDER BY block_number DESC LIMIT 1 ", ecr.db.Node.ChainID)
 	return blockNumber, err
 }
 
@@ -64,41 +81,53 @@ type DBGap struct {
 	Stop  uint64 `db:"stop"`
 }
 
-// RetrieveGapsInData is used to find the the block numbers at which we are missing data in the db
+// RetrieveGapsInData is used to find the the block numbers at which we are missing data for the node's chain in the db
 // it finds the union of heights where no data exists and where the times_validated is lower than the validation level
+// if a checkpoint has been imported, history starts at the checkpoint and no heights below it are reported
 func (ecr *GapRetriever) RetrieveGapsInData(validationLevel int) ([]DBGap, error) {
 	log.Info("searching for gaps in the eth ipfs watcher database")
+	historyStart, err := ecr.RetrieveHistoryStart()
+	if err != nil {
+		return nil, fmt.Errorf("eth CIDRetriever RetrieveHistoryStart error: %v", err)
+	}
 	startingBlock, err := ecr.RetrieveFirstBlockNumber()
 	if err != nil {
 		return nil, fmt.Errorf("eth CIDRetriever RetrieveFirstBlockNumber error: %v", err)
 	}
 	var initialGap []DBGap
-	if startingBlock != 0 {
+	if startingBlock > historyStart {
 		stop := uint64(startingBlock - 1)
-		log.Infof("found gap at the beginning of the eth sync from 0 to %d", stop)
+		log.Infof("found gap at the beginning of the eth sync from %d to %d", historyStart, stop)
 		initialGap = []DBGap{{
-			Start: 0,
+			Start: uint64(historyStart),
 			Stop:  stop,
 		}}
 	}
 
 	pgStr := `SELECT header_cids.block_number + 1 AS start, min(fr.block_number) - 1 AS stop FROM eth.header_cids
-				LEFT JOIN eth.header_cids r on eth.header_cids.block_number = r.block_number - 1
-				LEFT JOIN eth.header_cids fr on eth.header_cids.block_number < fr.block_number
-				WHERE r.block_number is NULL and fr.block_number IS NOT NULL
+				LEFT JOIN eth.header_cids r on eth.header_cids.block_number = r.block_number - 1 AND r.chain_id = $1
+				LEFT JOIN eth.header_cids fr on eth.header_cids.block_number < fr.block_number AND fr.chain_id = $1
+				WHERE header_cids.chain_id = $1 AND header_cids.block_number >= $2 AND r.block_number is NULL and fr.block_number IS NOT NULL
 				GROUP BY header_cids.block_number, r.block_number`
 	emptyGaps := make([]DBGap, 0)
-	if err := ecr.db.Select(&emptyGaps, pgStr); err != nil && err != sql.ErrNoRows {
+	if err := ecr.db.Reader().Select(&emptyGaps, pgStr, ecr.db.Node.ChainID, historyStart); err != nil && err != sql.ErrNoRows {
 		return nil, err
 	}
 
 	// Find sections of blocks where we are below the validation level
 	// There will be no overlap between these "gaps" and the ones above
 	pgStr = `SELECT block_number FROM eth.header_cids
-			WHERE times_validated < $1
-			ORDER BY block_number`
+			WHERE chain_id = $1 AND block_number >= $2 AND times_validated < $3`
+	args := []interface{}{ecr.db.Node.ChainID, historyStart, validationLevel}
+	if ecr.crossValidate {
+		pgStr += ` AND NOT EXISTS (SELECT 1 FROM eth.header_sources
+				WHERE header_sources.chain_id = header_cids.chain_id AND header_sources.block_number = header_cids.block_number
+				AND header_sources.block_hash = header_cids.block_hash AND header_sources.node_id = $4 AND header_sources.validated)`
+		args = append(args, ecr.db.NodeID)
+	}
+	pgStr += ` ORDER BY block_number`
 	var heights []uint64
-	if err := ecr.db.Select(&heights, pgStr, validationLevel); err != nil && err != sql.ErrNoRows {
+	if err := ecr.db.Reader().Select(&heights, pgStr, args...); err != nil && err != sql.ErrNoRows {
 		return nil, err
 	}
 	return append(append(initialGap, emptyGaps...), MissingHeightsToGaps(heights)...), nil
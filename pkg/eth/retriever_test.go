@@ -24,6 +24,7 @@ import (
 
 	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
 )
@@ -332,6 +333,64 @@ var _ = Describe("Retriever", func() {
 			Expect(ListContainsGap(gaps, eth.DBGap{Start: 110, Stop: 999})).To(BeTrue())
 			Expect(ListContainsGap(gaps, eth.DBGap{Start: 1001, Stop: 1010100})).To(BeTrue())
 		})
+
+		It("Only finds gaps in the data of its own chain", func() {
+			otherDB, err := shared.SetupDBWithNode(node.Info{ID: "otherChainNode", ChainID: 3})
+			Expect(err).ToNot(HaveOccurred())
+			payload1 := mocks.MockConvertedPayload
+			payload1.Block = mockBlock1010101
+			payload2 := payload1
+			payload2.Block = mockBlock0
+			err = eth.NewIPLDPublisher(otherDB).Publish(payload1)
+			Expect(err).ToNot(HaveOccurred())
+			err = repo.Publish(payload2)
+			Expect(err).ToNot(HaveOccurred())
+			gaps, err := retriever.RetrieveGapsInData(1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(gaps)).To(Equal(0))
+			otherGaps, err := eth.NewGapRetriever(otherDB).RetrieveGapsInData(1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(otherGaps)).To(Equal(1))
+			Expect(otherGaps[0].Start).To(Equal(uint64(0)))
+			Expect(otherGaps[0].Stop).To(Equal(uint64(1010100)))
+		})
+
+		It("Treats the earliest imported checkpoint as the start of history", func() {
+			payload1 := mocks.MockConvertedPayload
+			payload1.Block = mockBlock5
+			payload2 := payload1
+			payload2.Block = mockBlock1010101
+			err := repo.Publish(payload1)
+			Expect(err).ToNot(HaveOccurred())
+			err = repo.Publish(payload2)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = db.Exec(`INSERT INTO eth.checkpoints (chain_id, block_number, block_hash, state_root, schema_version, node_id)
+							VALUES ($1, $2, $3, $4, $5, $6)`, db.Node.ChainID, 5, mockBlock5.Hash().Hex(), mockBlock5.Root().Hex(), 26, db.NodeID)
+			Expect(err).ToNot(HaveOccurred())
+			start, err := retriever.RetrieveHistoryStart()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(start).To(Equal(int64(5)))
+			gaps, err := retriever.RetrieveGapsInData(1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(gaps)).To(Equal(1))
+			Expect(gaps[0].Start).To(Equal(uint64(6)))
+			Expect(gaps[0].Stop).To(Equal(uint64(1010100)))
+		})
+
+		It("Returns the gap from the checkpoint to the earliest block", func() {
+			payload := mocks.MockConvertedPayload
+			payload.Block = mockBlock1010101
+			err := repo.Publish(payload)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = db.Exec(`INSERT INTO eth.checkpoints (chain_id, block_number, block_hash, state_root, schema_version, node_id)
+							VALUES ($1, $2, $3, $4, $5, $6)`, db.Node.ChainID, 5, mockBlock5.Hash().Hex(), mockBlock5.Root().Hex(), 26, db.NodeID)
+			Expect(err).ToNot(HaveOccurred())
+			gaps, err := retriever.RetrieveGapsInData(1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(gaps)).To(Equal(1))
+			Expect(gaps[0].Start).To(Equal(uint64(5)))
+			Expect(gaps[0].Stop).To(Equal(uint64(1010100)))
+		})
 	})
 })
 
@@ -0,0 +1,134 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/rlp"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+	"github.com/multiformats/go-multihash"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/ipfs/ipld"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+// StatePublisher publishes and indexes individual state nodes, storage nodes, and contract code within the provided Postgres tx
+// This allows a full state trie to be indexed across many transactions, instead of in a single one like a state diff
+type StatePublisher struct {
+	indexer *CIDIndexer
+}
+
+// NewStatePublisher creates a pointer to a new StatePublisher
+func NewStatePublisher(db *postgres.DB) *StatePublisher {
+	return &StatePublisher{
+		indexer: NewCIDIndexer(db),
+	}
+}
+
+// PublishStateNode publishes and indexes the state node, and its account if it is a leaf, but not its storage nodes
+// diff is true if the node is part of a state diff, and false if it is part of a full state snapshot
+// it returns the stateID to reference the node's storage nodes by
+func (sp *StatePublisher) PublishStateNode(tx *blockstore.Tx, headerID int64, blockNumber uint64, stateNode sdtypes.StateNode, diff bool) (int64, error) {
+	// publish the state node
+	stateCIDStr, err := shared.PublishRaw(tx, ipld.MEthStateTrie, multihash.KECCAK_256, stateNode.NodeValue)
+	if err != nil {
+		return 0, err
+	}
+	mhKey, _ := shared.MultihashKeyFromCIDString(stateCIDStr)
+	stateModel := StateNodeModel{
+		Path:     stateNode.Path,
+		StateKey: common.BytesToHash(stateNode.LeafKey).String(),
+		CID:      stateCIDStr,
+		MhKey:    mhKey,
+		NodeType: ResolveFromNodeType(stateNode.NodeType),
+		Diff:     diff,
+	}
+	// index the state node, collect the stateID to reference by FK
+	stateID, err := sp.indexer.indexStateCID(tx.Tx, stateModel, headerID, blockNumber)
+	if err != nil {
+		return 0, err
+	}
+	// if we have a leaf, decode and index the account data
+	if stateNode.NodeType == sdtypes.Leaf {
+		var i []interface{}
+		if err := rlp.DecodeBytes(stateNode.NodeValue, &i); err != nil {
+			return 0, fmt.Errorf("error decoding state leaf node rlp: %s", err.Error())
+		}
+		if len(i) != 2 {
+			return 0, fmt.Errorf("eth IPLDPublisher expected state leaf node rlp to decode into two elements")
+		}
+		var account state.Account
+		if err := rlp.DecodeBytes(i[1].([]byte), &account); err != nil {
+			return 0, fmt.Errorf("error decoding state account rlp: %s", err.Error())
+		}
+		accountModel := StateAccountModel{
+			Balance:     account.Balance.String(),
+			Nonce:       account.Nonce,
+			CodeHash:    account.CodeHash,
+			StorageRoot: account.Root.String(),
+		}
+		if err := sp.indexer.indexStateAccount(tx.Tx, accountModel, stateID, blockNumber); err != nil {
+			return 0, err
+		}
+	}
+	return stateID, nil
+}
+
+// PublishStorageNode publishes and indexes the storage node under the state node with the provided stateID, at the block number of the state node
+// diff is true if the node is part of a storage diff, and false if it is part of a full state snapshot
+func (sp *StatePublisher) PublishStorageNode(tx *blockstore.Tx, stateID int64, blockNumber uint64, storageNode sdtypes.StorageNode, diff bool) error {
+	storageCIDStr, err := shared.PublishRaw(tx, ipld.MEthStorageTrie, multihash.KECCAK_256, storageNode.NodeValue)
+	if err != nil {
+		return err
+	}
+	mhKey, _ := shared.MultihashKeyFromCIDString(storageCIDStr)
+	storageModel := StorageNodeModel{
+		Path:       storageNode.Path,
+		StorageKey: common.BytesToHash(storageNode.LeafKey).String(),
+		CID:        storageCIDStr,
+		MhKey:      mhKey,
+		NodeType:   ResolveFromNodeType(storageNode.NodeType),
+		Diff:       diff,
+	}
+	return sp.indexer.indexStorageCID(tx.Tx, storageModel, stateID, blockNumber)
+}
+
+// PublishCode publishes the contract code to the ipld database, keyed by its code hash, and indexes it as seen at the header
+// txHash is the hash of the transaction that created the contract, or empty if it is not known
+func (sp *StatePublisher) PublishCode(tx *blockstore.Tx, headerID int64, blockNumber uint64, codeHash common.Hash, code []byte, txHash string) error {
+	// codec doesn't matter since db key is multihash-based
+	mhKey, err := shared.MultihashKeyFromKeccak256(codeHash)
+	if err != nil {
+		return err
+	}
+	if err := shared.PublishDirect(tx, mhKey, code); err != nil {
+		return err
+	}
+	return sp.indexer.indexCodeCID(tx.Tx, CodeModel{
+		CodeHash:    codeHash.Bytes(),
+		MhKey:       mhKey,
+		Size:        len(code),
+		HeaderID:    headerID,
+		BlockNumber: blockNumber,
+		TxHash:      txHash,
+	})
+}
@@ -19,6 +19,7 @@ package eth
 import (
 	"context"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/statediff"
 	"github.com/sirupsen/logrus"
@@ -35,7 +36,14 @@ type StreamClient interface {
 
 // Streamer interface for substituting mocks in tests
 type Streamer interface {
-	Stream(payloadChan chan statediff.Payload) (*rpc.ClientSubscription, error)
+	Stream(payloadChan chan statediff.Payload) (Subscription, error)
+}
+
+// Subscription is the subset of the rpc.ClientSubscription methods used by the sync process
+// It allows payloads to be streamed from sources other than a geth subscription
+type Subscription interface {
+	Err() <-chan error
+	Unsubscribe()
 }
 
 // PayloadStreamer satisfies the PayloadStreamer interface for ethereum
@@ -52,15 +60,25 @@ func NewPayloadStreamer(client StreamClient) *PayloadStreamer {
 			IncludeBlock:             true,
 			IncludeTD:                true,
 			IncludeReceipts:          true,
+			IncludeCode:              true,
 			IntermediateStorageNodes: true,
 			IntermediateStateNodes:   true,
 		},
 	}
 }
 
+// WatchAddresses narrows the state diffs streamed from the node to the accounts at the addresses
+func (ps *PayloadStreamer) WatchAddresses(addresses []common.Address) {
+	ps.params.WatchedAddresses = addresses
+}
+
 // Stream is the main loop for subscribing to data from the Geth state diff process
 // Satisfies the shared.PayloadStreamer interface
-func (ps *PayloadStreamer) Stream(payloadChan chan statediff.Payload) (*rpc.ClientSubscription, error) {
+func (ps *PayloadStreamer) Stream(payloadChan chan statediff.Payload) (Subscription, error) {
 	logrus.Debug("streaming diffs from geth")
-	return ps.Client.Subscribe(context.Background(), "statediff", payloadChan, "stream", ps.params)
+	sub, err := ps.Client.Subscribe(context.Background(), "statediff", payloadChan, "stream", ps.params)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
 }
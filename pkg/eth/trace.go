@@ -0,0 +1,77 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// TxTrace is the result of tracing a single transaction with debug_traceBlockByNumber
+type TxTrace struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// CallFrame is a single call in the call tree output by geth's callTracer
+type CallFrame struct {
+	Type    string         `json:"type"`
+	From    common.Address `json:"from"`
+	To      common.Address `json:"to"`
+	Value   *hexutil.Big   `json:"value,omitempty"`
+	Gas     hexutil.Uint64 `json:"gas"`
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	Input   hexutil.Bytes  `json:"input"`
+	Output  hexutil.Bytes  `json:"output,omitempty"`
+	Error   string         `json:"error,omitempty"`
+	Calls   []CallFrame    `json:"calls,omitempty"`
+}
+
+// FlattenCallTrace flattens the call tree into its frames in depth-first order
+// The top level call is at index and depth 0, the tree can be rebuilt from the index and depth of each frame
+func FlattenCallTrace(root CallFrame) []TraceModel {
+	traces := make([]TraceModel, 0)
+	var flatten func(frame CallFrame, depth int64)
+	flatten = func(frame CallFrame, depth int64) {
+		trace := TraceModel{
+			Index:    int64(len(traces)),
+			Depth:    depth,
+			CallType: strings.ToUpper(frame.Type),
+			Src:      frame.From.Hex(),
+			Dst:      frame.To.Hex(),
+			Gas:      uint64(frame.Gas),
+			GasUsed:  uint64(frame.GasUsed),
+			Error:    frame.Error,
+		}
+		if frame.Value != nil {
+			trace.Value = frame.Value.ToInt().String()
+		}
+		// the input of a contract creation is init code, it has no function selector
+		if len(frame.Input) >= 4 && !strings.HasPrefix(trace.CallType, "CREATE") {
+			trace.Selector = hexutil.Encode(frame.Input[:4])
+		}
+		traces = append(traces, trace)
+		for _, call := range frame.Calls {
+			flatten(call, depth+1)
+		}
+	}
+	flatten(root, 0)
+	return traces
+}
@@ -0,0 +1,80 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// TraceFetcher interface for substituting mocks in tests
+type TraceFetcher interface {
+	FetchTracesAt(blockHeights []uint64) (map[uint64][]TxTrace, error)
+}
+
+// CallTraceFetcher satisfies the TraceFetcher interface for ethereum
+// It is thread-safe as long as the underlying client is thread-safe
+type CallTraceFetcher struct {
+	client  BatchClient
+	timeout time.Duration
+}
+
+const traceMethod = "debug_traceBlockByNumber"
+
+// callTracer is the name of geth's built-in tracer which outputs the call tree of a transaction
+const callTracer = "callTracer"
+
+// NewCallTraceFetcher returns a CallTraceFetcher
+func NewCallTraceFetcher(bc BatchClient, timeout time.Duration) *CallTraceFetcher {
+	return &CallTraceFetcher{
+		client:  bc,
+		timeout: timeout,
+	}
+}
+
+// FetchTracesAt fetches the call traces of every transaction in the blocks at the given heights, keyed by block height
+// Calls TraceBlockByNumber(ctx context.Context, number rpc.BlockNumber, config *TraceConfig) ([]*txTraceResult, error)
+func (fetcher *CallTraceFetcher) FetchTracesAt(blockHeights []uint64) (map[uint64][]TxTrace, error) {
+	batch := make([]rpc.BatchElem, 0, len(blockHeights))
+	for _, height := range blockHeights {
+		batch = append(batch, rpc.BatchElem{
+			Method: traceMethod,
+			Args:   []interface{}{hexutil.Uint64(height), map[string]string{"tracer": callTracer}},
+			Result: new([]TxTrace),
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), fetcher.timeout)
+	defer cancel()
+	if err := fetcher.client.BatchCallContext(ctx, batch); err != nil {
+		return nil, fmt.Errorf("ethereum CallTraceFetcher batch err for block range %d-%d: %s", blockHeights[0], blockHeights[len(blockHeights)-1], err.Error())
+	}
+	results := make(map[uint64][]TxTrace, len(blockHeights))
+	for i, batchElem := range batch {
+		if batchElem.Error != nil {
+			return nil, fmt.Errorf("ethereum CallTraceFetcher err at blockheight %d: %s", blockHeights[i], batchElem.Error.Error())
+		}
+		traces, ok := batchElem.Result.(*[]TxTrace)
+		if ok {
+			results[blockHeights[i]] = *traces
+		}
+	}
+	return results, nil
+}
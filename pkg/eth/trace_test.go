@@ -0,0 +1,159 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package eth_test
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/params"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+var _ = Describe("Call traces", func() {
+	Describe("FlattenCallTrace", func() {
+		It("Flattens the call tree in depth-first order", func() {
+			traces := eth.FlattenCallTrace(mocks.MockCallTrace)
+			Expect(len(traces)).To(Equal(3))
+			Expect(traces[0]).To(Equal(eth.TraceModel{
+				Index:    0,
+				Depth:    0,
+				CallType: "CALL",
+				Src:      mocks.SenderAddr.Hex(),
+				Dst:      mocks.Address.Hex(),
+				Value:    "1000",
+				Gas:      50,
+				GasUsed:  45,
+			}))
+			Expect(traces[1]).To(Equal(eth.TraceModel{
+				Index:    1,
+				Depth:    1,
+				CallType: "STATICCALL",
+				Src:      mocks.Address.Hex(),
+				Dst:      mocks.AnotherAddress.Hex(),
+				Selector: "0x70a08231",
+				Gas:      30,
+				GasUsed:  5,
+			}))
+			Expect(traces[2]).To(Equal(eth.TraceModel{
+				Index:    2,
+				Depth:    1,
+				CallType: "CALL",
+				Src:      mocks.Address.Hex(),
+				Dst:      mocks.AnotherAddress.Hex(),
+				Value:    "10",
+				Gas:      20,
+				GasUsed:  20,
+				Error:    "out of gas",
+			}))
+		})
+		It("Doesn't derive a selector from contract creation code", func() {
+			traces := eth.FlattenCallTrace(eth.CallFrame{
+				Type:  "create2",
+				From:  mocks.SenderAddr,
+				To:    mocks.ContractAddress,
+				Input: hexutil.MustDecode("0x6080604052"),
+			})
+			Expect(len(traces)).To(Equal(1))
+			Expect(traces[0].CallType).To(Equal("CREATE2"))
+			Expect(traces[0].Selector).To(BeEmpty())
+		})
+	})
+
+	Describe("FetchTracesAt", func() {
+		It("Batch calls debug_traceBlockByNumber", func() {
+			mc := new(mocks.TraceClient)
+			err := mc.SetReturnTracesAt(mocks.BlockNumber.Uint64(), mocks.MockCallTraces)
+			Expect(err).ToNot(HaveOccurred())
+			err = mc.SetReturnTracesAt(mocks.BlockNumber.Uint64()+1, []eth.TxTrace{})
+			Expect(err).ToNot(HaveOccurred())
+			fetcher := eth.NewCallTraceFetcher(mc, time.Second*60)
+			traces, err := fetcher.FetchTracesAt([]uint64{mocks.BlockNumber.Uint64(), mocks.BlockNumber.Uint64() + 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(traces)).To(Equal(2))
+			Expect(traces[mocks.BlockNumber.Uint64()]).To(Equal(mocks.MockCallTraces))
+			Expect(traces[mocks.BlockNumber.Uint64()+1]).To(BeEmpty())
+		})
+		It("Returns an error if a block can't be traced", func() {
+			mc := new(mocks.TraceClient)
+			err := mc.SetReturnTracesAt(mocks.BlockNumber.Uint64(), mocks.MockCallTraces)
+			Expect(err).ToNot(HaveOccurred())
+			fetcher := eth.NewCallTraceFetcher(mc, time.Second*60)
+			_, err = fetcher.FetchTracesAt([]uint64{mocks.BlockNumber.Uint64(), mocks.BlockNumber.Uint64() + 1})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Transform", func() {
+		var (
+			db  *postgres.DB
+			err error
+		)
+		BeforeEach(func() {
+			db, err = shared.SetupDB()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = eth.NewStateDiffTransformer(params.MainnetChainConfig, db).Transform(1, mocks.MockStateDiffPayload)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		AfterEach(func() {
+			eth.TearDownDB(db)
+		})
+		It("Publishes the raw traces and indexes the flattened call trees of the block's transactions", func() {
+			err = eth.NewCallTraceTransformer(db).Transform(1, mocks.MockStateDiffPayload, mocks.MockCallTraces)
+			Expect(err).ToNot(HaveOccurred())
+			pgStr := `SELECT trace_cids.index, depth, call_type, src, dst, COALESCE(value::TEXT, '') AS value,
+						COALESCE(input_selector, '') AS input_selector, gas, gas_used, COALESCE(error, '') AS error, trace_cids.cid, trace_cids.mh_key
+						FROM eth.trace_cids INNER JOIN eth.transaction_cids ON (trace_cids.tx_id = transaction_cids.id)
+						WHERE transaction_cids.tx_hash = $1
+						ORDER BY trace_cids.index`
+			traces := make([]eth.TraceModel, 0)
+			err = db.Select(&traces, pgStr, mocks.MockTransactions[0].Hash().Hex())
+			Expect(err).ToNot(HaveOccurred())
+			expectedTraces := eth.FlattenCallTrace(mocks.MockCallTrace)
+			Expect(len(traces)).To(Equal(len(expectedTraces)))
+			for i, trace := range traces {
+				Expect(trace.CallType).To(Equal(expectedTraces[i].CallType))
+				Expect(trace.Index).To(Equal(expectedTraces[i].Index))
+				Expect(trace.Depth).To(Equal(expectedTraces[i].Depth))
+				Expect(trace.Src).To(Equal(expectedTraces[i].Src))
+				Expect(trace.Dst).To(Equal(expectedTraces[i].Dst))
+				Expect(trace.Value).To(Equal(expectedTraces[i].Value))
+				Expect(trace.Selector).To(Equal(expectedTraces[i].Selector))
+				Expect(trace.Error).To(Equal(expectedTraces[i].Error))
+				Expect(trace.CID).To(Equal(traces[0].CID))
+			}
+			var data []byte
+			err = db.Get(&data, `SELECT data FROM public.blocks WHERE key = $1`, traces[0].MhKey)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(MatchJSON(mocks.MockCallTraces[0].Result))
+			var count int
+			err = db.Get(&count, `SELECT COUNT(*) FROM eth.trace_cids`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(count).To(Equal(5))
+		})
+		It("Fails if the number of traces doesn't match the block's transactions", func() {
+			err = eth.NewCallTraceTransformer(db).Transform(1, mocks.MockStateDiffPayload, mocks.MockCallTraces[:2])
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,130 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/statediff"
+	"github.com/multiformats/go-multihash"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/ipfs/ipld"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+// TraceTransformer interface to allow substitution of mocks for testing
+type TraceTransformer interface {
+	Transform(workerID int, payload statediff.Payload, traces []TxTrace) error
+}
+
+// CallTraceTransformer satisfies the TraceTransformer interface for the output of geth's callTracer
+type CallTraceTransformer struct {
+	indexer *CIDIndexer
+}
+
+// NewCallTraceTransformer creates a pointer to a new CallTraceTransformer
+func NewCallTraceTransformer(db *postgres.DB) *CallTraceTransformer {
+	return &CallTraceTransformer{
+		indexer: NewCIDIndexer(db),
+	}
+}
+
+// SetBlockstore sets the blockstore the raw call traces are published to, by default they are published to public.blocks
+func (ctt *CallTraceTransformer) SetBlockstore(blocks blockstore.Blockstore) {
+	ctt.indexer.blocks = blocks
+}
+
+// Transform publishes the raw call trace of each transaction in the payload's block and indexes its flattened call tree
+// The payload must have been transformed already, traces are only indexed for the transactions of the block that are in the database
+func (ctt *CallTraceTransformer) Transform(workerID int, payload statediff.Payload, traces []TxTrace) (err error) {
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(payload.BlockRlp, block); err != nil {
+		return fmt.Errorf("error decoding payload block rlp: %s", err.Error())
+	}
+	transactions := block.Transactions()
+	if len(traces) != len(transactions) {
+		return fmt.Errorf("block at %d with hash %s has %d transactions but %d traces", block.NumberU64(), block.Hash().Hex(), len(transactions), len(traces))
+	}
+	tx, err := ctt.indexer.beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			shared.Rollback(tx.Tx)
+			panic(p)
+		} else if err != nil {
+			shared.Rollback(tx.Tx)
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	var headerID int64
+	if err = tx.Get(&headerID, `SELECT id FROM eth.header_cids WHERE chain_id = $1 AND block_number = $2 AND block_hash = $3`,
+		ctt.indexer.db.Node.ChainID, block.NumberU64(), block.Hash().Hex()); err != nil {
+		return fmt.Errorf("error finding header for block at %d with hash %s: %s", block.NumberU64(), block.Hash().Hex(), err.Error())
+	}
+	txIDs := make(map[string]int64)
+	rows := make([]TxModel, 0, len(transactions))
+	if err = tx.Select(&rows, `SELECT id, tx_hash FROM eth.transaction_cids WHERE header_id = $1 AND block_number = $2`, headerID, block.NumberU64()); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		txIDs[row.TxHash] = row.ID
+	}
+	for i, trace := range traces {
+		txHash := transactions[i].Hash().Hex()
+		// transactions left out by the index filter are not traced
+		txID, ok := txIDs[txHash]
+		if !ok {
+			continue
+		}
+		if trace.Error != "" {
+			logrus.Warnf("worker %d unable to trace tx %s: %s", workerID, txHash, trace.Error)
+			continue
+		}
+		var traceCID, mhKey string
+		traceCID, err = shared.PublishRaw(tx, ipld.RawBinary, multihash.KECCAK_256, trace.Result)
+		if err != nil {
+			return err
+		}
+		mhKey, err = shared.MultihashKeyFromCIDString(traceCID)
+		if err != nil {
+			return err
+		}
+		var root CallFrame
+		if err = json.Unmarshal(trace.Result, &root); err != nil {
+			return fmt.Errorf("error decoding call trace of tx %s: %s", txHash, err.Error())
+		}
+		for _, traceModel := range FlattenCallTrace(root) {
+			traceModel.TxID = txID
+			traceModel.BlockNumber = block.NumberU64()
+			traceModel.CID = traceCID
+			traceModel.MhKey = mhKey
+			if err = ctt.indexer.indexTraceCID(tx.Tx, traceModel); err != nil {
+				return err
+			}
+		}
+	}
+	return err
+}
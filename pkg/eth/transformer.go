@@ -23,7 +23,6 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
@@ -31,9 +30,9 @@ import (
 	"github.com/ethereum/go-ethereum/statediff"
 	node "github.com/ipfs/go-ipld-format"
 	"github.com/jmoiron/sqlx"
-	"github.com/multiformats/go-multihash"
 	"github.com/sirupsen/logrus"
 
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/ipfs/ipld"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/prom"
@@ -47,18 +46,57 @@ type Transformer interface {
 
 // StateDiffTransformer satisfies the Transformer interface for ethereum statediff objects
 type StateDiffTransformer struct {
-	chainConfig *params.ChainConfig
-	indexer     *CIDIndexer
+	chainConfig    *params.ChainConfig
+	indexer        *CIDIndexer
+	statePublisher *StatePublisher
+	// if true, state diffs are validated against the header's state root before being indexed
+	validate bool
+	// selects the subset of each payload that is indexed
+	filter *indexFilter
 }
 
 // NewStateDiffTransformer creates a pointer to a new PayloadConverter which satisfies the PayloadConverter interface
 func NewStateDiffTransformer(chainConfig *params.ChainConfig, db *postgres.DB) *StateDiffTransformer {
+	indexer := NewCIDIndexer(db)
 	return &StateDiffTransformer{
-		chainConfig: chainConfig,
-		indexer:     NewCIDIndexer(db),
+		chainConfig:    chainConfig,
+		indexer:        indexer,
+		statePublisher: &StatePublisher{indexer: indexer},
+		filter:         newIndexFilter(shared.IndexFilter{}),
 	}
 }
 
+// SetValidation turns validation of incoming state diffs on or off
+// When on, a header's times_validated is only incremented if its state diff hashes consistently up to its state root
+// When off, times_validated is incremented every time the header is indexed
+func (sdt *StateDiffTransformer) SetValidation(validate bool) {
+	sdt.validate = validate
+}
+
+// SetCrossValidation turns cross validation of the indexed headers against the other nodes which supplied them on or off
+// When on, a header's times_validated is the number of independent sources which supplied it with validated data that agrees on its state root,
+// rather than the number of times it was indexed with validated data
+func (sdt *StateDiffTransformer) SetCrossValidation(crossValidate bool) {
+	sdt.indexer.SetCrossValidation(crossValidate)
+}
+
+// SetConflictMode sets how re-indexing a row with content that differs from the indexed content is handled
+func (sdt *StateDiffTransformer) SetConflictMode(mode shared.ConflictMode) {
+	sdt.indexer.SetConflictMode(mode)
+}
+
+// SetFilter sets the subset of each payload that is indexed, by default everything is indexed
+// Partial state diffs can't be hashed up to the state root, so they aren't validated when the filter narrows the state
+func (sdt *StateDiffTransformer) SetFilter(filter shared.IndexFilter) {
+	sdt.filter = newIndexFilter(filter)
+}
+
+// SetBlockstore sets the blockstore the IPLDs are published to, by default they are published to public.blocks
+// The blocks of a payload are written to the blockstore before its db tx is committed
+func (sdt *StateDiffTransformer) SetBlockstore(blocks blockstore.Blockstore) {
+	sdt.indexer.blocks = blocks
+}
+
 // Transform method is used to process statediff.Payload objects
 // It performs the necessary data conversions and database persistence
 func (sdt *StateDiffTransformer) Transform(workerID int, payload statediff.Payload) (uint64, error) {
@@ -83,6 +121,22 @@ func (sdt *StateDiffTransformer) Transform(workerID int, payload statediff.Paylo
 	if err := rlp.DecodeBytes(payload.StateObjectRlp, stateDiff); err != nil {
 		return 0, fmt.Errorf("error decoding payload state object rlp: %s", err.Error())
 	}
+	// Validate the state diff, a diff that fails validation is still indexed but is not counted as validated
+	validated := true
+	if sdt.validate && sdt.filter.FullState() {
+		if err := ValidateStateDiff(block.Root(), stateDiff.Nodes); err != nil {
+			logrus.Warnf("worker %d payload at %d with hash %s: %v", workerID, height, blockHashStr, err)
+			prom.ValidationFailureInc()
+			validated = false
+		}
+	}
+	// The state root the diff hashes up to, partial state diffs don't include the state root node
+	var diffRoot string
+	if sdt.filter.FullState() {
+		if root, ok := DiffStateRoot(stateDiff.Nodes); ok {
+			diffRoot = root.String()
+		}
+	}
 	// Derive any missing fields
 	if err := receipts.DeriveFields(sdt.chainConfig, blockHash, height, transactions); err != nil {
 		return 0, err
@@ -101,18 +155,22 @@ func (sdt *StateDiffTransformer) Transform(workerID int, payload statediff.Paylo
 	prom.SetTimeMetric("t_payload_decode", tDiff)
 	traceMsg += fmt.Sprintf("payload decoding time: %s\r\n", tDiff.String())
 	t = time.Now()
+	// Create the partitions for the block ahead of the db tx, if the tables are partitioned
+	if err := sdt.indexer.preparePartitions(height); err != nil {
+		return 0, err
+	}
 	// Begin new db tx for everything
-	tx, err := sdt.indexer.db.Beginx()
+	tx, err := sdt.indexer.beginx()
 	if err != nil {
 		return 0, err
 	}
 	// defer to handle transaction commit or rollback for any return case
 	defer func() {
 		if p := recover(); p != nil {
-			shared.Rollback(tx)
+			shared.Rollback(tx.Tx)
 			panic(p)
 		} else if err != nil {
-			shared.Rollback(tx)
+			shared.Rollback(tx.Tx)
 		} else {
 			err = tx.Commit()
 			tDiff := time.Now().Sub(t)
@@ -128,7 +186,7 @@ func (sdt *StateDiffTransformer) Transform(workerID int, payload statediff.Paylo
 	t = time.Now()
 
 	// Publish and index header, collect headerID
-	headerID, err := sdt.processHeader(tx, block.Header(), headerNode, reward, payload.TotalDifficulty)
+	headerID, err := sdt.processHeader(tx, block.Header(), headerNode, reward, payload.TotalDifficulty, validated, diffRoot)
 	if err != nil {
 		return 0, err
 	}
@@ -137,57 +195,71 @@ func (sdt *StateDiffTransformer) Transform(workerID int, payload statediff.Paylo
 	traceMsg += fmt.Sprintf("header processing time: %s\r\n", tDiff.String())
 	t = time.Now()
 	// Publish and index uncles
-	if err := sdt.processUncles(tx, headerID, height, uncleNodes); err != nil {
-		return 0, err
+	if sdt.filter.Indexes(shared.Uncles) {
+		if err := sdt.processUncles(tx, headerID, height, uncleNodes); err != nil {
+			return 0, err
+		}
 	}
 	tDiff = time.Now().Sub(t)
 	prom.SetTimeMetric("t_uncle_processing", tDiff)
 	traceMsg += fmt.Sprintf("uncle processing time: %s\r\n", tDiff.String())
 	t = time.Now()
 	// Publish and index receipts and txs
-	if err := sdt.processReceiptsAndTxs(tx, processArgs{
-		headerID:     headerID,
-		blockNumber:  block.Number(),
-		receipts:     receipts,
-		txs:          transactions,
-		rctNodes:     rctNodes,
-		rctTrieNodes: rctTrieNodes,
-		txNodes:      txNodes,
-		txTrieNodes:  txTrieNodes,
-	}); err != nil {
-		return 0, err
+	if sdt.filter.Indexes(shared.Transactions) || sdt.filter.Indexes(shared.Receipts) {
+		if err := sdt.processReceiptsAndTxs(tx, processArgs{
+			headerID:     headerID,
+			blockNumber:  block.Number(),
+			receipts:     receipts,
+			txs:          transactions,
+			rctNodes:     rctNodes,
+			rctTrieNodes: rctTrieNodes,
+			txNodes:      txNodes,
+			txTrieNodes:  txTrieNodes,
+		}); err != nil {
+			return 0, err
+		}
 	}
 	tDiff = time.Now().Sub(t)
 	prom.SetTimeMetric("t_tx_receipt_processing", tDiff)
 	traceMsg += fmt.Sprintf("tx and receipt processing time: %s\r\n", tDiff.String())
 	t = time.Now()
 	// Publish and index state and storage nodes
-	if err := sdt.processStateAndStorage(tx, headerID, stateDiff); err != nil {
+	stateNodes := sdt.filter.stateNodes(stateDiff.Nodes)
+	if err := sdt.processStateAndStorage(tx, headerID, height, stateNodes); err != nil {
 		return 0, err
 	}
 	tDiff = time.Now().Sub(t)
 	prom.SetTimeMetric("t_state_store_processing", tDiff)
 	traceMsg += fmt.Sprintf("state and storage processing time: %s\r\n", tDiff.String())
 	t = time.Now()
-	if err := sdt.processCodeAndCodeHashes(tx, stateDiff.CodeAndCodeHashes); err != nil {
+	codes := sdt.filter.codes(stateNodes, stateDiff.CodeAndCodeHashes)
+	if err := sdt.processCodeAndCodeHashes(tx, headerID, height, codes, codeCreators(receipts, stateDiff.Nodes)); err != nil {
 		return 0, err
 	}
 	tDiff = time.Now().Sub(t)
 	prom.SetTimeMetric("t_code_codehash_processing", tDiff)
 	traceMsg += fmt.Sprintf("code and codehash processing time: %s\r\n", tDiff.String())
 	t = time.Now()
+	// Record the preimages of the state leaf keys of the addresses seen in the block
+	if err := sdt.processAddressPreimages(tx.Tx, block.Number(), transactions, receipts); err != nil {
+		return 0, err
+	}
+	tDiff = time.Now().Sub(t)
+	prom.SetTimeMetric("t_address_preimage_processing", tDiff)
+	traceMsg += fmt.Sprintf("address preimage processing time: %s\r\n", tDiff.String())
+	t = time.Now()
 	return height, err // return error explicity so that the defer() assigns to it
 }
 
 // processHeader publishes and indexes a header IPLD in Postgres
 // it returns the headerID
-func (sdt *StateDiffTransformer) processHeader(tx *sqlx.Tx, header *types.Header, headerNode node.Node, reward, td *big.Int) (int64, error) {
+func (sdt *StateDiffTransformer) processHeader(tx *blockstore.Tx, header *types.Header, headerNode node.Node, reward, td *big.Int, validated bool, diffRoot string) (int64, error) {
 	// publish header
 	if err := shared.PublishIPLD(tx, headerNode); err != nil {
 		return 0, err
 	}
 	// index header
-	return sdt.indexer.indexHeaderCID(tx, HeaderModel{
+	return sdt.indexer.indexHeaderCID(tx.Tx, HeaderModel{
 		CID:             headerNode.Cid().String(),
 		MhKey:           shared.MultihashKeyFromCID(headerNode.Cid()),
 		ParentHash:      header.ParentHash.String(),
@@ -201,10 +273,10 @@ func (sdt *StateDiffTransformer) processHeader(tx *sqlx.Tx, header *types.Header
 		TxRoot:          header.TxHash.String(),
 		UncleRoot:       header.UncleHash.String(),
 		Timestamp:       header.Time,
-	})
+	}, validated, diffRoot)
 }
 
-func (sdt *StateDiffTransformer) processUncles(tx *sqlx.Tx, headerID int64, blockNumber uint64, uncleNodes []*ipld.EthHeader) error {
+func (sdt *StateDiffTransformer) processUncles(tx *blockstore.Tx, headerID int64, blockNumber uint64, uncleNodes []*ipld.EthHeader) error {
 	// publish and index uncles
 	for _, uncleNode := range uncleNodes {
 		if err := shared.PublishIPLD(tx, uncleNode); err != nil {
@@ -218,7 +290,7 @@ func (sdt *StateDiffTransformer) processUncles(tx *sqlx.Tx, headerID int64, bloc
 			BlockHash:  uncleNode.Hash().String(),
 			Reward:     uncleReward.String(),
 		}
-		if err := sdt.indexer.indexUncleCID(tx, uncle, headerID); err != nil {
+		if err := sdt.indexer.indexUncleCID(tx.Tx, uncle, headerID, blockNumber); err != nil {
 			return err
 		}
 	}
@@ -238,7 +310,7 @@ type processArgs struct {
 }
 
 // processReceiptsAndTxs publishes and indexes receipt and transaction IPLDs in Postgres
-func (sdt *StateDiffTransformer) processReceiptsAndTxs(tx *sqlx.Tx, args processArgs) error {
+func (sdt *StateDiffTransformer) processReceiptsAndTxs(tx *blockstore.Tx, args processArgs) error {
 	// Process receipts and txs
 	signer := types.MakeSigner(sdt.chainConfig, args.blockNumber)
 	for i, receipt := range args.receipts {
@@ -248,22 +320,31 @@ func (sdt *StateDiffTransformer) processReceiptsAndTxs(tx *sqlx.Tx, args process
 		if err != nil {
 			return err
 		}
+		if !sdt.filter.matchTx(trx, from, receipt) {
+			continue
+		}
+		// receipts reference their transaction by FK, so the transaction is indexed even if only receipts are
+		indexReceipt := sdt.filter.Indexes(shared.Receipts)
 
 		// Publishing
 		// publish trie nodes, these aren't indexed directly
 		if err := shared.PublishIPLD(tx, args.txTrieNodes[i]); err != nil {
 			return err
 		}
-		if err := shared.PublishIPLD(tx, args.rctTrieNodes[i]); err != nil {
-			return err
+		if indexReceipt {
+			if err := shared.PublishIPLD(tx, args.rctTrieNodes[i]); err != nil {
+				return err
+			}
 		}
 		// publish the txs and receipts
 		txNode, rctNode := args.txNodes[i], args.rctNodes[i]
 		if err := shared.PublishIPLD(tx, txNode); err != nil {
 			return err
 		}
-		if err := shared.PublishIPLD(tx, rctNode); err != nil {
-			return err
+		if indexReceipt {
+			if err := shared.PublishIPLD(tx, rctNode); err != nil {
+				return err
+			}
 		}
 
 		// Indexing
@@ -297,10 +378,13 @@ func (sdt *StateDiffTransformer) processReceiptsAndTxs(tx *sqlx.Tx, args process
 			CID:    txNode.Cid().String(),
 			MhKey:  shared.MultihashKeyFromCID(txNode.Cid()),
 		}
-		txID, err := sdt.indexer.indexTransactionCID(tx, txModel, args.headerID)
+		txID, err := sdt.indexer.indexTransactionCID(tx.Tx, txModel, args.headerID, args.blockNumber.Uint64())
 		if err != nil {
 			return err
 		}
+		if !indexReceipt {
+			continue
+		}
 		// index the receipt
 		rctModel := ReceiptModel{
 			Topic0s:      topicSets[0],
@@ -318,7 +402,7 @@ func (sdt *StateDiffTransformer) processReceiptsAndTxs(tx *sqlx.Tx, args process
 		} else {
 			rctModel.PostState = common.Bytes2Hex(receipt.PostState)
 		}
-		if err := sdt.indexer.indexReceiptCID(tx, rctModel, txID); err != nil {
+		if err := sdt.indexer.indexReceiptCID(tx.Tx, rctModel, txID, args.blockNumber.Uint64()); err != nil {
 			return err
 		}
 	}
@@ -326,64 +410,16 @@ func (sdt *StateDiffTransformer) processReceiptsAndTxs(tx *sqlx.Tx, args process
 }
 
 // processStateAndStorage publishes and indexes state and storage nodes in Postgres
-func (sdt *StateDiffTransformer) processStateAndStorage(tx *sqlx.Tx, headerID int64, stateDiff *statediff.StateObject) error {
-	for _, stateNode := range stateDiff.Nodes {
-		// publish the state node
-		stateCIDStr, err := shared.PublishRaw(tx, ipld.MEthStateTrie, multihash.KECCAK_256, stateNode.NodeValue)
-		if err != nil {
-			return err
-		}
-		mhKey, _ := shared.MultihashKeyFromCIDString(stateCIDStr)
-		stateModel := StateNodeModel{
-			Path:     stateNode.Path,
-			StateKey: common.BytesToHash(stateNode.LeafKey).String(),
-			CID:      stateCIDStr,
-			MhKey:    mhKey,
-			NodeType: ResolveFromNodeType(stateNode.NodeType),
-		}
-		// index the state node, collect the stateID to reference by FK
-		stateID, err := sdt.indexer.indexStateCID(tx, stateModel, headerID)
+func (sdt *StateDiffTransformer) processStateAndStorage(tx *blockstore.Tx, headerID int64, blockNumber uint64, stateNodes []sdtypes.StateNode) error {
+	for _, stateNode := range stateNodes {
+		// publish and index the state node, collect the stateID to reference by FK
+		stateID, err := sdt.statePublisher.PublishStateNode(tx, headerID, blockNumber, stateNode, true)
 		if err != nil {
 			return err
 		}
-		// if we have a leaf, decode and index the account data
-		if stateNode.NodeType == sdtypes.Leaf {
-			var i []interface{}
-			if err := rlp.DecodeBytes(stateNode.NodeValue, &i); err != nil {
-				return fmt.Errorf("error decoding state leaf node rlp: %s", err.Error())
-			}
-			if len(i) != 2 {
-				return fmt.Errorf("eth IPLDPublisher expected state leaf node rlp to decode into two elements")
-			}
-			var account state.Account
-			if err := rlp.DecodeBytes(i[1].([]byte), &account); err != nil {
-				return fmt.Errorf("error decoding state account rlp: %s", err.Error())
-			}
-			accountModel := StateAccountModel{
-				Balance:     account.Balance.String(),
-				Nonce:       account.Nonce,
-				CodeHash:    account.CodeHash,
-				StorageRoot: account.Root.String(),
-			}
-			if err := sdt.indexer.indexStateAccount(tx, accountModel, stateID); err != nil {
-				return err
-			}
-		}
 		// if there are any storage nodes associated with this node, publish and index them
 		for _, storageNode := range stateNode.StorageNodes {
-			storageCIDStr, err := shared.PublishRaw(tx, ipld.MEthStorageTrie, multihash.KECCAK_256, storageNode.NodeValue)
-			if err != nil {
-				return err
-			}
-			mhKey, _ := shared.MultihashKeyFromCIDString(storageCIDStr)
-			storageModel := StorageNodeModel{
-				Path:       storageNode.Path,
-				StorageKey: common.BytesToHash(storageNode.LeafKey).String(),
-				CID:        storageCIDStr,
-				MhKey:      mhKey,
-				NodeType:   ResolveFromNodeType(storageNode.NodeType),
-			}
-			if err := sdt.indexer.indexStorageCID(tx, storageModel, stateID); err != nil {
+			if err := sdt.statePublisher.PublishStorageNode(tx, stateID, blockNumber, storageNode, true); err != nil {
 				return err
 			}
 		}
@@ -391,17 +427,80 @@ func (sdt *StateDiffTransformer) processStateAndStorage(tx *sqlx.Tx, headerID in
 	return nil
 }
 
-// processCodeAndCodeHashes publishes code and codehash pairs to the ipld database
-func (sdt *StateDiffTransformer) processCodeAndCodeHashes(tx *sqlx.Tx, codeAndCodeHashes []sdtypes.CodeAndCodeHash) error {
+// processCodeAndCodeHashes publishes code and codehash pairs to the ipld database and indexes them in eth.code_cids
+// creators maps code hashes to the hash of the transaction that created them, where known
+func (sdt *StateDiffTransformer) processCodeAndCodeHashes(tx *blockstore.Tx, headerID int64, blockNumber uint64, codeAndCodeHashes []sdtypes.CodeAndCodeHash, creators map[common.Hash]string) error {
 	for _, c := range codeAndCodeHashes {
-		// codec doesn't matter since db key is multihash-based
-		mhKey, err := shared.MultihashKeyFromKeccak256(c.Hash)
-		if err != nil {
+		if err := sdt.statePublisher.PublishCode(tx, headerID, blockNumber, c.Hash, c.Code, creators[c.Hash]); err != nil {
 			return err
 		}
-		if err := shared.PublishDirect(tx, mhKey, c.Code); err != nil {
+	}
+	return nil
+}
+
+// processAddressPreimages records the senders, recipients, created contracts, and log emitters of the block's transactions in eth.address_preimages,
+// so that state leaf keys can be resolved to the addresses they are the hash of
+// When filtering transactions, only the addresses of the transactions which match the filter are recorded
+func (sdt *StateDiffTransformer) processAddressPreimages(tx *sqlx.Tx, blockNumber *big.Int, txs types.Transactions, receipts types.Receipts) error {
+	signer := types.MakeSigner(sdt.chainConfig, blockNumber)
+	addresses := make(map[common.Address]bool)
+	for i, trx := range txs {
+		from, err := types.Sender(signer, trx)
+		if err != nil {
 			return err
 		}
+		receipt := receipts[i]
+		if !sdt.filter.matchTx(trx, from, receipt) {
+			continue
+		}
+		addresses[from] = true
+		if to := trx.To(); to != nil {
+			addresses[*to] = true
+		}
+		if receipt.ContractAddress != (common.Address{}) {
+			addresses[receipt.ContractAddress] = true
+		}
+		for _, log := range receipt.Logs {
+			addresses[log.Address] = true
+		}
 	}
-	return nil
+	return sdt.indexer.indexAddressPreimages(tx, addresses)
+}
+
+// codeCreators maps the code hash of each contract created directly by a transaction in the block to the hash of that transaction
+// contracts created by other contracts don't appear in receipt.ContractAddress, so their creator can't be derived here
+func codeCreators(receipts types.Receipts, stateNodes []sdtypes.StateNode) map[common.Hash]string {
+	created := make(map[common.Hash]int)
+	for i, receipt := range receipts {
+		if receipt.ContractAddress == (common.Address{}) {
+			continue
+		}
+		created[crypto.Keccak256Hash(receipt.ContractAddress.Bytes())] = i
+	}
+	creators := make(map[common.Hash]string)
+	if len(created) == 0 {
+		return creators
+	}
+	// if the same code is deployed more than once in the block, the earliest transaction is the creator
+	first := make(map[common.Hash]int)
+	for _, node := range stateNodes {
+		if node.NodeType != sdtypes.Leaf {
+			continue
+		}
+		i, ok := created[common.BytesToHash(node.LeafKey)]
+		if !ok {
+			continue
+		}
+		account, err := DecodeStateLeafAccount(node.NodeValue)
+		if err != nil {
+			continue
+		}
+		codeHash := common.BytesToHash(account.CodeHash)
+		if j, ok := first[codeHash]; ok && j < i {
+			continue
+		}
+		first[codeHash] = i
+		creators[codeHash] = receipts[i].TxHash.String()
+	}
+	return creators
 }
@@ -18,6 +18,7 @@ package eth_test
 
 import (
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-ipfs-blockstore"
@@ -27,6 +28,8 @@ import (
 
 	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/lookup"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
 )
@@ -188,6 +191,7 @@ var _ = Describe("PublishAndIndexer", func() {
 					Expect(account).To(Equal(eth.StateAccountModel{
 						ID:          account.ID,
 						StateID:     stateNode.ID,
+						BlockNumber: mocks.BlockNumber.Uint64(),
 						Balance:     "0",
 						CodeHash:    mocks.ContractCodeHash.Bytes(),
 						StorageRoot: mocks.ContractRoot,
@@ -202,6 +206,7 @@ var _ = Describe("PublishAndIndexer", func() {
 					Expect(account).To(Equal(eth.StateAccountModel{
 						ID:          account.ID,
 						StateID:     stateNode.ID,
+						BlockNumber: mocks.BlockNumber.Uint64(),
 						Balance:     "1000",
 						CodeHash:    mocks.AccountCodeHash.Bytes(),
 						StorageRoot: mocks.AccountRoot,
@@ -249,5 +254,62 @@ var _ = Describe("PublishAndIndexer", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(code).To(Equal(mocks.MockContractByteCode))
 		})
+
+		It("Indexes code with its first-seen block and creating transaction", func() {
+			key, err := shared.MultihashKeyFromKeccak256(mocks.MockCodeHash)
+			Expect(err).ToNot(HaveOccurred())
+			codeModel := new(eth.CodeModel)
+			pgStr := `SELECT code_cids.code_hash, code_cids.mh_key, code_cids.size, code_cids.block_number, code_cids.tx_hash
+					FROM eth.code_cids INNER JOIN eth.header_cids ON (code_cids.header_id = header_cids.id)
+					WHERE header_cids.block_hash = $1`
+			err = db.Get(codeModel, pgStr, mocks.MockBlock.Hash().String())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(codeModel.CodeHash).To(Equal(mocks.MockCodeHash.Bytes()))
+			Expect(codeModel.MhKey).To(Equal(key))
+			Expect(codeModel.Size).To(Equal(len(mocks.MockContractByteCode)))
+			Expect(codeModel.BlockNumber).To(Equal(mocks.BlockNumber.Uint64()))
+			Expect(codeModel.TxHash).To(Equal(mocks.MockTransactions[2].Hash().String()))
+			// the contract account links to its code by code hash, on the chain of its header
+			var size int
+			pgStr = `SELECT code_cids.size FROM eth.state_accounts
+					INNER JOIN eth.state_cids ON (state_accounts.state_id = state_cids.id)
+					INNER JOIN eth.header_cids ON (state_cids.header_id = header_cids.id)
+					INNER JOIN eth.code_cids ON (state_accounts.code_hash = code_cids.code_hash AND header_cids.chain_id = code_cids.chain_id)
+					WHERE state_cids.state_leaf_key = $1`
+			err = db.Get(&size, pgStr, common.BytesToHash(mocks.ContractLeafKey).Hex())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(size).To(Equal(len(mocks.MockContractByteCode)))
+		})
+
+		It("Indexes code separately for each chain", func() {
+			otherDB, err := shared.SetupDBWithNode(node.Info{ID: "otherChainNode", ChainID: 3})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = eth.NewStateDiffTransformer(params.MainnetChainConfig, otherDB).Transform(1, mocks.MockStateDiffPayload)
+			Expect(err).ToNot(HaveOccurred())
+			var chains []int
+			pgStr := `SELECT code_cids.chain_id FROM eth.code_cids
+					INNER JOIN eth.header_cids ON (code_cids.header_id = header_cids.id)
+					WHERE code_cids.code_hash = $1
+					AND code_cids.chain_id = header_cids.chain_id
+					ORDER BY code_cids.chain_id`
+			err = db.Select(&chains, pgStr, mocks.MockCodeHash.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(chains).To(Equal([]int{int(db.Node.ChainID), 3}))
+		})
+
+		It("Records the addresses seen in the block behind their state leaf keys", func() {
+			pgStr := `SELECT address FROM eth.address_preimages WHERE state_leaf_key = $1`
+			for _, address := range []common.Address{mocks.SenderAddr, mocks.Address, mocks.AnotherAddress, mocks.ContractAddress} {
+				var preimage string
+				err = db.Get(&preimage, pgStr, crypto.Keccak256Hash(address.Bytes()).Hex())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(preimage).To(Equal(address.String()))
+			}
+			// and resolves the contract's state leaf key
+			address, ok, err := lookup.NewStateRetriever(db).Address(common.BytesToHash(mocks.ContractLeafKey))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(address).To(Equal(mocks.ContractAddress))
+		})
 	})
 })
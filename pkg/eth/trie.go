@@ -0,0 +1,131 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// DecodedTrieNode is a decoded Merkle Patricia Trie node
+type DecodedTrieNode struct {
+	NodeType sdtypes.NodeType
+	// Partial path (in nibbles, without terminator) of a leaf or extension node
+	Key []byte
+	// Value of a leaf node
+	Value []byte
+	// The 16 child references of a branch node, or the single child reference of an extension node
+	Children []TrieRef
+}
+
+// TrieRef is a reference from a trie node to one of its children
+type TrieRef struct {
+	Hash     common.Hash // Hash of the child node, zero if the child is empty or embedded
+	Embedded []byte      // RLP of the child node if it is small enough to be embedded in its parent
+}
+
+// Empty returns true if the reference does not point to a child
+func (r TrieRef) Empty() bool {
+	return r.Hash == (common.Hash{}) && len(r.Embedded) == 0
+}
+
+// DecodeTrieNode decodes the rlp of a trie node into a DecodedTrieNode
+func DecodeTrieNode(raw []byte) (*DecodedTrieNode, error) {
+	elems, _, err := rlp.SplitList(raw)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding trie node: %v", err)
+	}
+	count, err := rlp.CountValues(elems)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding trie node: %v", err)
+	}
+	switch count {
+	case 2:
+		compactKey, rest, err := rlp.SplitString(elems)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding trie node key: %v", err)
+		}
+		if len(compactKey) == 0 {
+			return nil, fmt.Errorf("trie node has an empty key")
+		}
+		key := trie.CompactToHex(compactKey)
+		if key[len(key)-1] == 16 {
+			val, _, err := rlp.SplitString(rest)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding trie leaf value: %v", err)
+			}
+			return &DecodedTrieNode{
+				NodeType: sdtypes.Leaf,
+				Key:      key[:len(key)-1],
+				Value:    val,
+			}, nil
+		}
+		ref, _, err := decodeTrieRef(rest)
+		if err != nil {
+			return nil, err
+		}
+		return &DecodedTrieNode{
+			NodeType: sdtypes.Extension,
+			Key:      key,
+			Children: []TrieRef{ref},
+		}, nil
+	case 17:
+		n := &DecodedTrieNode{
+			NodeType: sdtypes.Branch,
+			Children: make([]TrieRef, 16),
+		}
+		for i := 0; i < 16; i++ {
+			n.Children[i], elems, err = decodeTrieRef(elems)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("trie node has unexpected number of elements %d", count)
+	}
+}
+
+func decodeTrieRef(buf []byte) (TrieRef, []byte, error) {
+	kind, val, rest, err := rlp.Split(buf)
+	if err != nil {
+		return TrieRef{}, nil, fmt.Errorf("error decoding trie node child: %v", err)
+	}
+	switch {
+	case kind == rlp.List:
+		return TrieRef{Embedded: buf[:len(buf)-len(rest)]}, rest, nil
+	case kind == rlp.String && len(val) == 0:
+		return TrieRef{}, rest, nil
+	case kind == rlp.String && len(val) == common.HashLength:
+		return TrieRef{Hash: common.BytesToHash(val)}, rest, nil
+	default:
+		return TrieRef{}, nil, fmt.Errorf("invalid trie node child of length %d", len(val))
+	}
+}
+
+// LeafKey returns the full key of a leaf node found at the provided path (in nibbles)
+func LeafKey(path []byte, leaf *DecodedTrieNode) []byte {
+	full := make([]byte, 0, len(path)+len(leaf.Key)+1)
+	full = append(full, path...)
+	full = append(full, leaf.Key...)
+	full = append(full, 16)
+	return trie.HexToCompact(full)[1:]
+}
@@ -0,0 +1,149 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/prom"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+// conflictKeys are the conflict targets of the upserts into the eth CID tables
+var conflictKeys = map[string][]string{
+	"header_cids":      {"chain_id", "block_number", "block_hash"},
+	"uncle_cids":       {"header_id", "block_hash", "block_number"},
+	"transaction_cids": {"header_id", "tx_hash", "block_number"},
+	"receipt_cids":     {"tx_id", "block_number"},
+	"state_cids":       {"header_id", "state_path", "block_number"},
+	"state_accounts":   {"state_id", "block_number"},
+	"storage_cids":     {"state_id", "storage_path", "block_number"},
+	"trace_cids":       {"tx_id", "index", "block_number"},
+}
+
+// contentColumns are the columns of the eth CID tables which hold indexed content, re-indexing a row with different values in them is a conflict
+// bookkeeping columns, such as times_validated, node_id, and the diff flag, are expected to change
+// so is td, which is only a lower bound when it is derived without the parent's total difficulty, e.g. by the importer
+var contentColumns = map[string][]string{
+	"header_cids":      {"parent_hash", "cid", "reward", "state_root", "tx_root", "receipt_root", "uncle_root", "bloom", "timestamp", "mh_key"},
+	"uncle_cids":       {"parent_hash", "cid", "reward", "mh_key"},
+	"transaction_cids": {"cid", "dst", "src", "index", "mh_key", "tx_data"},
+	"receipt_cids":     {"cid", "contract", "contract_hash", "topic0s", "topic1s", "topic2s", "topic3s", "log_contracts", "mh_key", "post_state", "post_status"},
+	"state_cids":       {"state_leaf_key", "cid", "node_type", "mh_key"},
+	"state_accounts":   {"balance", "nonce", "code_hash", "storage_root"},
+	"storage_cids":     {"storage_leaf_key", "cid", "node_type", "mh_key"},
+	"trace_cids":       {"depth", "call_type", "src", "dst", "value", "input_selector", "gas", "gas_used", "error", "cid", "mh_key"},
+}
+
+// ConflictError is returned when indexing a payload would change the content of an indexed row and conflicts are rejected
+type ConflictError struct {
+	Table       string
+	BlockNumber uint64
+}
+
+// Error satisfies the error interface
+func (ce *ConflictError) Error() string {
+	return fmt.Sprintf("re-indexing would change the content of a row of eth.%s at block %d", ce.Table, ce.BlockNumber)
+}
+
+// upsert is an insert into one of the eth CID tables which updates the row if it is already indexed
+type upsert struct {
+	table string
+	// INSERT ... ON CONFLICT ... DO UPDATE statement, without a WHERE clause or RETURNING
+	pgStr string
+	args  []interface{}
+	// values of the table's conflict key columns
+	keyArgs []interface{}
+}
+
+// unchanged is the WHERE clause which only lets the upsert update rows whose content it doesn't change
+func (u upsert) unchanged() string {
+	existing := make([]string, len(contentColumns[u.table]))
+	excluded := make([]string, len(contentColumns[u.table]))
+	for i, column := range contentColumns[u.table] {
+		existing[i] = "eth." + u.table + "." + column
+		excluded[i] = "EXCLUDED." + column
+	}
+	return fmt.Sprintf(" WHERE (%s) IS NOT DISTINCT FROM (%s)", strings.Join(existing, ", "), strings.Join(excluded, ", "))
+}
+
+// existing selects the indexed row, its content as json, locking it for the rest of the tx
+func (u upsert) existing() string {
+	keys := conflictKeys[u.table]
+	params := make([]string, len(keys))
+	for i := range keys {
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+	return fmt.Sprintf(`SELECT id, block_number, to_jsonb(t) AS content FROM eth.%s AS t WHERE (%s) = (%s) FOR UPDATE`,
+		u.table, strings.Join(keys, ", "), strings.Join(params, ", "))
+}
+
+type upsertedRow struct {
+	ID          int64  `db:"id"`
+	BlockNumber uint64 `db:"block_number"`
+	Content     string `db:"content"`
+}
+
+// upsert executes the upsert and returns the id of the row
+// If the row is already indexed with different content, the change is handled according to the indexer's conflict mode:
+// it is made and recorded in eth.upsert_conflicts, recorded there but not made, or fails the payload
+func (in *CIDIndexer) upsert(tx *sqlx.Tx, u upsert) (int64, error) {
+	var id int64
+	err := tx.Get(&id, u.pgStr+u.unchanged()+` RETURNING id`, u.args...)
+	if err != sql.ErrNoRows {
+		return id, err
+	}
+	prom.UpsertConflictInc(u.table)
+	var existing upsertedRow
+	if err := tx.Get(&existing, u.existing(), u.keyArgs...); err != nil {
+		return 0, err
+	}
+	if in.conflicts == shared.RejectConflicts {
+		log.Warnf("eth indexer rejecting a change to the content of eth.%s row %d at block %d: %s", u.table, existing.ID, existing.BlockNumber, existing.Content)
+		return 0, &ConflictError{Table: u.table, BlockNumber: existing.BlockNumber}
+	}
+	// the replacement is made in a savepoint to read it back, and rolled back if conflicts are only audited
+	overwrite := in.conflicts != shared.AuditConflicts
+	if _, err := tx.Exec(`SAVEPOINT upsert_conflict`); err != nil {
+		return 0, err
+	}
+	var replacement upsertedRow
+	pgStr := fmt.Sprintf(`%s RETURNING id, block_number, to_jsonb(%s.*) AS content`, u.pgStr, u.table)
+	if err := tx.Get(&replacement, pgStr, u.args...); err != nil {
+		return 0, err
+	}
+	release := `RELEASE SAVEPOINT upsert_conflict`
+	if !overwrite {
+		release = `ROLLBACK TO SAVEPOINT upsert_conflict`
+	}
+	if _, err := tx.Exec(release); err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`INSERT INTO eth.upsert_conflicts (table_name, block_number, node_id, existing, replacement, overwritten) VALUES ($1, $2, $3, $4, $5, $6)`,
+		"eth."+u.table, existing.BlockNumber, in.db.NodeID, existing.Content, replacement.Content, overwrite)
+	if err != nil {
+		return 0, err
+	}
+	log.Warnf("eth indexer re-indexed eth.%s row %d at block %d with different content (overwritten: %t), see eth.upsert_conflicts",
+		u.table, existing.ID, existing.BlockNumber, overwrite)
+	return existing.ID, nil
+}
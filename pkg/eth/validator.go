@@ -0,0 +1,193 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+)
+
+// ValidationError lists the inconsistencies found while validating a state diff
+type ValidationError struct {
+	Problems []string
+}
+
+// Error satisfies the error interface
+func (ve *ValidationError) Error() string {
+	return fmt.Sprintf("state diff failed validation: %s", strings.Join(ve.Problems, "; "))
+}
+
+// ValidateStateDiff checks that the intermediate state nodes of a diff hash consistently up to the provided state root,
+// and that the storage nodes of every account in the diff hash consistently up to that account's storage root
+// The diff is expected to contain intermediate nodes, as produced with the IntermediateStateNodes and
+// IntermediateStorageNodes statediffing params; an empty diff is trivially valid
+// It returns a *ValidationError if the diff is inconsistent
+func ValidateStateDiff(stateRoot common.Hash, nodes []sdtypes.StateNode) error {
+	problems := validateTrieNodes("state", stateRoot, stateNodeValues(nodes))
+	for _, stateNode := range nodes {
+		if stateNode.NodeType != sdtypes.Leaf || len(stateNode.StorageNodes) == 0 {
+			continue
+		}
+		account, err := DecodeStateLeafAccount(stateNode.NodeValue)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("state leaf at path %x: %v", stateNode.Path, err))
+			continue
+		}
+		for _, problem := range validateTrieNodes("storage", account.Root, storageNodeValues(stateNode.StorageNodes)) {
+			problems = append(problems, fmt.Sprintf("account %x: %s", stateNode.LeafKey, problem))
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// DiffStateRoot returns the hash of the state root node in a diff, which is the state root the node that produced the diff arrived at
+// It returns false if the diff doesn't include the state root node
+func DiffStateRoot(nodes []sdtypes.StateNode) (common.Hash, bool) {
+	for _, stateNode := range nodes {
+		if len(stateNode.Path) == 0 && stateNode.NodeType != sdtypes.Removed {
+			return crypto.Keccak256Hash(stateNode.NodeValue), true
+		}
+	}
+	return common.Hash{}, false
+}
+
+// ValidateStorageDiff checks that the intermediate storage nodes of a diff hash consistently up to the provided storage root
+// It returns a *ValidationError if the diff is inconsistent
+func ValidateStorageDiff(storageRoot common.Hash, nodes []sdtypes.StorageNode) error {
+	if problems := validateTrieNodes("storage", storageRoot, storageNodeValues(nodes)); len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// DecodeStateLeafAccount decodes the account held in a state leaf node
+func DecodeStateLeafAccount(leafNode []byte) (*state.Account, error) {
+	leaf, err := DecodeTrieNode(leafNode)
+	if err != nil {
+		return nil, err
+	}
+	if leaf.NodeType != sdtypes.Leaf {
+		return nil, fmt.Errorf("expected a leaf node, got node type %s", leaf.NodeType)
+	}
+	account := new(state.Account)
+	if err := rlp.DecodeBytes(leaf.Value, account); err != nil {
+		return nil, fmt.Errorf("error decoding state account rlp: %v", err)
+	}
+	return account, nil
+}
+
+func stateNodeValues(nodes []sdtypes.StateNode) map[string][]byte {
+	values := make(map[string][]byte, len(nodes))
+	for _, n := range nodes {
+		if n.NodeType != sdtypes.Removed {
+			values[string(n.Path)] = n.NodeValue
+		}
+	}
+	return values
+}
+
+func storageNodeValues(nodes []sdtypes.StorageNode) map[string][]byte {
+	values := make(map[string][]byte, len(nodes))
+	for _, n := range nodes {
+		if n.NodeType != sdtypes.Removed {
+			values[string(n.Path)] = n.NodeValue
+		}
+	}
+	return values
+}
+
+// validateTrieNodes checks the trie nodes in a diff, keyed by their path, against the trie root
+// Every node in the diff must be referenced by its parent in the diff, by hash or by embedding, up to the root node
+func validateTrieNodes(trieType string, root common.Hash, nodes map[string][]byte) []string {
+	if len(nodes) == 0 {
+		return nil
+	}
+	var problems []string
+	if rootNode, ok := nodes[""]; !ok {
+		problems = append(problems, fmt.Sprintf("%s diff is missing the root node", trieType))
+	} else if hash := crypto.Keccak256Hash(rootNode); hash != root {
+		problems = append(problems, fmt.Sprintf("%s root node hashes to %s, expected %s", trieType, hash.Hex(), root.Hex()))
+	}
+	paths := make([]string, 0, len(nodes))
+	for path := range nodes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	referenced := map[string]bool{"": true}
+	for _, path := range paths {
+		n, err := DecodeTrieNode(nodes[path])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s node at path %x: %v", trieType, path, err))
+			continue
+		}
+		for _, ref := range childRefs(path, n) {
+			childPath := ref.path
+			child, ok := nodes[childPath]
+			if !ok {
+				continue
+			}
+			referenced[childPath] = true
+			switch {
+			case ref.Empty():
+				problems = append(problems, fmt.Sprintf("%s node at path %x is not referenced by its parent", trieType, childPath))
+			case len(ref.Embedded) > 0 && !bytes.Equal(ref.Embedded, child):
+				problems = append(problems, fmt.Sprintf("%s node at path %x does not match the node embedded in its parent", trieType, childPath))
+			case len(ref.Embedded) == 0 && crypto.Keccak256Hash(child) != ref.Hash:
+				problems = append(problems, fmt.Sprintf("%s node at path %x does not hash to %s as referenced by its parent", trieType, childPath, ref.Hash.Hex()))
+			}
+		}
+	}
+	for _, path := range paths {
+		if !referenced[path] {
+			problems = append(problems, fmt.Sprintf("%s node at path %x has no parent in the diff", trieType, path))
+		}
+	}
+	return problems
+}
+
+// pathRef is a child reference along with the path of the child
+type pathRef struct {
+	TrieRef
+	path string
+}
+
+// childRefs returns the child references of a branch or extension node found at the provided path
+func childRefs(path string, n *DecodedTrieNode) []pathRef {
+	switch n.NodeType {
+	case sdtypes.Branch:
+		refs := make([]pathRef, len(n.Children))
+		for i, ref := range n.Children {
+			refs[i] = pathRef{TrieRef: ref, path: path + string([]byte{byte(i)})}
+		}
+		return refs
+	case sdtypes.Extension:
+		return []pathRef{{TrieRef: n.Children[0], path: path + string(n.Key)}}
+	default:
+		return nil
+	}
+}
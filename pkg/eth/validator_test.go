@@ -0,0 +1,205 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package eth_test
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+	"github.com/ethereum/go-ethereum/trie"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+)
+
+// trieNode is a hashed node of a committed trie
+type trieNode struct {
+	path  []byte
+	value []byte
+}
+
+// buildTrie commits the key-value pairs to a fresh trie and returns its root and every hashed node in it
+func buildTrie(kvs map[common.Hash][]byte) (common.Hash, []trieNode) {
+	trieDB := trie.NewDatabase(rawdb.NewMemoryDatabase())
+	tr, err := trie.New(common.Hash{}, trieDB)
+	Expect(err).ToNot(HaveOccurred())
+	for key, value := range kvs {
+		Expect(tr.TryUpdate(key.Bytes(), value)).To(Succeed())
+	}
+	root, err := tr.Commit(nil)
+	Expect(err).ToNot(HaveOccurred())
+	nodes := make([]trieNode, 0)
+	it := tr.NodeIterator(nil)
+	for it.Next(true) {
+		if it.Hash() == (common.Hash{}) {
+			continue
+		}
+		value, err := trieDB.Node(it.Hash())
+		Expect(err).ToNot(HaveOccurred())
+		nodes = append(nodes, trieNode{path: common.CopyBytes(it.Path()), value: value})
+	}
+	Expect(it.Error()).ToNot(HaveOccurred())
+	return root, nodes
+}
+
+func nodeType(value []byte) sdtypes.NodeType {
+	n, err := eth.DecodeTrieNode(value)
+	Expect(err).ToNot(HaveOccurred())
+	return n.NodeType
+}
+
+var _ = Describe("State diff validation", func() {
+	var (
+		stateRoot    common.Hash
+		storageRoot  common.Hash
+		stateNodes   []sdtypes.StateNode
+		storageNodes []sdtypes.StorageNode
+		contractPath []byte
+	)
+	BeforeEach(func() {
+		storage := make(map[common.Hash][]byte)
+		for i := int64(1); i <= 20; i++ {
+			enc, err := rlp.EncodeToBytes(big.NewInt(i * 1000).Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			storage[crypto.Keccak256Hash(common.BigToHash(big.NewInt(i)).Bytes())] = enc
+		}
+		var sNodes []trieNode
+		storageRoot, sNodes = buildTrie(storage)
+		storageNodes = make([]sdtypes.StorageNode, 0, len(sNodes))
+		for _, n := range sNodes {
+			storageNodes = append(storageNodes, sdtypes.StorageNode{NodeType: nodeType(n.value), Path: n.path, NodeValue: n.value})
+		}
+
+		contractKey := crypto.Keccak256Hash(common.HexToAddress("0xaE9BEa628c4Ce503DcFD7E305CaB4e29E7476592").Bytes())
+		accounts := make(map[common.Hash][]byte)
+		for i := int64(1); i <= 50; i++ {
+			enc, err := rlp.EncodeToBytes(state.Account{
+				Nonce:    uint64(i),
+				Balance:  big.NewInt(i),
+				Root:     types.EmptyRootHash,
+				CodeHash: crypto.Keccak256(nil),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			accounts[crypto.Keccak256Hash(big.NewInt(i).Bytes())] = enc
+		}
+		enc, err := rlp.EncodeToBytes(state.Account{
+			Balance:  big.NewInt(0),
+			Root:     storageRoot,
+			CodeHash: crypto.Keccak256([]byte{0x60, 0x00}),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		accounts[contractKey] = enc
+		var nodes []trieNode
+		stateRoot, nodes = buildTrie(accounts)
+		stateNodes = make([]sdtypes.StateNode, 0, len(nodes))
+		for _, n := range nodes {
+			stateNode := sdtypes.StateNode{NodeType: nodeType(n.value), Path: n.path, NodeValue: n.value}
+			if stateNode.NodeType == sdtypes.Leaf {
+				leaf, err := eth.DecodeTrieNode(n.value)
+				Expect(err).ToNot(HaveOccurred())
+				stateNode.LeafKey = eth.LeafKey(n.path, leaf)
+				if common.BytesToHash(stateNode.LeafKey) == contractKey {
+					stateNode.StorageNodes = storageNodes
+					contractPath = n.path
+				}
+			}
+			stateNodes = append(stateNodes, stateNode)
+		}
+		Expect(contractPath).ToNot(BeNil())
+	})
+
+	It("Accepts a diff that hashes up to the state and storage roots", func() {
+		Expect(eth.ValidateStateDiff(stateRoot, stateNodes)).To(Succeed())
+		Expect(eth.ValidateStorageDiff(storageRoot, storageNodes)).To(Succeed())
+	})
+
+	It("Accepts an empty diff", func() {
+		Expect(eth.ValidateStateDiff(stateRoot, nil)).To(Succeed())
+	})
+
+	It("Ignores removed nodes", func() {
+		removed := append(stateNodes, sdtypes.StateNode{NodeType: sdtypes.Removed, Path: []byte{0x0f, 0x0f, 0x0f, 0x0f}})
+		Expect(eth.ValidateStateDiff(stateRoot, removed)).To(Succeed())
+	})
+
+	It("Finds the state root a diff hashes up to", func() {
+		root, ok := eth.DiffStateRoot(stateNodes)
+		Expect(ok).To(BeTrue())
+		Expect(root).To(Equal(stateRoot))
+		_, ok = eth.DiffStateRoot(stateNodes[1:])
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Rejects a diff that does not hash up to the state root", func() {
+		err := eth.ValidateStateDiff(common.HexToHash("0x01"), stateNodes)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(*eth.ValidationError).Problems).To(HaveLen(1))
+	})
+
+	It("Rejects a diff that is missing the root node", func() {
+		err := eth.ValidateStateDiff(stateRoot, stateNodes[1:])
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("missing the root node"))
+	})
+
+	It("Rejects a diff with a node that does not match its parent", func() {
+		for i, n := range stateNodes {
+			if n.NodeType == sdtypes.Leaf && len(n.StorageNodes) == 0 {
+				tampered := make([]byte, len(n.NodeValue))
+				copy(tampered, n.NodeValue)
+				tampered[len(tampered)-1]++
+				stateNodes[i].NodeValue = tampered
+				break
+			}
+		}
+		err := eth.ValidateStateDiff(stateRoot, stateNodes)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("as referenced by its parent"))
+	})
+
+	It("Rejects a diff with a node whose parent is missing", func() {
+		for i, n := range stateNodes {
+			if len(n.Path) == 1 && n.NodeType != sdtypes.Leaf {
+				stateNodes = append(stateNodes[:i], stateNodes[i+1:]...)
+				break
+			}
+		}
+		err := eth.ValidateStateDiff(stateRoot, stateNodes)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("has no parent in the diff"))
+	})
+
+	It("Rejects a storage diff that does not hash up to the account's storage root", func() {
+		err := eth.ValidateStorageDiff(common.HexToHash("0x01"), storageNodes)
+		Expect(err).To(HaveOccurred())
+		for i, n := range stateNodes {
+			if len(n.StorageNodes) > 0 {
+				stateNodes[i].StorageNodes = storageNodes[1:]
+			}
+		}
+		err = eth.ValidateStateDiff(stateRoot, stateNodes)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("storage diff is missing the root node"))
+	})
+})
@@ -24,6 +24,7 @@ import (
 
 	"github.com/spf13/viper"
 
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
@@ -32,10 +33,15 @@ import (
 
 // Env variables
 const (
-	BACKFILL_FREQUENCY        = "BACKFILL_FREQUENCY"
-	BACKFILL_BATCH_SIZE       = "BACKFILL_BATCH_SIZE"
-	BACKFILL_WORKERS          = "BACKFILL_WORKERS"
-	BACKFILL_VALIDATION_LEVEL = "BACKFILL_VALIDATION_LEVEL"
+	BACKFILL_FREQUENCY            = "BACKFILL_FREQUENCY"
+	BACKFILL_BATCH_SIZE           = "BACKFILL_BATCH_SIZE"
+	BACKFILL_WORKERS              = "BACKFILL_WORKERS"
+	BACKFILL_VALIDATION_LEVEL     = "BACKFILL_VALIDATION_LEVEL"
+	BACKFILL_RECORD_PATH          = "BACKFILL_RECORD_PATH"
+	BACKFILL_REPLAY_PATH          = "BACKFILL_REPLAY_PATH"
+	BACKFILL_VALIDATE_STATE_DIFFS = "BACKFILL_VALIDATE_STATE_DIFFS"
+	BACKFILL_CROSS_VALIDATE       = "BACKFILL_CROSS_VALIDATE"
+	BACKFILL_TRACES               = "BACKFILL_TRACES"
 
 	BACKFILL_MAX_IDLE_CONNECTIONS = "BACKFILL_MAX_IDLE_CONNECTIONS"
 	BACKFILL_MAX_OPEN_CONNECTIONS = "BACKFILL_MAX_OPEN_CONNECTIONS"
@@ -44,16 +50,25 @@ const (
 
 // Config struct
 type Config struct {
-	DBConfig postgres.Config
-
-	DB              *postgres.DB
-	HTTPClient      *rpc.Client
-	Frequency       time.Duration
-	BatchSize       uint64
-	Workers         uint64
-	ValidationLevel int
-	Timeout         time.Duration // HTTP connection timeout in seconds
-	NodeInfo        node.Info
+	DBConfig         postgres.Config
+	Blockstore       blockstore.Blockstore
+	BlockstoreConfig blockstore.Config
+
+	DB                 *postgres.DB
+	HTTPClient         *rpc.Client
+	Frequency          time.Duration
+	BatchSize          uint64
+	Workers            uint64
+	ValidationLevel    int
+	Timeout            time.Duration // HTTP connection timeout in seconds
+	NodeInfo           node.Info
+	RecordPath         string              // Path to a local file to record fetched payloads to
+	ReplayPath         string              // Path to a local file of recorded payloads to fetch from instead of geth
+	ValidateStateDiffs bool                // If true, validate state diffs against the header state root before counting them as validated
+	CrossValidate      bool                // If true, count the independent nodes which agree on a header, rather than the times it was indexed, as its validation level
+	Filter             shared.IndexFilter  // Selects the subset of each payload that is indexed
+	Conflicts          shared.ConflictMode // How re-indexing a row with different content is handled
+	Traces             bool                // If true, also fetch and index the call traces of the transactions in each block
 }
 
 // NewConfig is used to initialize a historical config from a .toml file
@@ -67,6 +82,11 @@ func NewConfig() (*Config, error) {
 	viper.BindEnv("backfill.workers", BACKFILL_WORKERS)
 	viper.BindEnv("backfill.validationLevel", BACKFILL_VALIDATION_LEVEL)
 	viper.BindEnv("backfill.timeout", shared.HTTP_TIMEOUT)
+	viper.BindEnv("backfill.recordPath", BACKFILL_RECORD_PATH)
+	viper.BindEnv("backfill.replayPath", BACKFILL_REPLAY_PATH)
+	viper.BindEnv("backfill.validateStateDiffs", BACKFILL_VALIDATE_STATE_DIFFS)
+	viper.BindEnv("backfill.crossValidate", BACKFILL_CROSS_VALIDATE)
+	viper.BindEnv("backfill.traces", BACKFILL_TRACES)
 
 	timeout := viper.GetInt("backfill.timeout")
 	if timeout < 15 {
@@ -85,17 +105,41 @@ func NewConfig() (*Config, error) {
 	c.BatchSize = uint64(viper.GetInt64("backfill.batchSize"))
 	c.Workers = uint64(viper.GetInt64("backfill.workers"))
 	c.ValidationLevel = viper.GetInt("backfill.validationLevel")
-
-	ethHTTP := viper.GetString("ethereum.httpPath")
-	c.NodeInfo, c.HTTPClient, err = shared.GetEthNodeAndClient(fmt.Sprintf("http://%s", ethHTTP))
+	c.RecordPath = viper.GetString("backfill.recordPath")
+	c.ReplayPath = viper.GetString("backfill.replayPath")
+	c.ValidateStateDiffs = viper.GetBool("backfill.validateStateDiffs")
+	c.CrossValidate = viper.GetBool("backfill.crossValidate")
+	c.Traces = viper.GetBool("backfill.traces")
+	c.Filter, err = shared.GetIndexFilter()
+	if err != nil {
+		return nil, err
+	}
+	c.Conflicts, err = shared.GetConflictMode()
 	if err != nil {
 		return nil, err
 	}
 
+	if c.ReplayPath != "" {
+		c.NodeInfo = shared.GetEthNodeInfo()
+	} else {
+		ethHTTP := viper.GetString("ethereum.httpPath")
+		c.NodeInfo, c.HTTPClient, err = shared.GetEthNodeAndClient(fmt.Sprintf("http://%s", ethHTTP))
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	c.DBConfig.Init()
 	overrideDBConnConfig(&c.DBConfig)
-	db := utils.LoadPostgres(c.DBConfig, c.NodeInfo, true)
+	db := utils.LoadMigratedPostgres(c.DBConfig, c.NodeInfo, true)
 	c.DB = &db
+	if err := c.BlockstoreConfig.Init(); err != nil {
+		return nil, err
+	}
+	c.Blockstore, err = blockstore.NewBlockstore(c.BlockstoreConfig, c.DB.DB)
+	if err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
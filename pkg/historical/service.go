@@ -17,6 +17,7 @@
 package historical
 
 import (
+	"io"
 	"sync"
 	"time"
 
@@ -39,8 +40,14 @@ type Backfill interface {
 type Service struct {
 	// Interface for fetching statediff.Payloads over http
 	Fetcher eth.Fetcher
+	// Interface for recording fetched payloads to a local file, nil if not recording
+	Recorder eth.Recorder
 	// Interface for transforming payloads into IPLD object models in Postgres
 	Transformer eth.Transformer
+	// Interface for fetching the call traces of the transactions in each block, nil if not tracing
+	TraceFetcher eth.TraceFetcher
+	// Interface for transforming call traces into IPLD object models in Postgres, nil if not tracing
+	TraceTransformer eth.TraceTransformer
 	// Interface for finding gaps in the database
 	Retriever eth.Retriever
 	// Check frequency
@@ -61,13 +68,45 @@ type Service struct {
 func NewBackfillService(settings *Config) (Backfill, error) {
 	bs := new(Service)
 	var err error
-	bs.Fetcher = eth.NewPayloadFetcher(settings.HTTPClient, settings.Timeout)
+	if settings.ReplayPath != "" {
+		bs.Fetcher, err = eth.NewFileFetcher(settings.ReplayPath)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		fetcher := eth.NewPayloadFetcher(settings.HTTPClient, settings.Timeout)
+		fetcher.WatchAddresses(settings.Filter.Addresses)
+		bs.Fetcher = fetcher
+		if settings.Traces {
+			bs.TraceFetcher = eth.NewCallTraceFetcher(settings.HTTPClient, settings.Timeout)
+			traceTransformer := eth.NewCallTraceTransformer(settings.DB)
+			traceTransformer.SetBlockstore(settings.Blockstore)
+			bs.TraceTransformer = traceTransformer
+		}
+	}
+	if settings.Traces && settings.ReplayPath != "" {
+		log.Warn("call traces are not recorded, traces will not be indexed while replaying payloads")
+	}
+	if settings.RecordPath != "" {
+		bs.Recorder, err = eth.NewPayloadRecorder(settings.RecordPath)
+		if err != nil {
+			return nil, err
+		}
+	}
 	bs.ChainConfig, err = eth.ChainConfig(settings.NodeInfo.ChainID)
 	if err != nil {
 		return nil, err
 	}
-	bs.Transformer = eth.NewStateDiffTransformer(bs.ChainConfig, settings.DB)
-	bs.Retriever = eth.NewGapRetriever(settings.DB)
+	transformer := eth.NewStateDiffTransformer(bs.ChainConfig, settings.DB)
+	transformer.SetValidation(settings.ValidateStateDiffs)
+	transformer.SetCrossValidation(settings.CrossValidate)
+	transformer.SetFilter(settings.Filter)
+	transformer.SetConflictMode(settings.Conflicts)
+	transformer.SetBlockstore(settings.Blockstore)
+	bs.Transformer = transformer
+	retriever := eth.NewGapRetriever(settings.DB)
+	retriever.SetCrossValidation(settings.CrossValidate)
+	bs.Retriever = retriever
 	bs.BatchSize = settings.BatchSize
 	if bs.BatchSize == 0 {
 		bs.BatchSize = shared.DefaultMaxBatchSize
@@ -88,6 +127,12 @@ func (bfs *Service) Sync(wg *sync.WaitGroup) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		// the workers of the current pass are waited on before the recorder and fetcher they use are closed
+		workers := new(sync.WaitGroup)
+		defer func() {
+			workers.Wait()
+			bfs.close()
+		}()
 		for {
 			select {
 			case <-bfs.QuitChan:
@@ -104,7 +149,11 @@ func (bfs *Service) Sync(wg *sync.WaitGroup) {
 				// so that we know each of the previous workers is done before we search for new gaps
 				heightsChan := make(chan []uint64)
 				for i := 1; i <= int(bfs.Workers); i++ {
-					go bfs.backFill(wg, i, heightsChan)
+					workers.Add(1)
+					go func(id int) {
+						defer workers.Done()
+						bfs.backFill(wg, id, heightsChan)
+					}(i)
 				}
 				for _, gap := range gaps {
 					log.Infof("backfilling historical ethereum data from %d to %d", gap.Start, gap.Stop)
@@ -145,10 +194,26 @@ func (bfs *Service) backFill(wg *sync.WaitGroup, id int, heightChan chan []uint6
 			if err != nil {
 				log.Errorf("ethereum backfill worker %d fetcher error: %s", id, err.Error())
 			}
+			var traces map[uint64][]eth.TxTrace
+			if bfs.TraceFetcher != nil {
+				traces, err = bfs.TraceFetcher.FetchTracesAt(heights)
+				if err != nil {
+					log.Errorf("ethereum backfill worker %d trace fetcher error: %s", id, err.Error())
+				}
+			}
 			for _, payload := range payloads {
+				if bfs.Recorder != nil {
+					if err := bfs.Recorder.Record(payload); err != nil {
+						log.Errorf("ethereum backfill worker %d recorder error: %s", id, err.Error())
+					}
+				}
 				blockNumber, err := bfs.Transformer.Transform(id, payload)
 				if err != nil {
 					log.Errorf("ethereum backfill worker %d transformer error: %s", id, err.Error())
+				} else if blockTraces, ok := traces[blockNumber]; ok {
+					if err := bfs.TraceTransformer.Transform(id, payload, blockTraces); err != nil {
+						log.Errorf("ethereum backfill worker %d trace transformer error: %s", id, err.Error())
+					}
 				}
 				log.Infof("ethereum backfill worker %d transformed data at height %d", id, blockNumber)
 			}
@@ -160,6 +225,20 @@ func (bfs *Service) backFill(wg *sync.WaitGroup, id int, heightChan chan []uint6
 	}
 }
 
+// close closes the payload recorder and the file fetcher, if they are used
+func (bfs *Service) close() {
+	if bfs.Recorder != nil {
+		if err := bfs.Recorder.Close(); err != nil {
+			log.Errorf("ethereum backfill recorder error: %v", err)
+		}
+	}
+	if closer, ok := bfs.Fetcher.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Errorf("ethereum backfill fetcher error: %v", err)
+		}
+	}
+}
+
 func (bfs *Service) Stop() error {
 	log.Info("stopping ethereum backfill service")
 	close(bfs.QuitChan)
@@ -155,5 +155,54 @@ var _ = Describe("BackFiller", func() {
 			Expect(len(mockFetcher.CalledAtBlockHeights)).To(Equal(1))
 			Expect(mockFetcher.CalledAtBlockHeights[0]).To(Equal([]uint64{0, 1, 2}))
 		})
+
+		It("Fetches and transforms the call traces of the backfilled blocks", func() {
+			mockTransformer := &mocks.IterativeTransformer{
+				ReturnErr:     nil,
+				ReturnHeights: []uint64{100, 101},
+			}
+			mockTraceTransformer := new(mocks.TraceTransformer)
+			mockRetriever := &mocks.Retriever{
+				FirstBlockNumberToReturn: 0,
+				GapsToRetrieve: []eth.DBGap{
+					{
+						Start: 100, Stop: 101,
+					},
+				},
+			}
+			mockFetcher := &mocks.PayloadFetcher{
+				PayloadsToReturn: map[uint64]statediff.Payload{
+					100: mocks.MockStateDiffPayload,
+					101: mocks.MockStateDiffPayload,
+				},
+			}
+			mockTraceFetcher := &mocks.TraceFetcher{
+				TracesToReturn: map[uint64][]eth.TxTrace{
+					100: mocks.MockCallTraces,
+				},
+			}
+			quitChan := make(chan bool, 1)
+			backfiller := &historical.Service{
+				Transformer:       mockTransformer,
+				Fetcher:           mockFetcher,
+				TraceFetcher:      mockTraceFetcher,
+				TraceTransformer:  mockTraceTransformer,
+				Retriever:         mockRetriever,
+				GapCheckFrequency: time.Second * 2,
+				BatchSize:         shared.DefaultMaxBatchSize,
+				Workers:           shared.DefaultMaxBatchNumber,
+				QuitChan:          quitChan,
+			}
+			wg := &sync.WaitGroup{}
+			backfiller.Sync(wg)
+			time.Sleep(time.Second * 3)
+			quitChan <- true
+			Expect(len(mockTransformer.PassedStateDiffs)).To(Equal(2))
+			Expect(len(mockTraceFetcher.CalledAtBlockHeights)).To(Equal(1))
+			Expect(mockTraceFetcher.CalledAtBlockHeights[0]).To(Equal([]uint64{100, 101}))
+			Expect(len(mockTraceTransformer.PassedTraces)).To(Equal(1))
+			Expect(mockTraceTransformer.PassedTraces[0]).To(Equal(mocks.MockCallTraces))
+			Expect(mockTraceTransformer.PassedPayloads[0]).To(Equal(mocks.MockStateDiffPayload))
+		})
 	})
 })
@@ -0,0 +1,427 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package importer
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/statediff"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+var (
+	// ErrBlockNotFound is returned by a BlockSource when it does not hold the requested block
+	ErrBlockNotFound = errors.New("block not found")
+
+	emptyCodeHash = crypto.Keccak256Hash(nil)
+)
+
+// BlockSource is used to look up raw IPLD block data by keccak256 hash
+type BlockSource interface {
+	Get(hash common.Hash) ([]byte, error)
+}
+
+// PostgresBlockSource is a BlockSource backed by the public.blocks table
+type PostgresBlockSource struct {
+	db *postgres.DB
+}
+
+// NewPostgresBlockSource returns a new PostgresBlockSource
+func NewPostgresBlockSource(db *postgres.DB) *PostgresBlockSource {
+	return &PostgresBlockSource{db: db}
+}
+
+// Get satisfies the BlockSource interface
+func (ps *PostgresBlockSource) Get(hash common.Hash) ([]byte, error) {
+	mhKey, err := shared.MultihashKeyFromKeccak256(hash)
+	if err != nil {
+		return nil, err
+	}
+	var data blockstore.Data
+	if err := ps.db.Get(&data, `SELECT data FROM public.blocks WHERE key = $1`, mhKey); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrBlockNotFound
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// BlockstoreSource is a BlockSource backed by a blockstore
+type BlockstoreSource struct {
+	blocks blockstore.Blockstore
+}
+
+// NewBlockstoreSource returns a new BlockstoreSource
+func NewBlockstoreSource(blocks blockstore.Blockstore) *BlockstoreSource {
+	return &BlockstoreSource{blocks: blocks}
+}
+
+// Get satisfies the BlockSource interface
+func (bs *BlockstoreSource) Get(hash common.Hash) ([]byte, error) {
+	mhKey, err := shared.MultihashKeyFromKeccak256(hash)
+	if err != nil {
+		return nil, err
+	}
+	data, err := bs.blocks.Get(mhKey)
+	if err == blockstore.ErrNotFound {
+		return nil, ErrBlockNotFound
+	}
+	return data, err
+}
+
+// PayloadBuilder reconstructs statediff payloads from the IPLD blocks held in a BlockSource
+type PayloadBuilder struct {
+	source BlockSource
+	// Number of trie nodes which were referenced but could not be found in the source
+	// These are assumed to be unchanged nodes that were not included in the archive
+	Missing uint64
+}
+
+// NewPayloadBuilder returns a new PayloadBuilder
+func NewPayloadBuilder(source BlockSource) *PayloadBuilder {
+	return &PayloadBuilder{source: source}
+}
+
+// Build reconstructs the statediff payload for the provided header
+// The state diff is taken against the state root of the parent header, if the parent is nil the full state trie is walked
+func (pb *PayloadBuilder) Build(header *types.Header, uncles []*types.Header, parent *types.Header, td *big.Int) (statediff.Payload, error) {
+	oldRoot := common.Hash{}
+	if parent != nil {
+		oldRoot = parent.Root
+	}
+	return pb.build(header, uncles, td, func(stateObject *statediff.StateObject) error {
+		return pb.diffState(refFromHash(header.Root), refFromHash(oldRoot), nil, stateObject)
+	})
+}
+
+// BuildBlock reconstructs the payload for the provided header with an empty state diff, for when its state is indexed separately
+func (pb *PayloadBuilder) BuildBlock(header *types.Header, uncles []*types.Header, td *big.Int) (statediff.Payload, error) {
+	return pb.build(header, uncles, td, nil)
+}
+
+func (pb *PayloadBuilder) build(header *types.Header, uncles []*types.Header, td *big.Int, diff func(*statediff.StateObject) error) (statediff.Payload, error) {
+	txs, err := pb.transactions(header.TxHash)
+	if err != nil {
+		return statediff.Payload{}, fmt.Errorf("error rebuilding transactions for block %d: %v", header.Number.Uint64(), err)
+	}
+	receipts, err := pb.receipts(header.ReceiptHash)
+	if err != nil {
+		return statediff.Payload{}, fmt.Errorf("error rebuilding receipts for block %d: %v", header.Number.Uint64(), err)
+	}
+	if len(txs) != len(receipts) {
+		return statediff.Payload{}, fmt.Errorf("block %d has %d transactions but %d receipts", header.Number.Uint64(), len(txs), len(receipts))
+	}
+	block := types.NewBlockWithHeader(header).WithBody(txs, uncles)
+	stateObject := statediff.StateObject{
+		BlockNumber: header.Number,
+		BlockHash:   header.Hash(),
+	}
+	if diff != nil {
+		if err := diff(&stateObject); err != nil {
+			return statediff.Payload{}, fmt.Errorf("error rebuilding state diff for block %d: %v", header.Number.Uint64(), err)
+		}
+	}
+	blockRlp, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return statediff.Payload{}, err
+	}
+	receiptsRlp, err := rlp.EncodeToBytes(receipts)
+	if err != nil {
+		return statediff.Payload{}, err
+	}
+	stateObjectRlp, err := rlp.EncodeToBytes(stateObject)
+	if err != nil {
+		return statediff.Payload{}, err
+	}
+	return statediff.Payload{
+		BlockRlp:        blockRlp,
+		ReceiptsRlp:     receiptsRlp,
+		StateObjectRlp:  stateObjectRlp,
+		TotalDifficulty: td,
+	}, nil
+}
+
+// transactions reads the transactions out of the transaction trie with the provided root
+func (pb *PayloadBuilder) transactions(root common.Hash) (types.Transactions, error) {
+	values, err := pb.indexedLeaves(root)
+	if err != nil {
+		return nil, err
+	}
+	txs := make(types.Transactions, len(values))
+	for i, val := range values {
+		txs[i] = new(types.Transaction)
+		if err := rlp.DecodeBytes(val, txs[i]); err != nil {
+			return nil, fmt.Errorf("error decoding transaction %d: %v", i, err)
+		}
+	}
+	return txs, nil
+}
+
+// receipts reads the receipts out of the receipt trie with the provided root
+func (pb *PayloadBuilder) receipts(root common.Hash) (types.Receipts, error) {
+	values, err := pb.indexedLeaves(root)
+	if err != nil {
+		return nil, err
+	}
+	rcts := make(types.Receipts, len(values))
+	for i, val := range values {
+		rcts[i] = new(types.Receipt)
+		if err := rlp.DecodeBytes(val, rcts[i]); err != nil {
+			return nil, fmt.Errorf("error decoding receipt %d: %v", i, err)
+		}
+	}
+	return rcts, nil
+}
+
+// indexedLeaves returns the leaf values of a trie keyed by rlp encoded indexes (e.g. a tx or receipt trie) in index order
+// Unlike the state trie, these tries must be complete
+func (pb *PayloadBuilder) indexedLeaves(root common.Hash) ([][]byte, error) {
+	if root == types.EmptyRootHash {
+		return nil, nil
+	}
+	values := make(map[uint64][]byte)
+	err := pb.walkLeaves(refFromHash(root), nil, func(key, value []byte) error {
+		var idx uint64
+		if err := rlp.DecodeBytes(key, &idx); err != nil {
+			return fmt.Errorf("error decoding trie leaf index: %v", err)
+		}
+		values[idx] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ordered := make([][]byte, len(values))
+	for idx, val := range values {
+		if idx >= uint64(len(values)) {
+			return nil, fmt.Errorf("trie leaf index %d out of range", idx)
+		}
+		ordered[idx] = val
+	}
+	return ordered, nil
+}
+
+func (pb *PayloadBuilder) walkLeaves(ref eth.TrieRef, path []byte, leafFn func(key, value []byte) error) error {
+	if ref.Empty() {
+		return nil
+	}
+	raw := ref.Embedded
+	if len(raw) == 0 {
+		var err error
+		if raw, err = pb.source.Get(ref.Hash); err != nil {
+			return fmt.Errorf("error fetching trie node %s: %v", ref.Hash.Hex(), err)
+		}
+	}
+	n, err := eth.DecodeTrieNode(raw)
+	if err != nil {
+		return err
+	}
+	switch n.NodeType {
+	case sdtypes.Leaf:
+		return leafFn(eth.LeafKey(path, n), n.Value)
+	case sdtypes.Extension:
+		return pb.walkLeaves(n.Children[0], appendPath(path, n.Key...), leafFn)
+	default:
+		for i, child := range n.Children {
+			if err := pb.walkLeaves(child, appendPath(path, byte(i)), leafFn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// diffState adds every state node (and the storage nodes and code below it) found in the trie referenced by newRef,
+// but not at the same path in the trie referenced by oldRef, to the provided state object
+func (pb *PayloadBuilder) diffState(newRef, oldRef eth.TrieRef, path []byte, so *statediff.StateObject) error {
+	return pb.diffTrie(newRef, oldRef, path, func(path, raw []byte, n, old *eth.DecodedTrieNode) error {
+		if n == nil {
+			so.Nodes = append(so.Nodes, sdtypes.StateNode{
+				NodeType:  sdtypes.Removed,
+				Path:      path,
+				NodeValue: []byte{},
+			})
+			return nil
+		}
+		stateNode := sdtypes.StateNode{
+			NodeType:  n.NodeType,
+			Path:      path,
+			NodeValue: raw,
+		}
+		if n.NodeType != sdtypes.Leaf {
+			so.Nodes = append(so.Nodes, stateNode)
+			return nil
+		}
+		stateNode.LeafKey = eth.LeafKey(path, n)
+		account := new(state.Account)
+		if err := rlp.DecodeBytes(n.Value, account); err != nil {
+			return fmt.Errorf("error decoding account at path %x: %v", path, err)
+		}
+		// if this path held the same account before, diff against its old storage trie and code hash
+		oldStorageRoot, oldCodeHash := common.Hash{}, common.Hash{}
+		if old != nil && old.NodeType == sdtypes.Leaf && bytes.Equal(old.Key, n.Key) {
+			oldAccount := new(state.Account)
+			if err := rlp.DecodeBytes(old.Value, oldAccount); err == nil {
+				oldStorageRoot, oldCodeHash = oldAccount.Root, common.BytesToHash(oldAccount.CodeHash)
+			}
+		}
+		if account.Root != types.EmptyRootHash {
+			if err := pb.diffStorage(refFromHash(account.Root), refFromHash(oldStorageRoot), &stateNode); err != nil {
+				return err
+			}
+		}
+		so.Nodes = append(so.Nodes, stateNode)
+		codeHash := common.BytesToHash(account.CodeHash)
+		if codeHash == emptyCodeHash || codeHash == oldCodeHash {
+			return nil
+		}
+		code, err := pb.source.Get(codeHash)
+		if err == ErrBlockNotFound {
+			pb.Missing++
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		so.CodeAndCodeHashes = append(so.CodeAndCodeHashes, sdtypes.CodeAndCodeHash{
+			Hash: codeHash,
+			Code: code,
+		})
+		return nil
+	})
+}
+
+// diffStorage adds the storage nodes found in the trie referenced by newRef, but not at the same path in the trie referenced by oldRef, to the state node
+func (pb *PayloadBuilder) diffStorage(newRef, oldRef eth.TrieRef, stateNode *sdtypes.StateNode) error {
+	return pb.diffTrie(newRef, oldRef, nil, func(path, raw []byte, n, old *eth.DecodedTrieNode) error {
+		if n == nil {
+			stateNode.StorageNodes = append(stateNode.StorageNodes, sdtypes.StorageNode{
+				NodeType:  sdtypes.Removed,
+				Path:      path,
+				NodeValue: []byte{},
+			})
+			return nil
+		}
+		storageNode := sdtypes.StorageNode{
+			NodeType:  n.NodeType,
+			Path:      path,
+			NodeValue: raw,
+		}
+		if n.NodeType == sdtypes.Leaf {
+			storageNode.LeafKey = eth.LeafKey(path, n)
+		}
+		stateNode.StorageNodes = append(stateNode.StorageNodes, storageNode)
+		return nil
+	})
+}
+
+// diffFn is called for every node which differs between two tries
+// n is nil if the path has been emptied in the new trie, old is nil if the path was not (resolvably) occupied in the old trie
+type diffFn func(path, raw []byte, n, old *eth.DecodedTrieNode) error
+
+// diffTrie walks the trie referenced by newRef, descending only into nodes which differ from the node at the same path in the trie referenced by oldRef
+// Nodes embedded in their parent are skipped, as they are by the statediffing geth node
+// Nodes missing from the source are skipped and counted, as they are expected to belong to unchanged subtries
+func (pb *PayloadBuilder) diffTrie(newRef, oldRef eth.TrieRef, path []byte, fn diffFn) error {
+	if newRef.Hash == oldRef.Hash && newRef.Hash != (common.Hash{}) {
+		return nil
+	}
+	if newRef.Empty() {
+		if oldRef.Hash != (common.Hash{}) {
+			return fn(path, nil, nil, nil)
+		}
+		return nil
+	}
+	if newRef.Hash == (common.Hash{}) {
+		return nil
+	}
+	raw, err := pb.source.Get(newRef.Hash)
+	if err == ErrBlockNotFound {
+		pb.Missing++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	n, err := eth.DecodeTrieNode(raw)
+	if err != nil {
+		return err
+	}
+	var old *eth.DecodedTrieNode
+	if oldRef.Hash != (common.Hash{}) {
+		oldRaw, err := pb.source.Get(oldRef.Hash)
+		if err != nil && err != ErrBlockNotFound {
+			return err
+		}
+		if err == nil {
+			if old, err = eth.DecodeTrieNode(oldRaw); err != nil {
+				return err
+			}
+		}
+	}
+	if err := fn(path, raw, n, old); err != nil {
+		return err
+	}
+	switch n.NodeType {
+	case sdtypes.Branch:
+		for i, child := range n.Children {
+			oldChild := eth.TrieRef{}
+			if old != nil && old.NodeType == sdtypes.Branch {
+				oldChild = old.Children[i]
+			}
+			if err := pb.diffTrie(child, oldChild, appendPath(path, byte(i)), fn); err != nil {
+				return err
+			}
+		}
+	case sdtypes.Extension:
+		oldChild := eth.TrieRef{}
+		if old != nil && old.NodeType == sdtypes.Extension && bytes.Equal(old.Key, n.Key) {
+			oldChild = old.Children[0]
+		}
+		return pb.diffTrie(n.Children[0], oldChild, appendPath(path, n.Key...), fn)
+	}
+	return nil
+}
+
+func refFromHash(hash common.Hash) eth.TrieRef {
+	if hash == types.EmptyRootHash {
+		return eth.TrieRef{}
+	}
+	return eth.TrieRef{Hash: hash}
+}
+
+// appendPath returns a new path, so that sibling paths never share a backing array
+func appendPath(path []byte, nibbles ...byte) []byte {
+	p := make([]byte, 0, len(path)+len(nibbles))
+	p = append(p, path...)
+	return append(p, nibbles...)
+}
@@ -0,0 +1,182 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package importer_test
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/statediff"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+	"github.com/ethereum/go-ethereum/trie"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/importer"
+)
+
+// mapSource is an in-memory importer.BlockSource
+type mapSource map[common.Hash][]byte
+
+func (ms mapSource) Get(hash common.Hash) ([]byte, error) {
+	data, ok := ms[hash]
+	if !ok {
+		return nil, importer.ErrBlockNotFound
+	}
+	return data, nil
+}
+
+func (ms mapSource) put(data []byte) {
+	ms[crypto.Keccak256Hash(data)] = data
+}
+
+// commitTrie commits the provided key-value pairs to a fresh trie, adding its nodes to the source
+func commitTrie(source mapSource, kvs map[string][]byte) common.Hash {
+	db := rawdb.NewMemoryDatabase()
+	trieDB := trie.NewDatabase(db)
+	tr, err := trie.New(common.Hash{}, trieDB)
+	Expect(err).ToNot(HaveOccurred())
+	for key, value := range kvs {
+		Expect(tr.TryUpdate([]byte(key), value)).To(Succeed())
+	}
+	root, err := tr.Commit(nil)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(trieDB.Commit(root, false, nil)).To(Succeed())
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		source.put(common.CopyBytes(it.Value()))
+	}
+	return root
+}
+
+// commitIndexedTrie commits the list to a fresh trie keyed by rlp encoded index, like a tx or receipt trie
+func commitIndexedTrie(source mapSource, list types.DerivableList) common.Hash {
+	kvs := make(map[string][]byte)
+	for i := 0; i < list.Len(); i++ {
+		key, err := rlp.EncodeToBytes(uint(i))
+		Expect(err).ToNot(HaveOccurred())
+		kvs[string(key)] = list.GetRlp(i)
+	}
+	return commitTrie(source, kvs)
+}
+
+// buildStateTrie commits the provided accounts to a fresh state trie, adding its nodes to the source
+func buildStateTrie(source mapSource, accounts map[common.Hash]state.Account) common.Hash {
+	kvs := make(map[string][]byte)
+	for key, account := range accounts {
+		enc, err := rlp.EncodeToBytes(account)
+		Expect(err).ToNot(HaveOccurred())
+		kvs[string(key.Bytes())] = enc
+	}
+	return commitTrie(source, kvs)
+}
+
+func newAccount(nonce uint64) state.Account {
+	return state.Account{
+		Nonce:    nonce,
+		Balance:  big.NewInt(1000),
+		Root:     types.EmptyRootHash,
+		CodeHash: crypto.Keccak256(nil),
+	}
+}
+
+var _ = Describe("PayloadBuilder", func() {
+	var (
+		source  mapSource
+		builder *importer.PayloadBuilder
+	)
+	BeforeEach(func() {
+		source = make(mapSource)
+		builder = importer.NewPayloadBuilder(source)
+		Expect(commitIndexedTrie(source, mocks.MockTransactions)).To(Equal(mocks.MockBlock.TxHash()))
+		Expect(commitIndexedTrie(source, mocks.MockReceipts)).To(Equal(mocks.MockBlock.ReceiptHash()))
+	})
+
+	It("Rebuilds the block and receipts from their tries", func() {
+		header := mocks.MockBlock.Header()
+		payload, err := builder.Build(header, nil, nil, big.NewInt(1337))
+		Expect(err).ToNot(HaveOccurred())
+		block := new(types.Block)
+		Expect(rlp.DecodeBytes(payload.BlockRlp, block)).To(Succeed())
+		Expect(block.Hash()).To(Equal(mocks.MockBlock.Hash()))
+		Expect(len(block.Transactions())).To(Equal(len(mocks.MockTransactions)))
+		for i, tx := range block.Transactions() {
+			Expect(tx.Hash()).To(Equal(mocks.MockTransactions[i].Hash()))
+		}
+		receipts := make(types.Receipts, 0)
+		Expect(rlp.DecodeBytes(payload.ReceiptsRlp, &receipts)).To(Succeed())
+		Expect(types.DeriveSha(receipts, new(trie.Trie))).To(Equal(header.ReceiptHash))
+		Expect(payload.TotalDifficulty).To(Equal(big.NewInt(1337)))
+	})
+
+	It("Errors if a transaction trie node is missing", func() {
+		header := types.CopyHeader(mocks.MockBlock.Header())
+		header.TxHash = common.HexToHash("0x01")
+		_, err := builder.Build(header, nil, nil, big.NewInt(1))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Walks the full state trie when there is no parent, and only the changed nodes otherwise", func() {
+		accounts := make(map[common.Hash]state.Account)
+		for i := 0; i < 20; i++ {
+			accounts[crypto.Keccak256Hash([]byte{byte(i)})] = newAccount(0)
+		}
+		parentRoot := buildStateTrie(source, accounts)
+		changedKey := crypto.Keccak256Hash([]byte{7})
+		accounts[changedKey] = newAccount(1)
+		root := buildStateTrie(source, accounts)
+
+		parent := types.CopyHeader(mocks.MockBlock.Header())
+		parent.Root = parentRoot
+		header := types.CopyHeader(mocks.MockBlock.Header())
+		header.Root = root
+
+		payload, err := builder.Build(header, nil, nil, big.NewInt(1))
+		Expect(err).ToNot(HaveOccurred())
+		stateObject := new(statediff.StateObject)
+		Expect(rlp.DecodeBytes(payload.StateObjectRlp, stateObject)).To(Succeed())
+		leaves := 0
+		for _, n := range stateObject.Nodes {
+			if n.NodeType == sdtypes.Leaf {
+				leaves++
+			}
+		}
+		Expect(leaves).To(Equal(20))
+
+		payload, err = builder.Build(header, nil, parent, big.NewInt(1))
+		Expect(err).ToNot(HaveOccurred())
+		stateObject = new(statediff.StateObject)
+		Expect(rlp.DecodeBytes(payload.StateObjectRlp, stateObject)).To(Succeed())
+		Expect(len(stateObject.Nodes)).To(BeNumerically(">", 1))
+		var leaf sdtypes.StateNode
+		for _, n := range stateObject.Nodes {
+			if n.NodeType == sdtypes.Leaf {
+				Expect(leaf.LeafKey).To(BeNil())
+				leaf = n
+			}
+		}
+		Expect(leaf.LeafKey).To(Equal(changedKey.Bytes()))
+		Expect(stateObject.Nodes[0].Path).To(BeEmpty())
+	})
+})
@@ -0,0 +1,94 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package importer
+
+import (
+	"errors"
+
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+	"github.com/vulcanize/ipld-eth-indexer/utils"
+)
+
+// DefaultBatchSize is the default number of blocks inserted per db transaction
+const DefaultBatchSize uint64 = 10000
+
+// Env variables
+const (
+	IMPORT_FILE_PATH  = "IMPORT_FILE_PATH"
+	IMPORT_BATCH_SIZE = "IMPORT_BATCH_SIZE"
+
+	IMPORT_MAX_IDLE_CONNECTIONS = "IMPORT_MAX_IDLE_CONNECTIONS"
+	IMPORT_MAX_OPEN_CONNECTIONS = "IMPORT_MAX_OPEN_CONNECTIONS"
+	IMPORT_MAX_CONN_LIFETIME    = "IMPORT_MAX_CONN_LIFETIME"
+)
+
+// Config holds the parameters needed to perform an import
+type Config struct {
+	FilePath  string // Path to the CAR archive to import
+	BatchSize uint64 // Number of blocks to insert per db transaction
+
+	// DB info
+	DB               *postgres.DB
+	DBConfig         postgres.Config
+	Blockstore       blockstore.Blockstore
+	BlockstoreConfig blockstore.Config
+
+	NodeInfo node.Info // Info for the node the archive was originally indexed from
+}
+
+// NewConfig fills and returns an import config from toml parameters
+func NewConfig() (*Config, error) {
+	c := new(Config)
+	var err error
+
+	viper.BindEnv("import.filePath", IMPORT_FILE_PATH)
+	viper.BindEnv("import.batchSize", IMPORT_BATCH_SIZE)
+
+	c.FilePath = viper.GetString("import.filePath")
+	if c.FilePath == "" {
+		return nil, errors.New("import requires a file path")
+	}
+	c.BatchSize = uint64(viper.GetInt64("import.batchSize"))
+	c.NodeInfo = shared.GetEthNodeInfo()
+
+	c.DBConfig.Init()
+	overrideDBConnConfig(&c.DBConfig)
+	db := utils.LoadPostgres(c.DBConfig, c.NodeInfo, true)
+	c.DB = &db
+	if err := c.BlockstoreConfig.Init(); err != nil {
+		return nil, err
+	}
+	c.Blockstore, err = blockstore.NewBlockstore(c.BlockstoreConfig, c.DB.DB)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func overrideDBConnConfig(con *postgres.Config) {
+	viper.BindEnv("database.import.maxIdle", IMPORT_MAX_IDLE_CONNECTIONS)
+	viper.BindEnv("database.import.maxOpen", IMPORT_MAX_OPEN_CONNECTIONS)
+	viper.BindEnv("database.import.maxLifetime", IMPORT_MAX_CONN_LIFETIME)
+	con.MaxIdle = viper.GetInt("database.import.maxIdle")
+	con.MaxOpen = viper.GetInt("database.import.maxOpen")
+	con.MaxLifetime = viper.GetInt("database.import.maxLifetime")
+}
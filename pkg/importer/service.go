@@ -0,0 +1,286 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package importer
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/ipfs/car"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/ipfs/ipld"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+// maxUncleDepth is the maximum distance between a block and the uncles it includes
+const maxUncleDepth = 7
+
+// Importer is the top level interface for importing CAR archives
+type Importer interface {
+	Import() error
+}
+
+// Service for loading a CAR archive into Postgres and rebuilding the eth index tables from it
+type Service struct {
+	// Interface for transforming reconstructed payloads into IPLD object models in Postgres
+	Transformer eth.Transformer
+	// Builder for reconstructing statediff payloads from the loaded IPLDs
+	Builder *PayloadBuilder
+	// DB for looking up existing header data
+	DB *postgres.DB
+	// Blockstore the archive's blocks are loaded into
+	Blockstore blockstore.Blockstore
+	// Path to the CAR archive
+	filePath string
+	// Number of blocks to insert per db transaction
+	batchSize uint64
+}
+
+// NewImportService returns a new import service
+func NewImportService(settings *Config) (Importer, error) {
+	chainConfig, err := eth.ChainConfig(settings.NodeInfo.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	batchSize := settings.BatchSize
+	if batchSize == 0 {
+		batchSize = DefaultBatchSize
+	}
+	transformer := eth.NewStateDiffTransformer(chainConfig, settings.DB)
+	transformer.SetBlockstore(settings.Blockstore)
+	return &Service{
+		Transformer: transformer,
+		Builder:     NewPayloadBuilder(NewBlockstoreSource(settings.Blockstore)),
+		DB:          settings.DB,
+		Blockstore:  settings.Blockstore,
+		filePath:    settings.FilePath,
+		batchSize:   batchSize,
+	}, nil
+}
+
+// Import loads the archive's blocks into the blockstore and then reindexes every block header it contained
+func (s *Service) Import() error {
+	headers, err := s.load()
+	if err != nil {
+		return err
+	}
+	logrus.Infof("loaded %d headers from %s, reindexing", len(headers), s.filePath)
+	return s.reindex(headers)
+}
+
+// load verifies and inserts every block in the archive, returning the eth headers found
+func (s *Service) load() (map[common.Hash]*types.Header, error) {
+	f, err := os.Open(s.filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader, err := car.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[common.Hash]*types.Header)
+	var count uint64
+	for {
+		loaded, err := s.loadBatch(reader, headers)
+		if err != nil {
+			return nil, err
+		}
+		count += loaded
+		logrus.Infof("loaded %d blocks", count)
+		if loaded < s.batchSize {
+			return headers, nil
+		}
+	}
+}
+
+// loadBatch verifies and inserts up to batchSize blocks of the archive in a single transaction, adding the eth headers found to headers
+// it returns the number of blocks loaded, which is less than batchSize once the end of the archive is reached
+func (s *Service) loadBatch(reader *car.Reader, headers map[common.Hash]*types.Header) (count uint64, err error) {
+	tx, err := blockstore.Begin(s.DB.DB, s.Blockstore)
+	if err != nil {
+		return 0, err
+	}
+	// defer to handle transaction commit or rollback for any return case
+	defer func() {
+		if p := recover(); p != nil {
+			shared.Rollback(tx.Tx)
+			panic(p)
+		} else if err != nil {
+			shared.Rollback(tx.Tx)
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	for count < s.batchSize {
+		c, data, nextErr := reader.Next()
+		if nextErr == io.EOF {
+			return count, nil
+		}
+		if nextErr != nil {
+			return count, nextErr
+		}
+		// verify the cid against the data before it is written anywhere
+		derived, err := c.Prefix().Sum(data)
+		if err != nil {
+			return count, err
+		}
+		if !derived.Equals(c) {
+			return count, fmt.Errorf("block data does not match cid %s", c.String())
+		}
+		if err := shared.PublishDirect(tx, shared.MultihashKeyFromCID(c), data); err != nil {
+			return count, err
+		}
+		if c.Type() == ipld.MEthHeader {
+			header, err := ipld.DecodeEthHeader(c, data)
+			if err != nil {
+				return count, fmt.Errorf("error decoding header %s: %v", c.String(), err)
+			}
+			headers[header.Hash()] = header.Header
+		}
+		count++
+	}
+	return count, nil
+}
+
+// reindex rebuilds and transforms the payload for every imported block header, in height order
+func (s *Service) reindex(headers map[common.Hash]*types.Header) error {
+	byNumber := make(map[uint64][]*types.Header)
+	sorted := make([]*types.Header, 0, len(headers))
+	isParent := make(map[common.Hash]bool)
+	for _, header := range headers {
+		byNumber[header.Number.Uint64()] = append(byNumber[header.Number.Uint64()], header)
+		sorted = append(sorted, header)
+		isParent[header.ParentHash] = true
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Number.Cmp(sorted[j].Number) < 0
+	})
+	// uncles are stored as headers too, find them up front so they are not indexed as blocks in their own right
+	uncles := make(map[common.Hash][]*types.Header)
+	isUncle := make(map[common.Hash]bool)
+	for _, header := range sorted {
+		blockUncles, err := findUncles(header, byNumber)
+		if err != nil {
+			return err
+		}
+		uncles[header.Hash()] = blockUncles
+		for _, uncle := range blockUncles {
+			isUncle[uncle.Hash()] = true
+		}
+	}
+	for _, header := range sorted {
+		hash := header.Hash()
+		if isUncle[hash] && !isParent[hash] {
+			continue
+		}
+		parent, err := s.parent(header, headers)
+		if err != nil {
+			return err
+		}
+		td, err := s.totalDifficulty(header)
+		if err != nil {
+			return err
+		}
+		missing := s.Builder.Missing
+		payload, err := s.Builder.Build(header, uncles[hash], parent, td)
+		if err != nil {
+			return err
+		}
+		if s.Builder.Missing > missing {
+			logrus.Debugf("block %d references %d trie nodes not found in the archive or database", header.Number.Uint64(), s.Builder.Missing-missing)
+		}
+		if _, err := s.Transformer.Transform(0, payload); err != nil {
+			return fmt.Errorf("error indexing block %d: %v", header.Number.Uint64(), err)
+		}
+		logrus.Infof("reindexed block %d with hash %s", header.Number.Uint64(), hash.Hex())
+	}
+	return nil
+}
+
+// parent returns the parent of the provided header, if it can be found in the archive or the blockstore
+func (s *Service) parent(header *types.Header, headers map[common.Hash]*types.Header) (*types.Header, error) {
+	if parent, ok := headers[header.ParentHash]; ok {
+		return parent, nil
+	}
+	raw, err := s.Builder.source.Get(header.ParentHash)
+	if err == ErrBlockNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	parent := new(types.Header)
+	if err := rlp.DecodeBytes(raw, parent); err != nil {
+		return nil, err
+	}
+	return parent, nil
+}
+
+// totalDifficulty derives the total difficulty of the provided header from its parent's indexed total difficulty
+// if the parent has not been indexed, the block's own difficulty is used
+func (s *Service) totalDifficulty(header *types.Header) (*big.Int, error) {
+	var parentTD string
+	err := s.DB.Get(&parentTD, `SELECT td FROM eth.header_cids WHERE chain_id = $1 AND block_hash = $2 LIMIT 1`, s.DB.Node.ChainID, header.ParentHash.Hex())
+	if err == sql.ErrNoRows {
+		logrus.Warnf("parent of block %d is not indexed, using the block difficulty as its total difficulty", header.Number.Uint64())
+		return new(big.Int).Set(header.Difficulty), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	td, ok := new(big.Int).SetString(parentTD, 10)
+	if !ok {
+		return nil, fmt.Errorf("unable to parse total difficulty %s", parentTD)
+	}
+	return td.Add(td, header.Difficulty), nil
+}
+
+// findUncles finds the uncles of the provided header among the imported headers, by matching their hash against the header's uncle hash
+func findUncles(header *types.Header, byNumber map[uint64][]*types.Header) ([]*types.Header, error) {
+	if header.UncleHash == types.EmptyUncleHash {
+		return nil, nil
+	}
+	number := header.Number.Uint64()
+	candidates := make([]*types.Header, 0)
+	for n := number - 1; n+maxUncleDepth >= number && n < number; n-- {
+		candidates = append(candidates, byNumber[n]...)
+	}
+	// a block can include at most two uncles, and their order is significant
+	for i, a := range candidates {
+		if types.CalcUncleHash([]*types.Header{a}) == header.UncleHash {
+			return []*types.Header{a}, nil
+		}
+		for j, b := range candidates {
+			if i != j && types.CalcUncleHash([]*types.Header{a, b}) == header.UncleHash {
+				return []*types.Header{a, b}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("uncles of block %d with hash %s not found in archive", number, header.Hash().Hex())
+}
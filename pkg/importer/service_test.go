@@ -0,0 +1,179 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package importer_test
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/importer"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/ipfs/car"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/ipfs/ipld"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+// carBlock is a block to write into a test archive
+type carBlock struct {
+	cid  cid.Cid
+	data []byte
+}
+
+func newCARBlock(codec uint64, data []byte) carBlock {
+	c, err := ipld.RawdataToCid(codec, data, multihash.KECCAK_256)
+	Expect(err).ToNot(HaveOccurred())
+	return carBlock{cid: c, data: data}
+}
+
+// sourceBlocks returns the trie nodes collected in the source as blocks of the codec
+func sourceBlocks(codec uint64, source mapSource) []carBlock {
+	blocks := make([]carBlock, 0, len(source))
+	for _, data := range source {
+		blocks = append(blocks, newCARBlock(codec, data))
+	}
+	return blocks
+}
+
+func writeCAR(path string, blocks []carBlock) {
+	f, err := os.Create(path)
+	Expect(err).ToNot(HaveOccurred())
+	defer f.Close()
+	w, err := car.NewWriter(f, []cid.Cid{blocks[0].cid})
+	Expect(err).ToNot(HaveOccurred())
+	for _, block := range blocks {
+		Expect(w.Put(block.cid, block.data)).To(Succeed())
+	}
+	Expect(w.Flush()).To(Succeed())
+}
+
+func newTestHeader(number int64, extra string) *types.Header {
+	header := types.CopyHeader(mocks.MockBlock.Header())
+	header.Number = big.NewInt(number)
+	header.Extra = []byte(extra)
+	header.TxHash = types.EmptyRootHash
+	header.ReceiptHash = types.EmptyRootHash
+	header.UncleHash = types.EmptyUncleHash
+	header.Bloom = types.Bloom{}
+	header.Root = types.EmptyRootHash
+	return header
+}
+
+var _ = Describe("Service", func() {
+	var (
+		db      *postgres.DB
+		dir     string
+		service importer.Importer
+	)
+	BeforeEach(func() {
+		var err error
+		db, err = shared.SetupDB()
+		Expect(err).ToNot(HaveOccurred())
+		dir, err = ioutil.TempDir("", "importer")
+		Expect(err).ToNot(HaveOccurred())
+		service, err = importer.NewImportService(&importer.Config{
+			FilePath:   filepath.Join(dir, "archive.car"),
+			DB:         db,
+			Blockstore: blockstore.NewPostgresBlockstore(db.DB),
+			NodeInfo:   node.Info{ChainID: 1},
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		eth.TearDownDB(db)
+		os.RemoveAll(dir)
+	})
+
+	hashes := func(pgStr string) []string {
+		res := make([]string, 0)
+		Expect(db.Select(&res, pgStr)).To(Succeed())
+		return res
+	}
+
+	It("Loads the archive and indexes its block, uncle, state and storage", func() {
+		storageSource := make(mapSource)
+		slotKey := crypto.Keccak256Hash(common.Hash{}.Bytes())
+		value, err := rlp.EncodeToBytes([]byte{0x01})
+		Expect(err).ToNot(HaveOccurred())
+		storageRoot := commitTrie(storageSource, map[string][]byte{string(slotKey.Bytes()): value})
+
+		stateSource := make(mapSource)
+		contractKey := crypto.Keccak256Hash([]byte("contract"))
+		contract := newAccount(1)
+		contract.Root = storageRoot
+		accountKey := crypto.Keccak256Hash([]byte("account"))
+		stateRoot := buildStateTrie(stateSource, map[common.Hash]state.Account{
+			contractKey: contract,
+			accountKey:  newAccount(0),
+		})
+
+		uncle := newTestHeader(0, "uncle")
+		header := newTestHeader(1, "block")
+		header.ParentHash = common.HexToHash("0x01")
+		header.UncleHash = types.CalcUncleHash([]*types.Header{uncle})
+		header.Root = stateRoot
+		headerRLP, err := rlp.EncodeToBytes(header)
+		Expect(err).ToNot(HaveOccurred())
+		uncleRLP, err := rlp.EncodeToBytes(uncle)
+		Expect(err).ToNot(HaveOccurred())
+
+		blocks := []carBlock{newCARBlock(ipld.MEthHeader, headerRLP), newCARBlock(ipld.MEthHeader, uncleRLP)}
+		blocks = append(blocks, sourceBlocks(ipld.MEthStateTrie, stateSource)...)
+		blocks = append(blocks, sourceBlocks(ipld.MEthStorageTrie, storageSource)...)
+		writeCAR(filepath.Join(dir, "archive.car"), blocks)
+
+		Expect(service.Import()).To(Succeed())
+
+		Expect(hashes(`SELECT block_hash FROM eth.header_cids`)).To(Equal([]string{header.Hash().Hex()}))
+		Expect(hashes(`SELECT block_hash FROM eth.uncle_cids`)).To(Equal([]string{uncle.Hash().Hex()}))
+		Expect(hashes(`SELECT state_leaf_key FROM eth.state_cids WHERE node_type = 2`)).To(ConsistOf(contractKey.Hex(), accountKey.Hex()))
+		Expect(hashes(`SELECT storage_leaf_key FROM eth.storage_cids WHERE node_type = 2`)).To(Equal([]string{slotKey.Hex()}))
+	})
+
+	It("Rejects a block which doesn't match its cid, without loading the batch", func() {
+		header := newTestHeader(1, "block")
+		headerRLP, err := rlp.EncodeToBytes(header)
+		Expect(err).ToNot(HaveOccurred())
+		other := newTestHeader(1, "other")
+		otherRLP, err := rlp.EncodeToBytes(other)
+		Expect(err).ToNot(HaveOccurred())
+		mismatched := newCARBlock(ipld.MEthHeader, otherRLP)
+		mismatched.data = headerRLP
+		writeCAR(filepath.Join(dir, "archive.car"), []carBlock{newCARBlock(ipld.MEthHeader, headerRLP), mismatched})
+
+		err = service.Import()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("does not match cid"))
+		Expect(hashes(`SELECT block_hash FROM eth.header_cids`)).To(BeEmpty())
+		Expect(hashes(`SELECT key FROM public.blocks`)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,127 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package car
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+)
+
+// Version is the only CAR archive version we support
+const Version = 1
+
+// maxSectionSize guards against reading absurdly large sections from a corrupt archive
+const maxSectionSize = 32 << 20
+
+// Header is the header of a CARv1 archive
+type Header struct {
+	Roots   []cid.Cid
+	Version uint64
+}
+
+// Reader reads IPLD blocks out of a CARv1 archive
+// See https://github.com/ipld/specs/blob/master/block-layer/content-addressable-archives.md
+type Reader struct {
+	br     *bufio.Reader
+	Header Header
+}
+
+// NewReader reads the archive header from the provided reader and returns a Reader positioned at the first block
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	hb, err := readSection(br)
+	if err != nil {
+		return nil, fmt.Errorf("error reading car header: %v", err)
+	}
+	h, err := decodeHeader(hb)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding car header: %v", err)
+	}
+	if h.Version != Version {
+		return nil, fmt.Errorf("unsupported car version %d", h.Version)
+	}
+	return &Reader{
+		br:     br,
+		Header: h,
+	}, nil
+}
+
+// Next returns the next cid and block data in the archive
+// It returns io.EOF once the archive has been fully read
+func (cr *Reader) Next() (cid.Cid, []byte, error) {
+	section, err := readSection(cr.br)
+	if err != nil {
+		return cid.Cid{}, nil, err
+	}
+	n, c, err := cid.CidFromBytes(section)
+	if err != nil {
+		return cid.Cid{}, nil, fmt.Errorf("error decoding car section cid: %v", err)
+	}
+	return c, section[n:], nil
+}
+
+// readSection reads a single varint length-prefixed section
+func readSection(br *bufio.Reader) ([]byte, error) {
+	l, err := binary.ReadUvarint(br)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("error reading section length: %v", err)
+	}
+	if l > maxSectionSize {
+		return nil, fmt.Errorf("section length %d exceeds maximum of %d", l, maxSectionSize)
+	}
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return nil, fmt.Errorf("error reading section: %v", err)
+	}
+	return buf, nil
+}
+
+// decodeHeader decodes the dag-cbor encoded CARv1 header
+func decodeHeader(b []byte) (Header, error) {
+	d := &cborDecoder{buf: b}
+	v, err := d.decode()
+	if err != nil {
+		return Header{}, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return Header{}, errors.New("header is not a map")
+	}
+	h := Header{}
+	version, ok := m["version"].(uint64)
+	if !ok {
+		return Header{}, errors.New("header is missing version")
+	}
+	h.Version = version
+	roots, _ := m["roots"].([]interface{})
+	for _, root := range roots {
+		c, ok := root.(cid.Cid)
+		if !ok {
+			return Header{}, errors.New("header root is not a cid")
+		}
+		h.Roots = append(h.Roots, c)
+	}
+	return h, nil
+}
@@ -0,0 +1,152 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package car_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/ipfs/car"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/ipfs/ipld"
+)
+
+// writeSection writes a varint length-prefixed section
+func writeSection(buf *bytes.Buffer, data ...[]byte) {
+	l := 0
+	for _, d := range data {
+		l += len(d)
+	}
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	buf.Write(lenBuf[:binary.PutUvarint(lenBuf, uint64(l))])
+	for _, d := range data {
+		buf.Write(d)
+	}
+}
+
+// encodeHeader hand encodes a dag-cbor CARv1 header with a single root
+func encodeHeader(root cid.Cid, version byte) []byte {
+	h := []byte{0xa2, 0x65}
+	h = append(h, "roots"...)
+	link := append([]byte{0x00}, root.Bytes()...)
+	h = append(h, 0x81, 0xd8, 0x2a, 0x58, byte(len(link)))
+	h = append(h, link...)
+	h = append(h, 0x67)
+	h = append(h, "version"...)
+	return append(h, version)
+}
+
+var _ = Describe("Reader", func() {
+	var (
+		block1 = []byte("block one")
+		block2 = []byte("block two")
+		cid1   cid.Cid
+		cid2   cid.Cid
+	)
+	BeforeEach(func() {
+		var err error
+		cid1, err = ipld.RawdataToCid(ipld.MEthHeader, block1, multihash.KECCAK_256)
+		Expect(err).ToNot(HaveOccurred())
+		cid2, err = ipld.RawdataToCid(ipld.RawBinary, block2, multihash.KECCAK_256)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Reads the header and every block in the archive", func() {
+		buf := new(bytes.Buffer)
+		writeSection(buf, encodeHeader(cid1, 1))
+		writeSection(buf, cid1.Bytes(), block1)
+		writeSection(buf, cid2.Bytes(), block2)
+
+		reader, err := car.NewReader(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reader.Header.Version).To(Equal(uint64(1)))
+		Expect(reader.Header.Roots).To(Equal([]cid.Cid{cid1}))
+
+		c, data, err := reader.Next()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(Equal(cid1))
+		Expect(data).To(Equal(block1))
+		c, data, err = reader.Next()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(Equal(cid2))
+		Expect(data).To(Equal(block2))
+		_, _, err = reader.Next()
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	It("Rejects unsupported versions", func() {
+		buf := new(bytes.Buffer)
+		writeSection(buf, encodeHeader(cid1, 2))
+		_, err := car.NewReader(buf)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Errors on a truncated section", func() {
+		buf := new(bytes.Buffer)
+		writeSection(buf, encodeHeader(cid1, 1))
+		writeSection(buf, cid1.Bytes(), block1)
+		truncated := bytes.NewBuffer(buf.Bytes()[:buf.Len()-2])
+		reader, err := car.NewReader(truncated)
+		Expect(err).ToNot(HaveOccurred())
+		_, _, err = reader.Next()
+		Expect(err).To(HaveOccurred())
+		Expect(err).ToNot(Equal(io.EOF))
+	})
+})
+
+var _ = Describe("Writer", func() {
+	It("Writes an archive that can be read back", func() {
+		block1 := []byte("block one")
+		block2 := []byte("block two")
+		cid1, err := ipld.RawdataToCid(ipld.MEthHeader, block1, multihash.KECCAK_256)
+		Expect(err).ToNot(HaveOccurred())
+		cid2, err := ipld.RawdataToCid(ipld.RawBinary, block2, multihash.KECCAK_256)
+		Expect(err).ToNot(HaveOccurred())
+
+		buf := new(bytes.Buffer)
+		writer, err := car.NewWriter(buf, []cid.Cid{cid1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(writer.Put(cid1, block1)).To(Succeed())
+		Expect(writer.Put(cid2, block2)).To(Succeed())
+		Expect(writer.Flush()).To(Succeed())
+
+		expected := new(bytes.Buffer)
+		writeSection(expected, encodeHeader(cid1, 1))
+		writeSection(expected, cid1.Bytes(), block1)
+		writeSection(expected, cid2.Bytes(), block2)
+		Expect(buf.Bytes()).To(Equal(expected.Bytes()))
+
+		reader, err := car.NewReader(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reader.Header.Roots).To(Equal([]cid.Cid{cid1}))
+		c, data, err := reader.Next()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(Equal(cid1))
+		Expect(data).To(Equal(block1))
+		c, data, err = reader.Next()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(Equal(cid2))
+		Expect(data).To(Equal(block2))
+		_, _, err = reader.Next()
+		Expect(err).To(Equal(io.EOF))
+	})
+})
@@ -0,0 +1,205 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package car
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+)
+
+// CBOR major types used by the dag-cbor CAR header
+const (
+	cborUint   = 0
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+
+	// dag-cbor tag for a cid link
+	cidTag = 42
+)
+
+var errShortBuffer = errors.New("unexpected end of cbor data")
+
+// cborDecoder is a minimal dag-cbor decoder, it only supports the subset of cbor needed to decode a CAR header
+type cborDecoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *cborDecoder) decode() (interface{}, error) {
+	major, arg, err := d.readHead()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborUint:
+		return arg, nil
+	case cborBytes:
+		return d.readN(arg)
+	case cborText:
+		b, err := d.readN(arg)
+		return string(b), err
+	case cborArray:
+		arr := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case cborMap:
+		m := make(map[string]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, errors.New("cbor map key is not a string")
+			}
+			v, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+		}
+		return m, nil
+	case cborTag:
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		if arg != cidTag {
+			return v, nil
+		}
+		b, ok := v.([]byte)
+		if !ok || len(b) == 0 || b[0] != 0 {
+			return nil, errors.New("invalid cbor cid link")
+		}
+		return cid.Cast(b[1:])
+	case cborSimple:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		default:
+			return nil, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported cbor major type %d", major)
+	}
+}
+
+// readHead reads the major type and argument of the next cbor item
+func (d *cborDecoder) readHead() (byte, uint64, error) {
+	if d.pos >= len(d.buf) {
+		return 0, 0, errShortBuffer
+	}
+	b := d.buf[d.pos]
+	d.pos++
+	major, info := b>>5, b&0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		v, err := d.readN(1)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, uint64(v[0]), nil
+	case info == 25:
+		v, err := d.readN(2)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, uint64(binary.BigEndian.Uint16(v)), nil
+	case info == 26:
+		v, err := d.readN(4)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, uint64(binary.BigEndian.Uint32(v)), nil
+	case info == 27:
+		v, err := d.readN(8)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, binary.BigEndian.Uint64(v), nil
+	default:
+		return 0, 0, fmt.Errorf("unsupported cbor additional info %d", info)
+	}
+}
+
+func (d *cborDecoder) readN(n uint64) ([]byte, error) {
+	if uint64(len(d.buf)-d.pos) < n {
+		return nil, errShortBuffer
+	}
+	b := d.buf[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// cborEncoder is a minimal dag-cbor encoder, it only supports the subset of cbor needed to encode a CAR header
+type cborEncoder struct {
+	buf []byte
+}
+
+// writeHead writes the major type and argument of a cbor item using the shortest encoding
+func (e *cborEncoder) writeHead(major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		e.buf = append(e.buf, major<<5|byte(arg))
+	case arg <= 0xff:
+		e.buf = append(e.buf, major<<5|24, byte(arg))
+	case arg <= 0xffff:
+		e.buf = append(e.buf, major<<5|25)
+		e.buf = append(e.buf, make([]byte, 2)...)
+		binary.BigEndian.PutUint16(e.buf[len(e.buf)-2:], uint16(arg))
+	case arg <= 0xffffffff:
+		e.buf = append(e.buf, major<<5|26)
+		e.buf = append(e.buf, make([]byte, 4)...)
+		binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], uint32(arg))
+	default:
+		e.buf = append(e.buf, major<<5|27)
+		e.buf = append(e.buf, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], arg)
+	}
+}
+
+func (e *cborEncoder) writeString(s string) {
+	e.writeHead(cborText, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// writeLink writes a cid as a tagged byte string with the multibase identity prefix
+func (e *cborEncoder) writeLink(c cid.Cid) {
+	b := c.Bytes()
+	e.writeHead(cborTag, cidTag)
+	e.writeHead(cborBytes, uint64(len(b)+1))
+	e.buf = append(e.buf, 0x00)
+	e.buf = append(e.buf, b...)
+}
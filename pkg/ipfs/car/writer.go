@@ -0,0 +1,85 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package car
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+)
+
+// Writer writes IPLD blocks into a CARv1 archive
+type Writer struct {
+	bw *bufio.Writer
+}
+
+// NewWriter writes the archive header with the provided roots and returns a Writer for the blocks that follow it
+func NewWriter(w io.Writer, roots []cid.Cid) (*Writer, error) {
+	cw := &Writer{bw: bufio.NewWriter(w)}
+	if err := cw.writeSection(encodeHeader(Header{Roots: roots, Version: Version})); err != nil {
+		return nil, fmt.Errorf("error writing car header: %v", err)
+	}
+	return cw, nil
+}
+
+// Put writes a block to the archive
+func (cw *Writer) Put(c cid.Cid, data []byte) error {
+	return cw.writeSection(c.Bytes(), data)
+}
+
+// Flush writes any buffered blocks to the underlying writer
+func (cw *Writer) Flush() error {
+	return cw.bw.Flush()
+}
+
+// writeSection writes a single varint length-prefixed section
+func (cw *Writer) writeSection(data ...[]byte) error {
+	l := 0
+	for _, d := range data {
+		l += len(d)
+	}
+	if l > maxSectionSize {
+		return fmt.Errorf("section length %d exceeds maximum of %d", l, maxSectionSize)
+	}
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	if _, err := cw.bw.Write(lenBuf[:binary.PutUvarint(lenBuf, uint64(l))]); err != nil {
+		return err
+	}
+	for _, d := range data {
+		if _, err := cw.bw.Write(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeHeader encodes the CARv1 header as dag-cbor, keys are in canonical (length-first) order
+func encodeHeader(h Header) []byte {
+	e := &cborEncoder{}
+	e.writeHead(cborMap, 2)
+	e.writeString("roots")
+	e.writeHead(cborArray, uint64(len(h.Roots)))
+	for _, root := range h.Roots {
+		e.writeLink(root)
+	}
+	e.writeString("version")
+	e.writeHead(cborUint, h.Version)
+	return e.buf
+}
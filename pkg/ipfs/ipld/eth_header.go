@@ -66,7 +66,7 @@ func NewEthHeader(header *types.Header) (*EthHeader, error) {
 // DecodeEthHeader takes a cid and its raw binary data
 // from IPFS and returns an EthTx object for further processing.
 func DecodeEthHeader(c cid.Cid, b []byte) (*EthHeader, error) {
-	var h *types.Header
+	h := new(types.Header)
 	if err := rlp.DecodeBytes(b, h); err != nil {
 		return nil, err
 	}
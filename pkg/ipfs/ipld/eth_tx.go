@@ -68,7 +68,7 @@ func NewEthTx(tx *types.Transaction) (*EthTx, error) {
 // DecodeEthTx takes a cid and its raw binary data
 // from IPFS and returns an EthTx object for further processing.
 func DecodeEthTx(c cid.Cid, b []byte) (*EthTx, error) {
-	var t *types.Transaction
+	t := new(types.Transaction)
 	if err := rlp.DecodeBytes(b, t); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,123 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package layout
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/lookup"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+)
+
+// APIName is the namespace for the storage layout api
+const APIName = "layout"
+
+// APIVersion is the version of the storage layout api
+const APIVersion = "0.0.1"
+
+const storageDiffPgStr = `SELECT storage_cids.storage_leaf_key, storage_cids.mh_key, blocks.data FROM eth.storage_cids
+			INNER JOIN eth.state_cids ON (storage_cids.state_id = state_cids.id)
+			INNER JOIN eth.header_cids ON (state_cids.header_id = header_cids.id)
+			INNER JOIN public.blocks ON (storage_cids.mh_key = blocks.key)
+			WHERE header_cids.block_hash = $1
+			AND state_cids.state_leaf_key = $2
+			AND header_cids.chain_id = $3
+			AND storage_cids.node_type = 2
+			ORDER BY storage_cids.storage_path`
+
+// PublicLayoutAPI decodes the storage of the contracts with storage layouts into named variables
+type PublicLayoutAPI struct {
+	db       *postgres.DB
+	blocks   blockstore.Blockstore
+	decoders map[common.Address]*Decoder
+}
+
+// NewPublicLayoutAPI creates a new PublicLayoutAPI for the layouts, resolving hashed slots through eth.storage_preimages
+func NewPublicLayoutAPI(db *postgres.DB, layouts map[common.Address]*Layout) *PublicLayoutAPI {
+	preimages := NewDBPreimages(db)
+	decoders := make(map[common.Address]*Decoder, len(layouts))
+	for address, l := range layouts {
+		decoders[address] = NewDecoder(l, preimages)
+	}
+	return &PublicLayoutAPI{
+		db:       db,
+		blocks:   blockstore.NewPostgresBlockstore(db.DB),
+		decoders: decoders,
+	}
+}
+
+// SetBlockstore sets the blockstore the storage leaf nodes are read from when public.blocks only records their keys
+func (api *PublicLayoutAPI) SetBlockstore(blocks blockstore.Blockstore) {
+	api.blocks = blocks
+}
+
+// DecodeStorage decodes the value held at the storage leaf key of the contract into the variables it holds
+// It returns nil if the slot can't be resolved to a variable
+func (api *PublicLayoutAPI) DecodeStorage(address common.Address, storageLeafKey common.Hash, value hexutil.Bytes) ([]DecodedVariable, error) {
+	d, err := api.decoder(address)
+	if err != nil {
+		return nil, err
+	}
+	return d.Decode(storageLeafKey, value)
+}
+
+// StorageDiff decodes the storage of the contract which changed in the block
+// Slots which can't be resolved to a variable are left out, and slots which were cleared are not indexed with a leaf key
+func (api *PublicLayoutAPI) StorageDiff(address common.Address, blockHash common.Hash) ([]DecodedVariable, error) {
+	d, err := api.decoder(address)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]struct {
+		LeafKey string          `db:"storage_leaf_key"`
+		MhKey   string          `db:"mh_key"`
+		Data    blockstore.Data `db:"data"`
+	}, 0)
+	if err := api.db.Reader().Select(&rows, storageDiffPgStr, blockHash.Hex(), crypto.Keccak256Hash(address.Bytes()).Hex(), api.db.Node.ChainID); err != nil {
+		return nil, err
+	}
+	vars := make([]DecodedVariable, 0, len(rows))
+	for _, row := range rows {
+		data, err := blockstore.Load(api.blocks, row.MhKey, row.Data)
+		if err != nil {
+			return nil, err
+		}
+		value, err := lookup.DecodeStorageLeafValue(data)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := d.Decode(common.HexToHash(row.LeafKey), value)
+		if err != nil {
+			return nil, err
+		}
+		vars = append(vars, decoded...)
+	}
+	return vars, nil
+}
+
+func (api *PublicLayoutAPI) decoder(address common.Address) (*Decoder, error) {
+	d, ok := api.decoders[address]
+	if !ok {
+		return nil, fmt.Errorf("no storage layout for contract %s", address.Hex())
+	}
+	return d, nil
+}
@@ -0,0 +1,124 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package layout
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+	"github.com/vulcanize/ipld-eth-indexer/utils"
+)
+
+// Env variables
+const (
+	LAYOUT_DIR = "LAYOUT_DIR"
+
+	PREIMAGES_FILE  = "PREIMAGES_FILE"
+	PREIMAGES_FETCH = "PREIMAGES_FETCH"
+	PREIMAGES_START = "PREIMAGES_START"
+	PREIMAGES_STOP  = "PREIMAGES_STOP"
+
+	PREIMAGES_MAX_IDLE_CONNECTIONS = "PREIMAGES_MAX_IDLE_CONNECTIONS"
+	PREIMAGES_MAX_OPEN_CONNECTIONS = "PREIMAGES_MAX_OPEN_CONNECTIONS"
+	PREIMAGES_MAX_CONN_LIFETIME    = "PREIMAGES_MAX_CONN_LIFETIME"
+)
+
+// GetLayouts loads the storage layouts from the configured layout directory, it returns nil if none is configured
+func GetLayouts() (map[common.Address]*Layout, error) {
+	viper.BindEnv("layout.dir", LAYOUT_DIR)
+	dir := viper.GetString("layout.dir")
+	if dir == "" {
+		return nil, nil
+	}
+	return LoadLayouts(dir)
+}
+
+// Config holds the parameters needed to fill eth.storage_preimages
+type Config struct {
+	File       string                     // Path to a file of hex encoded preimages, one per line
+	Layouts    map[common.Address]*Layout // Storage layouts of the watched contracts, by contract address
+	Fetch      bool                       // If true, fetch the preimages of indexed storage leaf keys from the node with debug_preimage
+	Start      uint64                     // Block height to start fetching preimages from
+	Stop       uint64                     // Block height to stop fetching preimages at, if 0 up to the highest indexed block
+	HTTPClient *rpc.Client                // Ethereum rpc client, for fetching
+	Timeout    time.Duration              // HTTP connection timeout in seconds
+
+	// DB info
+	DB       *postgres.DB
+	DBConfig postgres.Config
+
+	NodeInfo node.Info
+}
+
+// NewConfig fills and returns a preimages config from toml parameters
+func NewConfig() (*Config, error) {
+	c := new(Config)
+	var err error
+
+	viper.BindEnv("preimages.file", PREIMAGES_FILE)
+	viper.BindEnv("preimages.fetch", PREIMAGES_FETCH)
+	viper.BindEnv("preimages.start", PREIMAGES_START)
+	viper.BindEnv("preimages.stop", PREIMAGES_STOP)
+	viper.BindEnv("ethereum.httpPath", shared.ETH_HTTP_PATH)
+	viper.BindEnv("preimages.timeout", shared.HTTP_TIMEOUT)
+
+	c.File = viper.GetString("preimages.file")
+	c.Fetch = viper.GetBool("preimages.fetch")
+	c.Start = uint64(viper.GetInt64("preimages.start"))
+	c.Stop = uint64(viper.GetInt64("preimages.stop"))
+	c.Layouts, err = GetLayouts()
+	if err != nil {
+		return nil, err
+	}
+	timeout := viper.GetInt("preimages.timeout")
+	if timeout < 15 {
+		timeout = 15
+	}
+	c.Timeout = time.Second * time.Duration(timeout)
+
+	if c.Fetch {
+		ethHTTP := viper.GetString("ethereum.httpPath")
+		c.NodeInfo, c.HTTPClient, err = shared.GetEthNodeAndClient(fmt.Sprintf("http://%s", ethHTTP))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		c.NodeInfo = shared.GetEthNodeInfo()
+	}
+
+	c.DBConfig.Init()
+	overrideDBConnConfig(&c.DBConfig)
+	db := utils.LoadPostgres(c.DBConfig, c.NodeInfo, false)
+	c.DB = &db
+	return c, nil
+}
+
+func overrideDBConnConfig(con *postgres.Config) {
+	viper.BindEnv("database.preimages.maxIdle", PREIMAGES_MAX_IDLE_CONNECTIONS)
+	viper.BindEnv("database.preimages.maxOpen", PREIMAGES_MAX_OPEN_CONNECTIONS)
+	viper.BindEnv("database.preimages.maxLifetime", PREIMAGES_MAX_CONN_LIFETIME)
+	con.MaxIdle = viper.GetInt("database.preimages.maxIdle")
+	con.MaxOpen = viper.GetInt("database.preimages.maxOpen")
+	con.MaxLifetime = viper.GetInt("database.preimages.maxLifetime")
+}
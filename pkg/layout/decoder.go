@@ -0,0 +1,314 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package layout
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// maxDepth caps how many mappings and dynamic arrays deep a slot is resolved
+const maxDepth = 8
+
+// arrayIndexLimit bounds the index of a dynamic array element found by its distance from the array's data slot
+var arrayIndexLimit = new(big.Int).Lsh(common.Big1, 40)
+
+// DecodedVariable is a variable decoded from a storage slot, a packed slot holds more than one
+type DecodedVariable struct {
+	// Name of the variable, with struct members and array indices appended, e.g. owner, config.fee, values[3], users.balance
+	Name string `json:"name"`
+	// Mapping keys, outermost first
+	Keys []string `json:"keys,omitempty"`
+	// Solidity type of the value
+	Type string `json:"type"`
+	// Decoded value: decimal for integers and enums, hex for addresses and fixed bytes, text for strings,
+	// the length for dynamic arrays and long bytes and strings
+	Value string `json:"value"`
+	// The slot the value is held in
+	Slot common.Hash `json:"slot"`
+}
+
+// entry is a member located at an absolute slot
+type entry struct {
+	name   string
+	keys   []string
+	typ    string
+	offset int
+}
+
+// Decoder decodes the storage leaf keys and values of a contract into the variables they hold, using its storage layout
+// The slots of variables at fixed positions are known from the layout; for mapping values and dynamic array elements
+// the slot, and the mapping key or array slot it was hashed from, are resolved through their keccak256 preimages
+type Decoder struct {
+	layout    *Layout
+	preimages Preimages
+	// the members at fixed positions, keyed by slot
+	static map[common.Hash][]entry
+	// the storage leaf keys of the fixed slots
+	leafKeys map[common.Hash]common.Hash
+	// the dynamic arrays and bytes at fixed positions, whose data starts at the keccak256 hash of their slot
+	roots map[common.Hash][]entry
+	span  uint64
+}
+
+// NewDecoder returns a pointer to a new Decoder for the layout
+func NewDecoder(l *Layout, preimages Preimages) *Decoder {
+	d := &Decoder{
+		layout:    l,
+		preimages: preimages,
+		static:    make(map[common.Hash][]entry),
+		leafKeys:  make(map[common.Hash]common.Hash),
+		roots:     make(map[common.Hash][]entry),
+		span:      l.maxSpan(),
+	}
+	for _, v := range l.Storage {
+		base, _ := new(big.Int).SetString(v.Slot, 10)
+		for _, m := range l.flatten(v.Label, v.Type) {
+			slot := common.BigToHash(new(big.Int).Add(base, new(big.Int).SetUint64(m.slot)))
+			e := entry{name: m.name, typ: m.typ, offset: m.offset + v.Offset}
+			d.static[slot] = append(d.static[slot], e)
+			d.leafKeys[crypto.Keccak256Hash(slot.Bytes())] = slot
+			switch l.Types[m.typ].Encoding {
+			case DynamicArray, Bytes:
+				d.roots[crypto.Keccak256Hash(slot.Bytes())] = append(d.roots[crypto.Keccak256Hash(slot.Bytes())], e)
+			}
+		}
+	}
+	return d
+}
+
+// Decode decodes the value held at the storage leaf key into the variables it holds
+// The value is the slot value as returned by lookup.DecodeStorageLeafValue or eth_getStorageAt
+// It returns nil if the slot can't be resolved to a variable of the layout
+func (d *Decoder) Decode(storageLeafKey common.Hash, value []byte) ([]DecodedVariable, error) {
+	slot, ok := d.leafKeys[storageLeafKey]
+	if !ok {
+		preimage, err := d.preimages.Preimage(storageLeafKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(preimage) != common.HashLength {
+			return nil, nil
+		}
+		slot = common.BytesToHash(preimage)
+	}
+	return d.DecodeSlot(slot, value)
+}
+
+// DecodeSlot decodes the value held at the slot into the variables it holds, nil if the slot can't be resolved
+func (d *Decoder) DecodeSlot(slot common.Hash, value []byte) ([]DecodedVariable, error) {
+	if len(value) > common.HashLength {
+		return nil, fmt.Errorf("storage value is %d bytes long, expected at most %d", len(value), common.HashLength)
+	}
+	entries, err := d.locate(slot, 0)
+	if err != nil {
+		return nil, err
+	}
+	word := common.LeftPadBytes(value, common.HashLength)
+	vars := make([]DecodedVariable, 0, len(entries))
+	for _, e := range entries {
+		t := d.layout.Types[e.typ]
+		if t.Encoding == Mapping {
+			// the slot of a mapping is left empty
+			continue
+		}
+		vars = append(vars, DecodedVariable{
+			Name:  e.name,
+			Keys:  e.keys,
+			Type:  t.Label,
+			Value: d.decodeValue(word, e),
+			Slot:  slot,
+		})
+	}
+	return vars, nil
+}
+
+// locate returns the members held at the slot
+func (d *Decoder) locate(slot common.Hash, depth int) ([]entry, error) {
+	if entries, ok := d.static[slot]; ok {
+		return entries, nil
+	}
+	if depth >= maxDepth {
+		return nil, nil
+	}
+	s := slot.Big()
+	// elements of dynamic arrays and long bytes at fixed positions are found by their distance from the start of the data
+	var closest *big.Int
+	var roots []entry
+	for start, r := range d.roots {
+		rel := new(big.Int).Sub(s, start.Big())
+		if rel.Sign() >= 0 && rel.Cmp(arrayIndexLimit) < 0 && (closest == nil || rel.Cmp(closest) < 0) {
+			closest, roots = rel, r
+		}
+	}
+	if closest != nil {
+		return d.elements(roots, closest.Uint64()), nil
+	}
+	// otherwise the slot is held by a mapping value or an array element starting at most span slots before it,
+	// at a hashed slot whose preimage is the mapping key and slot, or the array slot
+	for k := uint64(0); k < d.span && s.Cmp(new(big.Int).SetUint64(k)) >= 0; k++ {
+		start := common.BigToHash(new(big.Int).Sub(s, new(big.Int).SetUint64(k)))
+		preimage, err := d.preimages.Preimage(start)
+		if err != nil {
+			return nil, err
+		}
+		if len(preimage) < common.HashLength {
+			continue
+		}
+		key, parentSlot := preimage[:len(preimage)-common.HashLength], common.BytesToHash(preimage[len(preimage)-common.HashLength:])
+		parents, err := d.locate(parentSlot, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		var entries []entry
+		for _, parent := range parents {
+			t := d.layout.Types[parent.typ]
+			switch {
+			case t.Encoding == Mapping && len(key) > 0:
+				keys := append(append([]string{}, parent.keys...), d.decodeKey(key, t.Key))
+				for _, m := range d.layout.flatten(parent.name, t.Value) {
+					if m.slot == k {
+						entries = append(entries, entry{name: m.name, keys: keys, typ: m.typ, offset: m.offset})
+					}
+				}
+			case (t.Encoding == DynamicArray || t.Encoding == Bytes) && len(key) == 0:
+				entries = append(entries, d.elements([]entry{parent}, k)...)
+			}
+		}
+		if len(entries) > 0 {
+			return entries, nil
+		}
+	}
+	return nil, nil
+}
+
+// elements returns the members held at the slot rel slots from the start of the data of the dynamic arrays or long bytes
+func (d *Decoder) elements(roots []entry, rel uint64) []entry {
+	var entries []entry
+	for _, root := range roots {
+		t := d.layout.Types[root.typ]
+		if t.Encoding == Bytes {
+			entries = append(entries, entry{name: fmt.Sprintf("%s.data[%d]", root.name, rel), keys: root.keys, typ: bytesChunk})
+			continue
+		}
+		size := d.layout.size(t.Base)
+		var first, last uint64
+		if size >= 32 {
+			first = rel / d.layout.slots(t.Base)
+			last = first
+		} else {
+			perSlot := uint64(32 / size)
+			first, last = rel*perSlot, rel*perSlot+perSlot-1
+		}
+		for i := first; i <= last; i++ {
+			slot, offset := d.layout.element(t.Base, i)
+			for _, m := range d.layout.flatten(fmt.Sprintf("%s[%d]", root.name, i), t.Base) {
+				if slot+m.slot == rel {
+					entries = append(entries, entry{name: m.name, keys: root.keys, typ: m.typ, offset: m.offset + offset})
+				}
+			}
+		}
+	}
+	return entries
+}
+
+// bytesChunk is the pseudo type of the slots holding the data of long bytes and strings
+const bytesChunk = "t_bytes32"
+
+// decodeValue decodes the member held in the slot value
+func (d *Decoder) decodeValue(word []byte, e entry) string {
+	if e.typ == bytesChunk {
+		return hexutil.Encode(word)
+	}
+	t := d.layout.Types[e.typ]
+	switch t.Encoding {
+	case Inplace:
+		size := d.layout.size(e.typ)
+		if size == 0 || e.offset+size > common.HashLength {
+			return hexutil.Encode(word)
+		}
+		return decodeInplace(word[common.HashLength-e.offset-size:common.HashLength-e.offset], t.Label)
+	case DynamicArray:
+		return new(big.Int).SetBytes(word).String()
+	case Bytes:
+		// short values are held in the slot itself, with twice their length in the lowest byte
+		// long values hold twice their length plus one, with the data starting at the hash of the slot
+		if word[31]&1 == 1 {
+			length := new(big.Int).Rsh(new(big.Int).SetBytes(word), 1)
+			return length.String()
+		}
+		length := int(word[31] / 2)
+		if length > 31 {
+			length = 31
+		}
+		return decodeDynamic(word[:length], t.Label)
+	default:
+		return hexutil.Encode(word)
+	}
+}
+
+// decodeKey decodes a mapping key from the part of the preimage before the mapping slot
+// value type keys are padded to 32 bytes, bytes and string keys are not
+func (d *Decoder) decodeKey(key []byte, typ string) string {
+	t := d.layout.Types[typ]
+	if t.Encoding == Bytes || len(key) != common.HashLength {
+		return decodeDynamic(key, t.Label)
+	}
+	size := d.layout.size(typ)
+	if size == 0 || size > common.HashLength {
+		return hexutil.Encode(key)
+	}
+	if strings.HasPrefix(t.Label, "bytes") {
+		// fixed bytes are left aligned
+		return decodeInplace(key[:size], t.Label)
+	}
+	return decodeInplace(key[common.HashLength-size:], t.Label)
+}
+
+// decodeInplace decodes a value type from the bytes it takes up
+func decodeInplace(data []byte, label string) string {
+	switch {
+	case label == "bool":
+		return fmt.Sprintf("%t", new(big.Int).SetBytes(data).Sign() != 0)
+	case label == "address" || label == "address payable" || strings.HasPrefix(label, "contract "):
+		return common.BytesToAddress(data).Hex()
+	case strings.HasPrefix(label, "uint") || strings.HasPrefix(label, "enum "):
+		return new(big.Int).SetBytes(data).String()
+	case strings.HasPrefix(label, "int"):
+		// two's complement over the size of the type
+		v := new(big.Int).SetBytes(data)
+		if len(data) > 0 && data[0]&0x80 != 0 {
+			v.Sub(v, new(big.Int).Lsh(common.Big1, uint(8*len(data))))
+		}
+		return v.String()
+	default:
+		return hexutil.Encode(data)
+	}
+}
+
+// decodeDynamic decodes the data of a string as text and of anything else as hex
+func decodeDynamic(data []byte, label string) string {
+	if label == "string" {
+		return string(data)
+	}
+	return hexutil.Encode(data)
+}
@@ -0,0 +1,269 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package layout_test
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/layout"
+)
+
+// storage layout of
+//
+//	uint256 total;
+//	address owner; bool paused; uint64 fee;
+//	mapping(address => uint256) balances;
+//	mapping(address => mapping(uint256 => Info)) infos; // struct Info { uint256 amount; address who; int16 delta; }
+//	uint8[] small;
+//	string name;
+//	uint256[2] pair;
+//	mapping(string => uint256) byName;
+var testLayout = []byte(`{"storageLayout": {
+	"storage": [
+		{"label": "total", "offset": 0, "slot": "0", "type": "t_uint256"},
+		{"label": "owner", "offset": 0, "slot": "1", "type": "t_address"},
+		{"label": "paused", "offset": 20, "slot": "1", "type": "t_bool"},
+		{"label": "fee", "offset": 21, "slot": "1", "type": "t_uint64"},
+		{"label": "balances", "offset": 0, "slot": "2", "type": "t_mapping(t_address,t_uint256)"},
+		{"label": "infos", "offset": 0, "slot": "3", "type": "t_mapping(t_address,t_mapping(t_uint256,t_struct(Info)_storage))"},
+		{"label": "small", "offset": 0, "slot": "4", "type": "t_array(t_uint8)dyn_storage"},
+		{"label": "name", "offset": 0, "slot": "5", "type": "t_string_storage"},
+		{"label": "pair", "offset": 0, "slot": "6", "type": "t_array(t_uint256)2_storage"},
+		{"label": "byName", "offset": 0, "slot": "8", "type": "t_mapping(t_string_memory_ptr,t_uint256)"}
+	],
+	"types": {
+		"t_address": {"encoding": "inplace", "label": "address", "numberOfBytes": "20"},
+		"t_bool": {"encoding": "inplace", "label": "bool", "numberOfBytes": "1"},
+		"t_int16": {"encoding": "inplace", "label": "int16", "numberOfBytes": "2"},
+		"t_uint8": {"encoding": "inplace", "label": "uint8", "numberOfBytes": "1"},
+		"t_uint64": {"encoding": "inplace", "label": "uint64", "numberOfBytes": "8"},
+		"t_uint256": {"encoding": "inplace", "label": "uint256", "numberOfBytes": "32"},
+		"t_string_storage": {"encoding": "bytes", "label": "string", "numberOfBytes": "32"},
+		"t_string_memory_ptr": {"encoding": "bytes", "label": "string", "numberOfBytes": "32"},
+		"t_array(t_uint8)dyn_storage": {"base": "t_uint8", "encoding": "dynamic_array", "label": "uint8[]", "numberOfBytes": "32"},
+		"t_array(t_uint256)2_storage": {"base": "t_uint256", "encoding": "inplace", "label": "uint256[2]", "numberOfBytes": "64"},
+		"t_mapping(t_address,t_uint256)": {"encoding": "mapping", "key": "t_address", "label": "mapping(address => uint256)", "numberOfBytes": "32", "value": "t_uint256"},
+		"t_mapping(t_string_memory_ptr,t_uint256)": {"encoding": "mapping", "key": "t_string_memory_ptr", "label": "mapping(string => uint256)", "numberOfBytes": "32", "value": "t_uint256"},
+		"t_mapping(t_uint256,t_struct(Info)_storage)": {"encoding": "mapping", "key": "t_uint256", "label": "mapping(uint256 => struct Info)", "numberOfBytes": "32", "value": "t_struct(Info)_storage"},
+		"t_mapping(t_address,t_mapping(t_uint256,t_struct(Info)_storage))": {"encoding": "mapping", "key": "t_address", "label": "mapping(address => mapping(uint256 => struct Info))", "numberOfBytes": "32", "value": "t_mapping(t_uint256,t_struct(Info)_storage)"},
+		"t_struct(Info)_storage": {"encoding": "inplace", "label": "struct Info", "numberOfBytes": "64", "members": [
+			{"label": "amount", "offset": 0, "slot": "0", "type": "t_uint256"},
+			{"label": "who", "offset": 0, "slot": "1", "type": "t_address"},
+			{"label": "delta", "offset": 20, "slot": "1", "type": "t_int16"}
+		]}
+	}
+}}`)
+
+var (
+	holder = common.HexToAddress("0xde0B295669a9FD93d5F28D9Ec85E40f4cb697BAe")
+	who    = common.HexToAddress("0x0000000000000000000000000000000000C0ffee")
+)
+
+func slot(n int64) []byte {
+	return common.BigToHash(big.NewInt(n)).Bytes()
+}
+
+func leafKey(s []byte) common.Hash {
+	return crypto.Keccak256Hash(s)
+}
+
+func add(h []byte, n int64) []byte {
+	return common.BigToHash(new(big.Int).Add(new(big.Int).SetBytes(h), big.NewInt(n))).Bytes()
+}
+
+var _ = Describe("Decoder", func() {
+	var (
+		l         *layout.Layout
+		preimages layout.MapPreimages
+		decoder   *layout.Decoder
+	)
+	BeforeEach(func() {
+		var err error
+		l, err = layout.ParseLayout(testLayout)
+		Expect(err).ToNot(HaveOccurred())
+		preimages = make(layout.MapPreimages)
+		decoder = layout.NewDecoder(l, preimages)
+	})
+
+	It("Decodes variables at fixed slots without preimages", func() {
+		vars, err := decoder.Decode(leafKey(slot(0)), []byte{0x2a})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vars).To(Equal([]layout.DecodedVariable{{Name: "total", Type: "uint256", Value: "42", Slot: common.BytesToHash(slot(0))}}))
+
+		vars, err = decoder.Decode(leafKey(slot(7)), []byte{0x01, 0x00})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vars).To(HaveLen(1))
+		Expect(vars[0].Name).To(Equal("pair[1]"))
+		Expect(vars[0].Value).To(Equal("256"))
+	})
+
+	It("Decodes packed variables", func() {
+		value := make([]byte, 32)
+		copy(value[12:], who.Bytes())
+		value[11] = 1
+		value[10] = 0x05
+		vars, err := decoder.Decode(leafKey(slot(1)), value)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vars).To(HaveLen(3))
+		Expect(vars[0].Name).To(Equal("owner"))
+		Expect(vars[0].Value).To(Equal(who.Hex()))
+		Expect(vars[1].Name).To(Equal("paused"))
+		Expect(vars[1].Value).To(Equal("true"))
+		Expect(vars[2].Name).To(Equal("fee"))
+		Expect(vars[2].Value).To(Equal("5"))
+	})
+
+	It("Decodes short strings", func() {
+		value := make([]byte, 32)
+		copy(value, "hello")
+		value[31] = 10
+		vars, err := decoder.Decode(leafKey(slot(5)), value)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vars).To(HaveLen(1))
+		Expect(vars[0].Type).To(Equal("string"))
+		Expect(vars[0].Value).To(Equal("hello"))
+	})
+
+	It("Returns nil for slots which can't be resolved", func() {
+		vars, err := decoder.Decode(leafKey(slot(100)), []byte{1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vars).To(BeNil())
+		// the slot of a mapping value is only known through its preimage
+		valueSlot := crypto.Keccak256(common.LeftPadBytes(holder.Bytes(), 32), slot(2))
+		vars, err = decoder.Decode(leafKey(valueSlot), []byte{1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vars).To(BeNil())
+	})
+
+	It("Decodes mapping values and their keys through preimages", func() {
+		mappingPreimage := append(common.LeftPadBytes(holder.Bytes(), 32), slot(2)...)
+		valueSlot := crypto.Keccak256(mappingPreimage)
+		preimages.Add(valueSlot, mappingPreimage)
+		vars, err := decoder.Decode(leafKey(valueSlot), []byte{0x03, 0xe8})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vars).To(Equal([]layout.DecodedVariable{{
+			Name:  "balances",
+			Keys:  []string{holder.Hex()},
+			Type:  "uint256",
+			Value: "1000",
+			Slot:  common.BytesToHash(valueSlot),
+		}}))
+	})
+
+	It("Decodes string keyed mappings", func() {
+		mappingPreimage := append([]byte("bob"), slot(8)...)
+		valueSlot := crypto.Keccak256(mappingPreimage)
+		preimages.Add(valueSlot, mappingPreimage)
+		vars, err := decoder.Decode(leafKey(valueSlot), []byte{0x07})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vars).To(HaveLen(1))
+		Expect(vars[0].Name).To(Equal("byName"))
+		Expect(vars[0].Keys).To(Equal([]string{"bob"}))
+		Expect(vars[0].Value).To(Equal("7"))
+	})
+
+	It("Decodes struct members of nested mapping values", func() {
+		outerPreimage := append(common.LeftPadBytes(holder.Bytes(), 32), slot(3)...)
+		innerSlot := crypto.Keccak256(outerPreimage)
+		innerPreimage := append(slot(7), innerSlot...)
+		structSlot := crypto.Keccak256(innerPreimage)
+		memberSlot := add(structSlot, 1)
+		preimages.Add(outerPreimage, innerPreimage, memberSlot)
+
+		value := make([]byte, 32)
+		copy(value[12:], who.Bytes())
+		value[10], value[11] = 0xff, 0xfe // int16(-2)
+		vars, err := decoder.Decode(leafKey(memberSlot), value)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vars).To(HaveLen(2))
+		Expect(vars[0].Name).To(Equal("infos.who"))
+		Expect(vars[0].Keys).To(Equal([]string{holder.Hex(), "7"}))
+		Expect(vars[0].Value).To(Equal(who.Hex()))
+		Expect(vars[1].Name).To(Equal("infos.delta"))
+		Expect(vars[1].Type).To(Equal("int16"))
+		Expect(vars[1].Value).To(Equal("-2"))
+	})
+
+	It("Decodes packed dynamic array elements", func() {
+		elementSlot := add(crypto.Keccak256(slot(4)), 1)
+		preimages.Add(elementSlot)
+		value := make([]byte, 32)
+		value[30] = 9 // small[33], at offset 1
+		vars, err := decoder.Decode(leafKey(elementSlot), value)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vars).To(HaveLen(32))
+		Expect(vars[0].Name).To(Equal("small[32]"))
+		Expect(vars[0].Value).To(Equal("0"))
+		Expect(vars[1].Name).To(Equal("small[33]"))
+		Expect(vars[1].Value).To(Equal("9"))
+		// and the length at the array's slot
+		vars, err = decoder.Decode(leafKey(slot(4)), []byte{64})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vars[0].Value).To(Equal("64"))
+	})
+})
+
+var _ = Describe("Layouts and preimages", func() {
+	It("Parses bare layouts and rejects undescribed types", func() {
+		_, err := layout.ParseLayout([]byte(`{"storage": [{"label": "x", "offset": 0, "slot": "0", "type": "t_uint256"}], "types": {"t_uint256": {"encoding": "inplace", "label": "uint256", "numberOfBytes": "32"}}}`))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = layout.ParseLayout([]byte(`{"storage": [{"label": "x", "offset": 0, "slot": "0", "type": "t_uint256"}], "types": {}}`))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Derives the preimages of the fixed slots", func() {
+		l, err := layout.ParseLayout(testLayout)
+		Expect(err).ToNot(HaveOccurred())
+		preimages := layout.StaticPreimages(l)
+		Expect(preimages).To(HaveLen(9))
+		Expect(preimages).To(ContainElement(slot(0)))
+		Expect(preimages).To(ContainElement(slot(8)))
+	})
+
+	It("Loads layouts named by contract address and preimage files", func() {
+		dir, err := ioutil.TempDir("", "layouts")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		err = ioutil.WriteFile(filepath.Join(dir, holder.Hex()+".json"), testLayout, 0644)
+		Expect(err).ToNot(HaveOccurred())
+		layouts, err := layout.LoadLayouts(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(layouts).To(HaveKey(holder))
+
+		file := filepath.Join(dir, "preimages.txt")
+		err = ioutil.WriteFile(file, []byte("# slots\n"+hexutil.Encode(slot(1))+"\n\n"+common.Bytes2Hex(slot(2))+"\n"), 0644)
+		Expect(err).ToNot(HaveOccurred())
+		preimages, err := layout.ReadPreimageFile(file)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(preimages).To(Equal([][]byte{slot(1), slot(2)}))
+	})
+
+	It("Separates address preimages from storage preimages", func() {
+		addresses, rest := layout.SplitAddresses([][]byte{slot(1), holder.Bytes(), append(slot(2), slot(3)...)})
+		Expect(addresses).To(Equal([]common.Address{holder}))
+		Expect(rest).To(Equal([][]byte{slot(1), append(slot(2), slot(3)...)}))
+	})
+})
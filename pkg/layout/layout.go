@@ -0,0 +1,243 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package layout
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Type encodings used by solc in the storage layout
+const (
+	Inplace      = "inplace"
+	Mapping      = "mapping"
+	DynamicArray = "dynamic_array"
+	Bytes        = "bytes"
+)
+
+// Layout is the storage layout of a contract, as output by solc with --storage-layout (or outputSelection "storageLayout")
+type Layout struct {
+	Storage []Variable      `json:"storage"`
+	Types   map[string]Type `json:"types"`
+}
+
+// Variable is a state variable or struct member in a storage layout
+type Variable struct {
+	Label  string `json:"label"`
+	Offset int    `json:"offset"`
+	Slot   string `json:"slot"`
+	Type   string `json:"type"`
+}
+
+// Type describes a type referenced by the storage layout
+type Type struct {
+	Encoding      string     `json:"encoding"`
+	Label         string     `json:"label"`
+	NumberOfBytes string     `json:"numberOfBytes"`
+	Key           string     `json:"key,omitempty"`
+	Value         string     `json:"value,omitempty"`
+	Base          string     `json:"base,omitempty"`
+	Members       []Variable `json:"members,omitempty"`
+}
+
+// matches the length of a static array type id, e.g. t_array(t_uint8)5_storage
+var staticArrayLength = regexp.MustCompile(`\)(\d+)_storage$`)
+
+// ParseLayout parses a storage layout, either on its own or nested under the "storageLayout" key of solc's contract output
+func ParseLayout(data []byte) (*Layout, error) {
+	wrapped := struct {
+		StorageLayout *Layout `json:"storageLayout"`
+	}{}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, fmt.Errorf("error decoding storage layout json: %v", err)
+	}
+	l := wrapped.StorageLayout
+	if l == nil {
+		l = new(Layout)
+		if err := json.Unmarshal(data, l); err != nil {
+			return nil, fmt.Errorf("error decoding storage layout json: %v", err)
+		}
+	}
+	if err := l.check(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// LoadLayouts loads the storage layouts in the directory, each in a file named by the address of its contract (e.g. 0xabc...def.json)
+func LoadLayouts(dir string) (map[common.Address]*Layout, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	layouts := make(map[common.Address]*Layout, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		if !common.IsHexAddress(name) {
+			return nil, fmt.Errorf("storage layout file %s is not named by a contract address", file)
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		l, err := ParseLayout(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		layouts[common.HexToAddress(name)] = l
+	}
+	return layouts, nil
+}
+
+// check that every type referenced by the layout is described, so that decoding doesn't need to
+func (l *Layout) check() error {
+	if len(l.Storage) == 0 {
+		return fmt.Errorf("storage layout has no variables")
+	}
+	var checkVars func(vars []Variable) error
+	checkType := func(id string) error {
+		if id == "" {
+			return nil
+		}
+		if _, ok := l.Types[id]; !ok {
+			return fmt.Errorf("storage layout references undescribed type %s", id)
+		}
+		return nil
+	}
+	checkVars = func(vars []Variable) error {
+		for _, v := range vars {
+			if _, ok := new(big.Int).SetString(v.Slot, 10); !ok {
+				return fmt.Errorf("variable %s has invalid slot %q", v.Label, v.Slot)
+			}
+			if err := checkType(v.Type); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := checkVars(l.Storage); err != nil {
+		return err
+	}
+	for id, t := range l.Types {
+		if _, err := strconv.Atoi(t.NumberOfBytes); err != nil {
+			return fmt.Errorf("type %s has invalid numberOfBytes %q", id, t.NumberOfBytes)
+		}
+		for _, ref := range []string{t.Key, t.Value, t.Base} {
+			if err := checkType(ref); err != nil {
+				return err
+			}
+		}
+		if err := checkVars(t.Members); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// size returns the number of bytes a value of the type takes up in storage
+func (l *Layout) size(typ string) int {
+	n, _ := strconv.Atoi(l.Types[typ].NumberOfBytes)
+	return n
+}
+
+// slots returns the number of slots a value of the type takes up in storage
+func (l *Layout) slots(typ string) uint64 {
+	return uint64(l.size(typ)+31) / 32
+}
+
+// member is a value type, mapping, dynamic array, or bytes/string held at a fixed position relative to the start of its container
+type member struct {
+	name   string
+	typ    string
+	slot   uint64
+	offset int
+}
+
+// flatten expands structs and static arrays of the type into the members they are made up of
+func (l *Layout) flatten(name, typ string) []member {
+	t := l.Types[typ]
+	if t.Encoding != Inplace {
+		return []member{{name: name, typ: typ}}
+	}
+	switch {
+	case len(t.Members) > 0:
+		var members []member
+		for _, m := range t.Members {
+			slot, _ := new(big.Int).SetString(m.Slot, 10)
+			for _, inner := range l.flatten(name+"."+m.Label, m.Type) {
+				inner.slot += slot.Uint64()
+				inner.offset += m.Offset
+				members = append(members, inner)
+			}
+		}
+		return members
+	case t.Base != "":
+		match := staticArrayLength.FindStringSubmatch(typ)
+		if match == nil {
+			return nil
+		}
+		length, _ := strconv.Atoi(match[1])
+		var members []member
+		for i := 0; i < length; i++ {
+			slot, offset := l.element(t.Base, uint64(i))
+			for _, inner := range l.flatten(fmt.Sprintf("%s[%d]", name, i), t.Base) {
+				inner.slot += slot
+				inner.offset += offset
+				members = append(members, inner)
+			}
+		}
+		return members
+	default:
+		return []member{{name: name, typ: typ}}
+	}
+}
+
+// element returns the slot and offset of an array element relative to the start of the array
+// elements smaller than a slot are packed, larger ones start at a new slot
+func (l *Layout) element(base string, index uint64) (uint64, int) {
+	size := l.size(base)
+	if size >= 32 {
+		return index * l.slots(base), 0
+	}
+	perSlot := uint64(32 / size)
+	return index / perSlot, int(index%perSlot) * size
+}
+
+// maxSearchSpan caps the number of slots searched back from a slot for the start of the mapping value or array element holding it
+const maxSearchSpan = 256
+
+// maxSpan returns the number of slots taken up by the largest type in the layout, capped at maxSearchSpan
+func (l *Layout) maxSpan() uint64 {
+	var span uint64 = 1
+	for id := range l.Types {
+		if s := l.slots(id); s > span {
+			span = s
+		}
+	}
+	if span > maxSearchSpan {
+		return maxSearchSpan
+	}
+	return span
+}
@@ -0,0 +1,178 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package layout
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+)
+
+// Preimages looks up the keccak256 preimages of storage leaf keys and of the hashed slots they are derived from
+type Preimages interface {
+	// Preimage returns the preimage of the hash, or nil if it is not known
+	Preimage(hash common.Hash) ([]byte, error)
+}
+
+// MapPreimages is an in-memory set of preimages, keyed by their hash
+type MapPreimages map[common.Hash][]byte
+
+// Add adds the preimages to the set
+func (m MapPreimages) Add(preimages ...[]byte) {
+	for _, p := range preimages {
+		m[crypto.Keccak256Hash(p)] = p
+	}
+}
+
+// Preimage satisfies the Preimages interface
+func (m MapPreimages) Preimage(hash common.Hash) ([]byte, error) {
+	return m[hash], nil
+}
+
+// DBPreimages looks up preimages in eth.storage_preimages
+type DBPreimages struct {
+	db *postgres.DB
+}
+
+// NewDBPreimages returns a pointer to a new DBPreimages
+func NewDBPreimages(db *postgres.DB) *DBPreimages {
+	return &DBPreimages{
+		db: db,
+	}
+}
+
+// Preimage satisfies the Preimages interface
+func (p *DBPreimages) Preimage(hash common.Hash) ([]byte, error) {
+	var preimage []byte
+	if err := p.db.Get(&preimage, `SELECT preimage FROM eth.storage_preimages WHERE hash = $1`, hash.Hex()); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return preimage, nil
+}
+
+// Publish inserts the preimages into eth.storage_preimages, keyed by their keccak256 hash
+// Preimages are self-verifying, so ones which are already present are skipped
+// It returns the number of preimages that were new
+func (p *DBPreimages) Publish(preimages [][]byte) (int64, error) {
+	tx, err := p.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	var inserted int64
+	for _, preimage := range preimages {
+		res, err := tx.Exec(`INSERT INTO eth.storage_preimages (hash, preimage) VALUES ($1, $2) ON CONFLICT (hash) DO NOTHING`,
+			crypto.Keccak256Hash(preimage).Hex(), preimage)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		inserted += n
+	}
+	return inserted, tx.Commit()
+}
+
+// PublishAddresses inserts the addresses into eth.address_preimages, keyed by their state leaf key
+// It returns the number of addresses that were new
+func (p *DBPreimages) PublishAddresses(addresses []common.Address) (int64, error) {
+	tx, err := p.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	var inserted int64
+	for _, address := range addresses {
+		res, err := tx.Exec(`INSERT INTO eth.address_preimages (state_leaf_key, address) VALUES ($1, $2) ON CONFLICT (state_leaf_key) DO NOTHING`,
+			crypto.Keccak256Hash(address.Bytes()).Hex(), address.String())
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		inserted += n
+	}
+	return inserted, tx.Commit()
+}
+
+// SplitAddresses separates the 20 byte preimages, which are the preimages of state leaf keys, from the rest
+func SplitAddresses(preimages [][]byte) (addresses []common.Address, rest [][]byte) {
+	for _, preimage := range preimages {
+		if len(preimage) == common.AddressLength {
+			addresses = append(addresses, common.BytesToAddress(preimage))
+			continue
+		}
+		rest = append(rest, preimage)
+	}
+	return addresses, rest
+}
+
+// ReadPreimageFile reads a file of hex encoded preimages, one per line
+// Blank lines and lines starting with # are skipped
+func ReadPreimageFile(path string) ([][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var preimages [][]byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if !strings.HasPrefix(text, "0x") {
+			text = "0x" + text
+		}
+		preimage, err := hexutil.Decode(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, line, err)
+		}
+		preimages = append(preimages, preimage)
+	}
+	return preimages, scanner.Err()
+}
+
+// StaticPreimages returns the preimages of the storage leaf keys of every slot occupied by a variable at a fixed position in the layout
+// The positions of mapping values and dynamic array elements depend on hashes computed at runtime, so they aren't included
+func StaticPreimages(l *Layout) [][]byte {
+	d := NewDecoder(l, MapPreimages{})
+	preimages := make([][]byte, 0, len(d.static))
+	for slot := range d.static {
+		preimages = append(preimages, common.CopyBytes(slot.Bytes()))
+	}
+	return preimages
+}
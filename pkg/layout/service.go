@@ -0,0 +1,220 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package layout
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+)
+
+const missingPreimagesPgStr = `SELECT DISTINCT storage_cids.storage_leaf_key FROM eth.storage_cids
+			INNER JOIN eth.state_cids ON (storage_cids.state_id = state_cids.id)
+			INNER JOIN eth.header_cids ON (state_cids.header_id = header_cids.id)
+			LEFT JOIN eth.storage_preimages ON (storage_cids.storage_leaf_key = storage_preimages.hash)
+			WHERE header_cids.block_number BETWEEN $1 AND $2
+			AND storage_cids.node_type = 2
+			AND storage_preimages.hash IS NULL
+			AND ($3::VARCHAR(66)[] IS NULL OR state_cids.state_leaf_key = ANY($3::VARCHAR(66)[]))
+			AND header_cids.chain_id = $4`
+
+// hashed slots are keccak256 hashes, so slots this small are fixed positions which have no preimage to fetch
+var hashedSlotFloor = new(big.Int).Lsh(common.Big1, 64)
+
+// Filler is the top level interface for filling eth.storage_preimages
+type Filler interface {
+	Fill() (int64, error)
+}
+
+// Service for filling eth.storage_preimages
+type Service struct {
+	preimages *DBPreimages
+	db        *postgres.DB
+	client    *rpc.Client
+	timeout   time.Duration
+	file      string
+	layouts   map[common.Address]*Layout
+	fetch     bool
+	start     uint64
+	stop      uint64
+	// number of slots searched back from a hashed slot for the start of its mapping value or array element
+	span uint64
+}
+
+// NewPreimageService returns a new preimage Filler
+func NewPreimageService(settings *Config) Filler {
+	var span uint64 = 1
+	for _, l := range settings.Layouts {
+		if s := l.maxSpan(); s > span {
+			span = s
+		}
+	}
+	return &Service{
+		preimages: NewDBPreimages(settings.DB),
+		db:        settings.DB,
+		client:    settings.HTTPClient,
+		timeout:   settings.Timeout,
+		file:      settings.File,
+		layouts:   settings.Layouts,
+		fetch:     settings.Fetch,
+		start:     settings.Start,
+		stop:      settings.Stop,
+		span:      span,
+	}
+}
+
+// Fill inserts the preimages from the preimage file (20 byte preimages go to eth.address_preimages), the fixed slots of the storage layouts, and, if fetching,
+// the preimages the node has recorded for the storage leaf keys indexed in the block range (restricted to the
+// contracts with layouts, if any) and for the hashed slots they are derived from
+// It returns the number of preimages that were new
+func (s *Service) Fill() (int64, error) {
+	var inserted int64
+	if s.file != "" {
+		preimages, err := ReadPreimageFile(s.file)
+		if err != nil {
+			return inserted, err
+		}
+		addresses, preimages := SplitAddresses(preimages)
+		n, err := s.preimages.Publish(preimages)
+		if err != nil {
+			return inserted, err
+		}
+		logrus.Infof("inserted %d of %d storage preimages from %s", n, len(preimages), s.file)
+		inserted += n
+		n, err = s.preimages.PublishAddresses(addresses)
+		if err != nil {
+			return inserted, err
+		}
+		logrus.Infof("inserted %d of %d address preimages from %s", n, len(addresses), s.file)
+		inserted += n
+	}
+	for address, l := range s.layouts {
+		preimages := StaticPreimages(l)
+		n, err := s.preimages.Publish(preimages)
+		if err != nil {
+			return inserted, err
+		}
+		logrus.Infof("inserted %d of %d preimages from the storage layout of %s", n, len(preimages), address.Hex())
+		inserted += n
+	}
+	if !s.fetch {
+		return inserted, nil
+	}
+	n, err := s.fetchPreimages()
+	inserted += n
+	return inserted, err
+}
+
+func (s *Service) fetchPreimages() (int64, error) {
+	stop := s.stop
+	if stop == 0 {
+		stop = math.MaxInt64
+	}
+	var stateKeys []string
+	for address := range s.layouts {
+		stateKeys = append(stateKeys, crypto.Keccak256Hash(address.Bytes()).Hex())
+	}
+	var leafKeys []string
+	if err := s.db.Select(&leafKeys, missingPreimagesPgStr, s.start, stop, pq.Array(stateKeys), s.db.Node.ChainID); err != nil {
+		return 0, err
+	}
+	logrus.Infof("fetching the preimages of %d storage leaf keys", len(leafKeys))
+	found := make(MapPreimages)
+	for _, leafKey := range leafKeys {
+		slot, err := s.debugPreimage(common.HexToHash(leafKey))
+		if err != nil {
+			return 0, err
+		}
+		if len(slot) != common.HashLength {
+			continue
+		}
+		found.Add(slot)
+		if err := s.resolve(common.BytesToHash(slot), found, 0); err != nil {
+			return 0, err
+		}
+	}
+	preimages := make([][]byte, 0, len(found))
+	for _, preimage := range found {
+		preimages = append(preimages, preimage)
+	}
+	n, err := s.preimages.Publish(preimages)
+	if err != nil {
+		return 0, err
+	}
+	logrus.Infof("inserted %d preimages fetched from the node", n)
+	return n, nil
+}
+
+// resolve fetches the preimage of the hashed slot a mapping value or array element holding the slot starts at,
+// and recursively of the slot of the mapping or array holding that
+func (s *Service) resolve(slot common.Hash, found MapPreimages, depth int) error {
+	if depth >= maxDepth || slot.Big().Cmp(hashedSlotFloor) < 0 {
+		return nil
+	}
+	for k := uint64(0); k < s.span; k++ {
+		start := common.BigToHash(new(big.Int).Sub(slot.Big(), new(big.Int).SetUint64(k)))
+		if _, ok := found[start]; ok {
+			return nil
+		}
+		known, err := s.preimages.Preimage(start)
+		if err != nil {
+			return err
+		}
+		if known != nil {
+			return nil
+		}
+		preimage, err := s.debugPreimage(start)
+		if err != nil {
+			return err
+		}
+		if preimage == nil {
+			continue
+		}
+		found.Add(preimage)
+		if len(preimage) < common.HashLength {
+			return nil
+		}
+		return s.resolve(common.BytesToHash(preimage[len(preimage)-common.HashLength:]), found, depth+1)
+	}
+	return nil
+}
+
+// debugPreimage returns the preimage the node has recorded for the hash, nil if it has none
+// the node needs to run with --cache.preimages for the preimages of hashes computed by contracts to be recorded
+func (s *Service) debugPreimage(hash common.Hash) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	var preimage hexutil.Bytes
+	if err := s.client.CallContext(ctx, &preimage, "debug_preimage", hash); err != nil {
+		if strings.Contains(err.Error(), "unknown preimage") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return preimage, nil
+}
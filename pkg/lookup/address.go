@@ -0,0 +1,56 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package lookup
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/lib/pq"
+)
+
+const addressPreimagesPgStr = `SELECT state_leaf_key, address FROM eth.address_preimages
+			WHERE state_leaf_key = ANY($1::VARCHAR(66)[])`
+
+// Address resolves the state leaf key to the address it is the hash of
+// ok is false if the address has not been seen by the indexer or imported as a preimage
+func (r *StateRetriever) Address(stateKey common.Hash) (address common.Address, ok bool, err error) {
+	addresses, err := r.Addresses([]common.Hash{stateKey})
+	if err != nil {
+		return common.Address{}, false, err
+	}
+	address, ok = addresses[stateKey]
+	return address, ok, nil
+}
+
+// Addresses resolves the state leaf keys to the addresses they are the hashes of, keys which can't be resolved are left out
+func (r *StateRetriever) Addresses(stateKeys []common.Hash) (map[common.Hash]common.Address, error) {
+	keys := make([]string, len(stateKeys))
+	for i, key := range stateKeys {
+		keys[i] = key.Hex()
+	}
+	rows := make([]struct {
+		StateKey string `db:"state_leaf_key"`
+		Address  string `db:"address"`
+	}, 0, len(keys))
+	if err := r.db.Reader().Select(&rows, addressPreimagesPgStr, pq.Array(keys)); err != nil {
+		return nil, err
+	}
+	addresses := make(map[common.Hash]common.Address, len(rows))
+	for _, row := range rows {
+		addresses[common.HexToHash(row.StateKey)] = common.HexToAddress(row.Address)
+	}
+	return addresses, nil
+}
@@ -0,0 +1,183 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package lookup
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+)
+
+// the root node may be indexed with an empty or a NULL path
+const (
+	nodePathCondition = `%s = $1`
+	rootPathCondition = `(%s = $1 OR %[1]s IS NULL)`
+)
+
+const (
+	stateRootPgStr = `SELECT state_root FROM eth.header_cids WHERE id = canonical_header_id($1, $2)`
+	stateNodePgStr = `SELECT state_cids.node_type, state_cids.mh_key, blocks.data FROM eth.state_cids
+			INNER JOIN eth.header_cids ON (state_cids.header_id = header_cids.id)
+			INNER JOIN public.blocks ON (state_cids.mh_key = blocks.key)
+			WHERE %s
+			AND header_cids.block_number <= $2
+			AND header_cids.chain_id = $3
+			AND ` + canonical + `
+			ORDER BY header_cids.block_number DESC
+			LIMIT 1`
+	storageNodePgStr = `SELECT storage_cids.node_type, storage_cids.mh_key, blocks.data FROM eth.storage_cids
+			INNER JOIN eth.state_cids ON (storage_cids.state_id = state_cids.id)
+			INNER JOIN eth.header_cids ON (state_cids.header_id = header_cids.id)
+			INNER JOIN public.blocks ON (storage_cids.mh_key = blocks.key)
+			WHERE %s
+			AND header_cids.block_number <= $2
+			AND state_cids.state_leaf_key = $3
+			AND header_cids.chain_id = $4
+			AND ` + canonical + `
+			ORDER BY header_cids.block_number DESC
+			LIMIT 1`
+)
+
+// NodeFetcher returns the rlp of the trie node at the path (in nibbles), nil if there is no node at the path
+type NodeFetcher func(path []byte) ([]byte, error)
+
+type nodeRow struct {
+	NodeType int             `db:"node_type"`
+	MhKey    string          `db:"mh_key"`
+	Data     blockstore.Data `db:"data"`
+}
+
+// AccountProof returns the EIP-1186 proof for the account at the address at the height:
+// the rlp of the nodes on the path from the state root to the account, or to where the account would be if it does not exist
+func (r *StateRetriever) AccountProof(address common.Address, height uint64) ([][]byte, error) {
+	var root string
+	if err := r.db.Reader().Get(&root, stateRootPgStr, r.db.Node.ChainID, height); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("no canonical header indexed at height %d", height)
+		}
+		return nil, err
+	}
+	return Prove(common.HexToHash(root), crypto.Keccak256Hash(address.Bytes()), r.nodeFetcher(stateNodePgStr, `state_cids.state_path`, height))
+}
+
+// StorageProof returns the EIP-1186 proof for the storage slot of the account at the address at the height
+// The proof is empty if the account does not exist or has no storage
+func (r *StateRetriever) StorageProof(address common.Address, slot common.Hash, height uint64) ([][]byte, error) {
+	stateKey := crypto.Keccak256Hash(address.Bytes())
+	account, err := r.AccountByKey(stateKey, height)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return [][]byte{}, nil
+	}
+	return Prove(account.Root, crypto.Keccak256Hash(slot.Bytes()), r.nodeFetcher(storageNodePgStr, `storage_cids.storage_path`, height, stateKey.Hex()))
+}
+
+// nodeFetcher returns a NodeFetcher for the latest canonical node at a path, at or below the height
+func (r *StateRetriever) nodeFetcher(pgStr, pathColumn string, height uint64, args ...interface{}) NodeFetcher {
+	nodePgStr := fmt.Sprintf(pgStr, fmt.Sprintf(nodePathCondition, pathColumn))
+	rootPgStr := fmt.Sprintf(pgStr, fmt.Sprintf(rootPathCondition, pathColumn))
+	return func(path []byte) ([]byte, error) {
+		pgStr := nodePgStr
+		if len(path) == 0 {
+			pgStr = rootPgStr
+			path = []byte{}
+		}
+		row := new(nodeRow)
+		if err := r.db.Reader().Get(row, pgStr, append(append([]interface{}{path, height}, args...), r.db.Node.ChainID)...); err != nil {
+			if err == sql.ErrNoRows {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if eth.ResolveToNodeType(row.NodeType) == sdtypes.Removed {
+			return nil, nil
+		}
+		return blockstore.Load(r.blocks, row.MhKey, row.Data)
+	}
+}
+
+// Prove assembles the Merkle proof for the key in the trie with the root, fetching the nodes along the key's path
+// Like go-ethereum's trie.Prove, nodes embedded in their parent are not included in the proof
+// Each fetched node is checked against the hash its parent references, so an error is returned if the trie is not fully indexed
+func Prove(root, key common.Hash, fetch NodeFetcher) ([][]byte, error) {
+	proof := make([][]byte, 0)
+	if root == types.EmptyRootHash {
+		return proof, nil
+	}
+	nibbles := keyNibbles(key.Bytes())
+	path := make([]byte, 0, len(nibbles))
+	ref := eth.TrieRef{Hash: root}
+	for {
+		raw := ref.Embedded
+		if len(raw) == 0 {
+			var err error
+			raw, err = fetch(path)
+			if err != nil {
+				return nil, err
+			}
+			if raw == nil || crypto.Keccak256Hash(raw) != ref.Hash {
+				return nil, fmt.Errorf("trie node %s at path %x is not indexed", ref.Hash.Hex(), path)
+			}
+			proof = append(proof, raw)
+		}
+		node, err := eth.DecodeTrieNode(raw)
+		if err != nil {
+			return nil, err
+		}
+		switch node.NodeType {
+		case sdtypes.Branch:
+			if len(path) == len(nibbles) {
+				return proof, nil
+			}
+			next := nibbles[len(path)]
+			ref = node.Children[next]
+			path = append(path, next)
+		case sdtypes.Extension:
+			rest := nibbles[len(path):]
+			if len(rest) < len(node.Key) || string(rest[:len(node.Key)]) != string(node.Key) {
+				return proof, nil
+			}
+			ref = node.Children[0]
+			path = append(path, node.Key...)
+		default:
+			// a leaf ends the path, whether it is the key's or proves the key's absence
+			return proof, nil
+		}
+		if ref.Empty() {
+			return proof, nil
+		}
+	}
+}
+
+// keyNibbles converts a key into its nibbles
+func keyNibbles(key []byte) []byte {
+	nibbles := make([]byte, len(key)*2)
+	for i, b := range key {
+		nibbles[i*2] = b / 16
+		nibbles[i*2+1] = b % 16
+	}
+	return nibbles
+}
@@ -0,0 +1,115 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package lookup_test
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/trie"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/lookup"
+)
+
+var _ = Describe("Prove", func() {
+	var (
+		tr    *trie.Trie
+		root  common.Hash
+		nodes map[string][]byte
+		fetch lookup.NodeFetcher
+		key   = func(i int) common.Hash { return crypto.Keccak256Hash([]byte(fmt.Sprintf("key%d", i))) }
+	)
+
+	BeforeEach(func() {
+		var err error
+		triedb := trie.NewDatabase(rawdb.NewMemoryDatabase())
+		tr, err = trie.New(common.Hash{}, triedb)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < 100; i++ {
+			tr.Update(key(i).Bytes(), []byte(fmt.Sprintf("value%d", i)))
+		}
+		root, err = tr.Commit(nil)
+		Expect(err).ToNot(HaveOccurred())
+		// index every hashed node by its path, as the statediffs with intermediate nodes do
+		nodes = make(map[string][]byte)
+		it := tr.NodeIterator(nil)
+		for it.Next(true) {
+			if it.Hash() == (common.Hash{}) {
+				continue
+			}
+			blob, err := triedb.Node(it.Hash())
+			Expect(err).ToNot(HaveOccurred())
+			nodes[string(it.Path())] = blob
+		}
+		Expect(it.Error()).ToNot(HaveOccurred())
+		fetch = func(path []byte) ([]byte, error) {
+			return nodes[string(path)], nil
+		}
+	})
+
+	proofDB := func(proof [][]byte) *memorydb.Database {
+		db := memorydb.New()
+		for _, node := range proof {
+			Expect(db.Put(crypto.Keccak256(node), node)).To(Succeed())
+		}
+		return db
+	}
+
+	It("Assembles the same proof as go-ethereum for keys in the trie", func() {
+		for i := 0; i < 100; i++ {
+			proof, err := lookup.Prove(root, key(i), fetch)
+			Expect(err).ToNot(HaveOccurred())
+			expected := memorydb.New()
+			Expect(tr.Prove(key(i).Bytes(), 0, expected)).To(Succeed())
+			Expect(proofDB(proof)).To(Equal(expected))
+			value, err := trie.VerifyProof(root, key(i).Bytes(), proofDB(proof))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal([]byte(fmt.Sprintf("value%d", i))))
+		}
+	})
+
+	It("Assembles proofs of absence for keys not in the trie", func() {
+		missing := crypto.Keccak256Hash([]byte("missing"))
+		proof, err := lookup.Prove(root, missing, fetch)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(proof).ToNot(BeEmpty())
+		value, err := trie.VerifyProof(root, missing.Bytes(), proofDB(proof))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value).To(BeNil())
+	})
+
+	It("Returns an empty proof for the empty trie", func() {
+		proof, err := lookup.Prove(types.EmptyRootHash, key(0), fetch)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(proof).To(BeEmpty())
+	})
+
+	It("Errors if a node on the path is not indexed or does not match its reference", func() {
+		_, err := lookup.Prove(crypto.Keccak256Hash([]byte("another root")), key(0), fetch)
+		Expect(err).To(HaveOccurred())
+
+		delete(nodes, "")
+		_, err = lookup.Prove(root, key(0), fetch)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,231 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package lookup
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+)
+
+// canonical restricts a query to headers on the canonical chain of their chain
+const canonical = `header_cids.id = (SELECT canonical_header_id(header_cids.chain_id, header_cids.block_number))`
+
+const (
+	canonicalHeightPgStr = `SELECT block_number FROM eth.header_cids
+			WHERE block_hash = $1
+			AND chain_id = $2
+			AND ` + canonical + `
+			LIMIT 1`
+	stateLeafPgStr = `SELECT state_cids.state_path, state_cids.node_type, header_cids.block_number, state_cids.mh_key, blocks.data FROM eth.state_cids
+			INNER JOIN eth.header_cids ON (state_cids.header_id = header_cids.id)
+			INNER JOIN public.blocks ON (state_cids.mh_key = blocks.key)
+			WHERE state_cids.state_leaf_key = $1
+			AND header_cids.block_number <= $2
+			AND header_cids.chain_id = $3
+			AND ` + canonical + `
+			ORDER BY header_cids.block_number DESC
+			LIMIT 1`
+	stateRemovedPgStr = `SELECT exists(SELECT 1 FROM eth.state_cids
+			INNER JOIN eth.header_cids ON (state_cids.header_id = header_cids.id)
+			WHERE state_cids.state_path = $1
+			AND state_cids.node_type = 3
+			AND header_cids.block_number > $2
+			AND header_cids.block_number <= $3
+			AND header_cids.chain_id = $4
+			AND ` + canonical + `)`
+	storageLeafPgStr = `SELECT state_cids.state_path, storage_cids.storage_path, storage_cids.node_type, header_cids.block_number, storage_cids.mh_key, blocks.data
+			FROM eth.storage_cids
+			INNER JOIN eth.state_cids ON (storage_cids.state_id = state_cids.id)
+			INNER JOIN eth.header_cids ON (state_cids.header_id = header_cids.id)
+			INNER JOIN public.blocks ON (storage_cids.mh_key = blocks.key)
+			WHERE state_cids.state_leaf_key = $1
+			AND storage_cids.storage_leaf_key = $2
+			AND header_cids.block_number <= $3
+			AND header_cids.chain_id = $4
+			AND ` + canonical + `
+			ORDER BY header_cids.block_number DESC
+			LIMIT 1`
+	storageRemovedPgStr = `SELECT exists(SELECT 1 FROM eth.storage_cids
+			INNER JOIN eth.state_cids ON (storage_cids.state_id = state_cids.id)
+			INNER JOIN eth.header_cids ON (state_cids.header_id = header_cids.id)
+			WHERE state_cids.state_leaf_key = $1
+			AND storage_cids.storage_path = $2
+			AND storage_cids.node_type = 3
+			AND header_cids.block_number > $3
+			AND header_cids.block_number <= $4
+			AND header_cids.chain_id = $5
+			AND ` + canonical + `)`
+)
+
+// ErrNotCanonical is returned when state is looked up at a block that is not indexed on the canonical chain
+var ErrNotCanonical = errors.New("block is not indexed on the canonical chain")
+
+// StateRetriever looks up accounts and storage values at any indexed height
+//
+// Only state and storage diffs are indexed, so the value at height N is held in the latest leaf for the key at or below N
+// Leaves are only searched for on the canonical chain of the node's chain, and a leaf is only used if it was not removed in between:
+// a removed (node_type=3) node is indexed by path, not by key, so the path the leaf was found at is checked for removal
+// Storage is additionally treated as unset if its account does not exist at N, has an empty storage root at N,
+// or was removed in between (e.g. it self-destructed and was recreated)
+type StateRetriever struct {
+	db     *postgres.DB
+	blocks blockstore.Blockstore
+}
+
+// NewStateRetriever returns a pointer to a new StateRetriever
+func NewStateRetriever(db *postgres.DB) *StateRetriever {
+	return &StateRetriever{
+		db:     db,
+		blocks: blockstore.NewPostgresBlockstore(db.DB),
+	}
+}
+
+// SetBlockstore sets the blockstore the IPLD blocks are read from when public.blocks only records their keys
+func (r *StateRetriever) SetBlockstore(blocks blockstore.Blockstore) {
+	r.blocks = blocks
+}
+
+type stateLeafRow struct {
+	Path        []byte          `db:"state_path"`
+	NodeType    int             `db:"node_type"`
+	BlockNumber uint64          `db:"block_number"`
+	MhKey       string          `db:"mh_key"`
+	Data        blockstore.Data `db:"data"`
+}
+
+type storageLeafRow struct {
+	StatePath   []byte          `db:"state_path"`
+	Path        []byte          `db:"storage_path"`
+	NodeType    int             `db:"node_type"`
+	BlockNumber uint64          `db:"block_number"`
+	MhKey       string          `db:"mh_key"`
+	Data        blockstore.Data `db:"data"`
+}
+
+// CanonicalHeight returns the height of the block with the hash if it is on the canonical chain
+// It returns ErrNotCanonical otherwise
+func (r *StateRetriever) CanonicalHeight(blockHash common.Hash) (uint64, error) {
+	var height uint64
+	if err := r.db.Reader().Get(&height, canonicalHeightPgStr, blockHash.Hex(), r.db.Node.ChainID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrNotCanonical
+		}
+		return 0, err
+	}
+	return height, nil
+}
+
+// AccountAt returns the account at the address at the height, nil if it does not exist
+func (r *StateRetriever) AccountAt(address common.Address, height uint64) (*state.Account, error) {
+	return r.AccountByKey(crypto.Keccak256Hash(address.Bytes()), height)
+}
+
+// AccountByKey returns the account with the state leaf key at the height, nil if it does not exist
+func (r *StateRetriever) AccountByKey(stateKey common.Hash, height uint64) (*state.Account, error) {
+	row := new(stateLeafRow)
+	if err := r.db.Reader().Get(row, stateLeafPgStr, stateKey.Hex(), height, r.db.Node.ChainID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if eth.ResolveToNodeType(row.NodeType) == sdtypes.Removed {
+		return nil, nil
+	}
+	removed, err := r.stateRemoved(row.Path, row.BlockNumber, height)
+	if err != nil || removed {
+		return nil, err
+	}
+	data, err := blockstore.Load(r.blocks, row.MhKey, row.Data)
+	if err != nil {
+		return nil, err
+	}
+	return eth.DecodeStateLeafAccount(data)
+}
+
+// StorageAt returns the value of the storage slot of the account at the address at the height, nil if it is unset
+func (r *StateRetriever) StorageAt(address common.Address, slot common.Hash, height uint64) ([]byte, error) {
+	return r.StorageByKey(crypto.Keccak256Hash(address.Bytes()), crypto.Keccak256Hash(slot.Bytes()), height)
+}
+
+// StorageByKey returns the value of the storage leaf key of the account with the state leaf key at the height, nil if it is unset
+func (r *StateRetriever) StorageByKey(stateKey, storageKey common.Hash, height uint64) ([]byte, error) {
+	account, err := r.AccountByKey(stateKey, height)
+	if err != nil || account == nil || account.Root == types.EmptyRootHash {
+		return nil, err
+	}
+	row := new(storageLeafRow)
+	if err := r.db.Reader().Get(row, storageLeafPgStr, stateKey.Hex(), storageKey.Hex(), height, r.db.Node.ChainID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if eth.ResolveToNodeType(row.NodeType) == sdtypes.Removed {
+		return nil, nil
+	}
+	var removed bool
+	if err := r.db.Reader().Get(&removed, storageRemovedPgStr, stateKey.Hex(), row.Path, row.BlockNumber, height, r.db.Node.ChainID); err != nil {
+		return nil, err
+	}
+	if removed {
+		return nil, nil
+	}
+	// if the account was removed after the leaf was written, the leaf belongs to a previous incarnation of the account
+	if removed, err := r.stateRemoved(row.StatePath, row.BlockNumber, height); err != nil || removed {
+		return nil, err
+	}
+	data, err := blockstore.Load(r.blocks, row.MhKey, row.Data)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeStorageLeafValue(data)
+}
+
+func (r *StateRetriever) stateRemoved(path []byte, from, to uint64) (bool, error) {
+	var removed bool
+	err := r.db.Reader().Get(&removed, stateRemovedPgStr, path, from, to, r.db.Node.ChainID)
+	return removed, err
+}
+
+// DecodeStorageLeafValue decodes the slot value held in a storage leaf node
+func DecodeStorageLeafValue(leafNode []byte) ([]byte, error) {
+	leaf, err := eth.DecodeTrieNode(leafNode)
+	if err != nil {
+		return nil, err
+	}
+	if leaf.NodeType != sdtypes.Leaf {
+		return nil, fmt.Errorf("expected a leaf node, got node type %s", leaf.NodeType)
+	}
+	var value []byte
+	if err := rlp.DecodeBytes(leaf.Value, &value); err != nil {
+		return nil, fmt.Errorf("error decoding storage value rlp: %v", err)
+	}
+	return value, nil
+}
@@ -0,0 +1,201 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package lookup_test
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+	"github.com/ethereum/go-ethereum/trie"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/lookup"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+var (
+	contractPath = []byte{'\x06'}
+	contractKey  = common.BytesToHash(mocks.ContractLeafKey)
+	slot         = common.Hash{}
+)
+
+// newHeader returns a header at the height with the parent, extra distinguishes siblings
+func newHeader(height int64, parent common.Hash, extra byte) *types.Header {
+	header := mocks.MockHeader
+	header.Number = big.NewInt(height)
+	header.ParentHash = parent
+	header.Extra = []byte{extra}
+	return &header
+}
+
+// accountLeaf returns a state leaf node for the contract account with the balance
+func accountLeaf(balance int64) []byte {
+	account, err := rlp.EncodeToBytes(state.Account{
+		Balance:  big.NewInt(balance),
+		CodeHash: mocks.ContractCodeHash.Bytes(),
+		Root:     common.HexToHash(mocks.ContractRoot),
+	})
+	Expect(err).ToNot(HaveOccurred())
+	leaf, err := rlp.EncodeToBytes([]interface{}{mocks.ContractPartialPath, account})
+	Expect(err).ToNot(HaveOccurred())
+	return leaf
+}
+
+// storageLeaf returns a storage leaf node for slot 0 with the value
+func storageLeaf(value byte) []byte {
+	leaf, err := rlp.EncodeToBytes([]interface{}{mocks.StoragePartialPath, []byte{value}})
+	Expect(err).ToNot(HaveOccurred())
+	return leaf
+}
+
+var _ = Describe("StateRetriever", func() {
+	Describe("AccountAt and StorageAt", func() {
+		var (
+			db        *postgres.DB
+			publisher *eth.IPLDPublisher
+			retriever *lookup.StateRetriever
+		)
+
+		// publish indexes the header with the state nodes, and the contract's storage leaf with the value if it isn't 0
+		publish := func(header *types.Header, stateNodes []eth.TrieNode, storageValue byte) {
+			payload := eth.ConvertedPayload{
+				TotalDifficulty: header.Difficulty,
+				Block:           types.NewBlock(header, nil, nil, nil, new(trie.Trie)),
+				StateNodes:      stateNodes,
+			}
+			if storageValue != 0 {
+				payload.StorageNodes = map[string][]eth.TrieNode{
+					common.Bytes2Hex(contractPath): {{
+						LeafKey: common.BytesToHash(mocks.StorageLeafKey),
+						Path:    []byte{},
+						Value:   storageLeaf(storageValue),
+						Type:    sdtypes.Leaf,
+					}},
+				}
+			}
+			Expect(publisher.Publish(payload)).To(Succeed())
+		}
+		leafNode := func(balance int64) []eth.TrieNode {
+			return []eth.TrieNode{{LeafKey: contractKey, Path: contractPath, Value: accountLeaf(balance), Type: sdtypes.Leaf}}
+		}
+		removedNode := []eth.TrieNode{{Path: contractPath, Value: []byte{}, Type: sdtypes.Removed}}
+		balanceAt := func(height uint64) *big.Int {
+			account, err := retriever.AccountAt(mocks.ContractAddress, height)
+			Expect(err).ToNot(HaveOccurred())
+			if account == nil {
+				return nil
+			}
+			return account.Balance
+		}
+		storageAt := func(height uint64) []byte {
+			value, err := retriever.StorageAt(mocks.ContractAddress, slot, height)
+			Expect(err).ToNot(HaveOccurred())
+			return value
+		}
+
+		BeforeEach(func() {
+			var err error
+			db, err = shared.SetupDB()
+			Expect(err).ToNot(HaveOccurred())
+			publisher = eth.NewIPLDPublisher(db)
+			retriever = lookup.NewStateRetriever(db)
+		})
+		AfterEach(func() {
+			eth.TearDownDB(db)
+		})
+
+		It("Return the latest leaf at or below the height", func() {
+			header1 := newHeader(1, common.Hash{}, 0)
+			header2 := newHeader(2, header1.Hash(), 0)
+			header3 := newHeader(3, header2.Hash(), 0)
+			publish(header1, leafNode(100), 1)
+			publish(header2, nil, 0)
+			publish(header3, leafNode(300), 3)
+
+			Expect(balanceAt(0)).To(BeNil())
+			Expect(storageAt(0)).To(BeNil())
+			Expect(balanceAt(1)).To(Equal(big.NewInt(100)))
+			Expect(storageAt(1)).To(Equal([]byte{1}))
+			Expect(balanceAt(2)).To(Equal(big.NewInt(100)))
+			Expect(storageAt(2)).To(Equal([]byte{1}))
+			Expect(balanceAt(3)).To(Equal(big.NewInt(300)))
+			Expect(storageAt(3)).To(Equal([]byte{3}))
+		})
+
+		It("Return nothing if the account was removed between the leaf and the height", func() {
+			header1 := newHeader(1, common.Hash{}, 0)
+			header2 := newHeader(2, header1.Hash(), 0)
+			publish(header1, leafNode(100), 1)
+			publish(header2, removedNode, 0)
+
+			Expect(balanceAt(1)).To(Equal(big.NewInt(100)))
+			Expect(balanceAt(2)).To(BeNil())
+			Expect(balanceAt(3)).To(BeNil())
+		})
+
+		It("Hide the storage of a removed account, and of its previous incarnation once it is recreated", func() {
+			header1 := newHeader(1, common.Hash{}, 0)
+			header2 := newHeader(2, header1.Hash(), 0)
+			header3 := newHeader(3, header2.Hash(), 0)
+			publish(header1, leafNode(100), 1)
+			publish(header2, removedNode, 0)
+			publish(header3, leafNode(300), 0)
+
+			Expect(storageAt(1)).To(Equal([]byte{1}))
+			Expect(storageAt(2)).To(BeNil())
+			Expect(balanceAt(3)).To(Equal(big.NewInt(300)))
+			Expect(storageAt(3)).To(BeNil())
+		})
+
+		It("Ignore the state of non-canonical headers at the same height", func() {
+			header1 := newHeader(1, common.Hash{}, 0)
+			header2 := newHeader(2, header1.Hash(), 0)
+			uncle2 := newHeader(2, header1.Hash(), 1)
+			header3 := newHeader(3, header2.Hash(), 0)
+			publish(header1, leafNode(100), 1)
+			publish(header2, leafNode(200), 2)
+			publish(uncle2, leafNode(999), 9)
+			publish(header3, nil, 0)
+
+			Expect(balanceAt(2)).To(Equal(big.NewInt(200)))
+			Expect(storageAt(2)).To(Equal([]byte{2}))
+			Expect(balanceAt(3)).To(Equal(big.NewInt(200)))
+			Expect(storageAt(3)).To(Equal([]byte{2}))
+		})
+	})
+
+	Describe("DecodeStorageLeafValue", func() {
+		It("Decodes the slot value out of a storage leaf", func() {
+			value, err := lookup.DecodeStorageLeafValue(mocks.StorageLeafNode)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal(mocks.StorageValue))
+		})
+
+		It("Errors on nodes which are not leaves", func() {
+			_, err := lookup.DecodeStorageLeafValue([]byte{0x01})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,73 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build ignore
+// +build ignore
+
+// gen.go embeds the migration files of db/migrations in the binary, run it with `go generate ./pkg/migrations`
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	migrationsDir = "../../db/migrations"
+	outputFile    = "files.go"
+)
+
+func main() {
+	paths, err := filepath.Glob(filepath.Join(migrationsDir, "*.sql"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Strings(paths)
+	buf := new(bytes.Buffer)
+	buf.WriteString("// Code generated by gen.go from db/migrations; DO NOT EDIT.\n\n")
+	buf.WriteString("package migrations\n\n")
+	buf.WriteString("var files = []file{\n")
+	for _, path := range paths {
+		sql, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(buf, "\t{\n\t\tname: %q,\n\t\tsql: %s,\n\t},\n", filepath.Base(path), quote(string(sql)))
+	}
+	buf.WriteString("}\n")
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(outputFile, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// quote returns the sql as a raw string literal, so that the generated file reads like the migration
+func quote(sql string) string {
+	if strings.Contains(sql, "`") {
+		return strconv.Quote(sql)
+	}
+	return "`" + sql + "`"
+}
@@ -0,0 +1,123 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package migrations
+
+//go:generate go run gen.go
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goose annotations which split a migration into its up and down sections
+const (
+	annotationPrefix = "-- +goose"
+	upAnnotation     = "-- +goose Up"
+	downAnnotation   = "-- +goose Down"
+)
+
+// file is a migration file of db/migrations embedded by gen.go
+type file struct {
+	name string
+	sql  string
+}
+
+// Migration is a single schema migration, in the goose format of the files in db/migrations
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrations returns the migrations embedded in the binary, ordered by version
+func Migrations() ([]Migration, error) {
+	migrations := make([]Migration, 0, len(files))
+	versions := make(map[int64]string, len(files))
+	for _, f := range files {
+		migration, err := parse(f.name, f.sql)
+		if err != nil {
+			return nil, err
+		}
+		if dup, ok := versions[migration.Version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version %d", dup, migration.Name, migration.Version)
+		}
+		versions[migration.Version] = migration.Name
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// LatestVersion returns the schema version this binary expects the database to be at
+func LatestVersion() (int64, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// parse splits a migration file into its up and down sections
+// the version is the numeric prefix of the file name, e.g. 00015 for 00015_create_eth_code_cids_table.sql
+// goose statement annotations are dropped, since each section is executed as a single multi-statement query
+func parse(name, sql string) (Migration, error) {
+	migration := Migration{Name: name}
+	prefix := name
+	if i := strings.Index(name, "_"); i > 0 {
+		prefix = name[:i]
+	}
+	version, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil || version <= 0 {
+		return Migration{}, fmt.Errorf("migration %s does not start with a positive version number", name)
+	}
+	migration.Version = version
+	var up, down strings.Builder
+	var section *strings.Builder
+	var seenUp bool
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, upAnnotation):
+			section = &up
+			seenUp = true
+			continue
+		case strings.HasPrefix(trimmed, downAnnotation):
+			section = &down
+			continue
+		case strings.HasPrefix(trimmed, annotationPrefix):
+			continue
+		}
+		if section != nil {
+			section.WriteString(line)
+			section.WriteString("\n")
+		}
+	}
+	if !seenUp {
+		return Migration{}, fmt.Errorf("migration %s has no %q section", name, upAnnotation)
+	}
+	migration.Up = strings.TrimSpace(up.String())
+	migration.Down = strings.TrimSpace(down.String())
+	return migration, nil
+}
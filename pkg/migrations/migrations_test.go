@@ -0,0 +1,124 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package migrations_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/migrations"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+var _ = Describe("Migrations", func() {
+	Describe("Migrations", func() {
+		It("Embeds every migration in db/migrations", func() {
+			paths, err := filepath.Glob("../../db/migrations/*.sql")
+			Expect(err).ToNot(HaveOccurred())
+			embedded, err := migrations.Migrations()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(embedded)).To(Equal(len(paths)), "run `go generate ./pkg/migrations` to embed new migrations")
+			for i, path := range paths {
+				Expect(embedded[i].Name).To(Equal(filepath.Base(path)))
+				raw, err := ioutil.ReadFile(path)
+				Expect(err).ToNot(HaveOccurred())
+				// statement annotations are dropped from the embedded sections
+				sql := strings.NewReplacer("-- +goose StatementBegin\n", "", "-- +goose StatementEnd\n", "").Replace(string(raw))
+				Expect(sql).To(ContainSubstring(embedded[i].Up), "run `go generate ./pkg/migrations` to embed changed migrations")
+				Expect(sql).To(ContainSubstring(embedded[i].Down), "run `go generate ./pkg/migrations` to embed changed migrations")
+			}
+		})
+		It("Orders the migrations by version and splits them into their up and down sections", func() {
+			embedded, err := migrations.Migrations()
+			Expect(err).ToNot(HaveOccurred())
+			for i, migration := range embedded {
+				if i > 0 {
+					Expect(migration.Version).To(BeNumerically(">", embedded[i-1].Version))
+				}
+				Expect(migration.Up).ToNot(BeEmpty())
+				Expect(migration.Up).ToNot(ContainSubstring("+goose"))
+				Expect(migration.Down).ToNot(ContainSubstring("+goose"))
+			}
+			Expect(embedded[0].Version).To(Equal(int64(1)))
+			Expect(embedded[0].Up).To(HavePrefix("CREATE TABLE IF NOT EXISTS public.blocks"))
+			Expect(embedded[0].Down).To(Equal("DROP TABLE public.blocks;"))
+			Expect(strings.Count(embedded[11].Up, "CREATE FUNCTION")).To(Equal(1))
+		})
+	})
+
+	Describe("LatestVersion", func() {
+		It("Returns the version of the newest migration", func() {
+			embedded, err := migrations.Migrations()
+			Expect(err).ToNot(HaveOccurred())
+			version, err := migrations.LatestVersion()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(Equal(embedded[len(embedded)-1].Version))
+		})
+	})
+
+	Describe("Partitions", func() {
+		partitions := migrations.NewPartitions(nil, 100)
+		It("Finds the partition a height belongs to", func() {
+			Expect(partitions.Start(0)).To(Equal(uint64(0)))
+			Expect(partitions.Start(99)).To(Equal(uint64(0)))
+			Expect(partitions.Start(100)).To(Equal(uint64(100)))
+			Expect(partitions.Start(250)).To(Equal(uint64(200)))
+			Expect(partitions.Name("eth.header_cids", 200)).To(Equal("eth.header_cids_200_300"))
+		})
+		It("Returns the partitions which lie entirely within a block range", func() {
+			Expect(partitions.Covered([2]uint64{0, 99})).To(Equal([]uint64{0}))
+			Expect(partitions.Covered([2]uint64{0, 98})).To(BeEmpty())
+			Expect(partitions.Covered([2]uint64{1, 99})).To(BeEmpty())
+			Expect(partitions.Covered([2]uint64{50, 349})).To(Equal([]uint64{100, 200}))
+			Expect(partitions.Covered([2]uint64{100, 400})).To(Equal([]uint64{100, 200, 300}))
+		})
+		It("Doesn't partition with a partition size of 0", func() {
+			Expect(migrations.Partition(nil, 0)).To(MatchError("partition size must be greater than 0"))
+		})
+		It("Finds the test database without the partitioned layout", func() {
+			db, err := shared.SetupDB()
+			Expect(err).ToNot(HaveOccurred())
+			loaded, err := migrations.LoadPartitions(db.DB)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded).To(BeNil())
+		})
+	})
+
+	Describe("Migrator", func() {
+		It("Finds the test database at the latest version", func() {
+			db, err := shared.SetupDB()
+			Expect(err).ToNot(HaveOccurred())
+			migrator, err := migrations.NewMigrator(db.DB)
+			Expect(err).ToNot(HaveOccurred())
+			version, err := migrator.Version()
+			Expect(err).ToNot(HaveOccurred())
+			latest, err := migrations.LatestVersion()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(Equal(latest))
+			Expect(migrator.CheckVersion()).To(Succeed())
+			statuses, err := migrator.Status()
+			Expect(err).ToNot(HaveOccurred())
+			for _, status := range statuses {
+				Expect(status.Applied).To(BeTrue())
+			}
+		})
+	})
+})
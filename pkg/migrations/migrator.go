@@ -0,0 +1,209 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// versionTable is the table goose records the applied migrations in
+// migrations applied by this package and by the goose binary are interchangeable
+const versionTable = "public.goose_db_version"
+
+// Status is the state of a single migration in the database
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies the embedded migrations to a database
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+// NewMigrator creates a pointer to a new Migrator for the db
+func NewMigrator(db *sqlx.DB) (*Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// Version returns the schema version of the database, 0 if no migrations have been applied to it
+func (m *Migrator) Version() (int64, error) {
+	exists, err := m.versionTableExists()
+	if err != nil || !exists {
+		return 0, err
+	}
+	rows, err := m.db.Query(`SELECT version_id, is_applied FROM ` + versionTable + ` ORDER BY id DESC`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	// the most recent row of a version says whether it is applied, the current version is the latest applied one
+	rolledBack := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		var applied bool
+		if err := rows.Scan(&version, &applied); err != nil {
+			return 0, err
+		}
+		if rolledBack[version] {
+			continue
+		}
+		if applied {
+			return version, nil
+		}
+		rolledBack[version] = true
+	}
+	return 0, rows.Err()
+}
+
+// Up applies every migration newer than the database's version, each in its own transaction
+// It returns the migrations which were applied
+func (m *Migrator) Up() ([]Migration, error) {
+	if err := m.createVersionTable(); err != nil {
+		return nil, err
+	}
+	current, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+	applied := make([]Migration, 0)
+	for _, migration := range m.migrations {
+		if migration.Version <= current {
+			continue
+		}
+		if err := m.apply(migration.Up, migration.Version, true); err != nil {
+			return applied, fmt.Errorf("error applying migration %s: %v", migration.Name, err)
+		}
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+// Down rolls back the migration at the database's version
+// It returns the migration which was rolled back
+func (m *Migrator) Down() (Migration, error) {
+	current, err := m.Version()
+	if err != nil {
+		return Migration{}, err
+	}
+	if current == 0 {
+		return Migration{}, fmt.Errorf("no migrations to roll back")
+	}
+	for _, migration := range m.migrations {
+		if migration.Version != current {
+			continue
+		}
+		if err := m.apply(migration.Down, migration.Version, false); err != nil {
+			return Migration{}, fmt.Errorf("error rolling back migration %s: %v", migration.Name, err)
+		}
+		return migration, nil
+	}
+	return Migration{}, fmt.Errorf("database is at version %d which is not a known migration", current)
+}
+
+// Status returns the state of every embedded migration in the database
+func (m *Migrator) Status() ([]Status, error) {
+	exists, err := m.versionTableExists()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if exists {
+			var appliedAt sql.NullTime
+			err := m.db.QueryRow(`SELECT is_applied, tstamp FROM `+versionTable+` WHERE version_id = $1 ORDER BY id DESC LIMIT 1`,
+				migration.Version).Scan(&status.Applied, &appliedAt)
+			if err != nil && err != sql.ErrNoRows {
+				return nil, err
+			}
+			status.AppliedAt = appliedAt.Time
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// CheckVersion returns an error if the database is not at the schema version this binary expects
+func (m *Migrator) CheckVersion() error {
+	current, err := m.Version()
+	if err != nil {
+		return fmt.Errorf("unable to read the database schema version: %v", err)
+	}
+	expected := int64(0)
+	if len(m.migrations) > 0 {
+		expected = m.migrations[len(m.migrations)-1].Version
+	}
+	switch {
+	case current < expected:
+		return fmt.Errorf("database schema is at version %d but this binary requires version %d, run `ipld-eth-indexer migrate up` to migrate it", current, expected)
+	case current > expected:
+		return fmt.Errorf("database schema is at version %d which is newer than the version %d this binary supports, upgrade the binary or run `migrate down` with a newer binary", current, expected)
+	}
+	return nil
+}
+
+func (m *Migrator) apply(statements string, version int64, up bool) error {
+	tx, err := m.db.Beginx()
+	if err != nil {
+		return err
+	}
+	if statements != "" {
+		if _, err := tx.Exec(statements); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO `+versionTable+` (version_id, is_applied) VALUES ($1, $2)`, version, up); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) versionTableExists() (bool, error) {
+	var exists bool
+	err := m.db.Get(&exists, `SELECT to_regclass($1) IS NOT NULL`, versionTable)
+	return exists, err
+}
+
+// createVersionTable creates the version table the way goose does, if it doesn't exist yet
+func (m *Migrator) createVersionTable() error {
+	exists, err := m.versionTableExists()
+	if err != nil || exists {
+		return err
+	}
+	return m.apply(`CREATE TABLE `+versionTable+` (
+		id SERIAL PRIMARY KEY,
+		version_id BIGINT NOT NULL,
+		is_applied BOOLEAN NOT NULL,
+		tstamp TIMESTAMP DEFAULT now()
+	)`, 0, true)
+}
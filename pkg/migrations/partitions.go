@@ -0,0 +1,432 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package migrations
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// layoutTable records the partition size of a database with the partitioned layout, it only exists in such a database
+const layoutTable = "eth.partition_layout"
+
+// partitionLockID is the advisory lock that serializes the creation of partitions across indexers
+const partitionLockID = 4613580214733108429
+
+// PartitionedTables are the eth tables which are partitioned by block_number range in the partitioned layout
+// tables are ordered before the tables which reference them
+var PartitionedTables = []string{
+	"eth.header_cids",
+	"eth.uncle_cids",
+	"eth.transaction_cids",
+	"eth.receipt_cids",
+	"eth.trace_cids",
+	"eth.state_cids",
+	"eth.state_accounts",
+	"eth.storage_cids",
+}
+
+// storedFunctionMigrations are the migrations defining the stored functions and types over eth.header_cids rows
+// these depend on the table, so they are dropped and reapplied around rebuilding it
+var storedFunctionMigrations = []int64{14, 20, 23}
+
+// Partition rebuilds the eth tables with the partitioned layout, where the tables are partitioned by ranges of size block numbers
+// it only converts a database at the latest schema version, before anything has been indexed into it
+func Partition(db *sqlx.DB, size uint64) error {
+	if size == 0 {
+		return fmt.Errorf("partition size must be greater than 0")
+	}
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	if err := migrator.CheckVersion(); err != nil {
+		return err
+	}
+	partitioned, err := isPartitioned(db)
+	if err != nil {
+		return err
+	}
+	if partitioned {
+		return fmt.Errorf("eth tables are already partitioned")
+	}
+	var indexed bool
+	if err := db.Get(&indexed, `SELECT EXISTS (SELECT 1 FROM eth.header_cids)`); err != nil {
+		return err
+	}
+	if indexed {
+		return fmt.Errorf("eth tables can only be partitioned before anything is indexed into them")
+	}
+	functions := make([]Migration, 0, len(storedFunctionMigrations))
+	for _, version := range storedFunctionMigrations {
+		for _, migration := range migrator.migrations {
+			if migration.Version == version {
+				functions = append(functions, migration)
+			}
+		}
+	}
+	statements := make([]string, 0)
+	for i := len(functions) - 1; i >= 0; i-- {
+		statements = append(statements, functions[i].Down)
+	}
+	statements = append(statements, `ALTER TABLE eth.code_cids DROP CONSTRAINT code_cids_header_id_fkey`)
+	for i := len(PartitionedTables) - 1; i >= 0; i-- {
+		statements = append(statements, `DROP TABLE `+PartitionedTables[i])
+	}
+	statements = append(statements, partitionedTablesDDL,
+		`ALTER TABLE eth.code_cids ADD CONSTRAINT code_cids_header_id_fkey FOREIGN KEY (header_id, block_number)
+		REFERENCES eth.header_cids (id, block_number) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED`)
+	for _, migration := range functions {
+		statements = append(statements, migration.Up)
+	}
+	statements = append(statements, `CREATE TABLE `+layoutTable+` (partition_size BIGINT NOT NULL CHECK (partition_size > 0))`,
+		fmt.Sprintf(`INSERT INTO `+layoutTable+` (partition_size) VALUES (%d)`, size))
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Partitions creates and replaces the block range partitions of a database with the partitioned layout
+type Partitions struct {
+	db      *sqlx.DB
+	size    uint64
+	mu      sync.Mutex
+	created map[uint64]bool
+}
+
+// LoadPartitions returns the Partitions of the database, or nil if it doesn't have the partitioned layout
+func LoadPartitions(db *sqlx.DB) (*Partitions, error) {
+	partitioned, err := isPartitioned(db)
+	if err != nil || !partitioned {
+		return nil, err
+	}
+	var size uint64
+	if err := db.Get(&size, `SELECT partition_size FROM `+layoutTable); err != nil {
+		return nil, err
+	}
+	return NewPartitions(db, size), nil
+}
+
+// NewPartitions creates a pointer to new Partitions of the given size for the db
+func NewPartitions(db *sqlx.DB, size uint64) *Partitions {
+	return &Partitions{
+		db:      db,
+		size:    size,
+		created: make(map[uint64]bool),
+	}
+}
+
+// Size returns the number of block numbers each partition holds
+func (p *Partitions) Size() uint64 {
+	return p.size
+}
+
+// Start returns the first block number of the partition which holds the height
+func (p *Partitions) Start(height uint64) uint64 {
+	return height - height%p.size
+}
+
+// Covered returns the starts of the partitions which lie entirely within the inclusive block range
+func (p *Partitions) Covered(rng [2]uint64) []uint64 {
+	starts := make([]uint64, 0)
+	start := p.Start(rng[0])
+	if start < rng[0] {
+		start += p.size
+	}
+	for ; start+p.size-1 <= rng[1] && start >= rng[0]; start += p.size {
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+// Ensure creates the partitions which hold the height, and the ones after them, if they don't exist yet
+// creating the next partitions ahead of time keeps partition creation, which locks the tables, away from the chain head
+// it has to be called outside of the transaction that indexes the height
+func (p *Partitions) Ensure(height uint64) error {
+	start := p.Start(height)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.created[start] {
+		return nil
+	}
+	tx, err := p.db.Beginx()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, partitionLockID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, s := range []uint64{start, start + p.size} {
+		if err := p.create(tx, s, PartitionedTables); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	p.created[start] = true
+	return nil
+}
+
+// Reset replaces the partitions of the tables which start at start with empty ones, instead of deleting their rows
+// tables are reset in the order given, so tables have to come before the tables they reference
+func (p *Partitions) Reset(tx *sqlx.Tx, start uint64, tables []string) error {
+	for _, table := range tables {
+		name := p.Name(table, start)
+		if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s DETACH PARTITION %s`, table, name)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DROP TABLE ` + name); err != nil {
+			return err
+		}
+	}
+	return p.create(tx, start, tables)
+}
+
+// Name returns the name of the partition of the table which starts at start
+func (p *Partitions) Name(table string, start uint64) string {
+	return fmt.Sprintf("%s_%d_%d", table, start, start+p.size)
+}
+
+func (p *Partitions) create(tx *sqlx.Tx, start uint64, tables []string) error {
+	for _, table := range tables {
+		if _, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM (%d) TO (%d)`,
+			p.Name(table, start), table, start, start+p.size)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isPartitioned(db *sqlx.DB) (bool, error) {
+	var partitioned bool
+	err := db.Get(&partitioned, `SELECT to_regclass($1) IS NOT NULL`, layoutTable)
+	return partitioned, err
+}
+
+// partitionedTablesDDL creates the PartitionedTables as they are after the latest migration, partitioned by block_number range
+// primary keys and foreign keys between the tables include block_number, as keys of partitioned tables have to include the partition key
+const partitionedTablesDDL = `
+CREATE TABLE eth.header_cids (
+  id                    SERIAL,
+  block_number          BIGINT NOT NULL,
+  block_hash            VARCHAR(66) NOT NULL,
+  parent_hash           VARCHAR(66) NOT NULL,
+  cid                   TEXT NOT NULL,
+  mh_key                TEXT NOT NULL REFERENCES public.blocks (key) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+  td                    NUMERIC NOT NULL,
+  node_id               INTEGER NOT NULL REFERENCES nodes (id) ON DELETE CASCADE,
+  reward                NUMERIC NOT NULL,
+  state_root            VARCHAR(66) NOT NULL,
+  tx_root               VARCHAR(66) NOT NULL,
+  receipt_root          VARCHAR(66) NOT NULL,
+  uncle_root            VARCHAR(66) NOT NULL,
+  bloom                 BYTEA NOT NULL,
+  timestamp             NUMERIC NOT NULL,
+  times_validated       INTEGER NOT NULL DEFAULT 1,
+  chain_id              INTEGER NOT NULL,
+  PRIMARY KEY (id, block_number),
+  UNIQUE (chain_id, block_number, block_hash)
+) PARTITION BY RANGE (block_number);
+
+CREATE TABLE eth.uncle_cids (
+  id                    SERIAL,
+  header_id             INTEGER NOT NULL,
+  block_hash            VARCHAR(66) NOT NULL,
+  parent_hash           VARCHAR(66) NOT NULL,
+  cid                   TEXT NOT NULL,
+  mh_key                TEXT NOT NULL REFERENCES public.blocks (key) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+  reward                NUMERIC NOT NULL,
+  block_number          BIGINT NOT NULL,
+  PRIMARY KEY (id, block_number),
+  UNIQUE (header_id, block_hash, block_number),
+  CONSTRAINT uncle_cids_header_id_fkey FOREIGN KEY (header_id, block_number) REFERENCES eth.header_cids (id, block_number) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED
+) PARTITION BY RANGE (block_number);
+
+CREATE TABLE eth.transaction_cids (
+  id                    SERIAL,
+  header_id             INTEGER NOT NULL,
+  tx_hash               VARCHAR(66) NOT NULL,
+  index                 INTEGER NOT NULL,
+  cid                   TEXT NOT NULL,
+  mh_key                TEXT NOT NULL REFERENCES public.blocks (key) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+  dst                   VARCHAR(66) NOT NULL,
+  src                   VARCHAR(66) NOT NULL,
+  tx_data               BYTEA,
+  block_number          BIGINT NOT NULL,
+  PRIMARY KEY (id, block_number),
+  UNIQUE (header_id, tx_hash, block_number),
+  CONSTRAINT transaction_cids_header_id_fkey FOREIGN KEY (header_id, block_number) REFERENCES eth.header_cids (id, block_number) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED
+) PARTITION BY RANGE (block_number);
+
+CREATE TABLE eth.receipt_cids (
+  id                    SERIAL,
+  tx_id                 INTEGER NOT NULL,
+  cid                   TEXT NOT NULL,
+  mh_key                TEXT NOT NULL REFERENCES public.blocks (key) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+  contract              VARCHAR(66),
+  contract_hash         VARCHAR(66),
+  topic0s               VARCHAR(66)[],
+  topic1s               VARCHAR(66)[],
+  topic2s               VARCHAR(66)[],
+  topic3s               VARCHAR(66)[],
+  log_contracts         VARCHAR(66)[],
+  post_state            VARCHAR(66),
+  post_status           INTEGER,
+  block_number          BIGINT NOT NULL,
+  PRIMARY KEY (id, block_number),
+  UNIQUE (tx_id, block_number),
+  CONSTRAINT receipt_cids_tx_id_fkey FOREIGN KEY (tx_id, block_number) REFERENCES eth.transaction_cids (id, block_number) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED
+) PARTITION BY RANGE (block_number);
+
+CREATE TABLE eth.trace_cids (
+  id                    SERIAL,
+  tx_id                 INTEGER NOT NULL,
+  index                 INTEGER NOT NULL,
+  depth                 INTEGER NOT NULL,
+  call_type             VARCHAR(16) NOT NULL,
+  src                   VARCHAR(66) NOT NULL,
+  dst                   VARCHAR(66) NOT NULL,
+  value                 NUMERIC,
+  input_selector        VARCHAR(10),
+  gas                   BIGINT NOT NULL,
+  gas_used              BIGINT NOT NULL,
+  error                 TEXT,
+  cid                   TEXT NOT NULL,
+  mh_key                TEXT NOT NULL REFERENCES public.blocks (key) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+  block_number          BIGINT NOT NULL,
+  PRIMARY KEY (id, block_number),
+  UNIQUE (tx_id, index, block_number),
+  CONSTRAINT trace_cids_tx_id_fkey FOREIGN KEY (tx_id, block_number) REFERENCES eth.transaction_cids (id, block_number) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED
+) PARTITION BY RANGE (block_number);
+
+CREATE TABLE eth.state_cids (
+  id                    BIGSERIAL,
+  header_id             INTEGER NOT NULL,
+  state_leaf_key        VARCHAR(66),
+  cid                   TEXT NOT NULL,
+  mh_key                TEXT NOT NULL REFERENCES public.blocks (key) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+  state_path            BYTEA,
+  node_type             INTEGER NOT NULL,
+  diff                  BOOLEAN NOT NULL DEFAULT FALSE,
+  block_number          BIGINT NOT NULL,
+  PRIMARY KEY (id, block_number),
+  UNIQUE (header_id, state_path, block_number),
+  CONSTRAINT state_cids_header_id_fkey FOREIGN KEY (header_id, block_number) REFERENCES eth.header_cids (id, block_number) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED
+) PARTITION BY RANGE (block_number);
+
+CREATE TABLE eth.state_accounts (
+  id                    SERIAL,
+  state_id              BIGINT NOT NULL,
+  balance               NUMERIC NOT NULL,
+  nonce                 INTEGER NOT NULL,
+  code_hash             BYTEA NOT NULL,
+  storage_root          VARCHAR(66) NOT NULL,
+  block_number          BIGINT NOT NULL,
+  PRIMARY KEY (id, block_number),
+  UNIQUE (state_id, block_number),
+  CONSTRAINT state_accounts_state_id_fkey FOREIGN KEY (state_id, block_number) REFERENCES eth.state_cids (id, block_number) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED
+) PARTITION BY RANGE (block_number);
+
+CREATE TABLE eth.storage_cids (
+  id                    BIGSERIAL,
+  state_id              BIGINT NOT NULL,
+  storage_leaf_key      VARCHAR(66),
+  cid                   TEXT NOT NULL,
+  mh_key                TEXT NOT NULL REFERENCES public.blocks (key) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+  storage_path          BYTEA,
+  node_type             INTEGER NOT NULL,
+  diff                  BOOLEAN NOT NULL DEFAULT FALSE,
+  block_number          BIGINT NOT NULL,
+  PRIMARY KEY (id, block_number),
+  UNIQUE (state_id, storage_path, block_number),
+  CONSTRAINT storage_cids_state_id_fkey FOREIGN KEY (state_id, block_number) REFERENCES eth.state_cids (id, block_number) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED
+) PARTITION BY RANGE (block_number);
+
+CREATE INDEX block_number_index ON eth.header_cids USING brin (block_number);
+CREATE INDEX block_hash_index ON eth.header_cids USING btree (block_hash);
+CREATE INDEX header_cid_index ON eth.header_cids USING btree (cid);
+CREATE INDEX header_mh_index ON eth.header_cids USING btree (mh_key);
+CREATE INDEX state_root_index ON eth.header_cids USING btree (state_root);
+CREATE INDEX timestamp_index ON eth.header_cids USING brin (timestamp);
+
+CREATE INDEX tx_header_id_index ON eth.transaction_cids USING btree (header_id);
+CREATE INDEX tx_hash_index ON eth.transaction_cids USING btree (tx_hash);
+CREATE INDEX tx_cid_index ON eth.transaction_cids USING btree (cid);
+CREATE INDEX tx_mh_index ON eth.transaction_cids USING btree (mh_key);
+CREATE INDEX tx_dst_index ON eth.transaction_cids USING btree (dst);
+CREATE INDEX tx_src_index ON eth.transaction_cids USING btree (src);
+
+CREATE INDEX rct_tx_id_index ON eth.receipt_cids USING btree (tx_id);
+CREATE INDEX rct_cid_index ON eth.receipt_cids USING btree (cid);
+CREATE INDEX rct_mh_index ON eth.receipt_cids USING btree (mh_key);
+CREATE INDEX rct_contract_index ON eth.receipt_cids USING btree (contract);
+CREATE INDEX rct_contract_hash_index ON eth.receipt_cids USING btree (contract_hash);
+CREATE INDEX rct_topic0_index ON eth.receipt_cids USING gin (topic0s);
+CREATE INDEX rct_topic1_index ON eth.receipt_cids USING gin (topic1s);
+CREATE INDEX rct_topic2_index ON eth.receipt_cids USING gin (topic2s);
+CREATE INDEX rct_topic3_index ON eth.receipt_cids USING gin (topic3s);
+CREATE INDEX rct_log_contract_index ON eth.receipt_cids USING gin (log_contracts);
+
+CREATE INDEX trace_src_index ON eth.trace_cids USING btree (src);
+CREATE INDEX trace_dst_index ON eth.trace_cids USING btree (dst);
+CREATE INDEX trace_input_selector_index ON eth.trace_cids USING btree (input_selector);
+CREATE INDEX trace_mh_index ON eth.trace_cids USING btree (mh_key);
+
+CREATE INDEX state_header_id_index ON eth.state_cids USING btree (header_id);
+CREATE INDEX state_leaf_key_index ON eth.state_cids USING btree (state_leaf_key);
+CREATE INDEX state_cid_index ON eth.state_cids USING btree (cid);
+CREATE INDEX state_mh_index ON eth.state_cids USING btree (mh_key);
+CREATE INDEX state_path_index ON eth.state_cids USING btree (state_path);
+
+CREATE INDEX storage_state_id_index ON eth.storage_cids USING btree (state_id);
+CREATE INDEX storage_leaf_key_index ON eth.storage_cids USING btree (storage_leaf_key);
+CREATE INDEX storage_cid_index ON eth.storage_cids USING btree (cid);
+CREATE INDEX storage_mh_index ON eth.storage_cids USING btree (mh_key);
+CREATE INDEX storage_path_index ON eth.storage_cids USING btree (storage_path);
+
+CREATE INDEX account_state_id_index ON eth.state_accounts USING btree (state_id);
+CREATE INDEX storage_root_index ON eth.state_accounts USING btree (storage_root);
+CREATE INDEX account_code_hash_index ON eth.state_accounts USING btree (code_hash);
+
+CREATE TRIGGER header_cids_ai after INSERT ON eth.header_cids for each row execute procedure eth.graphql_subscription('header_cids', 'id');
+CREATE TRIGGER uncle_cids_ai after INSERT ON eth.uncle_cids for each row execute procedure eth.graphql_subscription('uncle_cids', 'id');
+CREATE TRIGGER transaction_cids_ai after INSERT ON eth.transaction_cids for each row execute procedure eth.graphql_subscription('transaction_cids', 'id');
+CREATE TRIGGER receipt_cids_ai after INSERT ON eth.receipt_cids for each row execute procedure eth.graphql_subscription('receipt_cids', 'id');
+CREATE TRIGGER trace_cids_ai after INSERT ON eth.trace_cids for each row execute procedure eth.graphql_subscription('trace_cids', 'id');
+CREATE TRIGGER state_cids_ai after INSERT ON eth.state_cids for each row execute procedure eth.graphql_subscription('state_cids', 'id');
+CREATE TRIGGER state_accounts_ai after INSERT ON eth.state_accounts for each row execute procedure eth.graphql_subscription('state_accounts', 'id');
+CREATE TRIGGER storage_cids_ai after INSERT ON eth.storage_cids for each row execute procedure eth.graphql_subscription('storage_cids', 'id');
+
+COMMENT ON TABLE eth.header_cids IS E'@name EthHeaderCids';
+COMMENT ON COLUMN eth.header_cids.node_id IS E'@name EthNodeID';
+COMMENT ON TABLE eth.transaction_cids IS E'@name EthTransactionCids';
+COMMENT ON TABLE eth.trace_cids IS E'@name EthTraceCids';
+`
@@ -17,7 +17,8 @@
 package postgres
 
 import (
-	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/viper"
 )
@@ -32,8 +33,21 @@ const (
 	DATABASE_MAX_IDLE_CONNECTIONS = "DATABASE_MAX_IDLE_CONNECTIONS"
 	DATABASE_MAX_OPEN_CONNECTIONS = "DATABASE_MAX_OPEN_CONNECTIONS"
 	DATABASE_MAX_CONN_LIFETIME    = "DATABASE_MAX_CONN_LIFETIME"
+	DATABASE_SSL_MODE             = "DATABASE_SSL_MODE"
+	DATABASE_SSL_ROOT_CERT        = "DATABASE_SSL_ROOT_CERT"
+	DATABASE_SSL_CERT             = "DATABASE_SSL_CERT"
+	DATABASE_SSL_KEY              = "DATABASE_SSL_KEY"
+	DATABASE_APPLICATION_NAME     = "DATABASE_APPLICATION_NAME"
+	DATABASE_STATEMENT_TIMEOUT    = "DATABASE_STATEMENT_TIMEOUT"
+	DATABASE_SEARCH_PATH          = "DATABASE_SEARCH_PATH"
+	DATABASE_DSN                  = "DATABASE_DSN"
+	DATABASE_REPLICA_DSN          = "DATABASE_REPLICA_DSN"
+	DATABASE_MAX_REPLICA_LAG      = "DATABASE_MAX_REPLICA_LAG"
 )
 
+// defaultSSLMode is the sslmode used when none is configured
+const defaultSSLMode = "disable"
+
 type Config struct {
 	Hostname    string
 	Name        string
@@ -43,18 +57,71 @@ type Config struct {
 	MaxIdle     int
 	MaxOpen     int
 	MaxLifetime int
+
+	// TLS settings, SSLMode defaults to disable
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+
+	// run-time parameters set on every connection
+	ApplicationName  string
+	StatementTimeout string
+	SearchPath       string
+
+	// DSN is used as the connection string as is, instead of the settings above, if it is set
+	DSN string
+
+	// ReplicaDSN is the connection string of a read replica that read-only queries are routed to, if it is set
+	// MaxReplicaLag is the replication lag, in seconds, past which they fall back to the primary; it defaults to 30
+	ReplicaDSN    string
+	MaxReplicaLag int
 }
 
+// DbConnectionString returns the connection string for the config, in the keyword/value format of libpq
+// a Hostname starting with a / is the directory of the unix socket to connect over
 func DbConnectionString(config Config) string {
-	if len(config.User) > 0 && len(config.Password) > 0 {
-		return fmt.Sprintf("postgresql://%s:%s@%s:%d/%s?sslmode=disable",
-			config.User, config.Password, config.Hostname, config.Port, config.Name)
+	if config.DSN != "" {
+		return config.DSN
+	}
+	sslMode := config.SSLMode
+	if sslMode == "" {
+		sslMode = defaultSSLMode
 	}
-	if len(config.User) > 0 && len(config.Password) == 0 {
-		return fmt.Sprintf("postgresql://%s@%s:%d/%s?sslmode=disable",
-			config.User, config.Hostname, config.Port, config.Name)
+	var port string
+	if config.Port > 0 {
+		port = strconv.Itoa(config.Port)
+	}
+	params := [][2]string{
+		{"host", config.Hostname},
+		{"port", port},
+		{"user", config.User},
+		{"password", config.Password},
+		{"dbname", config.Name},
+		{"sslmode", sslMode},
+		{"sslrootcert", config.SSLRootCert},
+		{"sslcert", config.SSLCert},
+		{"sslkey", config.SSLKey},
+		{"application_name", config.ApplicationName},
+		{"statement_timeout", config.StatementTimeout},
+		{"search_path", config.SearchPath},
+	}
+	pairs := make([]string, 0, len(params))
+	for _, param := range params {
+		if param[1] == "" {
+			continue
+		}
+		pairs = append(pairs, param[0]+"="+quoteParam(param[1]))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// quoteParam quotes a connection string value if it contains spaces, quotes, or backslashes
+func quoteParam(value string) string {
+	if !strings.ContainsAny(value, ` '\`) {
+		return value
 	}
-	return fmt.Sprintf("postgresql://%s:%d/%s?sslmode=disable", config.Hostname, config.Port, config.Name)
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
 }
 
 func (d *Config) Init() {
@@ -66,6 +133,16 @@ func (d *Config) Init() {
 	viper.BindEnv("database.maxIdle", DATABASE_MAX_IDLE_CONNECTIONS)
 	viper.BindEnv("database.maxOpen", DATABASE_MAX_OPEN_CONNECTIONS)
 	viper.BindEnv("database.maxLifetime", DATABASE_MAX_CONN_LIFETIME)
+	viper.BindEnv("database.sslMode", DATABASE_SSL_MODE)
+	viper.BindEnv("database.sslRootCert", DATABASE_SSL_ROOT_CERT)
+	viper.BindEnv("database.sslCert", DATABASE_SSL_CERT)
+	viper.BindEnv("database.sslKey", DATABASE_SSL_KEY)
+	viper.BindEnv("database.applicationName", DATABASE_APPLICATION_NAME)
+	viper.BindEnv("database.statementTimeout", DATABASE_STATEMENT_TIMEOUT)
+	viper.BindEnv("database.searchPath", DATABASE_SEARCH_PATH)
+	viper.BindEnv("database.dsn", DATABASE_DSN)
+	viper.BindEnv("database.replicaDSN", DATABASE_REPLICA_DSN)
+	viper.BindEnv("database.maxReplicaLag", DATABASE_MAX_REPLICA_LAG)
 
 	d.Name = viper.GetString("database.name")
 	d.Hostname = viper.GetString("database.hostname")
@@ -75,4 +152,14 @@ func (d *Config) Init() {
 	d.MaxIdle = viper.GetInt("database.maxIdle")
 	d.MaxOpen = viper.GetInt("database.maxOpen")
 	d.MaxLifetime = viper.GetInt("database.maxLifetime")
+	d.SSLMode = viper.GetString("database.sslMode")
+	d.SSLRootCert = viper.GetString("database.sslRootCert")
+	d.SSLCert = viper.GetString("database.sslCert")
+	d.SSLKey = viper.GetString("database.sslKey")
+	d.ApplicationName = viper.GetString("database.applicationName")
+	d.StatementTimeout = viper.GetString("database.statementTimeout")
+	d.SearchPath = viper.GetString("database.searchPath")
+	d.DSN = viper.GetString("database.dsn")
+	d.ReplicaDSN = viper.GetString("database.replicaDSN")
+	d.MaxReplicaLag = viper.GetInt("database.maxReplicaLag")
 }
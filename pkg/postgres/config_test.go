@@ -22,6 +22,8 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
 )
 
 var vulcanizeConfig = []byte(`
@@ -46,3 +48,43 @@ var _ = Describe("Loading the config", func() {
 	})
 
 })
+
+var _ = Describe("DbConnectionString", func() {
+	It("builds a keyword/value connection string with sslmode disabled by default", func() {
+		connStr := postgres.DbConnectionString(postgres.Config{
+			Hostname: "localhost",
+			Port:     5432,
+			Name:     "vulcanize_public",
+			User:     "postgres",
+		})
+		Expect(connStr).To(Equal("host=localhost port=5432 user=postgres dbname=vulcanize_public sslmode=disable"))
+	})
+
+	It("includes the TLS settings and run-time parameters, quoting values where needed", func() {
+		connStr := postgres.DbConnectionString(postgres.Config{
+			Hostname:         "/var/run/postgresql",
+			Name:             "vulcanize_public",
+			User:             "indexer",
+			Password:         `it's a \secret`,
+			SSLMode:          "verify-full",
+			SSLRootCert:      "/etc/ssl/ca.pem",
+			SSLCert:          "/etc/ssl/client.pem",
+			SSLKey:           "/etc/ssl/client.key",
+			ApplicationName:  "ipld-eth-indexer",
+			StatementTimeout: "30s",
+			SearchPath:       "eth, public",
+		})
+		Expect(connStr).To(Equal(`host=/var/run/postgresql user=indexer password='it\'s a \\secret' dbname=vulcanize_public sslmode=verify-full ` +
+			`sslrootcert=/etc/ssl/ca.pem sslcert=/etc/ssl/client.pem sslkey=/etc/ssl/client.key ` +
+			`application_name=ipld-eth-indexer statement_timeout=30s search_path='eth, public'`))
+	})
+
+	It("uses the DSN as is if it is set", func() {
+		connStr := postgres.DbConnectionString(postgres.Config{
+			Hostname: "localhost",
+			Port:     5432,
+			DSN:      "postgresql://indexer@db.example.com:5432/vulcanize_public?sslmode=verify-full",
+		})
+		Expect(connStr).To(Equal("postgresql://indexer@db.example.com:5432/vulcanize_public?sslmode=verify-full"))
+	})
+})
@@ -21,11 +21,12 @@ import (
 )
 
 const (
-	BeginTransactionFailedMsg = "failed to begin transaction"
-	DbConnectionFailedMsg     = "db connection failed"
-	DeleteQueryFailedMsg      = "delete query failed"
-	InsertQueryFailedMsg      = "insert query failed"
-	SettingNodeFailedMsg      = "unable to set db node"
+	BeginTransactionFailedMsg  = "failed to begin transaction"
+	DbConnectionFailedMsg      = "db connection failed"
+	DeleteQueryFailedMsg       = "delete query failed"
+	InsertQueryFailedMsg       = "insert query failed"
+	ReplicaConnectionFailedMsg = "replica db connection failed"
+	SettingNodeFailedMsg       = "unable to set db node"
 )
 
 func ErrBeginTransactionFailed(beginErr error) error {
@@ -44,6 +45,10 @@ func ErrDBInsertFailed(insertErr error) error {
 	return formatError(InsertQueryFailedMsg, insertErr.Error())
 }
 
+func ErrReplicaConnectionFailed(connectErr error) error {
+	return formatError(ReplicaConnectionFailedMsg, connectErr.Error())
+}
+
 func ErrUnableToSetNode(setErr error) error {
 	return formatError(SettingNodeFailedMsg, setErr.Error())
 }
@@ -27,8 +27,9 @@ import (
 
 type DB struct {
 	*sqlx.DB
-	Node   node.Info
-	NodeID int64
+	Node    node.Info
+	NodeID  int64
+	replica *replica
 }
 
 func NewDB(databaseConfig Config, node node.Info, createNode bool) (*DB, error) {
@@ -38,6 +39,32 @@ func NewDB(databaseConfig Config, node node.Info, createNode bool) (*DB, error)
 		return &DB{}, ErrDBConnectionFailed(connectErr)
 	}
 	prom.RegisterDBCollector(databaseConfig.Name, db)
+	setPoolLimits(db, databaseConfig)
+	pg := DB{DB: db, Node: node}
+
+	// the replica isn't pinged here, reads fall back to the primary for as long as it can't be reached
+	if databaseConfig.ReplicaDSN != "" {
+		replicaDB, err := sqlx.Open("postgres", databaseConfig.ReplicaDSN)
+		if err != nil {
+			db.Close()
+			return &DB{}, ErrReplicaConnectionFailed(err)
+		}
+		prom.RegisterDBCollector(databaseConfig.Name+"_replica", replicaDB)
+		setPoolLimits(replicaDB, databaseConfig)
+		pg.replica = newReplica(replicaDB, databaseConfig.MaxReplicaLag)
+	}
+
+	if createNode {
+		nodeErr := pg.CreateNode(&node)
+		if nodeErr != nil {
+			return &DB{}, ErrUnableToSetNode(nodeErr)
+		}
+	}
+
+	return &pg, nil
+}
+
+func setPoolLimits(db *sqlx.DB, databaseConfig Config) {
 	if databaseConfig.MaxOpen > 0 {
 		db.SetMaxOpenConns(databaseConfig.MaxOpen)
 	}
@@ -48,16 +75,26 @@ func NewDB(databaseConfig Config, node node.Info, createNode bool) (*DB, error)
 		lifetime := time.Duration(databaseConfig.MaxLifetime) * time.Second
 		db.SetConnMaxLifetime(lifetime)
 	}
-	pg := DB{DB: db, Node: node}
+}
 
-	if createNode {
-		nodeErr := pg.CreateNode(&node)
-		if nodeErr != nil {
-			return &DB{}, ErrUnableToSetNode(nodeErr)
-		}
+// Reader returns the connection pool read-only queries should use:
+// the read replica if one is configured and it is within the maximum replication lag, the primary otherwise
+func (db *DB) Reader() *sqlx.DB {
+	if db.replica != nil && db.replica.usable() {
+		return db.replica.db
 	}
+	return db.DB
+}
 
-	return &pg, nil
+// Close closes the connection pools of the primary and of the read replica
+func (db *DB) Close() error {
+	if db.replica != nil {
+		if err := db.replica.db.Close(); err != nil {
+			db.DB.Close()
+			return err
+		}
+	}
+	return db.DB.Close()
 }
 
 func (db *DB) CreateNode(node *node.Info) error {
@@ -92,4 +92,28 @@ var _ = Describe("Postgres DB", func() {
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring(postgres.SettingNodeFailedMsg))
 	})
+
+	Describe("Reader", func() {
+		It("reads from the primary if no replica is configured", func() {
+			Expect(db.Reader()).To(BeIdenticalTo(db.DB))
+		})
+
+		It("reads from the replica if it is within the maximum lag", func() {
+			config := shared.TestConfig()
+			config.ReplicaDSN = postgres.DbConnectionString(config)
+			replicated, err := postgres.NewDB(config, node.Info{}, false)
+			Expect(err).ToNot(HaveOccurred())
+			defer replicated.Close()
+			Expect(replicated.Reader()).ToNot(BeIdenticalTo(replicated.DB))
+		})
+
+		It("falls back to the primary if the replica can't be reached", func() {
+			config := shared.TestConfig()
+			config.ReplicaDSN = "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1"
+			replicated, err := postgres.NewDB(config, node.Info{}, false)
+			Expect(err).ToNot(HaveOccurred())
+			defer replicated.Close()
+			Expect(replicated.Reader()).To(BeIdenticalTo(replicated.DB))
+		})
+	})
 })
@@ -0,0 +1,87 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package postgres
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMaxReplicaLag is the maximum replication lag, in seconds, used when none is configured
+const defaultMaxReplicaLag = 30
+
+// lagCheckInterval is how long the outcome of a replication lag check is reused for
+const lagCheckInterval = 5 * time.Second
+
+// replicaLagPgStr returns the replication lag of the server in seconds
+// it is 0 if the server isn't a standby, or has replayed all of the WAL it received (an idle primary doesn't advance the replay timestamp)
+const replicaLagPgStr = `SELECT CASE
+			WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		END`
+
+// replica is a read replica whose replication lag is checked before routing reads to it
+type replica struct {
+	db     *sqlx.DB
+	maxLag time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	ok      bool
+}
+
+func newReplica(db *sqlx.DB, maxLag int) *replica {
+	if maxLag <= 0 {
+		maxLag = defaultMaxReplicaLag
+	}
+	return &replica{
+		db:     db,
+		maxLag: time.Duration(maxLag) * time.Second,
+		ok:     true,
+	}
+}
+
+// usable returns whether the replica can be reached and is within the maximum replication lag
+// the outcome is checked at most once every lagCheckInterval, and changes to it are logged
+func (r *replica) usable() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checked) < lagCheckInterval {
+		return r.ok
+	}
+	r.checked = time.Now()
+	var lag float64
+	if err := r.db.Get(&lag, replicaLagPgStr); err != nil {
+		if r.ok {
+			logrus.Warnf("read replica is unavailable, reading from the primary: %v", err)
+		}
+		r.ok = false
+		return false
+	}
+	ok := time.Duration(lag*float64(time.Second)) <= r.maxLag
+	switch {
+	case ok && !r.ok:
+		logrus.Infof("read replica is %.1fs behind, reading from it again", lag)
+	case !ok && r.ok:
+		logrus.Warnf("read replica is %.1fs behind, more than the maximum of %s, reading from the primary", lag, r.maxLag)
+	}
+	r.ok = ok
+	return ok
+}
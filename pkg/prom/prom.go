@@ -33,6 +33,9 @@ var (
 	transactions prometheus.Counter
 	blocks       prometheus.Counter
 
+	validationFailures prometheus.Counter
+	upsertConflicts    *prometheus.CounterVec
+
 	lenPayloadChan prometheus.Gauge
 
 	tPayloadDecode             prometheus.Histogram
@@ -65,6 +68,17 @@ func Init() {
 		Help:      "The total number of processed receipts",
 	})
 
+	validationFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validation_failures",
+		Help:      "The total number of state diffs that failed validation",
+	})
+	upsertConflicts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upsert_conflicts",
+		Help:      "The total number of re-indexed rows whose content differed from the indexed content",
+	}, []string{"table"})
+
 	lenPayloadChan = promauto.NewGauge(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Name:      "len_payload_chan",
@@ -149,6 +163,20 @@ func ReceiptInc() {
 	}
 }
 
+// ValidationFailureInc validation failure counter increment
+func ValidationFailureInc() {
+	if metrics {
+		validationFailures.Inc()
+	}
+}
+
+// UpsertConflictInc upsert conflict counter increment
+func UpsertConflictInc(table string) {
+	if metrics {
+		upsertConflicts.WithLabelValues(table).Inc()
+	}
+}
+
 // SetLenPayloadChan set chan length
 func SetLenPayloadChan(ln int) {
 	if metrics {
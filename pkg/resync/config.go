@@ -24,6 +24,7 @@ import (
 
 	"github.com/spf13/viper"
 
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
@@ -32,13 +33,18 @@ import (
 
 // Env variables
 const (
-	RESYNC_START            = "RESYNC_START"
-	RESYNC_STOP             = "RESYNC_STOP"
-	RESYNC_BATCH_SIZE       = "RESYNC_BATCH_SIZE"
-	RESYNC_WORKERS          = "RESYNC_WORKERS"
-	RESYNC_CLEAR_OLD_CACHE  = "RESYNC_CLEAR_OLD_CACHE"
-	RESYNC_TYPE             = "RESYNC_TYPE"
-	RESYNC_RESET_VALIDATION = "RESYNC_RESET_VALIDATION"
+	RESYNC_START                = "RESYNC_START"
+	RESYNC_STOP                 = "RESYNC_STOP"
+	RESYNC_BATCH_SIZE           = "RESYNC_BATCH_SIZE"
+	RESYNC_WORKERS              = "RESYNC_WORKERS"
+	RESYNC_CLEAR_OLD_CACHE      = "RESYNC_CLEAR_OLD_CACHE"
+	RESYNC_TYPE                 = "RESYNC_TYPE"
+	RESYNC_RESET_VALIDATION     = "RESYNC_RESET_VALIDATION"
+	RESYNC_RECORD_PATH          = "RESYNC_RECORD_PATH"
+	RESYNC_REPLAY_PATH          = "RESYNC_REPLAY_PATH"
+	RESYNC_VALIDATE_STATE_DIFFS = "RESYNC_VALIDATE_STATE_DIFFS"
+	RESYNC_CROSS_VALIDATE       = "RESYNC_CROSS_VALIDATE"
+	RESYNC_TRACES               = "RESYNC_TRACES"
 
 	RESYNC_MAX_IDLE_CONNECTIONS = "RESYNC_MAX_IDLE_CONNECTIONS"
 	RESYNC_MAX_OPEN_CONNECTIONS = "RESYNC_MAX_OPEN_CONNECTIONS"
@@ -52,15 +58,24 @@ type Config struct {
 	ResetValidation bool            // If true, resync will reset the validation level to 0 for the given range
 
 	// DB info
-	DB       *postgres.DB
-	DBConfig postgres.Config
-
-	HTTPClient *rpc.Client   // Ethereum rpc client
-	NodeInfo   node.Info     // Info for the associated node
-	Ranges     [][2]uint64   // The block height ranges to resync
-	BatchSize  uint64        // BatchSize for the resync http calls (client has to support batch sizing)
-	Timeout    time.Duration // HTTP connection timeout in seconds
-	Workers    uint64
+	DB               *postgres.DB
+	DBConfig         postgres.Config
+	Blockstore       blockstore.Blockstore
+	BlockstoreConfig blockstore.Config
+
+	HTTPClient         *rpc.Client   // Ethereum rpc client
+	NodeInfo           node.Info     // Info for the associated node
+	Ranges             [][2]uint64   // The block height ranges to resync
+	BatchSize          uint64        // BatchSize for the resync http calls (client has to support batch sizing)
+	Timeout            time.Duration // HTTP connection timeout in seconds
+	Workers            uint64
+	RecordPath         string              // Path to a local file to record fetched payloads to
+	ReplayPath         string              // Path to a local file of recorded payloads to fetch from instead of geth
+	ValidateStateDiffs bool                // If true, validate state diffs against the header state root before counting them as validated
+	CrossValidate      bool                // If true, count the independent nodes which agree on a header, rather than the times it was indexed, as its validation level
+	Filter             shared.IndexFilter  // Selects the subset of each payload that is indexed
+	Conflicts          shared.ConflictMode // How re-indexing a row with different content is handled
+	Traces             bool                // If true, also fetch and index the call traces of the transactions in each block
 }
 
 // NewConfig fills and returns a resync config from toml parameters
@@ -77,6 +92,11 @@ func NewConfig() (*Config, error) {
 	viper.BindEnv("resync.workers", RESYNC_WORKERS)
 	viper.BindEnv("resync.resetValidation", RESYNC_RESET_VALIDATION)
 	viper.BindEnv("resync.timeout", shared.HTTP_TIMEOUT)
+	viper.BindEnv("resync.recordPath", RESYNC_RECORD_PATH)
+	viper.BindEnv("resync.replayPath", RESYNC_REPLAY_PATH)
+	viper.BindEnv("resync.validateStateDiffs", RESYNC_VALIDATE_STATE_DIFFS)
+	viper.BindEnv("resync.crossValidate", RESYNC_CROSS_VALIDATE)
+	viper.BindEnv("resync.traces", RESYNC_TRACES)
 
 	timeout := viper.GetInt("resync.timeout")
 	if timeout < 5 {
@@ -91,6 +111,19 @@ func NewConfig() (*Config, error) {
 	c.ResetValidation = viper.GetBool("resync.resetValidation")
 	c.BatchSize = uint64(viper.GetInt64("resync.batchSize"))
 	c.Workers = uint64(viper.GetInt64("resync.workers"))
+	c.RecordPath = viper.GetString("resync.recordPath")
+	c.ReplayPath = viper.GetString("resync.replayPath")
+	c.ValidateStateDiffs = viper.GetBool("resync.validateStateDiffs")
+	c.CrossValidate = viper.GetBool("resync.crossValidate")
+	c.Traces = viper.GetBool("resync.traces")
+	c.Filter, err = shared.GetIndexFilter()
+	if err != nil {
+		return nil, err
+	}
+	c.Conflicts, err = shared.GetConflictMode()
+	if err != nil {
+		return nil, err
+	}
 
 	resyncType := viper.GetString("resync.type")
 	c.ResyncType, err = shared.GenerateDataTypeFromString(resyncType)
@@ -104,16 +137,27 @@ func NewConfig() (*Config, error) {
 		return nil, fmt.Errorf("ethereum does not support data type %s", c.ResyncType.String())
 	}
 
-	ethHTTP := viper.GetString("ethereum.httpPath")
-	c.NodeInfo, c.HTTPClient, err = shared.GetEthNodeAndClient(fmt.Sprintf("http://%s", ethHTTP))
-	if err != nil {
-		return nil, err
+	if c.ReplayPath != "" {
+		c.NodeInfo = shared.GetEthNodeInfo()
+	} else {
+		ethHTTP := viper.GetString("ethereum.httpPath")
+		c.NodeInfo, c.HTTPClient, err = shared.GetEthNodeAndClient(fmt.Sprintf("http://%s", ethHTTP))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	c.DBConfig.Init()
 	overrideDBConnConfig(&c.DBConfig)
-	db := utils.LoadPostgres(c.DBConfig, c.NodeInfo, true)
+	db := utils.LoadMigratedPostgres(c.DBConfig, c.NodeInfo, true)
 	c.DB = &db
+	if err := c.BlockstoreConfig.Init(); err != nil {
+		return nil, err
+	}
+	c.Blockstore, err = blockstore.NewBlockstore(c.BlockstoreConfig, c.DB.DB)
+	if err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
@@ -18,6 +18,7 @@ package resync
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/sirupsen/logrus"
@@ -34,8 +35,14 @@ type Resync interface {
 type Service struct {
 	// Interface for fetching historical statediff objects over http
 	Fetcher eth.Fetcher
+	// Interface for recording fetched payloads to a local file, nil if not recording
+	Recorder eth.Recorder
 	// Interface for transforming payloads into IPLD object models in Postgres
 	Transformer eth.Transformer
+	// Interface for fetching the call traces of the transactions in each block, nil if not tracing
+	TraceFetcher eth.TraceFetcher
+	// Interface for transforming call traces into IPLD object models in Postgres, nil if not tracing
+	TraceTransformer eth.TraceTransformer
 	// Interface for cleaning out data before resyncing (if clearOldCache is on)
 	Cleaner eth.Cleaner
 	// Size of batch fetches
@@ -60,13 +67,45 @@ type Service struct {
 func NewResyncService(settings *Config) (Resync, error) {
 	rs := new(Service)
 	var err error
-	rs.Fetcher = eth.NewPayloadFetcher(settings.HTTPClient, settings.Timeout)
+	if settings.ReplayPath != "" {
+		rs.Fetcher, err = eth.NewFileFetcher(settings.ReplayPath)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		fetcher := eth.NewPayloadFetcher(settings.HTTPClient, settings.Timeout)
+		fetcher.WatchAddresses(settings.Filter.Addresses)
+		rs.Fetcher = fetcher
+		if settings.Traces {
+			rs.TraceFetcher = eth.NewCallTraceFetcher(settings.HTTPClient, settings.Timeout)
+			traceTransformer := eth.NewCallTraceTransformer(settings.DB)
+			traceTransformer.SetBlockstore(settings.Blockstore)
+			rs.TraceTransformer = traceTransformer
+		}
+	}
+	if settings.Traces && settings.ReplayPath != "" {
+		logrus.Warn("call traces are not recorded, traces will not be indexed while replaying payloads")
+	}
+	if settings.RecordPath != "" {
+		rs.Recorder, err = eth.NewPayloadRecorder(settings.RecordPath)
+		if err != nil {
+			return nil, err
+		}
+	}
 	rs.ChainConfig, err = eth.ChainConfig(settings.NodeInfo.ChainID)
 	if err != nil {
 		return nil, err
 	}
-	rs.Transformer = eth.NewStateDiffTransformer(rs.ChainConfig, settings.DB)
-	rs.Cleaner = eth.NewDBCleaner(settings.DB)
+	transformer := eth.NewStateDiffTransformer(rs.ChainConfig, settings.DB)
+	transformer.SetValidation(settings.ValidateStateDiffs)
+	transformer.SetCrossValidation(settings.CrossValidate)
+	transformer.SetFilter(settings.Filter)
+	transformer.SetConflictMode(settings.Conflicts)
+	transformer.SetBlockstore(settings.Blockstore)
+	rs.Transformer = transformer
+	cleaner := eth.NewDBCleaner(settings.DB)
+	cleaner.SetBlockstore(settings.Blockstore)
+	rs.Cleaner = cleaner
 	rs.BatchSize = settings.BatchSize
 	if rs.BatchSize == 0 {
 		rs.BatchSize = shared.DefaultMaxBatchSize
@@ -122,6 +161,14 @@ func (rs *Service) Sync() error {
 	for i := 1; i <= int(rs.Workers); i++ {
 		rs.quitChan <- true
 	}
+	if closer, ok := rs.Fetcher.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	if rs.Recorder != nil {
+		return rs.Recorder.Close()
+	}
 	return nil
 }
 
@@ -134,10 +181,26 @@ func (rs *Service) resync(id int, heightChan chan []uint64) {
 			if err != nil {
 				logrus.Errorf("ethereum resync worker %d fetcher error: %s", id, err.Error())
 			}
+			var traces map[uint64][]eth.TxTrace
+			if rs.TraceFetcher != nil {
+				traces, err = rs.TraceFetcher.FetchTracesAt(heights)
+				if err != nil {
+					logrus.Errorf("ethereum resync worker %d trace fetcher error: %s", id, err.Error())
+				}
+			}
 			for _, payload := range payloads {
+				if rs.Recorder != nil {
+					if err := rs.Recorder.Record(payload); err != nil {
+						logrus.Errorf("ethereum resync worker %d recorder error: %s", id, err.Error())
+					}
+				}
 				blockNumber, err := rs.Transformer.Transform(id, payload)
 				if err != nil {
 					logrus.Errorf("ethereum resync worker %d transformer error: %s", id, err.Error())
+				} else if blockTraces, ok := traces[blockNumber]; ok {
+					if err := rs.TraceTransformer.Transform(id, payload, blockTraces); err != nil {
+						logrus.Errorf("ethereum resync worker %d trace transformer error: %s", id, err.Error())
+					}
 				}
 				logrus.Infof("ethereum resync worker %d transformed data at height %d", id, blockNumber)
 			}
@@ -0,0 +1,68 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"github.com/spf13/viper"
+)
+
+// Env variables
+const (
+	SERVER_HTTP_PATH = "SERVER_HTTP_PATH"
+	SERVER_WS_PATH   = "SERVER_WS_PATH"
+	SERVER_IPC_PATH  = "SERVER_IPC_PATH"
+
+	SERVER_ADMIN_PATH   = "SERVER_ADMIN_PATH"
+	SERVER_CORS_DOMAINS = "SERVER_CORS_DOMAINS"
+	SERVER_WS_ORIGINS   = "SERVER_WS_ORIGINS"
+)
+
+// Config struct for the RPC server
+// An empty endpoint disables serving over that transport
+// The http and websocket endpoints only serve the public APIs, the non-public ones are served over ipc and the admin endpoint
+type Config struct {
+	HTTPEndpoint  string   // host:port to serve http requests on
+	WSEndpoint    string   // host:port to serve websocket requests on
+	IPCEndpoint   string   // path to the ipc socket file
+	AdminEndpoint string   // host:port to serve the non-public APIs over http on
+	CORSDomains   []string // domains to accept cross origin http requests from, none if empty
+	WSOrigins     []string // origins to accept websocket requests from, only localhost if empty
+}
+
+// NewConfig is used to initialize an RPC server config from a .toml file
+func NewConfig() Config {
+	viper.BindEnv("server.httpPath", SERVER_HTTP_PATH)
+	viper.BindEnv("server.wsPath", SERVER_WS_PATH)
+	viper.BindEnv("server.ipcPath", SERVER_IPC_PATH)
+	viper.BindEnv("server.adminPath", SERVER_ADMIN_PATH)
+	viper.BindEnv("server.corsDomains", SERVER_CORS_DOMAINS)
+	viper.BindEnv("server.wsOrigins", SERVER_WS_ORIGINS)
+
+	return Config{
+		HTTPEndpoint:  viper.GetString("server.httpPath"),
+		WSEndpoint:    viper.GetString("server.wsPath"),
+		IPCEndpoint:   viper.GetString("server.ipcPath"),
+		AdminEndpoint: viper.GetString("server.adminPath"),
+		CORSDomains:   viper.GetStringSlice("server.corsDomains"),
+		WSOrigins:     viper.GetStringSlice("server.wsOrigins"),
+	}
+}
+
+// Enabled returns true if the RPC server is to be served over at least one transport
+func (c Config) Enabled() bool {
+	return c.HTTPEndpoint != "" || c.WSEndpoint != "" || c.IPCEndpoint != "" || c.AdminEndpoint != ""
+}
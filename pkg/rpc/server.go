@@ -0,0 +1,137 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+// Server serves the provided APIs over the http, websocket, and ipc transports enabled in its config
+type Server struct {
+	httpServer  *http.Server
+	wsServer    *http.Server
+	adminServer *http.Server
+	ipcListener net.Listener
+	handlers    []*rpc.Server
+}
+
+// StartServer registers the APIs and starts serving them over each enabled transport
+// Non-public APIs are only served over ipc and the admin endpoint
+func StartServer(config Config, apis []rpc.API) (*Server, error) {
+	s := new(Server)
+	public, admin := splitAPIs(apis)
+	if config.HTTPEndpoint != "" {
+		handler, err := newHandler(public)
+		if err != nil {
+			s.Stop()
+			return nil, err
+		}
+		s.handlers = append(s.handlers, handler)
+		s.httpServer, _, err = node.StartHTTPEndpoint(config.HTTPEndpoint, rpc.DefaultHTTPTimeouts, node.NewHTTPHandlerStack(handler, config.CORSDomains, []string{"*"}))
+		if err != nil {
+			s.Stop()
+			return nil, err
+		}
+		log.Infof("rpc server listening for http requests on %s", config.HTTPEndpoint)
+	}
+	if config.WSEndpoint != "" {
+		handler, err := newHandler(public)
+		if err != nil {
+			s.Stop()
+			return nil, err
+		}
+		s.handlers = append(s.handlers, handler)
+		s.wsServer, _, err = node.StartHTTPEndpoint(config.WSEndpoint, rpc.DefaultHTTPTimeouts, handler.WebsocketHandler(config.WSOrigins))
+		if err != nil {
+			s.Stop()
+			return nil, err
+		}
+		log.Infof("rpc server listening for websocket requests on %s", config.WSEndpoint)
+	}
+	if config.AdminEndpoint != "" {
+		handler, err := newHandler(admin)
+		if err != nil {
+			s.Stop()
+			return nil, err
+		}
+		s.handlers = append(s.handlers, handler)
+		s.adminServer, _, err = node.StartHTTPEndpoint(config.AdminEndpoint, rpc.DefaultHTTPTimeouts, node.NewHTTPHandlerStack(handler, nil, []string{"*"}))
+		if err != nil {
+			s.Stop()
+			return nil, err
+		}
+		log.Infof("rpc server listening for admin http requests on %s", config.AdminEndpoint)
+	}
+	if config.IPCEndpoint != "" {
+		listener, handler, err := rpc.StartIPCEndpoint(config.IPCEndpoint, apis)
+		if err != nil {
+			s.Stop()
+			return nil, err
+		}
+		s.ipcListener = listener
+		s.handlers = append(s.handlers, handler)
+		log.Infof("rpc server listening for ipc requests on %s", config.IPCEndpoint)
+	}
+	return s, nil
+}
+
+// Stop shuts down every transport the server is listening on
+func (s *Server) Stop() {
+	if s.httpServer != nil {
+		s.httpServer.Shutdown(context.Background())
+	}
+	if s.wsServer != nil {
+		s.wsServer.Shutdown(context.Background())
+	}
+	if s.adminServer != nil {
+		s.adminServer.Shutdown(context.Background())
+	}
+	if s.ipcListener != nil {
+		s.ipcListener.Close()
+	}
+	for _, handler := range s.handlers {
+		handler.Stop()
+	}
+}
+
+func newHandler(apis []rpc.API) (*rpc.Server, error) {
+	handler := rpc.NewServer()
+	for _, api := range apis {
+		if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
+			return nil, err
+		}
+	}
+	return handler, nil
+}
+
+// splitAPIs separates the public APIs from the non-public ones
+func splitAPIs(apis []rpc.API) (public, admin []rpc.API) {
+	for _, api := range apis {
+		if api.Public {
+			public = append(public, api)
+		} else {
+			admin = append(admin, api)
+		}
+	}
+	return public, admin
+}
@@ -0,0 +1,274 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package serve
+
+import (
+	"database/sql"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/filters"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// APIName is the namespace for the read-only eth api
+const APIName = "eth"
+
+// APIVersion is the version of the read-only eth api
+const APIVersion = "0.0.1"
+
+// PublicEthAPI is the read-only subset of the eth_ namespace, served from the indexed data
+type PublicEthAPI struct {
+	B *Backend
+}
+
+// NewPublicEthAPI creates a new PublicEthAPI with the provided backend
+func NewPublicEthAPI(b *Backend) *PublicEthAPI {
+	return &PublicEthAPI{
+		B: b,
+	}
+}
+
+// BlockNumber returns the number of the highest block indexed
+func (pea *PublicEthAPI) BlockNumber() (hexutil.Uint64, error) {
+	number, err := pea.B.LastBlockNumber()
+	return hexutil.Uint64(number), err
+}
+
+// GetBlockByNumber returns the requested canonical block
+// When fullTx is true all transactions in the block are returned, otherwise only the transaction hash is returned
+func (pea *PublicEthAPI) GetBlockByNumber(number rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
+	header, err := pea.B.HeaderByNumber(number)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return pea.block(header, fullTx)
+}
+
+// GetBlockByHash returns the requested block
+// When fullTx is true all transactions in the block are returned, otherwise only the transaction hash is returned
+func (pea *PublicEthAPI) GetBlockByHash(hash common.Hash, fullTx bool) (map[string]interface{}, error) {
+	header, err := pea.B.HeaderByHash(hash)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return pea.block(header, fullTx)
+}
+
+func (pea *PublicEthAPI) block(header *Header, fullTx bool) (map[string]interface{}, error) {
+	block, err := pea.B.Block(header)
+	if err != nil {
+		return nil, err
+	}
+	return RPCMarshalBlock(block, header.TotalDifficulty, fullTx), nil
+}
+
+// GetTransactionByHash returns the canonical transaction for the given hash
+func (pea *PublicEthAPI) GetTransactionByHash(hash common.Hash) (*RPCTransaction, error) {
+	header, index, err := pea.transactionHeader(hash)
+	if err != nil || header == nil {
+		return nil, err
+	}
+	txs, err := pea.B.Transactions(header)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(txs)) <= index {
+		return nil, nil
+	}
+	return NewRPCTransaction(txs[index], header.Hash(), header.Number.Uint64(), index), nil
+}
+
+// GetTransactionReceipt returns the receipt of the canonical transaction for the given hash
+func (pea *PublicEthAPI) GetTransactionReceipt(hash common.Hash) (map[string]interface{}, error) {
+	header, index, err := pea.transactionHeader(hash)
+	if err != nil || header == nil {
+		return nil, err
+	}
+	txs, err := pea.B.Transactions(header)
+	if err != nil {
+		return nil, err
+	}
+	rcts, err := pea.B.Receipts(header)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(rcts)) <= index || uint64(len(txs)) <= index {
+		return nil, nil
+	}
+	return RPCMarshalReceipt(rcts[index], txs[index]), nil
+}
+
+// transactionHeader returns the canonical header the transaction is in and its index, or a nil header if it is not indexed
+func (pea *PublicEthAPI) transactionHeader(hash common.Hash) (*Header, uint64, error) {
+	blockHash, _, index, err := pea.B.TransactionLocation(hash)
+	if err != nil {
+		return nil, 0, notFound(err)
+	}
+	header, err := pea.B.HeaderByHash(blockHash)
+	if err != nil {
+		return nil, 0, notFound(err)
+	}
+	return header, index, nil
+}
+
+// GetLogs returns the logs matching the given criteria
+// Blocks in the range are resolved along the canonical chain, the latest and pending block numbers resolve to the highest block indexed
+func (pea *PublicEthAPI) GetLogs(crit filters.FilterCriteria) ([]*types.Log, error) {
+	filter := LogFilter{
+		Addresses: crit.Addresses,
+		Topics:    crit.Topics,
+	}
+	logs := make([]*types.Log, 0)
+	var headers []*Header
+	if crit.BlockHash != nil {
+		header, err := pea.B.HeaderByHash(*crit.BlockHash)
+		if err != nil {
+			return nil, err
+		}
+		headers = []*Header{header}
+	} else {
+		from, err := pea.resolveNumber(crit.FromBlock)
+		if err != nil {
+			return nil, err
+		}
+		to, err := pea.resolveNumber(crit.ToBlock)
+		if err != nil {
+			return nil, err
+		}
+		if from > to {
+			return logs, nil
+		}
+		if headers, err = pea.B.LogHeaders(from, to, filter); err != nil {
+			return nil, err
+		}
+	}
+	for _, header := range headers {
+		headerLogs, err := pea.B.Logs(header, filter)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, headerLogs...)
+	}
+	return logs, nil
+}
+
+// resolveNumber resolves a filter's block number, nil and the negative block numbers resolve to the highest block indexed
+func (pea *PublicEthAPI) resolveNumber(number *big.Int) (uint64, error) {
+	if number == nil || number.Sign() < 0 {
+		return pea.B.LastBlockNumber()
+	}
+	return number.Uint64(), nil
+}
+
+// GetBalance returns the amount of wei for the given address in the state of the given block
+func (pea *PublicEthAPI) GetBalance(address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Big, error) {
+	header, err := pea.B.HeaderByNumberOrHash(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	account, err := pea.B.Account(address, header)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return (*hexutil.Big)(new(big.Int)), nil
+	}
+	return (*hexutil.Big)(account.Balance), nil
+}
+
+// GetStorageAt returns the storage for the given address and key in the state of the given block
+func (pea *PublicEthAPI) GetStorageAt(address common.Address, key string, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	header, err := pea.B.HeaderByNumberOrHash(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	value, err := pea.B.StorageAt(address, common.HexToHash(key), header)
+	if err != nil {
+		return nil, err
+	}
+	return value.Bytes(), nil
+}
+
+// GetCode returns the code stored at the given address in the state of the given block
+func (pea *PublicEthAPI) GetCode(address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	header, err := pea.B.HeaderByNumberOrHash(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	account, err := pea.B.Account(address, header)
+	if err != nil || account == nil {
+		return hexutil.Bytes{}, err
+	}
+	return pea.B.Code(common.BytesToHash(account.CodeHash))
+}
+
+// GetProof returns the account and storage values of the specified account including the Merkle-proof, as specified by EIP-1186
+func (pea *PublicEthAPI) GetProof(address common.Address, storageKeys []string, blockNrOrHash rpc.BlockNumberOrHash) (*AccountResult, error) {
+	header, err := pea.B.HeaderByNumberOrHash(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	account, err := pea.B.Account(address, header)
+	if err != nil {
+		return nil, err
+	}
+	accountProof, err := pea.B.AccountProof(address, header)
+	if err != nil {
+		return nil, err
+	}
+	result := &AccountResult{
+		Address:      address,
+		AccountProof: toHexSlice(accountProof),
+		Balance:      (*hexutil.Big)(new(big.Int)),
+		StorageHash:  types.EmptyRootHash,
+		StorageProof: make([]StorageResult, len(storageKeys)),
+	}
+	if account != nil {
+		result.Balance = (*hexutil.Big)(account.Balance)
+		result.CodeHash = common.BytesToHash(account.CodeHash)
+		result.Nonce = hexutil.Uint64(account.Nonce)
+		result.StorageHash = account.Root
+	}
+	for i, key := range storageKeys {
+		slot := common.HexToHash(key)
+		value, err := pea.B.StorageAt(address, slot, header)
+		if err != nil {
+			return nil, err
+		}
+		proof, err := pea.B.StorageProof(address, slot, header)
+		if err != nil {
+			return nil, err
+		}
+		result.StorageProof[i] = StorageResult{
+			Key:   key,
+			Value: (*hexutil.Big)(value.Big()),
+			Proof: toHexSlice(proof),
+		}
+	}
+	return result, nil
+}
+
+// notFound maps the errors for data that is not indexed to a nil error, so that a null result is returned like geth does
+func notFound(err error) error {
+	if err == ErrHeaderNotFound || err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,478 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package serve
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/ipfs/go-cid"
+	"github.com/lib/pq"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/ipfs/ipld"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/lookup"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+// canonical restricts a query to headers on the canonical chain of their chain
+const canonical = `header_cids.id = (SELECT canonical_header_id(header_cids.chain_id, header_cids.block_number))`
+
+const (
+	lastBlockNumberPgStr = `SELECT MAX(block_number) FROM eth.header_cids WHERE chain_id = $1`
+	headerByNumberPgStr  = `SELECT header_cids.id, header_cids.cid, header_cids.td, header_cids.mh_key, blocks.data FROM eth.header_cids
+			INNER JOIN public.blocks ON (header_cids.mh_key = blocks.key)
+			WHERE header_cids.id = canonical_header_id($1, $2)`
+	headerByHashPgStr = `SELECT header_cids.id, header_cids.cid, header_cids.td, header_cids.mh_key, blocks.data FROM eth.header_cids
+			INNER JOIN public.blocks ON (header_cids.mh_key = blocks.key)
+			WHERE header_cids.chain_id = $1
+			AND header_cids.block_hash = $2
+			LIMIT 1`
+	unclesPgStr = `SELECT uncle_cids.cid, uncle_cids.mh_key, blocks.data FROM eth.uncle_cids
+			INNER JOIN public.blocks ON (uncle_cids.mh_key = blocks.key)
+			WHERE uncle_cids.header_id = $1
+			ORDER BY uncle_cids.id`
+	txsPgStr = `SELECT transaction_cids.cid, transaction_cids.mh_key, blocks.data FROM eth.transaction_cids
+			INNER JOIN public.blocks ON (transaction_cids.mh_key = blocks.key)
+			WHERE transaction_cids.header_id = $1
+			ORDER BY transaction_cids.index`
+	rctsPgStr = `SELECT receipt_cids.cid, receipt_cids.mh_key, blocks.data FROM eth.receipt_cids
+			INNER JOIN eth.transaction_cids ON (receipt_cids.tx_id = transaction_cids.id)
+			INNER JOIN public.blocks ON (receipt_cids.mh_key = blocks.key)
+			WHERE transaction_cids.header_id = $1
+			ORDER BY transaction_cids.index`
+	txLocationPgStr = `SELECT header_cids.block_hash, header_cids.block_number, transaction_cids.index FROM eth.transaction_cids
+			INNER JOIN eth.header_cids ON (transaction_cids.header_id = header_cids.id)
+			WHERE transaction_cids.tx_hash = $1
+			AND header_cids.chain_id = $2
+			AND ` + canonical + `
+			LIMIT 1`
+	logHeadersPgStr = `SELECT DISTINCT header_cids.block_number FROM eth.receipt_cids
+			INNER JOIN eth.transaction_cids ON (receipt_cids.tx_id = transaction_cids.id)
+			INNER JOIN eth.header_cids ON (transaction_cids.header_id = header_cids.id)
+			WHERE header_cids.chain_id = $1
+			AND header_cids.block_number BETWEEN $2 AND $3
+			AND ` + canonical
+	codePgStr = `SELECT data FROM public.blocks WHERE key = $1`
+)
+
+var (
+	// ErrHeaderNotFound is returned when the requested header is not indexed
+	ErrHeaderNotFound = errors.New("header not found")
+	// ErrPartiallyIndexed is returned when the receipts of a block are requested but only some of them were indexed
+	ErrPartiallyIndexed = errors.New("block is only partially indexed")
+
+	emptyCodeHash = crypto.Keccak256Hash(nil)
+)
+
+// Backend reconstructs chain data from the eth.*_cids tables and the IPLD blocks they reference
+// Blocks requested by number, and the state at a block, are resolved along the canonical chain
+// Only the data of the chain of its node is served
+type Backend struct {
+	db          *postgres.DB
+	blocks      blockstore.Blockstore
+	chainConfig *params.ChainConfig
+	state       *lookup.StateRetriever
+}
+
+// NewBackend creates a pointer to a new Backend
+func NewBackend(db *postgres.DB, chainConfig *params.ChainConfig) *Backend {
+	return &Backend{
+		db:          db,
+		blocks:      blockstore.NewPostgresBlockstore(db.DB),
+		chainConfig: chainConfig,
+		state:       lookup.NewStateRetriever(db),
+	}
+}
+
+// SetBlockstore sets the blockstore the IPLD blocks are read from when public.blocks only records their keys
+func (b *Backend) SetBlockstore(blocks blockstore.Blockstore) {
+	b.blocks = blocks
+	b.state.SetBlockstore(blocks)
+}
+
+// Header is a header as indexed in eth.header_cids
+type Header struct {
+	*types.Header
+	ID              int64
+	TotalDifficulty *big.Int
+}
+
+type headerRow struct {
+	ID    int64           `db:"id"`
+	CID   string          `db:"cid"`
+	TD    string          `db:"td"`
+	MhKey string          `db:"mh_key"`
+	Data  blockstore.Data `db:"data"`
+}
+
+type ipldRow struct {
+	CID   string          `db:"cid"`
+	MhKey string          `db:"mh_key"`
+	Data  blockstore.Data `db:"data"`
+}
+
+// LastBlockNumber returns the highest block number indexed for the chain
+func (b *Backend) LastBlockNumber() (uint64, error) {
+	var number sql.NullInt64
+	if err := b.db.Reader().Get(&number, lastBlockNumberPgStr, b.db.Node.ChainID); err != nil {
+		return 0, err
+	}
+	if !number.Valid {
+		return 0, ErrHeaderNotFound
+	}
+	return uint64(number.Int64), nil
+}
+
+// HeaderByNumber returns the canonical header at the block number
+// The latest and pending block numbers resolve to the highest block indexed
+func (b *Backend) HeaderByNumber(number rpc.BlockNumber) (*Header, error) {
+	var height uint64
+	switch number {
+	case rpc.LatestBlockNumber, rpc.PendingBlockNumber:
+		var err error
+		if height, err = b.LastBlockNumber(); err != nil {
+			return nil, err
+		}
+	case rpc.EarliestBlockNumber:
+		height = 0
+	default:
+		height = uint64(number.Int64())
+	}
+	return b.header(headerByNumberPgStr, b.db.Node.ChainID, height)
+}
+
+// HeaderByHash returns the header with the block hash
+func (b *Backend) HeaderByHash(hash common.Hash) (*Header, error) {
+	return b.header(headerByHashPgStr, b.db.Node.ChainID, hash.Hex())
+}
+
+// HeaderByNumberOrHash returns the header for the block number or hash
+func (b *Backend) HeaderByNumberOrHash(blockNrOrHash rpc.BlockNumberOrHash) (*Header, error) {
+	if hash, ok := blockNrOrHash.Hash(); ok {
+		return b.HeaderByHash(hash)
+	}
+	if number, ok := blockNrOrHash.Number(); ok {
+		return b.HeaderByNumber(number)
+	}
+	return nil, errors.New("invalid arguments; neither block nor hash specified")
+}
+
+func (b *Backend) header(pgStr string, args ...interface{}) (*Header, error) {
+	row := new(headerRow)
+	if err := b.db.Reader().Get(row, pgStr, args...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrHeaderNotFound
+		}
+		return nil, err
+	}
+	c, err := cid.Decode(row.CID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := blockstore.Load(b.blocks, row.MhKey, row.Data)
+	if err != nil {
+		return nil, err
+	}
+	headerNode, err := ipld.DecodeEthHeader(c, data)
+	if err != nil {
+		return nil, err
+	}
+	td, ok := new(big.Int).SetString(row.TD, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid total difficulty %s for header %s", row.TD, headerNode.Hash().Hex())
+	}
+	return &Header{
+		Header:          headerNode.Header,
+		ID:              row.ID,
+		TotalDifficulty: td,
+	}, nil
+}
+
+// Block assembles the block for the header from its indexed uncles and transactions
+func (b *Backend) Block(header *Header) (*types.Block, error) {
+	uncleRows := make([]ipldRow, 0)
+	if err := b.db.Reader().Select(&uncleRows, unclesPgStr, header.ID); err != nil {
+		return nil, err
+	}
+	uncles := make([]*types.Header, len(uncleRows))
+	for i, row := range uncleRows {
+		c, err := cid.Decode(row.CID)
+		if err != nil {
+			return nil, err
+		}
+		data, err := blockstore.Load(b.blocks, row.MhKey, row.Data)
+		if err != nil {
+			return nil, err
+		}
+		uncleNode, err := ipld.DecodeEthHeader(c, data)
+		if err != nil {
+			return nil, err
+		}
+		uncles[i] = uncleNode.Header
+	}
+	txs, err := b.Transactions(header)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewBlockWithHeader(header.Header).WithBody(txs, uncles), nil
+}
+
+// Transactions returns the header's indexed transactions, in order
+func (b *Backend) Transactions(header *Header) (types.Transactions, error) {
+	txRows := make([]ipldRow, 0)
+	if err := b.db.Reader().Select(&txRows, txsPgStr, header.ID); err != nil {
+		return nil, err
+	}
+	txs := make(types.Transactions, len(txRows))
+	for i, row := range txRows {
+		c, err := cid.Decode(row.CID)
+		if err != nil {
+			return nil, err
+		}
+		data, err := blockstore.Load(b.blocks, row.MhKey, row.Data)
+		if err != nil {
+			return nil, err
+		}
+		txNode, err := ipld.DecodeEthTx(c, data)
+		if err != nil {
+			return nil, err
+		}
+		txs[i] = txNode.Transaction
+	}
+	return txs, nil
+}
+
+// Receipts returns the header's indexed receipts, in order, with their derived fields filled in
+// The fields can only be derived from the complete set, so it returns ErrPartiallyIndexed if the receipts don't hash up to the header's receipt root,
+// e.g. if the block was indexed with an index filter
+func (b *Backend) Receipts(header *Header) (types.Receipts, error) {
+	rctRows := make([]ipldRow, 0)
+	if err := b.db.Reader().Select(&rctRows, rctsPgStr, header.ID); err != nil {
+		return nil, err
+	}
+	rcts := make(types.Receipts, len(rctRows))
+	for i, row := range rctRows {
+		c, err := cid.Decode(row.CID)
+		if err != nil {
+			return nil, err
+		}
+		data, err := blockstore.Load(b.blocks, row.MhKey, row.Data)
+		if err != nil {
+			return nil, err
+		}
+		rctNode, err := ipld.DecodeEthReceipt(c, data)
+		if err != nil {
+			return nil, err
+		}
+		rcts[i] = rctNode.Receipt
+	}
+	if types.DeriveSha(rcts, trie.NewStackTrie(nil)) != header.ReceiptHash {
+		return nil, fmt.Errorf("%w: %s", ErrPartiallyIndexed, header.Hash().Hex())
+	}
+	txs, err := b.Transactions(header)
+	if err != nil {
+		return nil, err
+	}
+	if err := rcts.DeriveFields(b.chainConfig, header.Hash(), header.Number.Uint64(), txs); err != nil {
+		return nil, err
+	}
+	return rcts, nil
+}
+
+// TransactionLocation returns the hash and number of the canonical block the transaction is in, and its index in it
+// It returns sql.ErrNoRows if the transaction is not indexed on the canonical chain
+func (b *Backend) TransactionLocation(hash common.Hash) (common.Hash, uint64, uint64, error) {
+	var loc struct {
+		BlockHash   string `db:"block_hash"`
+		BlockNumber uint64 `db:"block_number"`
+		Index       uint64 `db:"index"`
+	}
+	if err := b.db.Reader().Get(&loc, txLocationPgStr, hash.Hex(), b.db.Node.ChainID); err != nil {
+		return common.Hash{}, 0, 0, err
+	}
+	return common.HexToHash(loc.BlockHash), loc.BlockNumber, loc.Index, nil
+}
+
+// LogFilter selects logs by their address and topics
+// An empty address list, topic list, or list at a topic position matches anything
+type LogFilter struct {
+	Addresses []common.Address
+	Topics    [][]common.Hash
+}
+
+// LogHeaders returns the canonical headers in the range that have a receipt which could contain a log matching the filter
+// This uses the contracts and topics indexed for each receipt in eth.receipt_cids, the logs themselves still need to be filtered
+func (b *Backend) LogHeaders(from, to uint64, filter LogFilter) ([]*Header, error) {
+	pgStr := logHeadersPgStr
+	args := []interface{}{b.db.Node.ChainID, from, to}
+	if len(filter.Addresses) > 0 {
+		addrs := make([]string, len(filter.Addresses))
+		for i, addr := range filter.Addresses {
+			addrs[i] = addr.String()
+		}
+		args = append(args, pq.Array(addrs))
+		pgStr += fmt.Sprintf(` AND receipt_cids.log_contracts && $%d::VARCHAR(66)[]`, len(args))
+	}
+	for i, topics := range filter.Topics {
+		if len(topics) == 0 || i > 3 {
+			continue
+		}
+		hexTopics := make([]string, len(topics))
+		for j, topic := range topics {
+			hexTopics[j] = topic.Hex()
+		}
+		args = append(args, pq.Array(hexTopics))
+		pgStr += fmt.Sprintf(` AND receipt_cids.topic%ds && $%d::VARCHAR(66)[]`, i, len(args))
+	}
+	pgStr += ` ORDER BY header_cids.block_number`
+	heights := make([]uint64, 0)
+	if err := b.db.Reader().Select(&heights, pgStr, args...); err != nil {
+		return nil, err
+	}
+	headers := make([]*Header, 0, len(heights))
+	for _, height := range heights {
+		header, err := b.HeaderByNumber(rpc.BlockNumber(height))
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, header)
+	}
+	return headers, nil
+}
+
+// Logs returns the header's logs that match the filter
+func (b *Backend) Logs(header *Header, filter LogFilter) ([]*types.Log, error) {
+	rcts, err := b.Receipts(header)
+	if err != nil {
+		return nil, err
+	}
+	var logs []*types.Log
+	for _, rct := range rcts {
+		logs = append(logs, FilterLogs(rct.Logs, filter)...)
+	}
+	return logs, nil
+}
+
+// FilterLogs returns the logs that match the filter
+func FilterLogs(logs []*types.Log, filter LogFilter) []*types.Log {
+	var ret []*types.Log
+Logs:
+	for _, log := range logs {
+		if len(filter.Addresses) > 0 && !includes(filter.Addresses, log.Address) {
+			continue
+		}
+		// If the to filtered topics is greater than the amount of topics in logs, skip.
+		if len(filter.Topics) > len(log.Topics) {
+			continue
+		}
+		for i, sub := range filter.Topics {
+			match := len(sub) == 0 // empty rule set == wildcard
+			for _, topic := range sub {
+				if log.Topics[i] == topic {
+					match = true
+					break
+				}
+			}
+			if !match {
+				continue Logs
+			}
+		}
+		ret = append(ret, log)
+	}
+	return ret
+}
+
+func includes(addresses []common.Address, a common.Address) bool {
+	for _, addr := range addresses {
+		if addr == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Account returns the account at the address in the state of the header, nil if it does not exist
+func (b *Backend) Account(address common.Address, header *Header) (*state.Account, error) {
+	height, err := b.stateHeight(header)
+	if err != nil {
+		return nil, err
+	}
+	return b.state.AccountAt(address, height)
+}
+
+// StorageAt returns the value of the storage slot of the account at the address in the state of the header
+func (b *Backend) StorageAt(address common.Address, slot common.Hash, header *Header) (common.Hash, error) {
+	height, err := b.stateHeight(header)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	value, err := b.state.StorageAt(address, slot, height)
+	return common.BytesToHash(value), err
+}
+
+// AccountProof returns the EIP-1186 proof of the account at the address in the state of the header
+func (b *Backend) AccountProof(address common.Address, header *Header) ([][]byte, error) {
+	height, err := b.stateHeight(header)
+	if err != nil {
+		return nil, err
+	}
+	return b.state.AccountProof(address, height)
+}
+
+// StorageProof returns the EIP-1186 proof of the storage slot of the account at the address in the state of the header
+func (b *Backend) StorageProof(address common.Address, slot common.Hash, header *Header) ([][]byte, error) {
+	height, err := b.stateHeight(header)
+	if err != nil {
+		return nil, err
+	}
+	return b.state.StorageProof(address, slot, height)
+}
+
+// stateHeight returns the height of the header, which must be on the canonical chain since state is only resolved along it
+func (b *Backend) stateHeight(header *Header) (uint64, error) {
+	return b.state.CanonicalHeight(header.Hash())
+}
+
+// Code returns the contract code with the code hash
+func (b *Backend) Code(codeHash common.Hash) ([]byte, error) {
+	if codeHash == emptyCodeHash {
+		return []byte{}, nil
+	}
+	mhKey, err := shared.MultihashKeyFromKeccak256(codeHash)
+	if err != nil {
+		return nil, err
+	}
+	var code blockstore.Data
+	if err := b.db.Reader().Get(&code, codePgStr, mhKey); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("code with hash %s is not indexed", codeHash.Hex())
+		}
+		return nil, err
+	}
+	return blockstore.Load(b.blocks, mhKey, code)
+}
@@ -0,0 +1,104 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package serve_test
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/serve"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+var _ = Describe("Backend", func() {
+	Describe("Receipts", func() {
+		var (
+			db          *postgres.DB
+			err         error
+			transformer *eth.StateDiffTransformer
+			backend     *serve.Backend
+		)
+		BeforeEach(func() {
+			db, err = shared.SetupDB()
+			Expect(err).ToNot(HaveOccurred())
+			transformer = eth.NewStateDiffTransformer(params.MainnetChainConfig, db)
+			backend = serve.NewBackend(db, params.MainnetChainConfig)
+		})
+		AfterEach(func() {
+			eth.TearDownDB(db)
+		})
+
+		It("Returns every receipt of a fully indexed block, with the log indexes derived", func() {
+			_, err = transformer.Transform(1, mocks.MockStateDiffPayload)
+			Expect(err).ToNot(HaveOccurred())
+			header, err := backend.HeaderByHash(mocks.MockBlock.Hash())
+			Expect(err).ToNot(HaveOccurred())
+			rcts, err := backend.Receipts(header)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rcts).To(HaveLen(len(mocks.MockReceipts)))
+			Expect(rcts[1].Logs[0].Index).To(Equal(uint(1)))
+		})
+
+		It("Returns ErrPartiallyIndexed if a transaction of the block was filtered out", func() {
+			transformer.SetFilter(shared.IndexFilter{Topics: []common.Hash{common.HexToHash("0x05")}})
+			_, err = transformer.Transform(1, mocks.MockStateDiffPayload)
+			Expect(err).ToNot(HaveOccurred())
+			header, err := backend.HeaderByHash(mocks.MockBlock.Hash())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = backend.Receipts(header)
+			Expect(errors.Is(err, serve.ErrPartiallyIndexed)).To(BeTrue())
+		})
+	})
+
+	Describe("FilterLogs", func() {
+		logs := []*types.Log{mocks.MockLog1, mocks.MockLog2}
+
+		It("Matches every log with an empty filter", func() {
+			Expect(serve.FilterLogs(logs, serve.LogFilter{})).To(Equal(logs))
+		})
+
+		It("Filters logs by address", func() {
+			filter := serve.LogFilter{Addresses: []common.Address{mocks.AnotherAddress}}
+			Expect(serve.FilterLogs(logs, filter)).To(Equal([]*types.Log{mocks.MockLog2}))
+		})
+
+		It("Filters logs by topic position, with empty positions as wildcards", func() {
+			filter := serve.LogFilter{Topics: [][]common.Hash{{}, {common.HexToHash("0x06"), common.HexToHash("0x08")}}}
+			Expect(serve.FilterLogs(logs, filter)).To(Equal([]*types.Log{mocks.MockLog1}))
+			filter = serve.LogFilter{Topics: [][]common.Hash{{common.HexToHash("0x06")}}}
+			Expect(serve.FilterLogs(logs, filter)).To(BeEmpty())
+			filter = serve.LogFilter{Topics: [][]common.Hash{{}, {}, {}}}
+			Expect(serve.FilterLogs(logs, filter)).To(BeEmpty())
+		})
+
+		It("Requires both the address and the topics to match", func() {
+			filter := serve.LogFilter{
+				Addresses: []common.Address{mocks.Address},
+				Topics:    [][]common.Hash{{common.HexToHash("0x05")}},
+			}
+			Expect(serve.FilterLogs(logs, filter)).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,88 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package serve
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/layout"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	srpc "github.com/vulcanize/ipld-eth-indexer/pkg/rpc"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+	"github.com/vulcanize/ipld-eth-indexer/utils"
+)
+
+// Env variables
+const (
+	SERVE_MAX_IDLE_CONNECTIONS = "SERVE_MAX_IDLE_CONNECTIONS"
+	SERVE_MAX_OPEN_CONNECTIONS = "SERVE_MAX_OPEN_CONNECTIONS"
+	SERVE_MAX_CONN_LIFETIME    = "SERVE_MAX_CONN_LIFETIME"
+)
+
+// Config holds the parameters needed to serve the indexed data over the eth json-rpc api
+type Config struct {
+	Server srpc.Config // Endpoints to serve the api on
+
+	// DB info
+	DB       *postgres.DB
+	DBConfig postgres.Config
+
+	// Blockstore the IPLD blocks are read from
+	Blockstore       blockstore.Blockstore
+	BlockstoreConfig blockstore.Config
+
+	NodeInfo node.Info // The node info parameters are used to select the chain config
+
+	Layouts map[common.Address]*layout.Layout // Storage layouts to decode contract storage with, the layout api is only served if there are any
+}
+
+// NewConfig fills and returns a serve config from toml parameters
+func NewConfig() (*Config, error) {
+	c := new(Config)
+	c.Server = srpc.NewConfig()
+	c.NodeInfo = shared.GetEthNodeInfo()
+	var err error
+	c.Layouts, err = layout.GetLayouts()
+	if err != nil {
+		return nil, err
+	}
+
+	c.DBConfig.Init()
+	overrideDBConnConfig(&c.DBConfig)
+	db := utils.LoadPostgres(c.DBConfig, c.NodeInfo, false)
+	c.DB = &db
+	if err := c.BlockstoreConfig.Init(); err != nil {
+		return nil, err
+	}
+	c.Blockstore, err = blockstore.NewBlockstore(c.BlockstoreConfig, c.DB.DB)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func overrideDBConnConfig(con *postgres.Config) {
+	viper.BindEnv("database.serve.maxIdle", SERVE_MAX_IDLE_CONNECTIONS)
+	viper.BindEnv("database.serve.maxOpen", SERVE_MAX_OPEN_CONNECTIONS)
+	viper.BindEnv("database.serve.maxLifetime", SERVE_MAX_CONN_LIFETIME)
+	con.MaxIdle = viper.GetInt("database.serve.maxIdle")
+	con.MaxOpen = viper.GetInt("database.serve.maxOpen")
+	con.MaxLifetime = viper.GetInt("database.serve.maxLifetime")
+}
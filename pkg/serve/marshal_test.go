@@ -0,0 +1,86 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package serve_test
+
+import (
+	"encoding/json"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/serve"
+)
+
+var _ = Describe("Marshalling", func() {
+	It("Marshals blocks with transaction hashes or full transactions", func() {
+		fields := serve.RPCMarshalBlock(mocks.MockBlock, mocks.MockHeader.Difficulty, false)
+		Expect(fields["hash"]).To(Equal(mocks.MockBlock.Hash()))
+		Expect(fields["number"]).To(Equal((*hexutil.Big)(mocks.BlockNumber)))
+		Expect(fields["totalDifficulty"]).To(Equal((*hexutil.Big)(mocks.MockHeader.Difficulty)))
+		Expect(fields["transactions"]).To(Equal([]interface{}{
+			mocks.MockTransactions[0].Hash(),
+			mocks.MockTransactions[1].Hash(),
+			mocks.MockTransactions[2].Hash(),
+		}))
+		Expect(fields["uncles"]).To(Equal([]common.Hash{}))
+
+		fields = serve.RPCMarshalBlock(mocks.MockBlock, mocks.MockHeader.Difficulty, true)
+		txs := fields["transactions"].([]interface{})
+		Expect(txs).To(HaveLen(3))
+		tx := txs[1].(*serve.RPCTransaction)
+		Expect(tx.Hash).To(Equal(mocks.MockTransactions[1].Hash()))
+		Expect(tx.From).To(Equal(mocks.SenderAddr))
+		Expect(*tx.To).To(Equal(mocks.AnotherAddress))
+		Expect(*tx.BlockHash).To(Equal(mocks.MockBlock.Hash()))
+		Expect(uint64(*tx.TransactionIndex)).To(Equal(uint64(1)))
+		_, err := json.Marshal(fields)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("Marshals receipts with their derived fields", func() {
+		// decode the receipts as they are stored in their IPLDs
+		rcts := make(types.Receipts, len(mocks.MockReceipts))
+		for i := range mocks.MockReceipts {
+			rcts[i] = new(types.Receipt)
+			Expect(rlp.DecodeBytes(mocks.MockReceipts.GetRlp(i), rcts[i])).To(Succeed())
+		}
+		err := rcts.DeriveFields(params.MainnetChainConfig, mocks.MockBlock.Hash(), mocks.BlockNumber.Uint64(), mocks.MockTransactions)
+		Expect(err).ToNot(HaveOccurred())
+
+		fields := serve.RPCMarshalReceipt(rcts[2], mocks.MockTransactions[2])
+		Expect(fields["blockHash"]).To(Equal(mocks.MockBlock.Hash()))
+		Expect(fields["transactionHash"]).To(Equal(mocks.MockTransactions[2].Hash()))
+		Expect(fields["transactionIndex"]).To(Equal(hexutil.Uint64(2)))
+		Expect(fields["from"]).To(Equal(mocks.SenderAddr))
+		Expect(fields["contractAddress"]).To(Equal(mocks.ContractAddress))
+		Expect(fields["root"]).To(Equal(hexutil.Bytes(common.HexToHash("0x2").Bytes())))
+		Expect(fields["logs"]).To(Equal([]*types.Log{}))
+
+		fields = serve.RPCMarshalReceipt(rcts[1], mocks.MockTransactions[1])
+		Expect(fields["contractAddress"]).To(BeNil())
+		logs := fields["logs"].([]*types.Log)
+		Expect(logs).To(HaveLen(1))
+		Expect(logs[0].Index).To(Equal(uint(1)))
+		Expect(logs[0].TxHash).To(Equal(mocks.MockTransactions[1].Hash()))
+	})
+})
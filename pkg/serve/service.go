@@ -0,0 +1,80 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package serve
+
+import (
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/layout"
+)
+
+// Server is the top level interface for serving the indexed data over json-rpc
+type Server interface {
+	// APIs to register with the rpc server
+	APIs() []rpc.API
+}
+
+// Service is the underlying struct for the server
+type Service struct {
+	// Backend for reading chain data out of Postgres
+	Backend *Backend
+	// Decodes the storage of the contracts with storage layouts, nil if there are none
+	Layouts *layout.PublicLayoutAPI
+}
+
+// NewServeService creates a new Server using an underlying Service struct
+func NewServeService(settings *Config) (Server, error) {
+	chainConfig, err := eth.ChainConfig(settings.NodeInfo.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	s := &Service{
+		Backend: NewBackend(settings.DB, chainConfig),
+	}
+	if settings.Blockstore != nil {
+		s.Backend.SetBlockstore(settings.Blockstore)
+	}
+	if len(settings.Layouts) > 0 {
+		s.Layouts = layout.NewPublicLayoutAPI(settings.DB, settings.Layouts)
+		if settings.Blockstore != nil {
+			s.Layouts.SetBlockstore(settings.Blockstore)
+		}
+	}
+	return s, nil
+}
+
+// APIs returns the RPC descriptors the server offers
+func (s *Service) APIs() []rpc.API {
+	apis := []rpc.API{
+		{
+			Namespace: APIName,
+			Version:   APIVersion,
+			Service:   NewPublicEthAPI(s.Backend),
+			Public:    true,
+		},
+	}
+	if s.Layouts != nil {
+		apis = append(apis, rpc.API{
+			Namespace: layout.APIName,
+			Version:   layout.APIVersion,
+			Service:   s.Layouts,
+			Public:    true,
+		})
+	}
+	return apis
+}
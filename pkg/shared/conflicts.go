@@ -0,0 +1,60 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package shared
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Env variables
+const (
+	INDEX_CONFLICTS = "INDEX_CONFLICTS"
+)
+
+// ConflictMode is how the indexer handles re-indexing a row with content that differs from what is already indexed,
+// for example a different cid for a transaction already indexed under the same header
+type ConflictMode string
+
+const (
+	// OverwriteConflicts replaces the existing content and records the change in eth.upsert_conflicts
+	OverwriteConflicts ConflictMode = "overwrite"
+	// AuditConflicts keeps the existing content and records the rejected change in eth.upsert_conflicts
+	AuditConflicts ConflictMode = "audit"
+	// RejectConflicts fails the whole payload, leaving the database as it was
+	RejectConflicts ConflictMode = "reject"
+)
+
+// ParseConflictMode returns the ConflictMode with the name, an empty name is OverwriteConflicts
+func ParseConflictMode(name string) (ConflictMode, error) {
+	switch m := ConflictMode(strings.ToLower(name)); m {
+	case "", OverwriteConflicts:
+		return OverwriteConflicts, nil
+	case AuditConflicts, RejectConflicts:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unrecognized conflict mode %q", name)
+	}
+}
+
+// GetConflictMode returns the conflict mode from the config
+func GetConflictMode() (ConflictMode, error) {
+	viper.BindEnv("index.conflicts", INDEX_CONFLICTS)
+	return ParseConflictMode(viper.GetString("index.conflicts"))
+}
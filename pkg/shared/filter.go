@@ -0,0 +1,120 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package shared
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/viper"
+)
+
+// Env variables
+const (
+	INDEX_TYPES     = "INDEX_TYPES"
+	INDEX_ADDRESSES = "INDEX_ADDRESSES"
+	INDEX_TOPICS    = "INDEX_TOPICS"
+	INDEX_SRC       = "INDEX_SRC"
+	INDEX_DST       = "INDEX_DST"
+)
+
+// IndexFilter selects the subset of each payload that is indexed
+// Headers are always indexed, so that gap detection keeps working
+type IndexFilter struct {
+	// Data types to index, all of them if empty
+	Types []DataType
+	// Watched accounts; their state and storage, the transactions sent to them and the logs they emit are indexed
+	Addresses []common.Address
+	// Watched event topics (topic0); the transactions which emit logs with them are indexed
+	Topics []common.Hash
+	// Watched transaction senders and recipients
+	Src, Dst []common.Address
+}
+
+// GetIndexFilter returns the index filter from the config
+func GetIndexFilter() (IndexFilter, error) {
+	viper.BindEnv("index.types", INDEX_TYPES)
+	viper.BindEnv("index.addresses", INDEX_ADDRESSES)
+	viper.BindEnv("index.topics", INDEX_TOPICS)
+	viper.BindEnv("index.src", INDEX_SRC)
+	viper.BindEnv("index.dst", INDEX_DST)
+
+	var f IndexFilter
+	var err error
+	if f.Addresses, err = hexToAddresses(viper.GetStringSlice("index.addresses")); err != nil {
+		return IndexFilter{}, err
+	}
+	if f.Src, err = hexToAddresses(viper.GetStringSlice("index.src")); err != nil {
+		return IndexFilter{}, err
+	}
+	if f.Dst, err = hexToAddresses(viper.GetStringSlice("index.dst")); err != nil {
+		return IndexFilter{}, err
+	}
+	for _, str := range viper.GetStringSlice("index.types") {
+		dataType, err := GenerateDataTypeFromString(str)
+		if err != nil {
+			return IndexFilter{}, err
+		}
+		f.Types = append(f.Types, dataType)
+	}
+	for _, str := range viper.GetStringSlice("index.topics") {
+		f.Topics = append(f.Topics, common.HexToHash(str))
+	}
+	return f, nil
+}
+
+func hexToAddresses(strs []string) ([]common.Address, error) {
+	var addresses []common.Address
+	for _, str := range strs {
+		if !common.IsHexAddress(str) {
+			return nil, fmt.Errorf("invalid index filter address: %s", str)
+		}
+		addresses = append(addresses, common.HexToAddress(str))
+	}
+	return addresses, nil
+}
+
+// Indexes returns true if the data type is indexed
+func (f IndexFilter) Indexes(t DataType) bool {
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, dataType := range f.Types {
+		if dataType == Full || dataType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// FiltersTransactions returns true if only the transactions matching the filter are indexed
+func (f IndexFilter) FiltersTransactions() bool {
+	return len(f.Addresses) > 0 || len(f.Topics) > 0 || len(f.Src) > 0 || len(f.Dst) > 0
+}
+
+// FullState returns true if every state and storage node is indexed
+func (f IndexFilter) FullState() bool {
+	return len(f.Addresses) == 0 && f.Indexes(State) && f.Indexes(Storage)
+}
+
+// String returns a description of the filter for logging
+func (f IndexFilter) String() string {
+	if len(f.Types) == 0 && !f.FiltersTransactions() {
+		return "everything"
+	}
+	return fmt.Sprintf("types %v, %d addresses, %d topics, %d senders, %d recipients", f.Types, len(f.Addresses), len(f.Topics), len(f.Src), len(f.Dst))
+}
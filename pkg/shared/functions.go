@@ -17,14 +17,21 @@
 package shared
 
 import (
+	"bytes"
+	"fmt"
+	"strings"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-ipfs-blockstore"
 	"github.com/ipfs/go-ipfs-ds-help"
 	node "github.com/ipfs/go-ipld-format"
 	"github.com/jmoiron/sqlx"
 	"github.com/multiformats/go-multihash"
 	"github.com/sirupsen/logrus"
+
+	ipldstore "github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/ipfs/ipld"
 )
 
@@ -51,31 +58,29 @@ func Rollback(tx *sqlx.Tx) {
 	}
 }
 
-// PublishIPLD is used to insert an ipld into Postgres blockstore with the provided tx
-func PublishIPLD(tx *sqlx.Tx, i node.Node) error {
-	dbKey := dshelp.MultihashToDsKey(i.Cid().Hash())
-	prefixedKey := blockstore.BlockPrefix.String() + dbKey.String()
-	raw := i.RawData()
-	_, err := tx.Exec(`INSERT INTO public.blocks (key, data) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING`, prefixedKey, raw)
-	return err
+// PublishIPLD is used to publish an ipld to the blockstore with the provided tx
+func PublishIPLD(tx *ipldstore.Tx, i node.Node) error {
+	return tx.Put(MultihashKeyFromCID(i.Cid()), i.RawData())
 }
 
-// FetchIPLD is used to retrieve an ipld from Postgres blockstore with the provided tx and cid string
-func FetchIPLD(tx *sqlx.Tx, cid string) ([]byte, error) {
+// FetchIPLD is used to retrieve an ipld with the provided tx or db, blockstore and cid string
+func FetchIPLD(q sqlx.Queryer, store ipldstore.Blockstore, cid string) ([]byte, error) {
 	mhKey, err := MultihashKeyFromCIDString(cid)
 	if err != nil {
 		return nil, err
 	}
-	pgStr := `SELECT data FROM public.blocks WHERE key = $1`
-	var block []byte
-	return block, tx.Get(&block, pgStr, mhKey)
+	return FetchIPLDByMhKey(q, store, mhKey)
 }
 
-// FetchIPLDByMhKey is used to retrieve an ipld from Postgres blockstore with the provided tx and mhkey string
-func FetchIPLDByMhKey(tx *sqlx.Tx, mhKey string) ([]byte, error) {
+// FetchIPLDByMhKey is used to retrieve an ipld with the provided tx or db, blockstore and mhkey string
+// the data is decompressed if it was stored compressed, and read from the blockstore if public.blocks only records its key
+func FetchIPLDByMhKey(q sqlx.Queryer, store ipldstore.Blockstore, mhKey string) ([]byte, error) {
 	pgStr := `SELECT data FROM public.blocks WHERE key = $1`
-	var block []byte
-	return block, tx.Get(&block, pgStr, mhKey)
+	var block ipldstore.Data
+	if err := sqlx.Get(q, &block, pgStr, mhKey); err != nil {
+		return nil, err
+	}
+	return ipldstore.Load(store, mhKey, block)
 }
 
 // MultihashKeyFromCID converts a cid into a blockstore-prefixed multihash db key string
@@ -94,16 +99,34 @@ func MultihashKeyFromCIDString(c string) (string, error) {
 	return blockstore.BlockPrefix.String() + dbKey.String(), nil
 }
 
-// PublishRaw derives a cid from raw bytes and provided codec and multihash type, and writes it to the db tx
-func PublishRaw(tx *sqlx.Tx, codec, mh uint64, raw []byte) (string, error) {
+// MultihashFromKey converts a blockstore-prefixed multihash db key string back into the multihash
+func MultihashFromKey(key string) (multihash.Multihash, error) {
+	if !strings.HasPrefix(key, blockstore.BlockPrefix.String()) {
+		return nil, fmt.Errorf("key %s is not blockstore-prefixed", key)
+	}
+	return dshelp.DsKeyToMultihash(datastore.NewKey(strings.TrimPrefix(key, blockstore.BlockPrefix.String())))
+}
+
+// VerifyMultihash recomputes the multihash of the data, using the hash function of the provided multihash, and compares the two
+func VerifyMultihash(mh multihash.Multihash, data []byte) (bool, error) {
+	decoded, err := multihash.Decode(mh)
+	if err != nil {
+		return false, err
+	}
+	sum, err := multihash.Sum(data, decoded.Code, decoded.Length)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(sum, mh), nil
+}
+
+// PublishRaw derives a cid from raw bytes and provided codec and multihash type, and publishes it to the blockstore with the provided tx
+func PublishRaw(tx *ipldstore.Tx, codec, mh uint64, raw []byte) (string, error) {
 	c, err := ipld.RawdataToCid(codec, raw, mh)
 	if err != nil {
 		return "", err
 	}
-	dbKey := dshelp.MultihashToDsKey(c.Hash())
-	prefixedKey := blockstore.BlockPrefix.String() + dbKey.String()
-	_, err = tx.Exec(`INSERT INTO public.blocks (key, data) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING`, prefixedKey, raw)
-	return c.String(), err
+	return c.String(), tx.Put(MultihashKeyFromCID(c), raw)
 }
 
 // MultihashKeyFromKeccak256 converts keccak256 hash bytes into a blockstore-prefixed multihash db key string
@@ -116,8 +139,7 @@ func MultihashKeyFromKeccak256(hash common.Hash) (string, error) {
 	return blockstore.BlockPrefix.String() + dbKey.String(), nil
 }
 
-// PublishDirect diretly writes a previously derived mhkey => value pair to the ipld database
-func PublishDirect(tx *sqlx.Tx, key string, value []byte) error {
-	_, err := tx.Exec(`INSERT INTO public.blocks (key, data) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING`, key, value)
-	return err
+// PublishDirect diretly writes a previously derived mhkey => value pair to the blockstore with the provided tx
+func PublishDirect(tx *ipldstore.Tx, key string, value []byte) error {
+	return tx.Put(key, value)
 }
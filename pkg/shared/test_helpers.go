@@ -28,14 +28,15 @@ import (
 
 // SetupDB is use to setup a db for watcher tests
 func SetupDB() (*postgres.DB, error) {
-	return postgres.NewDB(getTestConfig(), node.Info{}, true)
+	return postgres.NewDB(TestConfig(), node.Info{}, true)
 }
 
 func SetupDBWithNode(node node.Info) (*postgres.DB, error) {
-	return postgres.NewDB(getTestConfig(), node, true)
+	return postgres.NewDB(TestConfig(), node, true)
 }
 
-func getTestConfig() postgres.Config {
+// TestConfig returns the config of the test database, taken from the DATABASE_* environment variables
+func TestConfig() postgres.Config {
 	// get connection to test database from environment variables
 	hostname := os.Getenv(postgres.DATABASE_HOSTNAME)
 	if hostname == "" {
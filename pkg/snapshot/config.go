@@ -0,0 +1,137 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+	"github.com/vulcanize/ipld-eth-indexer/utils"
+)
+
+// Env variables
+const (
+	SNAPSHOT_BLOCK_HEIGHT = "SNAPSHOT_BLOCK_HEIGHT"
+	SNAPSHOT_MODE         = "SNAPSHOT_MODE"
+	SNAPSHOT_LEVELDB_PATH = "SNAPSHOT_LEVELDB_PATH"
+	SNAPSHOT_ANCIENT_PATH = "SNAPSHOT_ANCIENT_PATH"
+	SNAPSHOT_BATCH_SIZE   = "SNAPSHOT_BATCH_SIZE"
+
+	SNAPSHOT_MAX_IDLE_CONNECTIONS = "SNAPSHOT_MAX_IDLE_CONNECTIONS"
+	SNAPSHOT_MAX_OPEN_CONNECTIONS = "SNAPSHOT_MAX_OPEN_CONNECTIONS"
+	SNAPSHOT_MAX_CONN_LIFETIME    = "SNAPSHOT_MAX_CONN_LIFETIME"
+)
+
+// Mode is the source the snapshot is taken from
+type Mode string
+
+const (
+	LevelDB Mode = "leveldb"
+	RPC     Mode = "rpc"
+)
+
+// Config holds the parameters needed to take a snapshot
+type Config struct {
+	BlockHeight uint64 // Block height to snapshot the state at
+	Mode        Mode   // Source to take the snapshot from
+	LevelDBPath string // Path to the geth leveldb chaindata directory, for the leveldb mode
+	AncientPath string // Path to the geth ancient (freezer) directory, for the leveldb mode
+	BatchSize   uint64 // Number of nodes to publish per Postgres transaction
+
+	// DB info
+	DB               *postgres.DB
+	DBConfig         postgres.Config
+	Blockstore       blockstore.Blockstore
+	BlockstoreConfig blockstore.Config
+
+	HTTPClient *rpc.Client   // Ethereum rpc client, for the rpc mode
+	Timeout    time.Duration // HTTP connection timeout in seconds
+	NodeInfo   node.Info
+}
+
+// NewConfig fills and returns a snapshot config from toml parameters
+func NewConfig() (*Config, error) {
+	c := new(Config)
+	var err error
+
+	viper.BindEnv("ethereum.httpPath", shared.ETH_HTTP_PATH)
+	viper.BindEnv("snapshot.blockHeight", SNAPSHOT_BLOCK_HEIGHT)
+	viper.BindEnv("snapshot.mode", SNAPSHOT_MODE)
+	viper.BindEnv("snapshot.levelDBPath", SNAPSHOT_LEVELDB_PATH)
+	viper.BindEnv("snapshot.ancientPath", SNAPSHOT_ANCIENT_PATH)
+	viper.BindEnv("snapshot.batchSize", SNAPSHOT_BATCH_SIZE)
+	viper.BindEnv("snapshot.timeout", shared.HTTP_TIMEOUT)
+
+	c.BlockHeight = uint64(viper.GetInt64("snapshot.blockHeight"))
+	c.BatchSize = uint64(viper.GetInt64("snapshot.batchSize"))
+	timeout := viper.GetInt("snapshot.timeout")
+	if timeout < 15 {
+		timeout = 15
+	}
+	c.Timeout = time.Second * time.Duration(timeout)
+
+	c.Mode = Mode(viper.GetString("snapshot.mode"))
+	switch c.Mode {
+	case LevelDB:
+		c.LevelDBPath = viper.GetString("snapshot.levelDBPath")
+		if c.LevelDBPath == "" {
+			return nil, fmt.Errorf("snapshot leveldb mode requires a leveldb path")
+		}
+		c.AncientPath = viper.GetString("snapshot.ancientPath")
+		if c.AncientPath == "" {
+			c.AncientPath = c.LevelDBPath + "/ancient"
+		}
+		c.NodeInfo = shared.GetEthNodeInfo()
+	case RPC:
+		ethHTTP := viper.GetString("ethereum.httpPath")
+		c.NodeInfo, c.HTTPClient, err = shared.GetEthNodeAndClient(fmt.Sprintf("http://%s", ethHTTP))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unrecognized snapshot mode %q, expected %q or %q", c.Mode, LevelDB, RPC)
+	}
+
+	c.DBConfig.Init()
+	overrideDBConnConfig(&c.DBConfig)
+	db := utils.LoadPostgres(c.DBConfig, c.NodeInfo, true)
+	c.DB = &db
+	if err := c.BlockstoreConfig.Init(); err != nil {
+		return nil, err
+	}
+	c.Blockstore, err = blockstore.NewBlockstore(c.BlockstoreConfig, c.DB.DB)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func overrideDBConnConfig(con *postgres.Config) {
+	viper.BindEnv("database.snapshot.maxIdle", SNAPSHOT_MAX_IDLE_CONNECTIONS)
+	viper.BindEnv("database.snapshot.maxOpen", SNAPSHOT_MAX_OPEN_CONNECTIONS)
+	viper.BindEnv("database.snapshot.maxLifetime", SNAPSHOT_MAX_CONN_LIFETIME)
+	con.MaxIdle = viper.GetInt("database.snapshot.maxIdle")
+	con.MaxOpen = viper.GetInt("database.snapshot.maxOpen")
+	con.MaxLifetime = viper.GetInt("database.snapshot.maxLifetime")
+}
@@ -0,0 +1,239 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+// DefaultBatchSize is the default number of nodes published per Postgres transaction
+const DefaultBatchSize uint64 = 10000
+
+// Snapshotter is the top level interface for indexing a full state snapshot
+type Snapshotter interface {
+	Snapshot() error
+}
+
+// Service for indexing a full state snapshot
+type Service struct {
+	// DB to index the snapshot into
+	DB *postgres.DB
+	// Blockstore to publish the IPLDs of the snapshot to
+	Blockstore blockstore.Blockstore
+	// Interface for reading the block and state trie to snapshot
+	Source Source
+	// Interface for transforming the snapshot block into IPLD object models in Postgres
+	Transformer eth.Transformer
+	// Publisher for the state and storage nodes of the snapshot
+	Publisher *eth.StatePublisher
+	// Block height to snapshot the state at
+	height uint64
+	// Number of nodes published per Postgres transaction
+	batchSize uint64
+}
+
+// NewSnapshotService returns a new snapshot service
+func NewSnapshotService(settings *Config) (Snapshotter, error) {
+	var source Source
+	var err error
+	switch settings.Mode {
+	case LevelDB:
+		source, err = NewLevelDBSource(settings.LevelDBPath, settings.AncientPath)
+		if err != nil {
+			return nil, err
+		}
+	case RPC:
+		source = NewRPCSource(settings.HTTPClient, settings.Timeout)
+	default:
+		return nil, fmt.Errorf("unrecognized snapshot mode %q", settings.Mode)
+	}
+	return NewService(settings.DB, settings.Blockstore, source, settings.BlockHeight, settings.BatchSize)
+}
+
+// NewService returns a new snapshot service which indexes the state at the provided height read from the provided source
+func NewService(db *postgres.DB, blocks blockstore.Blockstore, source Source, height, batchSize uint64) (*Service, error) {
+	chainConfig, err := eth.ChainConfig(db.Node.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	if batchSize == 0 {
+		batchSize = DefaultBatchSize
+	}
+	transformer := eth.NewStateDiffTransformer(chainConfig, db)
+	transformer.SetBlockstore(blocks)
+	return &Service{
+		DB:          db,
+		Blockstore:  blocks,
+		Source:      source,
+		Transformer: transformer,
+		Publisher:   eth.NewStatePublisher(db),
+		height:      height,
+		batchSize:   batchSize,
+	}, nil
+}
+
+// Snapshot indexes the block at the configured height, and then every node of its state trie and storage tries with diff=false
+func (s *Service) Snapshot() error {
+	defer s.Source.Close()
+	payload, err := s.Source.BlockPayload(s.height)
+	if err != nil {
+		return err
+	}
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(payload.BlockRlp, block); err != nil {
+		return fmt.Errorf("error decoding payload block rlp: %v", err)
+	}
+	// the payload carries an empty state diff, so this publishes and indexes only the header, uncles, txs, and receipts
+	if _, err := s.Transformer.Transform(0, payload); err != nil {
+		return err
+	}
+	var headerID int64
+	if err := s.DB.Get(&headerID, `SELECT id FROM eth.header_cids WHERE chain_id = $1 AND block_hash = $2`, s.DB.Node.ChainID, block.Hash().String()); err != nil {
+		return err
+	}
+	logrus.Infof("snapshotting state trie %s at height %d", block.Root().Hex(), block.NumberU64())
+	bp := &batchPublisher{
+		db:        s.DB,
+		blocks:    s.Blockstore,
+		publisher: s.Publisher,
+		headerID:  headerID,
+		height:    block.NumberU64(),
+		batchSize: s.batchSize,
+	}
+	if err := s.Source.WalkState(block.Root(), bp); err != nil {
+		bp.rollback()
+		return err
+	}
+	if err := bp.commit(); err != nil {
+		return err
+	}
+	logrus.Infof("finished snapshot at height %d: published %d state nodes, %d storage nodes, and %d contracts",
+		block.NumberU64(), bp.stateNodes, bp.storageNodes, bp.codes)
+	return nil
+}
+
+// batchPublisher satisfies the NodeHandler interface by publishing the nodes it is handed, committing every batchSize nodes
+type batchPublisher struct {
+	db        *postgres.DB
+	blocks    blockstore.Blockstore
+	publisher *eth.StatePublisher
+	headerID  int64
+	height    uint64
+	batchSize uint64
+
+	tx *blockstore.Tx
+	// number of nodes published in the current tx
+	pending uint64
+	// stateID of the last state node published, for its storage nodes to reference
+	stateID int64
+
+	stateNodes, storageNodes, codes uint64
+}
+
+// HandleStateNode satisfies the NodeHandler interface
+func (bp *batchPublisher) HandleStateNode(node sdtypes.StateNode) error {
+	if err := bp.begin(); err != nil {
+		return err
+	}
+	stateID, err := bp.publisher.PublishStateNode(bp.tx, bp.headerID, bp.height, node, false)
+	if err != nil {
+		return err
+	}
+	bp.stateID = stateID
+	bp.stateNodes++
+	return bp.next()
+}
+
+// HandleStorageNode satisfies the NodeHandler interface
+func (bp *batchPublisher) HandleStorageNode(node sdtypes.StorageNode) error {
+	if bp.stateID == 0 {
+		return fmt.Errorf("storage node at path %x handled before any state node", node.Path)
+	}
+	if err := bp.begin(); err != nil {
+		return err
+	}
+	if err := bp.publisher.PublishStorageNode(bp.tx, bp.stateID, bp.height, node, false); err != nil {
+		return err
+	}
+	bp.storageNodes++
+	return bp.next()
+}
+
+// HandleCode satisfies the NodeHandler interface
+func (bp *batchPublisher) HandleCode(codeHash common.Hash, code []byte) error {
+	if err := bp.begin(); err != nil {
+		return err
+	}
+	if err := bp.publisher.PublishCode(bp.tx, bp.headerID, bp.height, codeHash, code, ""); err != nil {
+		return err
+	}
+	bp.codes++
+	return bp.next()
+}
+
+func (bp *batchPublisher) begin() error {
+	if bp.tx != nil {
+		return nil
+	}
+	tx, err := blockstore.Begin(bp.db.DB, bp.blocks)
+	if err != nil {
+		return err
+	}
+	bp.tx = tx
+	return nil
+}
+
+// next commits the current tx once it holds a full batch of nodes
+func (bp *batchPublisher) next() error {
+	bp.pending++
+	if bp.pending < bp.batchSize {
+		return nil
+	}
+	if err := bp.commit(); err != nil {
+		return err
+	}
+	logrus.Infof("snapshot progress: published %d state nodes, %d storage nodes, and %d contracts", bp.stateNodes, bp.storageNodes, bp.codes)
+	return nil
+}
+
+func (bp *batchPublisher) commit() error {
+	if bp.tx == nil {
+		return nil
+	}
+	err := bp.tx.Commit()
+	bp.tx = nil
+	bp.pending = 0
+	return err
+}
+
+func (bp *batchPublisher) rollback() {
+	if bp.tx != nil {
+		shared.Rollback(bp.tx.Tx)
+		bp.tx = nil
+	}
+}
@@ -0,0 +1,291 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/statediff"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+)
+
+var nullCodeHash = crypto.Keccak256(nil)
+
+// Source interface for the block and full state trie to snapshot
+type Source interface {
+	// BlockPayload returns a payload for the block at the provided height, with an empty state diff
+	BlockPayload(height uint64) (statediff.Payload, error)
+	// WalkState passes every node of the state trie with the provided root, and of the storage tries of its accounts, to the handler
+	WalkState(root common.Hash, handler NodeHandler) error
+	Close() error
+}
+
+// NodeHandler interface for processing the nodes of a state trie as they are walked
+type NodeHandler interface {
+	// HandleStateNode is called with every state node, without its storage nodes
+	HandleStateNode(node sdtypes.StateNode) error
+	// HandleStorageNode is called with every storage node of the account held in the state node last handled
+	HandleStorageNode(node sdtypes.StorageNode) error
+	// HandleCode is called with the code of every contract account
+	HandleCode(codeHash common.Hash, code []byte) error
+}
+
+// ChainDBSource satisfies the Source interface by reading directly from a geth chain database
+type ChainDBSource struct {
+	db ethdb.Database
+}
+
+// NewLevelDBSource opens the geth leveldb database, and its ancient (freezer) database, at the provided paths
+// The geth node using the database must be stopped first
+func NewLevelDBSource(path, ancientPath string) (*ChainDBSource, error) {
+	db, err := rawdb.NewLevelDBDatabaseWithFreezer(path, 1024, 256, ancientPath, "ipld-eth-indexer/snapshot/")
+	if err != nil {
+		return nil, err
+	}
+	return NewChainDBSource(db), nil
+}
+
+// NewChainDBSource returns a ChainDBSource reading from the provided geth chain database
+func NewChainDBSource(db ethdb.Database) *ChainDBSource {
+	return &ChainDBSource{db: db}
+}
+
+// BlockPayload satisfies the Source interface
+func (cs *ChainDBSource) BlockPayload(height uint64) (statediff.Payload, error) {
+	hash := rawdb.ReadCanonicalHash(cs.db, height)
+	if hash == (common.Hash{}) {
+		return statediff.Payload{}, fmt.Errorf("no canonical block found at height %d", height)
+	}
+	block := rawdb.ReadBlock(cs.db, hash, height)
+	if block == nil {
+		return statediff.Payload{}, fmt.Errorf("block %s at height %d not found", hash.Hex(), height)
+	}
+	td := rawdb.ReadTd(cs.db, hash, height)
+	if td == nil {
+		return statediff.Payload{}, fmt.Errorf("total difficulty of block %s at height %d not found", hash.Hex(), height)
+	}
+	receipts := rawdb.ReadRawReceipts(cs.db, hash, height)
+	if receipts == nil {
+		receipts = types.Receipts{}
+	}
+	return newPayload(block, receipts, td)
+}
+
+// WalkState satisfies the Source interface
+func (cs *ChainDBSource) WalkState(root common.Hash, handler NodeHandler) error {
+	sdb := state.NewDatabase(cs.db)
+	stateTrie, err := sdb.OpenTrie(root)
+	if err != nil {
+		return fmt.Errorf("error opening state trie %s: %v", root.Hex(), err)
+	}
+	return walkTrie(sdb, stateTrie, func(path []byte, value []byte, n *eth.DecodedTrieNode) error {
+		stateNode := sdtypes.StateNode{
+			NodeType:  n.NodeType,
+			Path:      path,
+			NodeValue: value,
+		}
+		if n.NodeType != sdtypes.Leaf {
+			return handler.HandleStateNode(stateNode)
+		}
+		stateNode.LeafKey = eth.LeafKey(path, n)
+		if err := handler.HandleStateNode(stateNode); err != nil {
+			return err
+		}
+		var account state.Account
+		if err := rlp.DecodeBytes(n.Value, &account); err != nil {
+			return fmt.Errorf("error decoding account at path %x: %v", path, err)
+		}
+		addrHash := common.BytesToHash(stateNode.LeafKey)
+		if account.Root != types.EmptyRootHash {
+			storageTrie, err := sdb.OpenStorageTrie(addrHash, account.Root)
+			if err != nil {
+				return fmt.Errorf("error opening storage trie %s: %v", account.Root.Hex(), err)
+			}
+			if err := walkTrie(sdb, storageTrie, func(path []byte, value []byte, n *eth.DecodedTrieNode) error {
+				storageNode := sdtypes.StorageNode{
+					NodeType:  n.NodeType,
+					Path:      path,
+					NodeValue: value,
+				}
+				if n.NodeType == sdtypes.Leaf {
+					storageNode.LeafKey = eth.LeafKey(path, n)
+				}
+				return handler.HandleStorageNode(storageNode)
+			}); err != nil {
+				return err
+			}
+		}
+		if !bytes.Equal(account.CodeHash, nullCodeHash) {
+			codeHash := common.BytesToHash(account.CodeHash)
+			code, err := sdb.ContractCode(addrHash, codeHash)
+			if err != nil {
+				return fmt.Errorf("error retrieving code %s: %v", codeHash.Hex(), err)
+			}
+			return handler.HandleCode(codeHash, code)
+		}
+		return nil
+	})
+}
+
+// Close closes the underlying database
+func (cs *ChainDBSource) Close() error {
+	return cs.db.Close()
+}
+
+// walkTrie calls f with the path, rlp, and decoded form of every hashed node in the trie
+// like the statediff builder, nodes embedded in their parent are skipped
+func walkTrie(sdb state.Database, tr state.Trie, f func(path []byte, value []byte, n *eth.DecodedTrieNode) error) error {
+	it := tr.NodeIterator(nil)
+	for it.Next(true) {
+		// skip value nodes and embedded nodes
+		if it.Leaf() || it.Hash() == (common.Hash{}) {
+			continue
+		}
+		value, err := sdb.TrieDB().Node(it.Hash())
+		if err != nil {
+			return err
+		}
+		n, err := eth.DecodeTrieNode(value)
+		if err != nil {
+			return fmt.Errorf("error decoding trie node %s: %v", it.Hash().Hex(), err)
+		}
+		if err := f(common.CopyBytes(it.Path()), value, n); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// RPCSource satisfies the Source interface by fetching the full state trie from a statediffing geth node over rpc
+// The entire state trie is returned in a single payload, so this is only suited to chains with a small state
+type RPCSource struct {
+	client  *rpc.Client
+	timeout time.Duration
+	// the state trie fetched with the last block payload
+	stateTrie *statediff.StateObject
+}
+
+const stateTrieMethod = "statediff_stateTrieAt"
+
+// NewRPCSource returns a new RPCSource
+func NewRPCSource(client *rpc.Client, timeout time.Duration) *RPCSource {
+	return &RPCSource{
+		client:  client,
+		timeout: timeout,
+	}
+}
+
+// BlockPayload satisfies the Source interface
+// Calls StateTrieAt(ctx context.Context, blockNumber uint64, params Params) (*Payload, error)
+func (rs *RPCSource) BlockPayload(height uint64) (statediff.Payload, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.timeout)
+	defer cancel()
+	payload := new(statediff.Payload)
+	if err := rs.client.CallContext(ctx, payload, stateTrieMethod, height, statediff.Params{
+		IncludeBlock:    true,
+		IncludeReceipts: true,
+		IncludeTD:       true,
+		IncludeCode:     true,
+	}); err != nil {
+		return statediff.Payload{}, fmt.Errorf("ethereum RPCSource err at blockheight %d: %v", height, err)
+	}
+	stateTrie := new(statediff.StateObject)
+	if err := rlp.DecodeBytes(payload.StateObjectRlp, stateTrie); err != nil {
+		return statediff.Payload{}, fmt.Errorf("error decoding payload state object rlp: %v", err)
+	}
+	rs.stateTrie = stateTrie
+	emptyDiff, err := rlp.EncodeToBytes(statediff.StateObject{
+		BlockNumber: stateTrie.BlockNumber,
+		BlockHash:   stateTrie.BlockHash,
+	})
+	if err != nil {
+		return statediff.Payload{}, err
+	}
+	payload.StateObjectRlp = emptyDiff
+	return *payload, nil
+}
+
+// WalkState satisfies the Source interface
+// It replays the state trie fetched with the last block payload
+func (rs *RPCSource) WalkState(root common.Hash, handler NodeHandler) error {
+	if rs.stateTrie == nil {
+		return fmt.Errorf("no state trie has been fetched")
+	}
+	for _, stateNode := range rs.stateTrie.Nodes {
+		storageNodes := stateNode.StorageNodes
+		stateNode.StorageNodes = nil
+		if err := handler.HandleStateNode(stateNode); err != nil {
+			return err
+		}
+		for _, storageNode := range storageNodes {
+			if err := handler.HandleStorageNode(storageNode); err != nil {
+				return err
+			}
+		}
+	}
+	for _, c := range rs.stateTrie.CodeAndCodeHashes {
+		if err := handler.HandleCode(c.Hash, c.Code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close satisfies the Source interface
+func (rs *RPCSource) Close() error {
+	rs.client.Close()
+	return nil
+}
+
+// newPayload packages the block, its receipts, and its total difficulty with an empty state diff
+func newPayload(block *types.Block, receipts types.Receipts, td *big.Int) (statediff.Payload, error) {
+	blockRlp, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return statediff.Payload{}, err
+	}
+	receiptsRlp, err := rlp.EncodeToBytes(receipts)
+	if err != nil {
+		return statediff.Payload{}, err
+	}
+	emptyDiff, err := rlp.EncodeToBytes(statediff.StateObject{
+		BlockNumber: block.Number(),
+		BlockHash:   block.Hash(),
+	})
+	if err != nil {
+		return statediff.Payload{}, err
+	}
+	return statediff.Payload{
+		BlockRlp:        blockRlp,
+		ReceiptsRlp:     receiptsRlp,
+		TotalDifficulty: td,
+		StateObjectRlp:  emptyDiff,
+	}, nil
+}
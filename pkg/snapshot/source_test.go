@@ -0,0 +1,132 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot_test
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/statediff"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/snapshot"
+)
+
+// recordingHandler collects the nodes it is handed, nesting storage nodes under the last state node
+type recordingHandler struct {
+	stateNodes []sdtypes.StateNode
+	codes      map[common.Hash][]byte
+}
+
+func (rh *recordingHandler) HandleStateNode(node sdtypes.StateNode) error {
+	rh.stateNodes = append(rh.stateNodes, node)
+	return nil
+}
+
+func (rh *recordingHandler) HandleStorageNode(node sdtypes.StorageNode) error {
+	last := &rh.stateNodes[len(rh.stateNodes)-1]
+	last.StorageNodes = append(last.StorageNodes, node)
+	return nil
+}
+
+func (rh *recordingHandler) HandleCode(codeHash common.Hash, code []byte) error {
+	rh.codes[codeHash] = code
+	return nil
+}
+
+var _ = Describe("ChainDBSource", func() {
+	var (
+		genesis  *types.Block
+		source   *snapshot.ChainDBSource
+		contract = common.HexToAddress("0xaE9BEa628c4Ce503DcFD7E305CaB4e29E7476592")
+		code     = []byte{0x60, 0x01, 0x60, 0x00, 0x55}
+	)
+	BeforeEach(func() {
+		alloc := core.GenesisAlloc{
+			contract: {
+				Balance: big.NewInt(0),
+				Code:    code,
+				Storage: map[common.Hash]common.Hash{},
+			},
+		}
+		for i := int64(1); i <= 30; i++ {
+			alloc[common.BigToAddress(big.NewInt(i))] = core.GenesisAccount{Balance: big.NewInt(i)}
+			alloc[contract].Storage[common.BigToHash(big.NewInt(i))] = common.BigToHash(big.NewInt(i * 100))
+		}
+		db := rawdb.NewMemoryDatabase()
+		genesis = (&core.Genesis{Config: params.TestChainConfig, Difficulty: big.NewInt(1), Alloc: alloc}).MustCommit(db)
+		source = snapshot.NewChainDBSource(db)
+	})
+	AfterEach(func() {
+		source.Close()
+	})
+
+	It("Returns the block at the height with an empty state diff", func() {
+		payload, err := source.BlockPayload(0)
+		Expect(err).ToNot(HaveOccurred())
+		block := new(types.Block)
+		Expect(rlp.DecodeBytes(payload.BlockRlp, block)).To(Succeed())
+		Expect(block.Hash()).To(Equal(genesis.Hash()))
+		Expect(payload.TotalDifficulty).To(Equal(genesis.Difficulty()))
+		stateDiff := new(statediff.StateObject)
+		Expect(rlp.DecodeBytes(payload.StateObjectRlp, stateDiff)).To(Succeed())
+		Expect(stateDiff.BlockHash).To(Equal(genesis.Hash()))
+		Expect(stateDiff.Nodes).To(BeEmpty())
+	})
+
+	It("Errors if there is no block at the height", func() {
+		_, err := source.BlockPayload(1)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Walks every node of the state and storage tries", func() {
+		handler := &recordingHandler{codes: make(map[common.Hash][]byte)}
+		Expect(source.WalkState(genesis.Root(), handler)).To(Succeed())
+		Expect(len(handler.stateNodes)).To(BeNumerically(">", 31))
+		var leaves int
+		var contractNode *sdtypes.StateNode
+		for i, n := range handler.stateNodes {
+			if n.NodeType == sdtypes.Leaf {
+				leaves++
+				if common.BytesToHash(n.LeafKey) == crypto.Keccak256Hash(contract.Bytes()) {
+					contractNode = &handler.stateNodes[i]
+				}
+			}
+		}
+		Expect(leaves).To(Equal(31))
+		Expect(contractNode).ToNot(BeNil())
+		var storageLeaves int
+		for _, n := range contractNode.StorageNodes {
+			if n.NodeType == sdtypes.Leaf {
+				storageLeaves++
+			}
+		}
+		Expect(storageLeaves).To(Equal(30))
+		Expect(handler.codes).To(Equal(map[common.Hash][]byte{crypto.Keccak256Hash(code): code}))
+		// a full trie hashes consistently up to its root
+		Expect(eth.ValidateStateDiff(genesis.Root(), handler.stateNodes)).To(Succeed())
+	})
+})
@@ -0,0 +1,74 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// APIName is the namespace for the stream api
+const APIName = "stream"
+
+// APIVersion is the version of the stream api
+const APIVersion = "0.0.1"
+
+// PublicStreamAPI offers subscriptions to the blocks committed by the indexer
+type PublicStreamAPI struct {
+	s *Service
+}
+
+// NewPublicStreamAPI creates a new PublicStreamAPI with the provided service
+func NewPublicStreamAPI(s *Service) *PublicStreamAPI {
+	return &PublicStreamAPI{
+		s: s,
+	}
+}
+
+// Blocks subscribes to the payloads of the blocks committed by the indexer, filtered by the settings
+// Subscriptions are only supported over websockets and ipc
+func (api *PublicStreamAPI) Blocks(ctx context.Context, settings SubscriptionSettings) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	filter, err := NewFilter(settings)
+	if err != nil {
+		return nil, err
+	}
+	rpcSub := notifier.CreateSubscription()
+	// subscribe before replaying, so that no block committed in the meantime is missed
+	sub := api.s.subscribe(filter)
+	var start *uint64
+	if settings.Start != nil {
+		height := uint64(*settings.Start)
+		start = &height
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-rpcSub.Err():
+		case <-notifier.Closed():
+		}
+		close(done)
+	}()
+	go api.s.stream(sub, start, func(payload *Payload) error {
+		return notifier.Notify(rpcSub.ID, payload)
+	}, done)
+	return rpcSub, nil
+}
@@ -0,0 +1,135 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/serve"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+// Filter applies the server side filters of a subscription to payloads
+type Filter struct {
+	types       map[shared.DataType]bool
+	addresses   map[common.Address]bool
+	stateKeys   map[common.Hash]bool
+	storageKeys map[common.Hash]bool
+	logFilter   serve.LogFilter
+	cidsOnly    bool
+}
+
+// NewFilter returns a pointer to a new Filter for the settings
+func NewFilter(settings SubscriptionSettings) (*Filter, error) {
+	types, err := settings.types()
+	if err != nil {
+		return nil, err
+	}
+	f := &Filter{
+		types: types,
+		logFilter: serve.LogFilter{
+			Addresses: settings.Addresses,
+			Topics:    settings.Topics,
+		},
+		cidsOnly: settings.CIDsOnly,
+	}
+	if len(settings.Addresses) > 0 {
+		f.addresses = make(map[common.Address]bool, len(settings.Addresses))
+		f.stateKeys = make(map[common.Hash]bool, len(settings.Addresses))
+		for _, address := range settings.Addresses {
+			f.addresses[address] = true
+			f.stateKeys[crypto.Keccak256Hash(address.Bytes())] = true
+		}
+	}
+	if len(settings.StorageKeys) > 0 {
+		f.storageKeys = make(map[common.Hash]bool, len(settings.StorageKeys))
+		for _, slot := range settings.StorageKeys {
+			f.storageKeys[crypto.Keccak256Hash(slot.Bytes())] = true
+		}
+	}
+	return f, nil
+}
+
+// Apply returns the parts of the payload which match the filter, nil if nothing matches
+// Receipts are matched if their transaction matches or if they contain a matching log
+func (f *Filter) Apply(payload *Payload) *Payload {
+	filtered := &Payload{
+		BlockNumber:     payload.BlockNumber,
+		BlockHash:       payload.BlockHash,
+		TotalDifficulty: payload.TotalDifficulty,
+	}
+	if f.types[shared.Headers] && payload.Header != nil {
+		header := f.ipld(*payload.Header)
+		filtered.Header = &header
+	}
+	if f.types[shared.Uncles] {
+		for _, uncle := range payload.Uncles {
+			filtered.Uncles = append(filtered.Uncles, f.ipld(uncle))
+		}
+	}
+	matchedTxs := make(map[uint64]bool, len(payload.Transactions))
+	for _, tx := range payload.Transactions {
+		if f.addresses == nil || f.addresses[tx.Src] || (tx.Dst != nil && f.addresses[*tx.Dst]) {
+			matchedTxs[uint64(tx.Index)] = true
+			if f.types[shared.Transactions] {
+				tx.IPLD = f.ipld(tx.IPLD)
+				filtered.Transactions = append(filtered.Transactions, tx)
+			}
+		}
+	}
+	if f.types[shared.Receipts] {
+		filtered.Logs = serve.FilterLogs(payload.Logs, f.logFilter)
+		for _, log := range filtered.Logs {
+			matchedTxs[uint64(log.TxIndex)] = true
+		}
+		for _, rct := range payload.Receipts {
+			if matchedTxs[uint64(rct.TxIndex)] {
+				rct.IPLD = f.ipld(rct.IPLD)
+				filtered.Receipts = append(filtered.Receipts, rct)
+			}
+		}
+	}
+	if f.types[shared.State] {
+		for _, node := range payload.StateNodes {
+			if f.stateKeys == nil || f.stateKeys[node.LeafKey] {
+				node.IPLD = f.ipld(node.IPLD)
+				filtered.StateNodes = append(filtered.StateNodes, node)
+			}
+		}
+	}
+	if f.types[shared.Storage] {
+		for _, node := range payload.StorageNodes {
+			if (f.stateKeys == nil || f.stateKeys[node.StateLeafKey]) && (f.storageKeys == nil || f.storageKeys[node.LeafKey]) {
+				node.IPLD = f.ipld(node.IPLD)
+				filtered.StorageNodes = append(filtered.StorageNodes, node)
+			}
+		}
+	}
+	if filtered.Header == nil && len(filtered.Uncles) == 0 && len(filtered.Transactions) == 0 && len(filtered.Receipts) == 0 &&
+		len(filtered.Logs) == 0 && len(filtered.StateNodes) == 0 && len(filtered.StorageNodes) == 0 {
+		return nil
+	}
+	return filtered
+}
+
+func (f *Filter) ipld(i IPLD) IPLD {
+	if f.cidsOnly {
+		i.Data = nil
+	}
+	return i
+}
@@ -0,0 +1,99 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stream_test
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/stream"
+	smocks "github.com/vulcanize/ipld-eth-indexer/pkg/stream/mocks"
+)
+
+var _ = Describe("Filter", func() {
+	apply := func(settings stream.SubscriptionSettings) *stream.Payload {
+		filter, err := stream.NewFilter(settings)
+		Expect(err).ToNot(HaveOccurred())
+		return filter.Apply(smocks.MockPayload)
+	}
+
+	It("Passes everything through with empty settings", func() {
+		Expect(apply(stream.SubscriptionSettings{})).To(Equal(smocks.MockPayload))
+	})
+
+	It("Rejects unknown data types", func() {
+		_, err := stream.NewFilter(stream.SubscriptionSettings{Types: []string{"bananas"}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Only includes the selected data types", func() {
+		payload := apply(stream.SubscriptionSettings{Types: []string{"headers", "state"}})
+		Expect(payload.Header).To(Equal(smocks.MockPayload.Header))
+		Expect(payload.StateNodes).To(Equal(smocks.MockPayload.StateNodes))
+		Expect(payload.Transactions).To(BeEmpty())
+		Expect(payload.Receipts).To(BeEmpty())
+		Expect(payload.Logs).To(BeEmpty())
+		Expect(payload.StorageNodes).To(BeEmpty())
+	})
+
+	It("Filters transactions, receipts, logs and state by address", func() {
+		payload := apply(stream.SubscriptionSettings{Addresses: []common.Address{mocks.AnotherAddress}})
+		Expect(payload.Transactions).To(Equal(smocks.MockPayload.Transactions[1:2]))
+		Expect(payload.Receipts).To(Equal(smocks.MockPayload.Receipts[1:2]))
+		Expect(payload.Logs).To(Equal(smocks.MockLogs[1:]))
+		Expect(payload.StateNodes).To(Equal(smocks.MockPayload.StateNodes[1:]))
+		Expect(payload.StorageNodes).To(BeEmpty())
+	})
+
+	It("Includes the receipts of logs matching by topic", func() {
+		payload := apply(stream.SubscriptionSettings{
+			Types:  []string{"receipts"},
+			Topics: [][]common.Hash{{common.HexToHash("0x05")}},
+		})
+		Expect(payload.Logs).To(Equal(smocks.MockLogs[1:]))
+		// the transactions aren't filtered by topic, so all of their receipts are included
+		Expect(payload.Receipts).To(Equal(smocks.MockPayload.Receipts))
+	})
+
+	It("Filters storage by account and slot", func() {
+		payload := apply(stream.SubscriptionSettings{
+			Types:       []string{"storage"},
+			Addresses:   []common.Address{mocks.ContractAddress},
+			StorageKeys: []common.Hash{smocks.StorageSlot},
+		})
+		Expect(payload.StorageNodes).To(Equal(smocks.MockPayload.StorageNodes))
+		payload = apply(stream.SubscriptionSettings{
+			Types:       []string{"storage"},
+			StorageKeys: []common.Hash{common.HexToHash("0x02")},
+		})
+		Expect(payload).To(BeNil())
+	})
+
+	It("Leaves the IPLD data out when only CIDs are requested", func() {
+		payload := apply(stream.SubscriptionSettings{CIDsOnly: true})
+		Expect(payload.Header.CID).To(Equal(smocks.MockPayload.Header.CID))
+		Expect(payload.Header.Data).To(BeNil())
+		for _, tx := range payload.Transactions {
+			Expect(tx.Data).To(BeNil())
+		}
+		Expect(payload.StorageNodes[0].CID).To(Equal(smocks.MockPayload.StorageNodes[0].CID))
+		Expect(payload.StorageNodes[0].Data).To(BeNil())
+		Expect(smocks.MockPayload.Header.Data).ToNot(BeNil())
+	})
+})
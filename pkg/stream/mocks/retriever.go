@@ -0,0 +1,57 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package mocks
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/stream"
+)
+
+// Retriever mock for tests
+type Retriever struct {
+	sync.Mutex
+	Payloads     map[common.Hash]*stream.Payload
+	Canonical    map[uint64]common.Hash
+	Height       uint64
+	ReturnErr    error
+	PassedHashes []common.Hash
+}
+
+// LastHeight mock method
+func (r *Retriever) LastHeight() (uint64, error) {
+	return r.Height, r.ReturnErr
+}
+
+// CanonicalHash mock method
+func (r *Retriever) CanonicalHash(height uint64) (common.Hash, error) {
+	return r.Canonical[height], r.ReturnErr
+}
+
+// Retrieve mock method
+func (r *Retriever) Retrieve(hash common.Hash) (*stream.Payload, error) {
+	r.Lock()
+	defer r.Unlock()
+	r.PassedHashes = append(r.PassedHashes, hash)
+	payload, ok := r.Payloads[hash]
+	if !ok && r.ReturnErr == nil {
+		return nil, stream.ErrBlockNotIndexed
+	}
+	return payload, r.ReturnErr
+}
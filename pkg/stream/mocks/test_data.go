@@ -0,0 +1,61 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package mocks
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/stream"
+)
+
+// Test variables
+var (
+	MockLogs = []*types.Log{
+		{Address: mocks.Address, Topics: mocks.MockLog1.Topics, TxIndex: 0},
+		{Address: mocks.AnotherAddress, Topics: mocks.MockLog2.Topics, TxIndex: 1},
+	}
+	StorageSlot = common.HexToHash("0x01")
+	MockPayload = &stream.Payload{
+		BlockNumber:     hexutil.Uint64(mocks.MockBlock.NumberU64()),
+		BlockHash:       mocks.MockBlock.Hash(),
+		TotalDifficulty: (*hexutil.Big)(mocks.MockBlock.Difficulty()),
+		Header:          &stream.IPLD{CID: mocks.HeaderCID.String(), Data: mocks.MockHeaderRlp},
+		Transactions: []stream.Transaction{
+			{IPLD: stream.IPLD{CID: mocks.Trx1CID.String(), Data: mocks.MockTransactions.GetRlp(0)}, Index: 0, Hash: mocks.MockTransactions[0].Hash(), Src: mocks.SenderAddr, Dst: &mocks.Address},
+			{IPLD: stream.IPLD{CID: mocks.Trx2CID.String(), Data: mocks.MockTransactions.GetRlp(1)}, Index: 1, Hash: mocks.MockTransactions[1].Hash(), Src: mocks.SenderAddr, Dst: &mocks.AnotherAddress},
+			{IPLD: stream.IPLD{CID: mocks.Trx3CID.String(), Data: mocks.MockTransactions.GetRlp(2)}, Index: 2, Hash: mocks.MockTransactions[2].Hash(), Src: mocks.SenderAddr},
+		},
+		Receipts: []stream.Receipt{
+			{IPLD: stream.IPLD{CID: mocks.Rct1CID.String(), Data: mocks.MockReceipts.GetRlp(0)}, TxIndex: 0},
+			{IPLD: stream.IPLD{CID: mocks.Rct2CID.String(), Data: mocks.MockReceipts.GetRlp(1)}, TxIndex: 1},
+			{IPLD: stream.IPLD{CID: mocks.Rct3CID.String(), Data: mocks.MockReceipts.GetRlp(2)}, TxIndex: 2},
+		},
+		Logs: MockLogs,
+		StateNodes: []stream.StateNode{
+			{IPLD: stream.IPLD{CID: mocks.State1CID.String(), Data: mocks.ContractLeafNode}, LeafKey: crypto.Keccak256Hash(mocks.ContractAddress.Bytes()), Path: []byte{'\x06'}, NodeType: sdtypes.Leaf},
+			{IPLD: stream.IPLD{CID: mocks.State2CID.String(), Data: mocks.AccountLeafNode}, LeafKey: crypto.Keccak256Hash(mocks.AnotherAddress.Bytes()), Path: []byte{'\x0c'}, NodeType: sdtypes.Leaf},
+		},
+		StorageNodes: []stream.StorageNode{
+			{IPLD: stream.IPLD{CID: mocks.StorageCID.String(), Data: mocks.StorageLeafNode}, StateLeafKey: crypto.Keccak256Hash(mocks.ContractAddress.Bytes()), LeafKey: crypto.Keccak256Hash(StorageSlot.Bytes()), Path: []byte{}, NodeType: sdtypes.Leaf},
+		},
+	}
+)
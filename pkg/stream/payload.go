@@ -0,0 +1,123 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+)
+
+// IPLD is the CID of an indexed IPLD block, with its raw data unless the subscription asked for CIDs only
+type IPLD struct {
+	CID  string        `json:"cid"`
+	Data hexutil.Bytes `json:"data,omitempty"`
+}
+
+// Transaction is an indexed transaction
+type Transaction struct {
+	IPLD
+	Index hexutil.Uint64  `json:"index"`
+	Hash  common.Hash     `json:"hash"`
+	Src   common.Address  `json:"from"`
+	Dst   *common.Address `json:"to"`
+}
+
+// Receipt is an indexed receipt, with the index of its transaction
+type Receipt struct {
+	IPLD
+	TxIndex hexutil.Uint64 `json:"transactionIndex"`
+}
+
+// StateNode is an indexed state diff node
+type StateNode struct {
+	IPLD
+	LeafKey  common.Hash      `json:"leafKey"`
+	Path     hexutil.Bytes    `json:"path"`
+	NodeType sdtypes.NodeType `json:"nodeType"`
+}
+
+// StorageNode is an indexed storage diff node, with the leaf key of the account it belongs to
+type StorageNode struct {
+	IPLD
+	StateLeafKey common.Hash      `json:"stateLeafKey"`
+	LeafKey      common.Hash      `json:"leafKey"`
+	Path         hexutil.Bytes    `json:"path"`
+	NodeType     sdtypes.NodeType `json:"nodeType"`
+}
+
+// Payload is the data indexed for a single block, as pushed to subscribers
+// The logs have their derived fields filled in, they are left out if not every receipt of the block is indexed
+type Payload struct {
+	BlockNumber     hexutil.Uint64 `json:"blockNumber"`
+	BlockHash       common.Hash    `json:"blockHash"`
+	TotalDifficulty *hexutil.Big   `json:"totalDifficulty"`
+	Header          *IPLD          `json:"header,omitempty"`
+	Uncles          []IPLD         `json:"uncles,omitempty"`
+	Transactions    []Transaction  `json:"transactions,omitempty"`
+	Receipts        []Receipt      `json:"receipts,omitempty"`
+	Logs            []*types.Log   `json:"logs,omitempty"`
+	StateNodes      []StateNode    `json:"stateNodes,omitempty"`
+	StorageNodes    []StorageNode  `json:"storageNodes,omitempty"`
+}
+
+// SubscriptionSettings are the server side filters of a subscription
+type SubscriptionSettings struct {
+	// Height to resume from, blocks already indexed at and above it are replayed along the canonical chain before new blocks are pushed
+	// If not set only new blocks are pushed
+	Start *hexutil.Uint64 `json:"start"`
+	// Data types to push (headers, uncles, transactions, receipts, state, storage), all of them if empty or full
+	// Logs are pushed along with receipts
+	Types []string `json:"types"`
+	// Filters transactions by sender or recipient, logs by contract, and state and storage nodes by account
+	// State and storage nodes are limited to leaf (and removed) nodes when set
+	Addresses []common.Address `json:"addresses"`
+	// Filters logs by topic position, like eth_getLogs; an empty position matches any topic
+	Topics [][]common.Hash `json:"topics"`
+	// Filters storage nodes by slot, the slots are hashed into their storage leaf keys
+	StorageKeys []common.Hash `json:"storageKeys"`
+	// If true the IPLD data is left out and only the CIDs are pushed
+	CIDsOnly bool `json:"cidsOnly"`
+}
+
+// types returns the data types selected by the settings
+func (s SubscriptionSettings) types() (map[shared.DataType]bool, error) {
+	selected := make(map[shared.DataType]bool)
+	for _, str := range s.Types {
+		dataType, err := shared.GenerateDataTypeFromString(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subscription data type: %s", str)
+		}
+		selected[dataType] = true
+	}
+	if len(selected) == 0 || selected[shared.Full] {
+		return map[shared.DataType]bool{
+			shared.Headers:      true,
+			shared.Uncles:       true,
+			shared.Transactions: true,
+			shared.Receipts:     true,
+			shared.State:        true,
+			shared.Storage:      true,
+		}, nil
+	}
+	return selected, nil
+}
@@ -0,0 +1,289 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+)
+
+const (
+	lastHeightPgStr    = `SELECT MAX(block_number) FROM eth.header_cids WHERE chain_id = $1`
+	canonicalHashPgStr = `SELECT block_hash FROM eth.header_cids WHERE id = canonical_header_id($1, $2)`
+	headerPgStr        = `SELECT header_cids.id, header_cids.block_number, header_cids.td, header_cids.cid, header_cids.mh_key, blocks.data FROM eth.header_cids
+			INNER JOIN public.blocks ON (header_cids.mh_key = blocks.key)
+			WHERE header_cids.chain_id = $1
+			AND header_cids.block_hash = $2
+			LIMIT 1`
+	unclesPgStr = `SELECT uncle_cids.cid, uncle_cids.mh_key, blocks.data FROM eth.uncle_cids
+			INNER JOIN public.blocks ON (uncle_cids.mh_key = blocks.key)
+			WHERE uncle_cids.header_id = $1
+			ORDER BY uncle_cids.id`
+	txsPgStr = `SELECT transaction_cids.index, transaction_cids.tx_hash, transaction_cids.src, transaction_cids.dst, transaction_cids.cid, transaction_cids.mh_key, blocks.data FROM eth.transaction_cids
+			INNER JOIN public.blocks ON (transaction_cids.mh_key = blocks.key)
+			WHERE transaction_cids.header_id = $1
+			ORDER BY transaction_cids.index`
+	rctsPgStr = `SELECT transaction_cids.index, receipt_cids.cid, receipt_cids.mh_key, blocks.data FROM eth.receipt_cids
+			INNER JOIN eth.transaction_cids ON (receipt_cids.tx_id = transaction_cids.id)
+			INNER JOIN public.blocks ON (receipt_cids.mh_key = blocks.key)
+			WHERE transaction_cids.header_id = $1
+			ORDER BY transaction_cids.index`
+	stateNodesPgStr = `SELECT COALESCE(state_cids.state_leaf_key, '') AS state_leaf_key, state_cids.state_path, state_cids.node_type, state_cids.cid, state_cids.mh_key, blocks.data
+			FROM eth.state_cids
+			INNER JOIN public.blocks ON (state_cids.mh_key = blocks.key)
+			WHERE state_cids.header_id = $1
+			ORDER BY state_cids.state_path`
+	storageNodesPgStr = `SELECT COALESCE(state_cids.state_leaf_key, '') AS state_leaf_key, COALESCE(storage_cids.storage_leaf_key, '') AS storage_leaf_key,
+			storage_cids.storage_path, storage_cids.node_type, storage_cids.cid, storage_cids.mh_key, blocks.data
+			FROM eth.storage_cids
+			INNER JOIN eth.state_cids ON (storage_cids.state_id = state_cids.id)
+			INNER JOIN public.blocks ON (storage_cids.mh_key = blocks.key)
+			WHERE state_cids.header_id = $1
+			ORDER BY state_cids.state_path, storage_cids.storage_path`
+)
+
+// Retriever retrieves the payloads pushed to subscribers
+type Retriever interface {
+	// LastHeight returns the highest block height indexed
+	LastHeight() (uint64, error)
+	// CanonicalHash returns the hash of the canonical block at the height, the zero hash if there is none indexed
+	CanonicalHash(height uint64) (common.Hash, error)
+	// Retrieve returns the full payload indexed for the block with the hash, ErrBlockNotIndexed if it is not indexed
+	Retrieve(hash common.Hash) (*Payload, error)
+}
+
+// ErrBlockNotIndexed is returned by Retrieve when the block is not indexed
+var ErrBlockNotIndexed = errors.New("block is not indexed")
+
+// DBRetriever satisfies the Retriever interface by assembling payloads from the eth.*_cids tables and the IPLD blocks they reference
+// It reads from the primary, never the read replica, since blocks are pushed right after they are committed and a replica may not have them yet
+type DBRetriever struct {
+	db          *postgres.DB
+	blocks      blockstore.Blockstore
+	chainConfig *params.ChainConfig
+}
+
+// NewDBRetriever returns a pointer to a new DBRetriever
+func NewDBRetriever(db *postgres.DB, chainConfig *params.ChainConfig) *DBRetriever {
+	return &DBRetriever{
+		db:          db,
+		blocks:      blockstore.NewPostgresBlockstore(db.DB),
+		chainConfig: chainConfig,
+	}
+}
+
+// SetBlockstore sets the blockstore the IPLD blocks are read from when public.blocks only records their keys
+func (r *DBRetriever) SetBlockstore(blocks blockstore.Blockstore) {
+	r.blocks = blocks
+}
+
+type headerRow struct {
+	ipldRow
+	ID          int64  `db:"id"`
+	BlockNumber uint64 `db:"block_number"`
+	TD          string `db:"td"`
+}
+
+type ipldRow struct {
+	CID   string          `db:"cid"`
+	MhKey string          `db:"mh_key"`
+	Data  blockstore.Data `db:"data"`
+}
+
+// load reads the row's block from the blockstore if public.blocks only records its key
+func (r *DBRetriever) load(row *ipldRow) error {
+	data, err := blockstore.Load(r.blocks, row.MhKey, row.Data)
+	row.Data = data
+	return err
+}
+
+func (r ipldRow) ipld() IPLD {
+	return IPLD{CID: r.CID, Data: []byte(r.Data)}
+}
+
+type txRow struct {
+	ipldRow
+	Index uint64 `db:"index"`
+	Hash  string `db:"tx_hash"`
+	Src   string `db:"src"`
+	Dst   string `db:"dst"`
+}
+
+type rctRow struct {
+	ipldRow
+	TxIndex uint64 `db:"index"`
+}
+
+type stateRow struct {
+	ipldRow
+	LeafKey  string `db:"state_leaf_key"`
+	Path     []byte `db:"state_path"`
+	NodeType int    `db:"node_type"`
+}
+
+type storageRow struct {
+	ipldRow
+	StateLeafKey string `db:"state_leaf_key"`
+	LeafKey      string `db:"storage_leaf_key"`
+	Path         []byte `db:"storage_path"`
+	NodeType     int    `db:"node_type"`
+}
+
+// LastHeight satisfies the Retriever interface
+func (r *DBRetriever) LastHeight() (uint64, error) {
+	var height sql.NullInt64
+	if err := r.db.DB.Get(&height, lastHeightPgStr, r.db.Node.ChainID); err != nil {
+		return 0, err
+	}
+	return uint64(height.Int64), nil
+}
+
+// CanonicalHash satisfies the Retriever interface
+func (r *DBRetriever) CanonicalHash(height uint64) (common.Hash, error) {
+	var hash sql.NullString
+	if err := r.db.DB.Get(&hash, canonicalHashPgStr, r.db.Node.ChainID, height); err != nil && err != sql.ErrNoRows {
+		return common.Hash{}, err
+	}
+	return common.HexToHash(hash.String), nil
+}
+
+// Retrieve satisfies the Retriever interface
+func (r *DBRetriever) Retrieve(hash common.Hash) (*Payload, error) {
+	header := new(headerRow)
+	if err := r.db.DB.Get(header, headerPgStr, r.db.Node.ChainID, hash.Hex()); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrBlockNotIndexed, hash.Hex())
+		}
+		return nil, err
+	}
+	td, ok := new(big.Int).SetString(header.TD, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid total difficulty %s for header %s", header.TD, hash.Hex())
+	}
+	payload := &Payload{
+		BlockNumber:     hexutil.Uint64(header.BlockNumber),
+		BlockHash:       hash,
+		TotalDifficulty: (*hexutil.Big)(td),
+	}
+	if err := r.load(&header.ipldRow); err != nil {
+		return nil, err
+	}
+	payload.Header = &IPLD{CID: header.CID, Data: []byte(header.Data)}
+	uncles := make([]ipldRow, 0)
+	if err := r.db.DB.Select(&uncles, unclesPgStr, header.ID); err != nil {
+		return nil, err
+	}
+	for _, uncle := range uncles {
+		if err := r.load(&uncle); err != nil {
+			return nil, err
+		}
+		payload.Uncles = append(payload.Uncles, uncle.ipld())
+	}
+	txRows := make([]txRow, 0)
+	if err := r.db.DB.Select(&txRows, txsPgStr, header.ID); err != nil {
+		return nil, err
+	}
+	txs := make(types.Transactions, len(txRows))
+	for i, row := range txRows {
+		if err := r.load(&row.ipldRow); err != nil {
+			return nil, err
+		}
+		txs[i] = new(types.Transaction)
+		if err := rlp.DecodeBytes(row.Data, txs[i]); err != nil {
+			return nil, fmt.Errorf("error decoding transaction %s: %v", row.Hash, err)
+		}
+		tx := Transaction{
+			IPLD:  row.ipld(),
+			Index: hexutil.Uint64(row.Index),
+			Hash:  common.HexToHash(row.Hash),
+			Src:   common.HexToAddress(row.Src),
+		}
+		if row.Dst != "" {
+			dst := common.HexToAddress(row.Dst)
+			tx.Dst = &dst
+		}
+		payload.Transactions = append(payload.Transactions, tx)
+	}
+	rctRows := make([]rctRow, 0)
+	if err := r.db.DB.Select(&rctRows, rctsPgStr, header.ID); err != nil {
+		return nil, err
+	}
+	rcts := make(types.Receipts, len(rctRows))
+	for i, row := range rctRows {
+		if err := r.load(&row.ipldRow); err != nil {
+			return nil, err
+		}
+		rcts[i] = new(types.Receipt)
+		if err := rlp.DecodeBytes(row.Data, rcts[i]); err != nil {
+			return nil, fmt.Errorf("error decoding receipt %s: %v", row.CID, err)
+		}
+		payload.Receipts = append(payload.Receipts, Receipt{IPLD: row.ipld(), TxIndex: hexutil.Uint64(row.TxIndex)})
+	}
+	// the logs can only be derived if every receipt of the block is indexed, which isn't the case with a filtered index
+	if len(rcts) == len(txs) {
+		if err := rcts.DeriveFields(r.chainConfig, hash, header.BlockNumber, txs); err != nil {
+			return nil, err
+		}
+		for _, rct := range rcts {
+			payload.Logs = append(payload.Logs, rct.Logs...)
+		}
+	}
+	stateRows := make([]stateRow, 0)
+	if err := r.db.DB.Select(&stateRows, stateNodesPgStr, header.ID); err != nil {
+		return nil, err
+	}
+	for _, row := range stateRows {
+		if err := r.load(&row.ipldRow); err != nil {
+			return nil, err
+		}
+		payload.StateNodes = append(payload.StateNodes, StateNode{
+			IPLD:     row.ipld(),
+			LeafKey:  common.HexToHash(row.LeafKey),
+			Path:     row.Path,
+			NodeType: eth.ResolveToNodeType(row.NodeType),
+		})
+	}
+	storageRows := make([]storageRow, 0)
+	if err := r.db.DB.Select(&storageRows, storageNodesPgStr, header.ID); err != nil {
+		return nil, err
+	}
+	for _, row := range storageRows {
+		if err := r.load(&row.ipldRow); err != nil {
+			return nil, err
+		}
+		payload.StorageNodes = append(payload.StorageNodes, StorageNode{
+			IPLD:         row.ipld(),
+			StateLeafKey: common.HexToHash(row.StateLeafKey),
+			LeafKey:      common.HexToHash(row.LeafKey),
+			Path:         row.Path,
+			NodeType:     eth.ResolveToNodeType(row.NodeType),
+		})
+	}
+	return payload, nil
+}
@@ -0,0 +1,242 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stream
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/statediff"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+)
+
+// subscriptionBufferSize is the number of committed blocks buffered for a subscription before it falls behind
+// A subscription that falls behind catches up by replaying the blocks it missed from the database
+const subscriptionBufferSize = 1024
+
+// retrieveAttempts is the number of times a committed block is retrieved before it is given up on, waiting retrieveRetryInterval in between
+// A committed block should always be found, a miss means the rows are not visible to the retriever yet
+const (
+	retrieveAttempts      = 5
+	retrieveRetryInterval = 200 * time.Millisecond
+)
+
+// Service pushes the blocks committed by the indexer to subscribers
+// Blocks are pushed at least once: a block can be pushed again if it is re-indexed, or when a subscription replays or catches up
+type Service struct {
+	// Interface for retrieving the payloads of committed blocks
+	Retriever Retriever
+	sync.Mutex
+	subs   map[*subscription]bool
+	quit   chan struct{}
+	closed bool
+}
+
+// NewStreamService returns a pointer to a new Service
+func NewStreamService(retriever Retriever) *Service {
+	return &Service{
+		Retriever: retriever,
+		subs:      make(map[*subscription]bool),
+		quit:      make(chan struct{}),
+	}
+}
+
+// committedBlock is a block committed by the indexer
+type committedBlock struct {
+	hash   common.Hash
+	height uint64
+}
+
+type subscription struct {
+	filter *Filter
+	blocks chan committedBlock
+	// signalled when a committed block didn't fit into the buffer, missedFrom is the lowest height missed since
+	lagged     chan struct{}
+	mu         sync.Mutex
+	missed     bool
+	missedFrom uint64
+}
+
+// Committed is called after the payload has been committed to the database, it notifies the subscribers
+func (s *Service) Committed(payload statediff.Payload) {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.subs) == 0 {
+		return
+	}
+	header, err := eth.PayloadHeader(payload)
+	if err != nil {
+		log.Errorf("stream service payload error: %v", err)
+		return
+	}
+	block := committedBlock{hash: header.Hash(), height: header.Number.Uint64()}
+	for sub := range s.subs {
+		sub.notify(block)
+	}
+}
+
+// Stop shuts down every subscription
+func (s *Service) Stop() {
+	s.Lock()
+	defer s.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.quit)
+	}
+}
+
+func (s *Service) subscribe(filter *Filter) *subscription {
+	sub := &subscription{
+		filter: filter,
+		blocks: make(chan committedBlock, subscriptionBufferSize),
+		lagged: make(chan struct{}, 1),
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.subs[sub] = true
+	return sub
+}
+
+func (s *Service) unsubscribe(sub *subscription) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.subs, sub)
+}
+
+// stream pushes payloads for the subscription using send, until send fails or done is closed
+// If start is not nil the blocks from start on are replayed first
+func (s *Service) stream(sub *subscription, start *uint64, send func(*Payload) error, done <-chan struct{}) {
+	defer s.unsubscribe(sub)
+	if start != nil {
+		if !s.replay(sub, *start, send, done) {
+			return
+		}
+	}
+	for {
+		select {
+		case block := <-sub.blocks:
+			if !s.push(sub, block.hash, send) {
+				return
+			}
+		case <-sub.lagged:
+			sub.mu.Lock()
+			from := sub.missedFrom
+			sub.missed = false
+			sub.mu.Unlock()
+			log.Warnf("stream subscription fell behind, catching up from height %d", from)
+			if !s.replay(sub, from, send, done) {
+				return
+			}
+		case <-done:
+			return
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// replay pushes the canonical blocks from the height up to the highest block indexed, it returns false if the subscription is done
+func (s *Service) replay(sub *subscription, from uint64, send func(*Payload) error, done <-chan struct{}) bool {
+	to, err := s.Retriever.LastHeight()
+	if err != nil {
+		log.Errorf("stream service replay error: %v", err)
+		return true
+	}
+	for height := from; height <= to; height++ {
+		select {
+		case <-done:
+			return false
+		case <-s.quit:
+			return false
+		default:
+		}
+		hash, err := s.Retriever.CanonicalHash(height)
+		if err != nil {
+			log.Errorf("stream service replay error at height %d: %v", height, err)
+			continue
+		}
+		if hash == (common.Hash{}) {
+			continue
+		}
+		if !s.push(sub, hash, send) {
+			return false
+		}
+	}
+	return true
+}
+
+// push retrieves, filters and sends the payload for the block, it returns false if sending failed
+func (s *Service) push(sub *subscription, hash common.Hash, send func(*Payload) error) bool {
+	payload, err := s.Retriever.Retrieve(hash)
+	for attempt := 1; errors.Is(err, ErrBlockNotIndexed) && attempt < retrieveAttempts; attempt++ {
+		select {
+		case <-s.quit:
+			return false
+		case <-time.After(retrieveRetryInterval):
+		}
+		payload, err = s.Retriever.Retrieve(hash)
+	}
+	if err != nil {
+		log.Errorf("stream service error retrieving block %s: %v", hash.Hex(), err)
+		return true
+	}
+	filtered := sub.filter.Apply(payload)
+	if filtered == nil {
+		return true
+	}
+	if err := send(filtered); err != nil {
+		log.Errorf("stream service error sending block %s: %v", hash.Hex(), err)
+		return false
+	}
+	return true
+}
+
+// notify buffers the committed block, or records it as missed if the subscription has fallen behind
+func (sub *subscription) notify(block committedBlock) {
+	select {
+	case sub.blocks <- block:
+		return
+	default:
+	}
+	sub.mu.Lock()
+	if !sub.missed || block.height < sub.missedFrom {
+		sub.missedFrom = block.height
+	}
+	sub.missed = true
+	sub.mu.Unlock()
+	select {
+	case sub.lagged <- struct{}{}:
+	default:
+	}
+}
+
+// APIs returns the RPC descriptors the stream service offers
+func (s *Service) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: APIName,
+			Version:   APIVersion,
+			Service:   NewPublicStreamAPI(s),
+			Public:    true,
+		},
+	}
+}
@@ -0,0 +1,142 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package stream_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/stream"
+	smocks "github.com/vulcanize/ipld-eth-indexer/pkg/stream/mocks"
+)
+
+var _ = Describe("Service", func() {
+	var (
+		retriever *smocks.Retriever
+		service   *stream.Service
+		client    *rpc.Client
+		payloads  chan stream.Payload
+		sub       *rpc.ClientSubscription
+		earlier   = common.HexToHash("0x01")
+	)
+
+	BeforeEach(func() {
+		earlierPayload := *smocks.MockPayload
+		earlierPayload.BlockNumber = 0
+		earlierPayload.BlockHash = earlier
+		retriever = &smocks.Retriever{
+			Payloads: map[common.Hash]*stream.Payload{
+				earlier:                      &earlierPayload,
+				smocks.MockPayload.BlockHash: smocks.MockPayload,
+			},
+			Canonical: map[uint64]common.Hash{0: earlier},
+		}
+		service = stream.NewStreamService(retriever)
+		server := rpc.NewServer()
+		for _, api := range service.APIs() {
+			Expect(server.RegisterName(api.Namespace, api.Service)).To(Succeed())
+		}
+		client = rpc.DialInProc(server)
+		payloads = make(chan stream.Payload, 10)
+	})
+
+	AfterEach(func() {
+		if sub != nil {
+			sub.Unsubscribe()
+		}
+		service.Stop()
+		client.Close()
+	})
+
+	subscribe := func(settings stream.SubscriptionSettings) {
+		var err error
+		sub, err = client.Subscribe(context.Background(), stream.APIName, payloads, "blocks", settings)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	// committed notifies the service until the subscription has been registered
+	committed := func() {
+		Eventually(func() int {
+			service.Committed(mocks.MockStateDiffPayload)
+			return len(payloads)
+		}).ShouldNot(BeZero())
+	}
+
+	It("Pushes committed blocks to subscribers", func() {
+		subscribe(stream.SubscriptionSettings{})
+		committed()
+		payload := <-payloads
+		Expect(payload.BlockHash).To(Equal(mocks.MockBlock.Hash()))
+		Expect(payload.Header.Data).To(Equal(smocks.MockPayload.Header.Data))
+		Expect(payload.Transactions).To(HaveLen(3))
+		Expect(payload.Logs).To(HaveLen(2))
+	})
+
+	It("Replays indexed blocks when resuming from a height", func() {
+		start := hexutil.Uint64(0)
+		subscribe(stream.SubscriptionSettings{Start: &start, Types: []string{"headers"}, CIDsOnly: true})
+		var payload stream.Payload
+		Eventually(payloads).Should(Receive(&payload))
+		Expect(payload.BlockHash).To(Equal(earlier))
+		Expect(payload.Header.CID).To(Equal(smocks.MockPayload.Header.CID))
+		Expect(payload.Header.Data).To(BeNil())
+		Expect(payload.Transactions).To(BeEmpty())
+		committed()
+		Eventually(payloads).Should(Receive(&payload))
+		Expect(payload.BlockHash).To(Equal(mocks.MockBlock.Hash()))
+	})
+
+	It("Retries a committed block that can't be retrieved yet", func() {
+		start := hexutil.Uint64(0)
+		subscribe(stream.SubscriptionSettings{Start: &start})
+		var payload stream.Payload
+		Eventually(payloads).Should(Receive(&payload))
+		Expect(payload.BlockHash).To(Equal(earlier))
+		retriever.Lock()
+		delete(retriever.Payloads, smocks.MockPayload.BlockHash)
+		retriever.Unlock()
+		service.Committed(mocks.MockStateDiffPayload)
+		Eventually(func() int {
+			retriever.Lock()
+			defer retriever.Unlock()
+			return len(retriever.PassedHashes)
+		}).Should(BeNumerically(">=", 2))
+		retriever.Lock()
+		retriever.Payloads[smocks.MockPayload.BlockHash] = smocks.MockPayload
+		retriever.Unlock()
+		Eventually(payloads, 2*time.Second).Should(Receive(&payload))
+		Expect(payload.BlockHash).To(Equal(mocks.MockBlock.Hash()))
+	})
+
+	It("Doesn't push blocks that don't match the filters", func() {
+		subscribe(stream.SubscriptionSettings{Types: []string{"storage"}, StorageKeys: []common.Hash{common.HexToHash("0x02")}})
+		Eventually(func() int {
+			service.Committed(mocks.MockStateDiffPayload)
+			retriever.Lock()
+			defer retriever.Unlock()
+			return len(retriever.PassedHashes)
+		}).ShouldNot(BeZero())
+		Consistently(payloads, 100*time.Millisecond).ShouldNot(Receive())
+	})
+})
@@ -0,0 +1,166 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// APIName is the namespace for the indexer's admin api
+const APIName = "indexer"
+
+// APIVersion is the version of the indexer's admin api
+const APIVersion = "0.0.1"
+
+// pendingRangeLimit is the maximum number of ranges that can be waiting to be resynced
+const pendingRangeLimit = 100
+
+var errNotRunning = errors.New("indexer is not running")
+
+// IndexerAPI is the indexer_ namespace for inspecting and controlling a running indexer
+type IndexerAPI struct {
+	service *Service
+}
+
+// NewIndexerAPI creates a new IndexerAPI for the provided service
+func NewIndexerAPI(service *Service) *IndexerAPI {
+	return &IndexerAPI{
+		service: service,
+	}
+}
+
+// Status is the state of a running indexer
+type Status struct {
+	// Highest block received from the subscription
+	Head uint64 `json:"head"`
+	// Highest block transformed by a sync worker
+	LastIndexed uint64 `json:"lastIndexed"`
+	// Number of sync workers running, and the number we want running
+	Workers       int64 `json:"workers"`
+	TargetWorkers int64 `json:"targetWorkers"`
+	// Number of payloads waiting for a sync worker
+	QueueLength  int                `json:"queueLength"`
+	Paused       bool               `json:"paused"`
+	Subscription SubscriptionStatus `json:"subscription"`
+	// Ranges waiting to be or being resynced
+	PendingResyncs []BlockRange `json:"pendingResyncs"`
+}
+
+// SubscriptionStatus is the health of the indexer's statediff subscription
+type SubscriptionStatus struct {
+	Healthy     bool      `json:"healthy"`
+	LastPayload time.Time `json:"lastPayload"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Status returns the current state of the indexer
+func (api *IndexerAPI) Status() (*Status, error) {
+	c := api.service.control
+	if c == nil {
+		return nil, errNotRunning
+	}
+	c.Lock()
+	defer c.Unlock()
+	status := &Status{
+		Head:          c.head,
+		LastIndexed:   c.lastIndexed,
+		Workers:       c.running,
+		TargetWorkers: c.target,
+		QueueLength:   len(c.publishPayload),
+		Paused:        c.paused,
+		Subscription: SubscriptionStatus{
+			Healthy:     c.subErr == nil,
+			LastPayload: c.lastPayload,
+		},
+		PendingResyncs: append([]BlockRange{}, c.pending...),
+	}
+	if c.subErr != nil {
+		status.Subscription.Error = c.subErr.Error()
+	}
+	return status, nil
+}
+
+// Pause stops the sync workers and any resync from processing further payloads until resumed
+// While paused the subscription is kept open, but only the most recent payloads are kept in the queue
+func (api *IndexerAPI) Pause() error {
+	if api.service.control == nil {
+		return errNotRunning
+	}
+	api.service.control.setPaused(true)
+	return nil
+}
+
+// Resume restarts processing after a pause
+func (api *IndexerAPI) Resume() error {
+	if api.service.control == nil {
+		return errNotRunning
+	}
+	api.service.control.setPaused(false)
+	return nil
+}
+
+// SetWorkers changes the number of sync workers
+// Workers that are removed finish the payload they are working on before shutting down
+func (api *IndexerAPI) SetWorkers(workers int64) error {
+	if api.service.control == nil {
+		return errNotRunning
+	}
+	if workers < 1 {
+		return fmt.Errorf("need at least one sync worker, got %d", workers)
+	}
+	api.service.setWorkers(workers)
+	return nil
+}
+
+// EnqueueResync queues the range to be fetched from the ethereum node and reindexed by this process
+// Ranges are resynced one at a time, in the order they are enqueued
+func (api *IndexerAPI) EnqueueResync(start, stop uint64) error {
+	c := api.service.control
+	if c == nil {
+		return errNotRunning
+	}
+	if api.service.Fetcher == nil {
+		return errors.New("indexer is not configured to fetch payloads for a resync")
+	}
+	if start > stop {
+		return fmt.Errorf("range start %d is greater than its stop %d", start, stop)
+	}
+	rng := BlockRange{Start: start, Stop: stop}
+	c.Lock()
+	defer c.Unlock()
+	select {
+	case c.rangeChan <- rng:
+		c.pending = append(c.pending, rng)
+		return nil
+	default:
+		return fmt.Errorf("there are already %d ranges waiting to be resynced", pendingRangeLimit)
+	}
+}
+
+// EnqueueBackfill resets the validation level of the headers in the range
+// so that a running backfill process picks the range up and refills it on its next gap check
+func (api *IndexerAPI) EnqueueBackfill(start, stop uint64) error {
+	if api.service.Cleaner == nil {
+		return errors.New("indexer is not configured to reset validation levels for a backfill")
+	}
+	if start > stop {
+		return fmt.Errorf("range start %d is greater than its stop %d", start, stop)
+	}
+	return api.service.Cleaner.ResetValidation([][2]uint64{{start, stop}})
+}
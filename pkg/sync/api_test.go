@@ -0,0 +1,149 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sync_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/statediff"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+	s "github.com/vulcanize/ipld-eth-indexer/pkg/sync"
+)
+
+var _ = Describe("IndexerAPI", func() {
+	var (
+		wg              *sync.WaitGroup
+		payloadChan     chan statediff.Payload
+		quitChan        chan bool
+		mockTransformer *mocks.Transformer
+		mockFetcher     *mocks.PayloadFetcher
+		mockCleaner     *mocks.Cleaner
+		service         *s.Service
+		api             *s.IndexerAPI
+	)
+	BeforeEach(func() {
+		wg = new(sync.WaitGroup)
+		payloadChan = make(chan statediff.Payload, 1)
+		quitChan = make(chan bool)
+		mockTransformer = &mocks.Transformer{
+			ReturnHeight: mocks.BlockNumber.Uint64(),
+		}
+		mockFetcher = &mocks.PayloadFetcher{
+			PayloadsToReturn: map[uint64]statediff.Payload{
+				mocks.BlockNumber.Uint64(): mocks.MockStateDiffPayload,
+			},
+		}
+		mockCleaner = new(mocks.Cleaner)
+		service = &s.Service{
+			Streamer: &mocks.PayloadStreamer{
+				ReturnSub: &rpc.ClientSubscription{},
+			},
+			Transformer: mockTransformer,
+			Fetcher:     mockFetcher,
+			Cleaner:     mockCleaner,
+			PayloadChan: payloadChan,
+			QuitChan:    quitChan,
+			Workers:     1,
+		}
+		api = s.NewIndexerAPI(service)
+	})
+	AfterEach(func() {
+		close(quitChan)
+		wg.Wait()
+	})
+
+	status := func() *s.Status {
+		status, err := api.Status()
+		Expect(err).ToNot(HaveOccurred())
+		return status
+	}
+
+	It("Errors if the indexer is not running", func() {
+		_, err := api.Status()
+		Expect(err).To(HaveOccurred())
+		Expect(api.Pause()).ToNot(Succeed())
+	})
+
+	It("Reports the head and last indexed height", func() {
+		Expect(service.Sync(wg)).To(Succeed())
+		Expect(status().Workers).To(Equal(int64(1)))
+		payloadChan <- mocks.MockStateDiffPayload
+		Eventually(func() uint64 { return status().LastIndexed }).Should(Equal(mocks.BlockNumber.Uint64()))
+		st := status()
+		Expect(st.Head).To(Equal(mocks.BlockNumber.Uint64()))
+		Expect(st.QueueLength).To(Equal(0))
+		Expect(st.Subscription.Healthy).To(BeTrue())
+		Expect(st.Subscription.LastPayload.IsZero()).To(BeFalse())
+	})
+
+	It("Pauses and resumes processing", func() {
+		Expect(service.Sync(wg)).To(Succeed())
+		Expect(api.Pause()).To(Succeed())
+		payloadChan <- mocks.MockStateDiffPayload
+		Eventually(func() int { return status().QueueLength }).Should(Equal(1))
+		Consistently(func() uint64 { return status().LastIndexed }, 500*time.Millisecond).Should(BeZero())
+		Expect(status().Paused).To(BeTrue())
+		Expect(api.Resume()).To(Succeed())
+		Eventually(func() uint64 { return status().LastIndexed }).Should(Equal(mocks.BlockNumber.Uint64()))
+		Expect(status().Paused).To(BeFalse())
+	})
+
+	It("Changes the number of workers", func() {
+		Expect(service.Sync(wg)).To(Succeed())
+		Expect(api.SetWorkers(3)).To(Succeed())
+		Expect(status().Workers).To(Equal(int64(3)))
+		Expect(api.SetWorkers(2)).To(Succeed())
+		Eventually(func() int64 { return status().Workers }).Should(Equal(int64(2)))
+		Expect(status().TargetWorkers).To(Equal(int64(2)))
+		Expect(api.SetWorkers(0)).ToNot(Succeed())
+	})
+
+	It("Resyncs enqueued ranges", func() {
+		Expect(service.Sync(wg)).To(Succeed())
+		Expect(api.EnqueueResync(2, 1)).ToNot(Succeed())
+		Expect(api.EnqueueResync(mocks.BlockNumber.Uint64(), mocks.BlockNumber.Uint64())).To(Succeed())
+		Eventually(func() int { return len(status().PendingResyncs) }).Should(BeZero())
+		Expect(mockFetcher.CalledAtBlockHeights).To(Equal([][]uint64{{mocks.BlockNumber.Uint64()}}))
+		Expect(mockTransformer.PassedStateDiff).To(Equal(mocks.MockStateDiffPayload))
+	})
+
+	It("Resets the validation level of ranges enqueued for backfill", func() {
+		Expect(service.Sync(wg)).To(Succeed())
+		Expect(api.EnqueueBackfill(10, 20)).To(Succeed())
+		Expect(mockCleaner.PassedResetRanges).To(Equal([][2]uint64{{10, 20}}))
+	})
+
+	It("Is served in the indexer namespace", func() {
+		Expect(service.Sync(wg)).To(Succeed())
+		server := rpc.NewServer()
+		defer server.Stop()
+		for _, api := range service.APIs() {
+			Expect(server.RegisterName(api.Namespace, api.Service)).To(Succeed())
+		}
+		client := rpc.DialInProc(server)
+		defer client.Close()
+		Expect(client.Call(nil, "indexer_setWorkers", 2)).To(Succeed())
+		var st s.Status
+		Expect(client.Call(&st, "indexer_status")).To(Succeed())
+		Expect(st.Workers).To(Equal(int64(2)))
+	})
+})
@@ -18,10 +18,12 @@ package sync
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/spf13/viper"
 
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
@@ -30,7 +32,11 @@ import (
 
 // Env variables
 const (
-	SYNC_WORKERS = "SYNC_WORKERS"
+	SYNC_WORKERS              = "SYNC_WORKERS"
+	SYNC_RECORD_PATH          = "SYNC_RECORD_PATH"
+	SYNC_REPLAY_PATH          = "SYNC_REPLAY_PATH"
+	SYNC_VALIDATE_STATE_DIFFS = "SYNC_VALIDATE_STATE_DIFFS"
+	SYNC_CROSS_VALIDATE       = "SYNC_CROSS_VALIDATE"
 
 	SYNC_MAX_IDLE_CONNECTIONS = "SYNC_MAX_IDLE_CONNECTIONS"
 	SYNC_MAX_OPEN_CONNECTIONS = "SYNC_MAX_OPEN_CONNECTIONS"
@@ -39,11 +45,20 @@ const (
 
 // Config struct
 type Config struct {
-	DB       *postgres.DB
-	DBConfig postgres.Config
-	Workers  int64
-	WSClient *rpc.Client
-	NodeInfo node.Info
+	DB                 *postgres.DB
+	DBConfig           postgres.Config
+	Blockstore         blockstore.Blockstore
+	BlockstoreConfig   blockstore.Config
+	Workers            int64
+	WSClient           *rpc.Client
+	Timeout            time.Duration // HTTP connection timeout in seconds, used when fetching ranges enqueued for resync
+	NodeInfo           node.Info
+	RecordPath         string              // Path to a local file to record streamed payloads to
+	ReplayPath         string              // Path to a local file of recorded payloads to replay instead of streaming from geth
+	ValidateStateDiffs bool                // If true, validate state diffs against the header state root before counting them as validated
+	CrossValidate      bool                // If true, count the independent nodes which agree on a header, rather than the times it was indexed, as its validation level
+	Filter             shared.IndexFilter  // Selects the subset of each payload that is indexed
+	Conflicts          shared.ConflictMode // How re-indexing a row with different content is handled
 }
 
 // NewConfig is used to initialize a sync config from a .toml file
@@ -51,24 +66,57 @@ func NewConfig() (*Config, error) {
 	c := new(Config)
 	var err error
 	viper.BindEnv("sync.workers", SYNC_WORKERS)
+	viper.BindEnv("sync.recordPath", SYNC_RECORD_PATH)
+	viper.BindEnv("sync.replayPath", SYNC_REPLAY_PATH)
+	viper.BindEnv("sync.validateStateDiffs", SYNC_VALIDATE_STATE_DIFFS)
+	viper.BindEnv("sync.crossValidate", SYNC_CROSS_VALIDATE)
 	viper.BindEnv("ethereum.wsPath", shared.ETH_WS_PATH)
+	viper.BindEnv("sync.timeout", shared.HTTP_TIMEOUT)
 
 	workers := viper.GetInt64("sync.workers")
 	if workers < 1 {
 		workers = 1
 	}
 	c.Workers = workers
-
-	ethWS := viper.GetString("ethereum.wsPath")
-	c.NodeInfo, c.WSClient, err = shared.GetEthNodeAndClient(fmt.Sprintf("ws://%s", ethWS))
+	c.RecordPath = viper.GetString("sync.recordPath")
+	c.ReplayPath = viper.GetString("sync.replayPath")
+	c.ValidateStateDiffs = viper.GetBool("sync.validateStateDiffs")
+	c.CrossValidate = viper.GetBool("sync.crossValidate")
+	c.Filter, err = shared.GetIndexFilter()
+	if err != nil {
+		return nil, err
+	}
+	c.Conflicts, err = shared.GetConflictMode()
 	if err != nil {
 		return nil, err
 	}
+	timeout := viper.GetInt("sync.timeout")
+	if timeout < 15 {
+		timeout = 15
+	}
+	c.Timeout = time.Second * time.Duration(timeout)
+
+	if c.ReplayPath != "" {
+		c.NodeInfo = shared.GetEthNodeInfo()
+	} else {
+		ethWS := viper.GetString("ethereum.wsPath")
+		c.NodeInfo, c.WSClient, err = shared.GetEthNodeAndClient(fmt.Sprintf("ws://%s", ethWS))
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	c.DBConfig.Init()
 	overrideDBConnConfig(&c.DBConfig)
-	syncDB := utils.LoadPostgres(c.DBConfig, c.NodeInfo, true)
+	syncDB := utils.LoadMigratedPostgres(c.DBConfig, c.NodeInfo, true)
 	c.DB = &syncDB
+	if err := c.BlockstoreConfig.Init(); err != nil {
+		return nil, err
+	}
+	c.Blockstore, err = blockstore.NewBlockstore(c.BlockstoreConfig, c.DB.DB)
+	if err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
@@ -0,0 +1,152 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/statediff"
+)
+
+// BlockRange is an inclusive range of block heights
+type BlockRange struct {
+	Start uint64 `json:"start"`
+	Stop  uint64 `json:"stop"`
+}
+
+// control holds the runtime state of a running indexer that can be inspected and changed through its API
+type control struct {
+	sync.Mutex
+	// WaitGroup and queue passed to Sync, used to spin up new workers
+	wg             *sync.WaitGroup
+	publishPayload chan statediff.Payload
+	// Closed and replaced whenever the workers need to re-check whether to pause or exit
+	changed chan struct{}
+	paused  bool
+	// Number of workers we want and number of workers currently running
+	target, running int64
+	// ID to give the next worker spun up
+	nextID int
+	// Highest block received from the subscription, and highest block transformed by a worker
+	head, lastIndexed uint64
+	// Health of the subscription
+	lastPayload time.Time
+	subErr      error
+	// Ranges waiting to be or being resynced
+	rangeChan chan BlockRange
+	pending   []BlockRange
+}
+
+func newControl(wg *sync.WaitGroup, publishPayload chan statediff.Payload, workers int64) *control {
+	return &control{
+		wg:             wg,
+		publishPayload: publishPayload,
+		changed:        make(chan struct{}),
+		target:         workers,
+		rangeChan:      make(chan BlockRange, pendingRangeLimit),
+	}
+}
+
+// broadcast wakes up every worker waiting on the current changed channel
+// It must be called while holding the lock
+func (c *control) broadcast() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// await blocks while the indexer is paused
+// It returns false if the calling worker should exit, either because we are quitting or because there are more workers than we want
+// Otherwise it returns the channel which is closed the next time the workers need to re-check
+func (c *control) await(quit <-chan bool) (<-chan struct{}, bool) {
+	c.Lock()
+	for {
+		if c.running > c.target {
+			c.running--
+			c.Unlock()
+			return nil, false
+		}
+		changed := c.changed
+		if !c.paused {
+			c.Unlock()
+			return changed, true
+		}
+		c.Unlock()
+		select {
+		case <-changed:
+		case <-quit:
+			return nil, false
+		}
+		c.Lock()
+	}
+}
+
+// awaitUnpaused blocks while the indexer is paused, it returns false if we are quitting
+func (c *control) awaitUnpaused(quit <-chan bool) bool {
+	c.Lock()
+	for c.paused {
+		changed := c.changed
+		c.Unlock()
+		select {
+		case <-changed:
+		case <-quit:
+			return false
+		}
+		c.Lock()
+	}
+	c.Unlock()
+	return true
+}
+
+func (c *control) setPaused(paused bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.paused = paused
+	c.broadcast()
+}
+
+func (c *control) received(height uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if height > c.head {
+		c.head = height
+	}
+	c.lastPayload = time.Now()
+}
+
+func (c *control) indexed(height uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if height > c.lastIndexed {
+		c.lastIndexed = height
+	}
+}
+
+func (c *control) subscriptionError(err error) {
+	c.Lock()
+	defer c.Unlock()
+	c.subErr = err
+}
+
+// finished removes the first pending range, ranges are resynced in the order they were enqueued
+func (c *control) finished() {
+	c.Lock()
+	defer c.Unlock()
+	if len(c.pending) > 0 {
+		c.pending = c.pending[1:]
+	}
+}
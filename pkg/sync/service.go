@@ -17,6 +17,7 @@
 package sync
 
 import (
+	"io"
 	"sync"
 
 	ethnode "github.com/ethereum/go-ethereum/node"
@@ -29,6 +30,8 @@ import (
 	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/prom"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/stream"
+	"github.com/vulcanize/ipld-eth-indexer/utils"
 )
 
 // Indexer is the top level interface for streaming, converting to IPLDs, publishing, and indexing all chain data at head
@@ -48,16 +51,28 @@ type Indexer interface {
 type Service struct {
 	// Interface for streaming payloads over an rpc subscription
 	Streamer eth.Streamer
+	// Interface for recording streamed payloads to a local file, nil if not recording
+	Recorder eth.Recorder
 	// Interface for transforming raw payloads into IPLD object models in Postgres
 	Transformer eth.Transformer
+	// Interface for fetching the payloads of ranges enqueued for resync, nil if resyncing is not supported
+	Fetcher eth.Fetcher
+	// Interface for resetting the validation level of ranges enqueued for backfill, nil if backfilling is not supported
+	Cleaner eth.Cleaner
+	// Pushes committed blocks to the subscribers of the stream api, nil if streaming is not supported
+	Stream *stream.Service
 	// Chan the processor uses to subscribe to payloads from the Streamer
 	PayloadChan chan statediff.Payload
 	// Used to signal shutdown of the service
 	QuitChan chan bool
 	// Number of sync workers
 	Workers int64
+	// Flag to block on a full publish buffer instead of dropping its oldest payload, set when replaying a recording
+	replay bool
 	// chain type for this service
 	ChainConfig *params.ChainConfig
+	// Runtime state exposed through the indexer api, initialized by Sync
+	control *control
 }
 
 // NewIndexer creates a new Indexer using an underlying Service struct
@@ -65,12 +80,47 @@ func NewIndexerService(settings *Config) (Indexer, error) {
 	sn := new(Service)
 	var err error
 	sn.PayloadChan = make(chan statediff.Payload, eth.PayloadChanBufferSize)
-	sn.Streamer = eth.NewPayloadStreamer(settings.WSClient)
+	if settings.ReplayPath != "" {
+		sn.Streamer = eth.NewFileStreamer(settings.ReplayPath)
+		sn.replay = true
+	} else {
+		streamer := eth.NewPayloadStreamer(settings.WSClient)
+		streamer.WatchAddresses(settings.Filter.Addresses)
+		sn.Streamer = streamer
+	}
+	if settings.ReplayPath != "" {
+		sn.Fetcher, err = eth.NewFileFetcher(settings.ReplayPath)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		fetcher := eth.NewPayloadFetcher(settings.WSClient, settings.Timeout)
+		fetcher.WatchAddresses(settings.Filter.Addresses)
+		sn.Fetcher = fetcher
+	}
+	if settings.RecordPath != "" {
+		sn.Recorder, err = eth.NewPayloadRecorder(settings.RecordPath)
+		if err != nil {
+			return nil, err
+		}
+	}
 	sn.ChainConfig, err = eth.ChainConfig(settings.NodeInfo.ChainID)
 	if err != nil {
 		return nil, err
 	}
-	sn.Transformer = eth.NewStateDiffTransformer(sn.ChainConfig, settings.DB)
+	transformer := eth.NewStateDiffTransformer(sn.ChainConfig, settings.DB)
+	transformer.SetValidation(settings.ValidateStateDiffs)
+	transformer.SetCrossValidation(settings.CrossValidate)
+	transformer.SetFilter(settings.Filter)
+	transformer.SetConflictMode(settings.Conflicts)
+	transformer.SetBlockstore(settings.Blockstore)
+	sn.Transformer = transformer
+	cleaner := eth.NewDBCleaner(settings.DB)
+	cleaner.SetBlockstore(settings.Blockstore)
+	sn.Cleaner = cleaner
+	retriever := stream.NewDBRetriever(settings.DB, sn.ChainConfig)
+	retriever.SetBlockstore(settings.Blockstore)
+	sn.Stream = stream.NewStreamService(retriever)
 	sn.QuitChan = make(chan bool)
 	sn.Workers = settings.Workers
 	return sn, nil
@@ -83,7 +133,18 @@ func (sap *Service) Protocols() []p2p.Protocol {
 
 // APIs returns the RPC descriptors the indexer service offers
 func (sap *Service) APIs() []rpc.API {
-	return []rpc.API{}
+	apis := []rpc.API{
+		{
+			Namespace: APIName,
+			Version:   APIVersion,
+			Service:   NewIndexerAPI(sap),
+			Public:    false,
+		},
+	}
+	if sap.Stream != nil {
+		apis = append(apis, sap.Stream.APIs()...)
+	}
+	return apis
 }
 
 // Sync streams incoming raw chain data and converts it for further processing
@@ -96,25 +157,55 @@ func (sap *Service) Sync(wg *sync.WaitGroup) error {
 	}
 	// spin up publish worker goroutines
 	publishPayload := make(chan statediff.Payload, eth.PayloadChanBufferSize)
-	for i := 1; i <= int(sap.Workers); i++ {
-		go sap.transform(wg, i, publishPayload)
-		log.Debugf("ethereum sync worker %d successfully spun up", i)
+	sap.control = newControl(wg, publishPayload, sap.Workers)
+	sap.setWorkers(sap.Workers)
+	if sap.Fetcher != nil {
+		wg.Add(1)
+		go sap.resync(wg)
 	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		if sap.Recorder != nil {
+			defer func() {
+				if err := sap.Recorder.Close(); err != nil {
+					log.Errorf("ethereum sync recorder error: %v", err)
+				}
+			}()
+		}
 		for {
 			select {
 			case diffPayload := <-sap.PayloadChan:
-				select {
-				case publishPayload <- diffPayload:
-				default:
-					<-publishPayload
-					publishPayload <- diffPayload
+				if header, err := eth.PayloadHeader(diffPayload); err != nil {
+					log.Errorf("ethereum sync payload error: %v", err)
+				} else {
+					sap.control.received(header.Number.Uint64())
+				}
+				if sap.Recorder != nil {
+					if err := sap.Recorder.Record(diffPayload); err != nil {
+						log.Errorf("ethereum sync recorder error: %v", err)
+					}
+				}
+				if sap.replay {
+					// a recording is replayed as fast as it can be read, so wait for the workers rather than drop payloads
+					select {
+					case publishPayload <- diffPayload:
+					case <-sap.QuitChan:
+						log.Info("quiting ethereum sync process")
+						return
+					}
+				} else {
+					select {
+					case publishPayload <- diffPayload:
+					default:
+						<-publishPayload
+						publishPayload <- diffPayload
+					}
 				}
 				prom.SetLenPayloadChan(len(publishPayload))
 			case err := <-sub.Err():
 				log.Errorf("ethereumm sync subscription error: %v", err)
+				sap.control.subscriptionError(err)
 			case <-sap.QuitChan:
 				log.Info("quiting ethereum sync process")
 				return
@@ -128,17 +219,26 @@ func (sap *Service) Sync(wg *sync.WaitGroup) error {
 // transform is spun up by Sync and receives statediff payloads from it
 // it transforms this data into IPLD models and indexes their CIDs with useful metadata in Postgres
 func (sap *Service) transform(wg *sync.WaitGroup, id int, statediffChan <-chan statediff.Payload) {
-	wg.Add(1)
 	defer wg.Done()
 	for {
+		// block while paused, and exit if there are more workers than we want
+		changed, ok := sap.control.await(sap.QuitChan)
+		if !ok {
+			log.Infof("ethereum sync worker %d shutting down", id)
+			return
+		}
 		select {
 		case diff := <-statediffChan:
 			prom.SetLenPayloadChan(len(statediffChan))
 			blockNumber, err := sap.Transformer.Transform(id, diff)
 			if err != nil {
 				log.Errorf("ethereum sync worker %d transformer error: %v", id, err)
+				continue
 			}
+			sap.control.indexed(blockNumber)
+			sap.committed(diff)
 			log.Infof("ethereum sync worker %d transformed data at height %d", id, blockNumber)
+		case <-changed:
 		case <-sap.QuitChan:
 			log.Infof("ethereum sync worker %d shutting down", id)
 			return
@@ -146,6 +246,81 @@ func (sap *Service) transform(wg *sync.WaitGroup, id int, statediffChan <-chan s
 	}
 }
 
+// setWorkers sets the number of sync workers we want, spinning up new ones as needed
+// the workers check the number themselves and shut down if there are too many
+func (sap *Service) setWorkers(workers int64) {
+	c := sap.control
+	c.Lock()
+	defer c.Unlock()
+	c.target = workers
+	for c.running < c.target {
+		c.running++
+		c.nextID++
+		c.wg.Add(1)
+		go sap.transform(c.wg, c.nextID, c.publishPayload)
+		log.Debugf("ethereum sync worker %d successfully spun up", c.nextID)
+	}
+	c.broadcast()
+}
+
+// resync is spun up by Sync and resyncs the ranges enqueued through the indexer api, one at a time
+func (sap *Service) resync(wg *sync.WaitGroup) {
+	defer wg.Done()
+	if closer, ok := sap.Fetcher.(io.Closer); ok {
+		defer func() {
+			if err := closer.Close(); err != nil {
+				log.Errorf("ethereum sync resync fetcher error: %v", err)
+			}
+		}()
+	}
+	for {
+		select {
+		case rng := <-sap.control.rangeChan:
+			log.Infof("ethereum sync resyncing range from %d to %d", rng.Start, rng.Stop)
+			if err := sap.resyncRange(rng); err != nil {
+				log.Errorf("ethereum sync resync error for range from %d to %d: %v", rng.Start, rng.Stop, err)
+			}
+			sap.control.finished()
+		case <-sap.QuitChan:
+			log.Info("ethereum sync resync process shutting down")
+			return
+		}
+	}
+}
+
+func (sap *Service) resyncRange(rng BlockRange) error {
+	blockRangeBins, err := utils.GetBlockHeightBins(rng.Start, rng.Stop, shared.DefaultMaxBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, heights := range blockRangeBins {
+		if !sap.control.awaitUnpaused(sap.QuitChan) {
+			return nil
+		}
+		payloads, err := sap.Fetcher.FetchAt(heights)
+		if err != nil {
+			return err
+		}
+		for _, payload := range payloads {
+			blockNumber, err := sap.Transformer.Transform(0, payload)
+			if err != nil {
+				log.Errorf("ethereum sync resync transformer error: %v", err)
+				continue
+			}
+			sap.committed(payload)
+			log.Infof("ethereum sync resync transformed data at height %d", blockNumber)
+		}
+	}
+	return nil
+}
+
+// committed notifies the stream subscribers of a payload that has been committed
+func (sap *Service) committed(payload statediff.Payload) {
+	if sap.Stream != nil {
+		sap.Stream.Committed(payload)
+	}
+}
+
 // Start is used to begin the service
 // This is mostly just to satisfy the node.Service interface
 func (sap *Service) Start() error {
@@ -158,6 +333,9 @@ func (sap *Service) Start() error {
 // This is mostly just to satisfy the node.Service interface
 func (sap *Service) Stop() error {
 	log.Info("stopping ethereum indexer service")
+	if sap.Stream != nil {
+		sap.Stream.Stop()
+	}
 	close(sap.QuitChan)
 	return nil
 }
@@ -0,0 +1,100 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package validate
+
+import (
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+	"github.com/vulcanize/ipld-eth-indexer/utils"
+)
+
+// Env variables
+const (
+	VALIDATE_START            = "VALIDATE_START"
+	VALIDATE_STOP             = "VALIDATE_STOP"
+	VALIDATE_BATCH_SIZE       = "VALIDATE_BATCH_SIZE"
+	VALIDATE_RESET_VALIDATION = "VALIDATE_RESET_VALIDATION"
+	VALIDATE_REPORT_PATH      = "VALIDATE_REPORT_PATH"
+
+	VALIDATE_MAX_IDLE_CONNECTIONS = "VALIDATE_MAX_IDLE_CONNECTIONS"
+	VALIDATE_MAX_OPEN_CONNECTIONS = "VALIDATE_MAX_OPEN_CONNECTIONS"
+	VALIDATE_MAX_CONN_LIFETIME    = "VALIDATE_MAX_CONN_LIFETIME"
+)
+
+// Config holds the parameters needed to perform a state diff validation
+type Config struct {
+	Start           uint64 // Block height to start validating from
+	Stop            uint64 // Block height to stop validating at, if 0 the entire database is validated
+	BatchSize       uint64 // Number of block heights to load headers for per query
+	ResetValidation bool   // If true, reset times_validated to 0 at bad heights so that backfill resyncs them
+	ReportPath      string // Path to write the JSON report to, if empty the report is only logged
+
+	// DB info
+	DB       *postgres.DB
+	DBConfig postgres.Config
+
+	// Blockstore the IPLD blocks are read from
+	Blockstore       blockstore.Blockstore
+	BlockstoreConfig blockstore.Config
+
+	NodeInfo node.Info
+}
+
+// NewConfig fills and returns a validate config from toml parameters
+func NewConfig() (*Config, error) {
+	c := new(Config)
+
+	viper.BindEnv("validate.start", VALIDATE_START)
+	viper.BindEnv("validate.stop", VALIDATE_STOP)
+	viper.BindEnv("validate.batchSize", VALIDATE_BATCH_SIZE)
+	viper.BindEnv("validate.resetValidation", VALIDATE_RESET_VALIDATION)
+	viper.BindEnv("validate.reportPath", VALIDATE_REPORT_PATH)
+
+	c.Start = uint64(viper.GetInt64("validate.start"))
+	c.Stop = uint64(viper.GetInt64("validate.stop"))
+	c.BatchSize = uint64(viper.GetInt64("validate.batchSize"))
+	c.ResetValidation = viper.GetBool("validate.resetValidation")
+	c.ReportPath = viper.GetString("validate.reportPath")
+	c.NodeInfo = shared.GetEthNodeInfo()
+
+	c.DBConfig.Init()
+	overrideDBConnConfig(&c.DBConfig)
+	db := utils.LoadPostgres(c.DBConfig, c.NodeInfo, false)
+	c.DB = &db
+	if err := c.BlockstoreConfig.Init(); err != nil {
+		return nil, err
+	}
+	var err error
+	c.Blockstore, err = blockstore.NewBlockstore(c.BlockstoreConfig, c.DB.DB)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func overrideDBConnConfig(con *postgres.Config) {
+	viper.BindEnv("database.validate.maxIdle", VALIDATE_MAX_IDLE_CONNECTIONS)
+	viper.BindEnv("database.validate.maxOpen", VALIDATE_MAX_OPEN_CONNECTIONS)
+	viper.BindEnv("database.validate.maxLifetime", VALIDATE_MAX_CONN_LIFETIME)
+	con.MaxIdle = viper.GetInt("database.validate.maxIdle")
+	con.MaxOpen = viper.GetInt("database.validate.maxOpen")
+	con.MaxLifetime = viper.GetInt("database.validate.maxLifetime")
+}
@@ -0,0 +1,302 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package validate
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ethereum/go-ethereum/common"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/utils"
+)
+
+// DefaultBatchSize is the default number of block heights to load headers for per query
+const DefaultBatchSize uint64 = 100
+
+const (
+	headersPgStr = `SELECT id, block_number, block_hash, state_root FROM eth.header_cids
+			WHERE block_number BETWEEN $1 AND $2
+			AND chain_id = $3
+			ORDER BY block_number, id`
+	stateNodesPgStr = `SELECT state_cids.id, state_cids.state_path, state_cids.node_type, state_cids.mh_key, blocks.data, state_accounts.storage_root
+			FROM eth.state_cids
+			INNER JOIN public.blocks ON (state_cids.mh_key = blocks.key)
+			LEFT JOIN eth.state_accounts ON (state_cids.id = state_accounts.state_id)
+			WHERE state_cids.header_id = $1`
+	storageNodesPgStr = `SELECT storage_cids.state_id, storage_cids.storage_path, storage_cids.node_type, storage_cids.mh_key, blocks.data
+			FROM eth.storage_cids
+			INNER JOIN eth.state_cids ON (storage_cids.state_id = state_cids.id)
+			INNER JOIN public.blocks ON (storage_cids.mh_key = blocks.key)
+			WHERE state_cids.header_id = $1`
+)
+
+// Validator is the top level interface for validating the state diffs indexed in the database
+type Validator interface {
+	Validate() (*Report, error)
+}
+
+// Service for validating the state diffs indexed in the database
+type Service struct {
+	// DB to validate
+	DB *postgres.DB
+	// Interface for resetting the validation level of bad heights
+	Cleaner eth.Cleaner
+	// Blockstore the IPLD blocks are read from when public.blocks only records their keys
+	Blocks blockstore.Blockstore
+	// Block range to validate, if stop is 0 the range is the entire database
+	start, stop uint64
+	// Number of block heights to load headers for per query
+	batchSize uint64
+	// Flag to turn on or off resetting the validation level of bad heights
+	resetValidation bool
+	// Path to write the JSON report to
+	reportPath string
+}
+
+// NewValidateService returns a new validate service
+func NewValidateService(settings *Config) Validator {
+	batchSize := settings.BatchSize
+	if batchSize == 0 {
+		batchSize = DefaultBatchSize
+	}
+	blocks := settings.Blockstore
+	if blocks == nil {
+		blocks = blockstore.NewPostgresBlockstore(settings.DB.DB)
+	}
+	cleaner := eth.NewDBCleaner(settings.DB)
+	cleaner.SetBlockstore(blocks)
+	return &Service{
+		DB:              settings.DB,
+		Cleaner:         cleaner,
+		Blocks:          blocks,
+		start:           settings.Start,
+		stop:            settings.Stop,
+		batchSize:       batchSize,
+		resetValidation: settings.ResetValidation,
+		reportPath:      settings.ReportPath,
+	}
+}
+
+type headerRow struct {
+	ID          int64  `db:"id"`
+	BlockNumber uint64 `db:"block_number"`
+	BlockHash   string `db:"block_hash"`
+	StateRoot   string `db:"state_root"`
+}
+
+type stateRow struct {
+	ID          int64           `db:"id"`
+	Path        []byte          `db:"state_path"`
+	NodeType    int             `db:"node_type"`
+	MhKey       string          `db:"mh_key"`
+	Data        blockstore.Data `db:"data"`
+	StorageRoot sql.NullString  `db:"storage_root"`
+}
+
+type storageRow struct {
+	StateID  int64           `db:"state_id"`
+	Path     []byte          `db:"storage_path"`
+	NodeType int             `db:"node_type"`
+	MhKey    string          `db:"mh_key"`
+	Data     blockstore.Data `db:"data"`
+}
+
+// Validate runs the validation and returns its report
+func (s *Service) Validate() (*Report, error) {
+	report := &Report{
+		Start: s.start,
+		Stop:  s.stop,
+	}
+	if report.Stop == 0 {
+		if err := s.DB.Reader().Get(&report.Stop, `SELECT COALESCE(MAX(block_number), 0) FROM eth.header_cids WHERE chain_id = $1`, s.DB.Node.ChainID); err != nil {
+			return nil, err
+		}
+	}
+	if report.Stop >= report.Start {
+		bins, err := utils.GetBlockHeightBins(report.Start, report.Stop, s.batchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, heights := range bins {
+			headers := make([]headerRow, 0)
+			if err := s.DB.Reader().Select(&headers, headersPgStr, heights[0], heights[len(heights)-1], s.DB.Node.ChainID); err != nil {
+				return nil, err
+			}
+			for _, header := range headers {
+				if err := s.validateHeader(header, report); err != nil {
+					return nil, err
+				}
+			}
+			logrus.Infof("validated state diffs from %d to %d", heights[0], heights[len(heights)-1])
+		}
+	}
+	if s.resetValidation && len(report.BadHeights) > 0 {
+		rngs := make([][2]uint64, 0, len(report.BadHeights))
+		for _, height := range report.BadHeights {
+			rngs = append(rngs, [2]uint64{height, height})
+		}
+		if err := s.Cleaner.ResetValidation(rngs); err != nil {
+			return nil, err
+		}
+	}
+	if s.reportPath != "" {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(s.reportPath, b, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// validateHeader loads the state diff indexed for the header and checks it
+func (s *Service) validateHeader(header headerRow, report *Report) error {
+	stateRows := make([]stateRow, 0)
+	if err := s.DB.Reader().Select(&stateRows, stateNodesPgStr, header.ID); err != nil {
+		return err
+	}
+	storageRows := make([]storageRow, 0)
+	if err := s.DB.Reader().Select(&storageRows, storageNodesPgStr, header.ID); err != nil {
+		return err
+	}
+	storageNodes := make(map[int64][]sdtypes.StorageNode)
+	for _, row := range storageRows {
+		data, err := blockstore.Load(s.Blocks, row.MhKey, row.Data)
+		if err != nil {
+			return err
+		}
+		storageNodes[row.StateID] = append(storageNodes[row.StateID], sdtypes.StorageNode{
+			NodeType:  eth.ResolveToNodeType(row.NodeType),
+			Path:      row.Path,
+			NodeValue: data,
+		})
+	}
+	nodes := make([]sdtypes.StateNode, 0, len(stateRows))
+	storageRoots := make(map[string]common.Hash)
+	for _, row := range stateRows {
+		data, err := blockstore.Load(s.Blocks, row.MhKey, row.Data)
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, sdtypes.StateNode{
+			NodeType:     eth.ResolveToNodeType(row.NodeType),
+			Path:         row.Path,
+			NodeValue:    data,
+			StorageNodes: storageNodes[row.ID],
+		})
+		if row.StorageRoot.Valid {
+			storageRoots[string(row.Path)] = common.HexToHash(row.StorageRoot.String)
+		}
+	}
+	report.CheckedHeaders++
+	if problems := CheckStateDiff(common.HexToHash(header.StateRoot), nodes, storageRoots); len(problems) > 0 {
+		report.add(Failure{
+			BlockNumber: header.BlockNumber,
+			BlockHash:   header.BlockHash,
+			Problems:    problems,
+		})
+	}
+	return nil
+}
+
+// CheckStateDiff checks that an indexed state diff hashes consistently up to the header's state root,
+// and that the storage diff of each account hashes consistently up to the storage root indexed for it in eth.state_accounts
+// storageRoots maps the path of each state leaf to the storage root indexed for it
+// It returns the problems found, if any
+func CheckStateDiff(stateRoot common.Hash, nodes []sdtypes.StateNode, storageRoots map[string]common.Hash) []string {
+	var problems []string
+	stateNodes := make([]sdtypes.StateNode, len(nodes))
+	for i, n := range nodes {
+		stateNodes[i] = n
+		stateNodes[i].StorageNodes = nil
+	}
+	problems = append(problems, validationProblems(eth.ValidateStateDiff(stateRoot, stateNodes))...)
+	for _, n := range nodes {
+		if n.NodeType != sdtypes.Leaf {
+			continue
+		}
+		storageRoot, ok := storageRoots[string(n.Path)]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("state leaf at path %x has no indexed account", n.Path))
+			continue
+		}
+		account, err := eth.DecodeStateLeafAccount(n.NodeValue)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("state leaf at path %x: %v", n.Path, err))
+			continue
+		}
+		if account.Root != storageRoot {
+			problems = append(problems, fmt.Sprintf("state leaf at path %x has storage root %s but %s is indexed", n.Path, account.Root.Hex(), storageRoot.Hex()))
+		}
+		for _, problem := range validationProblems(eth.ValidateStorageDiff(storageRoot, n.StorageNodes)) {
+			problems = append(problems, fmt.Sprintf("state leaf at path %x: %s", n.Path, problem))
+		}
+	}
+	return problems
+}
+
+func validationProblems(err error) []string {
+	if err == nil {
+		return nil
+	}
+	if ve, ok := err.(*eth.ValidationError); ok {
+		return ve.Problems
+	}
+	return []string{err.Error()}
+}
+
+// Failure is a header whose indexed state diff failed validation
+type Failure struct {
+	BlockNumber uint64   `json:"blockNumber"`
+	BlockHash   string   `json:"blockHash"`
+	Problems    []string `json:"problems"`
+}
+
+// Report is the result of a validation
+type Report struct {
+	Start          uint64    `json:"start"`
+	Stop           uint64    `json:"stop"`
+	CheckedHeaders uint64    `json:"checkedHeaders"`
+	Failures       []Failure `json:"failures"`
+	// Heights with at least one failure
+	BadHeights []uint64 `json:"badHeights"`
+}
+
+// add records the failure, headers are validated in height order so the bad heights stay sorted
+func (r *Report) add(failure Failure) {
+	logrus.Warnf("state diff validation failed for block %d with hash %s: %v", failure.BlockNumber, failure.BlockHash, failure.Problems)
+	r.Failures = append(r.Failures, failure)
+	if l := len(r.BadHeights); l == 0 || r.BadHeights[l-1] != failure.BlockNumber {
+		r.BadHeights = append(r.BadHeights, failure.BlockNumber)
+	}
+}
+
+// String summarizes the report
+func (r *Report) String() string {
+	return fmt.Sprintf("validated the state diffs of %d headers from block %d to %d; %d failed validation at %d heights",
+		r.CheckedHeaders, r.Start, r.Stop, len(r.Failures), len(r.BadHeights))
+}
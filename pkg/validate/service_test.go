@@ -0,0 +1,125 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package validate_test
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	sdtypes "github.com/ethereum/go-ethereum/statediff/types"
+	"github.com/ethereum/go-ethereum/trie"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/validate"
+)
+
+// buildTrie commits the key-value pairs to a fresh trie and returns its root and every hashed node in it, keyed by path
+func buildTrie(kvs map[common.Hash][]byte) (common.Hash, map[string][]byte) {
+	trieDB := trie.NewDatabase(rawdb.NewMemoryDatabase())
+	tr, err := trie.New(common.Hash{}, trieDB)
+	Expect(err).ToNot(HaveOccurred())
+	for key, value := range kvs {
+		Expect(tr.TryUpdate(key.Bytes(), value)).To(Succeed())
+	}
+	root, err := tr.Commit(nil)
+	Expect(err).ToNot(HaveOccurred())
+	nodes := make(map[string][]byte)
+	it := tr.NodeIterator(nil)
+	for it.Next(true) {
+		if it.Hash() == (common.Hash{}) {
+			continue
+		}
+		value, err := trieDB.Node(it.Hash())
+		Expect(err).ToNot(HaveOccurred())
+		nodes[string(it.Path())] = value
+	}
+	Expect(it.Error()).ToNot(HaveOccurred())
+	return root, nodes
+}
+
+func nodeType(value []byte) sdtypes.NodeType {
+	n, err := eth.DecodeTrieNode(value)
+	Expect(err).ToNot(HaveOccurred())
+	return n.NodeType
+}
+
+var _ = Describe("CheckStateDiff", func() {
+	var (
+		stateRoot    common.Hash
+		storageRoot  common.Hash
+		stateNodes   []sdtypes.StateNode
+		storageRoots map[string]common.Hash
+	)
+	BeforeEach(func() {
+		storage := make(map[common.Hash][]byte)
+		for i := int64(1); i <= 10; i++ {
+			enc, err := rlp.EncodeToBytes(big.NewInt(i).Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			storage[crypto.Keccak256Hash(common.BigToHash(big.NewInt(i)).Bytes())] = enc
+		}
+		var storageTrie map[string][]byte
+		storageRoot, storageTrie = buildTrie(storage)
+		storageNodes := make([]sdtypes.StorageNode, 0, len(storageTrie))
+		for path, value := range storageTrie {
+			storageNodes = append(storageNodes, sdtypes.StorageNode{NodeType: nodeType(value), Path: []byte(path), NodeValue: value})
+		}
+		account, err := rlp.EncodeToBytes(state.Account{
+			Balance:  big.NewInt(0),
+			Root:     storageRoot,
+			CodeHash: crypto.Keccak256([]byte{0x60, 0x00}),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		var stateTrie map[string][]byte
+		stateRoot, stateTrie = buildTrie(map[common.Hash][]byte{crypto.Keccak256Hash([]byte{0x01}): account})
+		// a single account trie is just a root leaf
+		Expect(stateTrie).To(HaveLen(1))
+		stateNodes = []sdtypes.StateNode{{
+			NodeType:     sdtypes.Leaf,
+			Path:         []byte{},
+			NodeValue:    stateTrie[""],
+			StorageNodes: storageNodes,
+		}}
+		storageRoots = map[string]common.Hash{"": storageRoot}
+	})
+
+	It("Passes a diff that hashes up to the state root and indexed storage roots", func() {
+		Expect(validate.CheckStateDiff(stateRoot, stateNodes, storageRoots)).To(BeEmpty())
+	})
+
+	It("Flags a diff that does not hash up to the state root", func() {
+		Expect(validate.CheckStateDiff(common.HexToHash("0x01"), stateNodes, storageRoots)).To(HaveLen(1))
+	})
+
+	It("Flags a leaf without an indexed account", func() {
+		problems := validate.CheckStateDiff(stateRoot, stateNodes, map[string]common.Hash{})
+		Expect(problems).To(HaveLen(1))
+		Expect(problems[0]).To(ContainSubstring("no indexed account"))
+	})
+
+	It("Flags an indexed storage root that does not match the storage diff", func() {
+		problems := validate.CheckStateDiff(stateRoot, stateNodes, map[string]common.Hash{"": common.HexToHash("0x01")})
+		Expect(problems).To(HaveLen(2))
+		Expect(problems[0]).To(ContainSubstring("is indexed"))
+		Expect(problems[1]).To(ContainSubstring("storage root node hashes to"))
+	})
+})
@@ -0,0 +1,104 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package verify
+
+import (
+	"github.com/spf13/viper"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+	"github.com/vulcanize/ipld-eth-indexer/utils"
+)
+
+// Env variables
+const (
+	VERIFY_START       = "VERIFY_START"
+	VERIFY_STOP        = "VERIFY_STOP"
+	VERIFY_BATCH_SIZE  = "VERIFY_BATCH_SIZE"
+	VERIFY_ORPHANS     = "VERIFY_ORPHANS"
+	VERIFY_ENQUEUE     = "VERIFY_ENQUEUE"
+	VERIFY_REPORT_PATH = "VERIFY_REPORT_PATH"
+
+	VERIFY_MAX_IDLE_CONNECTIONS = "VERIFY_MAX_IDLE_CONNECTIONS"
+	VERIFY_MAX_OPEN_CONNECTIONS = "VERIFY_MAX_OPEN_CONNECTIONS"
+	VERIFY_MAX_CONN_LIFETIME    = "VERIFY_MAX_CONN_LIFETIME"
+)
+
+// Config holds the parameters needed to perform a verification
+type Config struct {
+	Start      uint64 // Block height to start verifying from
+	Stop       uint64 // Block height to stop verifying at, if 0 the entire database is verified
+	BatchSize  uint64 // Number of block heights to verify per query
+	Orphans    bool   // If true, also scan the entire blockstore for unreferenced blocks and hash mismatches
+	Enqueue    bool   // If true, clean out the data at bad heights so that backfill refills them
+	ReportPath string // Path to write the JSON report to, if empty the report is only logged
+
+	// DB info
+	DB       *postgres.DB
+	DBConfig postgres.Config
+
+	// Blockstore the IPLD blocks are read from
+	Blockstore       blockstore.Blockstore
+	BlockstoreConfig blockstore.Config
+
+	NodeInfo node.Info
+}
+
+// NewConfig fills and returns a verify config from toml parameters
+func NewConfig() (*Config, error) {
+	c := new(Config)
+
+	viper.BindEnv("verify.start", VERIFY_START)
+	viper.BindEnv("verify.stop", VERIFY_STOP)
+	viper.BindEnv("verify.batchSize", VERIFY_BATCH_SIZE)
+	viper.BindEnv("verify.orphans", VERIFY_ORPHANS)
+	viper.BindEnv("verify.enqueue", VERIFY_ENQUEUE)
+	viper.BindEnv("verify.reportPath", VERIFY_REPORT_PATH)
+
+	c.Start = uint64(viper.GetInt64("verify.start"))
+	c.Stop = uint64(viper.GetInt64("verify.stop"))
+	c.BatchSize = uint64(viper.GetInt64("verify.batchSize"))
+	c.Orphans = viper.GetBool("verify.orphans")
+	c.Enqueue = viper.GetBool("verify.enqueue")
+	c.ReportPath = viper.GetString("verify.reportPath")
+	c.NodeInfo = shared.GetEthNodeInfo()
+
+	c.DBConfig.Init()
+	overrideDBConnConfig(&c.DBConfig)
+	db := utils.LoadPostgres(c.DBConfig, c.NodeInfo, false)
+	c.DB = &db
+	if err := c.BlockstoreConfig.Init(); err != nil {
+		return nil, err
+	}
+	var err error
+	c.Blockstore, err = blockstore.NewBlockstore(c.BlockstoreConfig, c.DB.DB)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func overrideDBConnConfig(con *postgres.Config) {
+	viper.BindEnv("database.verify.maxIdle", VERIFY_MAX_IDLE_CONNECTIONS)
+	viper.BindEnv("database.verify.maxOpen", VERIFY_MAX_OPEN_CONNECTIONS)
+	viper.BindEnv("database.verify.maxLifetime", VERIFY_MAX_CONN_LIFETIME)
+	con.MaxIdle = viper.GetInt("database.verify.maxIdle")
+	con.MaxOpen = viper.GetInt("database.verify.maxOpen")
+	con.MaxLifetime = viper.GetInt("database.verify.maxLifetime")
+}
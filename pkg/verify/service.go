@@ -0,0 +1,405 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/blockstore"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+	"github.com/vulcanize/ipld-eth-indexer/utils"
+)
+
+// DefaultBatchSize is the default number of block heights verified per query, and blocks per orphan scan page
+const DefaultBatchSize uint64 = 1000
+
+// referenceQueries select every cid reference of an eth.*_cids table, within a block range, joined to the referenced block
+var referenceQueries = []struct {
+	table string
+	query string
+}{
+	{"eth.header_cids", `SELECT header_cids.block_number, header_cids.cid, header_cids.mh_key, blocks.data, blocks.key IS NULL AS missing
+			FROM eth.header_cids
+			LEFT JOIN public.blocks ON (header_cids.mh_key = blocks.key)
+			WHERE header_cids.block_number BETWEEN $1 AND $2
+			AND header_cids.chain_id = $3`},
+	{"eth.uncle_cids", `SELECT header_cids.block_number, uncle_cids.cid, uncle_cids.mh_key, blocks.data, blocks.key IS NULL AS missing
+			FROM eth.uncle_cids
+			INNER JOIN eth.header_cids ON (uncle_cids.header_id = header_cids.id)
+			LEFT JOIN public.blocks ON (uncle_cids.mh_key = blocks.key)
+			WHERE header_cids.block_number BETWEEN $1 AND $2
+			AND header_cids.chain_id = $3`},
+	{"eth.transaction_cids", `SELECT header_cids.block_number, transaction_cids.cid, transaction_cids.mh_key, blocks.data, blocks.key IS NULL AS missing
+			FROM eth.transaction_cids
+			INNER JOIN eth.header_cids ON (transaction_cids.header_id = header_cids.id)
+			LEFT JOIN public.blocks ON (transaction_cids.mh_key = blocks.key)
+			WHERE header_cids.block_number BETWEEN $1 AND $2
+			AND header_cids.chain_id = $3`},
+	{"eth.receipt_cids", `SELECT header_cids.block_number, receipt_cids.cid, receipt_cids.mh_key, blocks.data, blocks.key IS NULL AS missing
+			FROM eth.receipt_cids
+			INNER JOIN eth.transaction_cids ON (receipt_cids.tx_id = transaction_cids.id)
+			INNER JOIN eth.header_cids ON (transaction_cids.header_id = header_cids.id)
+			LEFT JOIN public.blocks ON (receipt_cids.mh_key = blocks.key)
+			WHERE header_cids.block_number BETWEEN $1 AND $2
+			AND header_cids.chain_id = $3`},
+	{"eth.trace_cids", `SELECT header_cids.block_number, trace_cids.cid, trace_cids.mh_key, blocks.data, blocks.key IS NULL AS missing
+			FROM eth.trace_cids
+			INNER JOIN eth.transaction_cids ON (trace_cids.tx_id = transaction_cids.id)
+			INNER JOIN eth.header_cids ON (transaction_cids.header_id = header_cids.id)
+			LEFT JOIN public.blocks ON (trace_cids.mh_key = blocks.key)
+			WHERE header_cids.block_number BETWEEN $1 AND $2
+			AND header_cids.chain_id = $3`},
+	{"eth.state_cids", `SELECT header_cids.block_number, state_cids.cid, state_cids.mh_key, blocks.data, blocks.key IS NULL AS missing
+			FROM eth.state_cids
+			INNER JOIN eth.header_cids ON (state_cids.header_id = header_cids.id)
+			LEFT JOIN public.blocks ON (state_cids.mh_key = blocks.key)
+			WHERE header_cids.block_number BETWEEN $1 AND $2
+			AND header_cids.chain_id = $3`},
+	{"eth.storage_cids", `SELECT header_cids.block_number, storage_cids.cid, storage_cids.mh_key, blocks.data, blocks.key IS NULL AS missing
+			FROM eth.storage_cids
+			INNER JOIN eth.state_cids ON (storage_cids.state_id = state_cids.id)
+			INNER JOIN eth.header_cids ON (state_cids.header_id = header_cids.id)
+			LEFT JOIN public.blocks ON (storage_cids.mh_key = blocks.key)
+			WHERE header_cids.block_number BETWEEN $1 AND $2
+			AND header_cids.chain_id = $3`},
+}
+
+// unreferencedPgStr selects the keys, out of the provided set, which are not referenced by any eth.*_cids table
+const unreferencedPgStr = `SELECT key FROM public.blocks
+			WHERE key = ANY($1)
+			AND NOT EXISTS (SELECT 1 FROM eth.header_cids WHERE header_cids.mh_key = blocks.key)
+			AND NOT EXISTS (SELECT 1 FROM eth.uncle_cids WHERE uncle_cids.mh_key = blocks.key)
+			AND NOT EXISTS (SELECT 1 FROM eth.transaction_cids WHERE transaction_cids.mh_key = blocks.key)
+			AND NOT EXISTS (SELECT 1 FROM eth.receipt_cids WHERE receipt_cids.mh_key = blocks.key)
+			AND NOT EXISTS (SELECT 1 FROM eth.trace_cids WHERE trace_cids.mh_key = blocks.key)
+			AND NOT EXISTS (SELECT 1 FROM eth.state_cids WHERE state_cids.mh_key = blocks.key)
+			AND NOT EXISTS (SELECT 1 FROM eth.storage_cids WHERE storage_cids.mh_key = blocks.key)`
+
+// Verifier is the top level interface for verifying the content integrity of the database
+type Verifier interface {
+	Verify() (*Report, error)
+}
+
+// Service for verifying the content integrity of the database
+type Service struct {
+	// DB to verify
+	DB *postgres.DB
+	// Interface for removing the data at bad heights so that backfill refills them
+	Cleaner eth.Cleaner
+	// Blockstore the IPLD blocks are read from when public.blocks only records their keys
+	Blocks blockstore.Blockstore
+	// Block range to verify, if stop is 0 the range is the entire database
+	start, stop uint64
+	// Number of block heights verified per query
+	batchSize uint64
+	// Flag to turn on or off the orphan scan
+	orphans bool
+	// Flag to turn on or off queueing bad heights for backfill
+	enqueue bool
+	// Path to write the JSON report to
+	reportPath string
+}
+
+// NewVerifyService returns a new verify service
+func NewVerifyService(settings *Config) Verifier {
+	batchSize := settings.BatchSize
+	if batchSize == 0 {
+		batchSize = DefaultBatchSize
+	}
+	blocks := settings.Blockstore
+	if blocks == nil {
+		blocks = blockstore.NewPostgresBlockstore(settings.DB.DB)
+	}
+	cleaner := eth.NewDBCleaner(settings.DB)
+	cleaner.SetBlockstore(blocks)
+	return &Service{
+		DB:         settings.DB,
+		Cleaner:    cleaner,
+		Blocks:     blocks,
+		start:      settings.Start,
+		stop:       settings.Stop,
+		batchSize:  batchSize,
+		orphans:    settings.Orphans,
+		enqueue:    settings.Enqueue,
+		reportPath: settings.ReportPath,
+	}
+}
+
+type referenceRow struct {
+	BlockNumber uint64          `db:"block_number"`
+	CID         string          `db:"cid"`
+	MhKey       string          `db:"mh_key"`
+	Data        blockstore.Data `db:"data"`
+	Missing     bool            `db:"missing"`
+}
+
+// Verify runs the verification and returns its report
+func (s *Service) Verify() (*Report, error) {
+	report := &Report{
+		Start: s.start,
+		Stop:  s.stop,
+	}
+	if report.Stop == 0 {
+		if err := s.DB.Reader().Get(&report.Stop, `SELECT COALESCE(MAX(block_number), 0) FROM eth.header_cids WHERE chain_id = $1`, s.DB.Node.ChainID); err != nil {
+			return nil, err
+		}
+	}
+	if report.Stop >= report.Start {
+		bins, err := utils.GetBlockHeightBins(report.Start, report.Stop, s.batchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, heights := range bins {
+			if err := s.verifyReferences(heights[0], heights[len(heights)-1], report); err != nil {
+				return nil, err
+			}
+			logrus.Infof("verified references from %d to %d", heights[0], heights[len(heights)-1])
+		}
+	}
+	if s.orphans {
+		if err := s.verifyBlockstore(report); err != nil {
+			return nil, err
+		}
+	}
+	report.finalize()
+	if s.enqueue && len(report.BadHeights) > 0 {
+		if err := s.enqueueHeights(report.BadHeights); err != nil {
+			return nil, err
+		}
+	}
+	if s.reportPath != "" {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(s.reportPath, b, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// enqueueHeights queues the heights for backfill by cleaning out their data, as resync does before refilling a range
+// backfill then finds them as missing heights, whatever its validation level, and refetches them from the node
+// a bad block is removed along with its references, so it is rewritten instead of being kept when the height is refilled
+func (s *Service) enqueueHeights(heights []uint64) error {
+	rngs := make([][2]uint64, 0, len(heights))
+	for _, height := range heights {
+		if l := len(rngs); l > 0 && rngs[l-1][1]+1 == height {
+			rngs[l-1][1] = height
+			continue
+		}
+		rngs = append(rngs, [2]uint64{height, height})
+	}
+	logrus.Infof("cleaning out the data at %d bad heights so that backfill refills them", len(heights))
+	if err := s.Cleaner.Clean(rngs, shared.Full); err != nil {
+		return fmt.Errorf("verify failed to queue bad heights for backfill: %v", err)
+	}
+	return nil
+}
+
+// verifyReferences checks every cid reference within the block range
+func (s *Service) verifyReferences(start, stop uint64, report *Report) error {
+	for _, ref := range referenceQueries {
+		rows, err := s.DB.Reader().Queryx(ref.query, start, stop, s.DB.Node.ChainID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var row referenceRow
+			if err := rows.StructScan(&row); err != nil {
+				rows.Close()
+				return err
+			}
+			report.CheckedReferences++
+			if row.Missing {
+				report.add(Issue{BlockNumber: row.BlockNumber, Table: ref.table, CID: row.CID, MhKey: row.MhKey, Problem: ProblemDangling})
+				continue
+			}
+			if problem := CheckReference(row.CID, row.MhKey); problem != "" {
+				report.add(Issue{BlockNumber: row.BlockNumber, Table: ref.table, CID: row.CID, MhKey: row.MhKey, Problem: problem})
+				continue
+			}
+			data, err := blockstore.Load(s.Blocks, row.MhKey, row.Data)
+			if err == blockstore.ErrNotFound {
+				report.add(Issue{BlockNumber: row.BlockNumber, Table: ref.table, CID: row.CID, MhKey: row.MhKey, Problem: ProblemDangling})
+				continue
+			}
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			if problem := CheckBlock(row.MhKey, data); problem != "" {
+				report.add(Issue{BlockNumber: row.BlockNumber, Table: ref.table, CID: row.CID, MhKey: row.MhKey, Problem: problem})
+			}
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return err
+		}
+		rows.Close()
+	}
+	return nil
+}
+
+// verifyBlockstore scans the entire blockstore, checking every block's data against its key and finding unreferenced blocks
+// Contract code is only referenced by the code hash of eth.state_accounts, so is not considered an orphan
+func (s *Service) verifyBlockstore(report *Report) error {
+	logrus.Info("loading code hashes for the orphan scan")
+	codeHashes := make([][]byte, 0)
+	if err := s.DB.Reader().Select(&codeHashes, `SELECT DISTINCT code_hash FROM eth.state_accounts`); err != nil {
+		return err
+	}
+	codeKeys := make(map[string]bool, len(codeHashes))
+	for _, codeHash := range codeHashes {
+		key, err := shared.MultihashKeyFromKeccak256(common.BytesToHash(codeHash))
+		if err != nil {
+			return err
+		}
+		codeKeys[key] = true
+	}
+	lastKey := ""
+	for {
+		blocks := make([]struct {
+			Key  string          `db:"key"`
+			Data blockstore.Data `db:"data"`
+		}, 0, s.batchSize)
+		if err := s.DB.Reader().Select(&blocks, `SELECT key, data FROM public.blocks WHERE key > $1 ORDER BY key LIMIT $2`, lastKey, s.batchSize); err != nil {
+			return err
+		}
+		if len(blocks) == 0 {
+			return nil
+		}
+		keys := make([]string, 0, len(blocks))
+		for _, block := range blocks {
+			report.CheckedBlocks++
+			keys = append(keys, block.Key)
+			data, err := blockstore.Load(s.Blocks, block.Key, block.Data)
+			if err == blockstore.ErrNotFound {
+				report.add(Issue{MhKey: block.Key, Problem: ProblemDangling})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if problem := CheckBlock(block.Key, data); problem != "" {
+				report.add(Issue{MhKey: block.Key, Problem: problem})
+			}
+		}
+		lastKey = blocks[len(blocks)-1].Key
+		unreferenced := make([]string, 0)
+		if err := s.DB.Reader().Select(&unreferenced, unreferencedPgStr, pq.Array(keys)); err != nil {
+			return err
+		}
+		for _, key := range unreferenced {
+			if !codeKeys[key] {
+				report.Orphans = append(report.Orphans, key)
+			}
+		}
+		logrus.Infof("scanned %d blocks, found %d orphans", report.CheckedBlocks, len(report.Orphans))
+	}
+}
+
+// Problems found by verification
+const (
+	ProblemDangling     = "mh_key is not in public.blocks"
+	ProblemCIDMismatch  = "cid does not match mh_key"
+	ProblemInvalidCID   = "cid cannot be decoded"
+	ProblemInvalidKey   = "key cannot be decoded into a multihash"
+	ProblemHashMismatch = "data does not hash to key"
+)
+
+// CheckReference checks that a cid and the mh_key stored alongside it agree, returning the problem if they do not
+func CheckReference(cidStr, mhKey string) string {
+	key, err := shared.MultihashKeyFromCIDString(cidStr)
+	if err != nil {
+		return ProblemInvalidCID
+	}
+	if key != mhKey {
+		return ProblemCIDMismatch
+	}
+	return ""
+}
+
+// CheckBlock checks that the data stored under a blockstore key hashes to the multihash in the key, returning the problem if it does not
+func CheckBlock(key string, data []byte) string {
+	mh, err := shared.MultihashFromKey(key)
+	if err != nil {
+		return ProblemInvalidKey
+	}
+	ok, err := shared.VerifyMultihash(mh, data)
+	if err != nil {
+		return ProblemInvalidKey
+	}
+	if !ok {
+		return ProblemHashMismatch
+	}
+	return ""
+}
+
+// Issue is a single problem found by verification
+type Issue struct {
+	BlockNumber uint64 `json:"blockNumber,omitempty"`
+	Table       string `json:"table,omitempty"`
+	CID         string `json:"cid,omitempty"`
+	MhKey       string `json:"mhKey"`
+	Problem     string `json:"problem"`
+}
+
+// Report is the result of a verification
+type Report struct {
+	Start             uint64   `json:"start"`
+	Stop              uint64   `json:"stop"`
+	CheckedReferences uint64   `json:"checkedReferences"`
+	CheckedBlocks     uint64   `json:"checkedBlocks"`
+	Issues            []Issue  `json:"issues"`
+	Orphans           []string `json:"orphans"`
+	// Heights with at least one issue
+	BadHeights []uint64 `json:"badHeights"`
+}
+
+func (r *Report) add(issue Issue) {
+	logrus.Warnf("verification issue: %s (table: %s, block: %d, cid: %s, key: %s)", issue.Problem, issue.Table, issue.BlockNumber, issue.CID, issue.MhKey)
+	r.Issues = append(r.Issues, issue)
+}
+
+// finalize collects the distinct bad heights
+func (r *Report) finalize() {
+	seen := make(map[uint64]bool)
+	for _, issue := range r.Issues {
+		if issue.Table != "" && !seen[issue.BlockNumber] {
+			seen[issue.BlockNumber] = true
+			r.BadHeights = append(r.BadHeights, issue.BlockNumber)
+		}
+	}
+	sort.Slice(r.BadHeights, func(i, j int) bool { return r.BadHeights[i] < r.BadHeights[j] })
+}
+
+// String summarizes the report
+func (r *Report) String() string {
+	return fmt.Sprintf("verified %d references from block %d to %d and %d blocks; found %d issues at %d heights and %d orphaned blocks",
+		r.CheckedReferences, r.Start, r.Stop, r.CheckedBlocks, len(r.Issues), len(r.BadHeights), len(r.Orphans))
+}
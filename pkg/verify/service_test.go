@@ -0,0 +1,116 @@
+// VulcanizeDB
+// Copyright © 2020 Vulcanize
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package verify_test
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/eth/mocks"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/shared"
+	"github.com/vulcanize/ipld-eth-indexer/pkg/verify"
+)
+
+var _ = Describe("Checks", func() {
+	Describe("CheckReference", func() {
+		It("Passes when the cid matches the mh_key", func() {
+			Expect(verify.CheckReference(mocks.HeaderCID.String(), mocks.HeaderMhKey)).To(BeEmpty())
+		})
+		It("Flags a cid which does not match the mh_key", func() {
+			Expect(verify.CheckReference(mocks.HeaderCID.String(), mocks.Trx1MhKey)).To(Equal(verify.ProblemCIDMismatch))
+		})
+		It("Flags a cid which cannot be decoded", func() {
+			Expect(verify.CheckReference("not a cid", mocks.HeaderMhKey)).To(Equal(verify.ProblemInvalidCID))
+		})
+	})
+
+	Describe("CheckBlock", func() {
+		It("Passes when the data hashes to the key", func() {
+			Expect(verify.CheckBlock(mocks.HeaderMhKey, mocks.MockHeaderRlp)).To(BeEmpty())
+			Expect(verify.CheckBlock(mocks.State1MhKey, mocks.ContractLeafNode)).To(BeEmpty())
+		})
+		It("Flags data which does not hash to the key", func() {
+			Expect(verify.CheckBlock(mocks.HeaderMhKey, mocks.ContractLeafNode)).To(Equal(verify.ProblemHashMismatch))
+		})
+		It("Flags keys which are not multihashes", func() {
+			Expect(verify.CheckBlock("/blocks/NOTAMULTIHASH", mocks.MockHeaderRlp)).To(Equal(verify.ProblemInvalidKey))
+			Expect(verify.CheckBlock(mocks.HeaderCID.String(), mocks.MockHeaderRlp)).To(Equal(verify.ProblemInvalidKey))
+		})
+	})
+})
+
+var _ = Describe("Service", func() {
+	var (
+		db *postgres.DB
+	)
+	BeforeEach(func() {
+		var err error
+		db, err = shared.SetupDB()
+		Expect(err).ToNot(HaveOccurred())
+		publisher := eth.NewIPLDPublisher(db)
+		for _, number := range []int64{0, 1, 2, 3} {
+			payload := mocks.MockConvertedPayload
+			payload.Block = newMockBlock(number)
+			err = publisher.Publish(payload)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		// corrupt the header block at height 2
+		var mhKey string
+		err = db.Get(&mhKey, `SELECT mh_key FROM eth.header_cids WHERE block_number = 2`)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = db.Exec(`UPDATE public.blocks SET data = $1 WHERE key = $2`, []byte("not the header"), mhKey)
+		Expect(err).ToNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		eth.TearDownDB(db)
+	})
+
+	Describe("Verify", func() {
+		It("Reports the heights with corrupt blocks", func() {
+			report, err := verify.NewVerifyService(&verify.Config{DB: db}).Verify()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.BadHeights).To(Equal([]uint64{2}))
+			gaps, err := eth.NewGapRetriever(db).RetrieveGapsInData(0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gaps).To(BeEmpty())
+		})
+		It("Queues the heights with corrupt blocks for backfill", func() {
+			report, err := verify.NewVerifyService(&verify.Config{DB: db, Enqueue: true}).Verify()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.BadHeights).To(Equal([]uint64{2}))
+			gaps, err := eth.NewGapRetriever(db).RetrieveGapsInData(0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gaps).To(Equal([]eth.DBGap{{Start: 2, Stop: 2}}))
+			var numbers []uint64
+			err = db.Select(&numbers, `SELECT block_number FROM eth.header_cids ORDER BY block_number`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(numbers).To(Equal([]uint64{0, 1, 3}))
+		})
+	})
+})
+
+func newMockBlock(number int64) *types.Block {
+	header := mocks.MockHeader
+	header.Number = big.NewInt(number)
+	return types.NewBlock(&header, mocks.MockTransactions, nil, mocks.MockReceipts, new(trie.Trie))
+}
@@ -14,13 +14,10 @@ test $DATABASE_PASSWORD
 test $VDB_COMMAND
 set +e
 
-# Construct the connection string for postgres
-VDB_PG_CONNECT=postgresql://$DATABASE_USER:$DATABASE_PASSWORD@$DATABASE_HOSTNAME:$DATABASE_PORT/$DATABASE_NAME?sslmode=disable
-
-# Run the DB migrations
-echo "Connecting with: $VDB_PG_CONNECT"
+# Run the DB migrations embedded in the binary
+echo "Connecting to: $DATABASE_HOSTNAME:$DATABASE_PORT/$DATABASE_NAME"
 echo "Running database migrations"
-./goose -dir migrations/vulcanizedb postgres "$VDB_PG_CONNECT" up
+./ipld-eth-indexer migrate up --config=config.toml
 
 # If the db migrations ran without err
 if [[ $? -eq 0 ]]; then
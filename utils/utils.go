@@ -21,6 +21,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/vulcanize/ipld-eth-indexer/pkg/migrations"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/node"
 	"github.com/vulcanize/ipld-eth-indexer/pkg/postgres"
 )
@@ -33,6 +34,25 @@ func LoadPostgres(database postgres.Config, node node.Info, createNode bool) pos
 	return *db
 }
 
+// LoadMigratedPostgres loads postgres like LoadPostgres, but refuses to start if the database schema
+// isn't at the version of the migrations embedded in the binary
+func LoadMigratedPostgres(database postgres.Config, node node.Info, createNode bool) postgres.DB {
+	db := LoadPostgres(database, node, false)
+	migrator, err := migrations.NewMigrator(db.DB)
+	if err != nil {
+		logrus.Fatal("Error loading migrations: ", err)
+	}
+	if err := migrator.CheckVersion(); err != nil {
+		logrus.Fatal(err)
+	}
+	if createNode {
+		if err := db.CreateNode(&node); err != nil {
+			logrus.Fatal("Error loading postgres: ", err)
+		}
+	}
+	return db
+}
+
 // GetBlockHeightBins splits a block range up into bins of block heights of the given batch size
 func GetBlockHeightBins(startingBlock, endingBlock, batchSize uint64) ([][]uint64, error) {
 	if endingBlock < startingBlock {